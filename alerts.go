@@ -1,25 +1,200 @@
 package main
 
 import (
+	"sort"
 	"strings"
 
 	"github.com/cloudflare/unsee/internal/alertmanager"
+	"github.com/cloudflare/unsee/internal/config"
 	"github.com/cloudflare/unsee/internal/filters"
 	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/slices"
+
+	"github.com/gin-gonic/gin"
 )
 
-func getFiltersFromQuery(filterString string) ([]filters.FilterT, bool) {
-	validFilters := false
-	matchFilters := []filters.FilterT{}
-	qList := strings.Split(filterString, ",")
-	for _, filterExpression := range qList {
-		f := filters.NewFilter(filterExpression)
-		if f.GetIsValid() {
-			validFilters = true
+// getFiltersFromQuery parses the filter expression passed in the q query
+// argument, if it's invalid then an empty expression that doesn't match any
+// alert is returned along with the error
+func getFiltersFromQuery(filterString string) (*filters.Expression, *models.FilterError) {
+	expression, err := filters.ParseExpression(filterString)
+	if err != nil {
+		filterError := models.FilterError{Message: err.Error()}
+		if parseError, ok := err.(*filters.ParseError); ok {
+			filterError.Message = parseError.Message
+			filterError.Position = parseError.Position
+		}
+		return expression, &filterError
+	}
+	return expression, nil
+}
+
+// getGroupByFromQuery returns the list of label names alerts should be
+// grouped by, it's read from the group_by query argument (comma separated list,
+// it can be passed multiple times) and defaults to grouping.by config option,
+// empty list means that groups created by Alertmanager are used
+func getGroupByFromQuery(c *gin.Context) []string {
+	values, found := c.GetQueryArray("group_by")
+	if !found {
+		return config.Config().Grouping.By
+	}
+	groupBy := []string{}
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && !slices.StringInSlice(groupBy, name) {
+				groupBy = append(groupBy, name)
+			}
 		}
-		matchFilters = append(matchFilters, f)
 	}
-	return matchFilters, validFilters
+	return groupBy
+}
+
+// alertGroupFor returns the group alert belongs to when alerts are grouped
+// using values of passed label names instead of groups created by Alertmanager
+// routes, @receiver and @alertmanager can be used to group alerts by the
+// receiver and Alertmanager instance names
+func alertGroupFor(alert models.Alert, groupBy []string) models.AlertGroup {
+	group := models.AlertGroup{Labels: map[string]string{}}
+	for _, name := range groupBy {
+		switch name {
+		case "@receiver":
+			group.Receiver = alert.Receiver
+		case "@alertmanager":
+			names := []string{}
+			for _, am := range alert.Alertmanager {
+				names = append(names, am.Name)
+			}
+			sort.Strings(names)
+			group.Labels[name] = strings.Join(names, ",")
+		default:
+			if value, found := alert.Labels[name]; found {
+				group.Labels[name] = value
+			}
+		}
+	}
+	group.ID = group.LabelsFingerprint()
+	return group
+}
+
+// groupedAlert is an alert along with the ID of the group it belongs to,
+// alerts are flattened this way so they can be sorted across all groups
+type groupedAlert struct {
+	groupID string
+	alert   models.Alert
+}
+
+// filterAlerts returns a copy of every deduplicated alert group containing
+// only alerts matching passed filter expression, along with colors and
+// counters for labels found on those alerts, alerts are regrouped if any
+// label name to group by is passed and sorted using passed keys before
+// filters are applied, so that @limit filter will keep the first alerts
+func filterAlerts(expression *filters.Expression, groupBy []string, sortBy []sortKey) ([]models.AlertGroup, models.LabelsColorMap, models.LabelsCountMap) {
+	alerts := []models.AlertGroup{}
+	colors := models.LabelsColorMap{}
+	counters := models.LabelsCountMap{}
+
+	dedupedAlerts := alertmanager.DedupAlerts()
+	dedupedColors := alertmanager.DedupColors()
+
+	groups := map[string]models.AlertGroup{}
+	groupSizes := map[string]int{}
+	entries := []groupedAlert{}
+	for _, ag := range dedupedAlerts {
+		for _, alert := range ag.Alerts {
+			group := models.AlertGroup{ID: ag.ID, Receiver: ag.Receiver, Labels: ag.Labels}
+			if len(groupBy) > 0 {
+				group = alertGroupFor(alert, groupBy)
+			}
+			if _, found := groups[group.ID]; !found {
+				groups[group.ID] = group
+			}
+			groupSizes[group.ID]++
+			entries = append(entries, groupedAlert{groupID: group.ID, alert: alert})
+		}
+	}
+
+	if len(sortBy) > 0 {
+		sort.SliceStable(entries, func(i, j int) bool {
+			a, b := entries[i], entries[j]
+			return lessAlerts(sortBy, a.alert, b.alert, groupSizes[a.groupID], groupSizes[b.groupID])
+		})
+	}
+
+	filtered := map[string]*models.AlertGroup{}
+	// groups are returned in the order they were first seen
+	ids := []string{}
+	var matches int
+	for _, entry := range entries {
+		alert := entry.alert
+		if !expression.Match(&alert, matches) {
+			continue
+		}
+		matches++
+
+		agCopy, found := filtered[entry.groupID]
+		if !found {
+			group := groups[entry.groupID]
+			agCopy = &models.AlertGroup{
+				ID:         group.ID,
+				Receiver:   group.Receiver,
+				Labels:     group.Labels,
+				Alerts:     []models.Alert{},
+				StateCount: map[string]int{},
+			}
+			for _, s := range models.AlertStateList {
+				agCopy.StateCount[s] = 0
+			}
+			filtered[entry.groupID] = agCopy
+			ids = append(ids, entry.groupID)
+		}
+
+		// we need to update fingerprints since we've modified some fields in dedup
+		// and agCopy.ContentFingerprint() depends on per alert fingerprint
+		// we update it here rather than in dedup since here we can apply it
+		// only for alerts left after filtering
+		alert.UpdateFingerprints()
+		agCopy.Alerts = append(agCopy.Alerts, alert)
+
+		countLabel(counters, "@state", alert.State)
+
+		countLabel(counters, "@receiver", alert.Receiver)
+		if ck, foundKey := dedupedColors["@receiver"]; foundKey {
+			if cv, foundVal := ck[alert.Receiver]; foundVal {
+				if _, found := colors["@receiver"]; !found {
+					colors["@receiver"] = map[string]models.LabelColors{}
+				}
+				colors["@receiver"][alert.Receiver] = cv
+			}
+		}
+
+		agCopy.StateCount[alert.State]++
+
+		for key, value := range alert.Labels {
+			if keyMap, foundKey := dedupedColors[key]; foundKey {
+				if color, foundColor := keyMap[value]; foundColor {
+					if _, found := colors[key]; !found {
+						colors[key] = map[string]models.LabelColors{}
+					}
+					colors[key][value] = color
+				}
+			}
+			countLabel(counters, key, value)
+		}
+	}
+
+	for _, id := range ids {
+		agCopy := filtered[id]
+		// alerts merged from multiple Alertmanager groups need to be sorted
+		// again, unless custom sort order was requested
+		if len(groupBy) > 0 && len(sortBy) == 0 {
+			sort.Sort(agCopy.Alerts)
+		}
+		agCopy.Hash = agCopy.ContentFingerprint()
+		alerts = append(alerts, *agCopy)
+	}
+
+	return alerts, colors, counters
 }
 
 func countLabel(countStore models.LabelsCountMap, key string, val string) {
@@ -34,24 +209,62 @@ func countLabel(countStore models.LabelsCountMap, key string, val string) {
 }
 
 func getUpstreams() models.AlertmanagerAPISummary {
-	summary := models.AlertmanagerAPISummary{}
+	summary := models.AlertmanagerAPISummary{
+		Instances: []models.AlertmanagerAPIStatus{},
+		Clusters:  []models.AlertmanagerAPICluster{},
+	}
 
-	upstreams := alertmanager.GetAlertmanagers()
-	for _, upstream := range upstreams {
-		u := models.AlertmanagerAPIStatus{
-			Name:  upstream.Name,
-			URI:   upstream.SanitizedURI(),
-			Error: upstream.Error(),
+	for _, cluster := range alertmanager.GetClusters() {
+		c := models.AlertmanagerAPICluster{
+			Name:    cluster.Name,
+			Members: []string{},
+			Errors:  cluster.Errors(),
 		}
-		summary.Instances = append(summary.Instances, u)
+		for _, upstream := range cluster.Members {
+			u := models.AlertmanagerAPIStatus{
+				Name:    upstream.Name,
+				URI:     upstream.SanitizedURI(),
+				Cluster: cluster.Name,
+				Error:   upstream.Error(),
+			}
+			u.Stale, u.StaleSince = upstream.Stale()
+			summary.Instances = append(summary.Instances, u)
+			c.Members = append(c.Members, upstream.Name)
 
-		summary.Counters.Total++
-		if u.Error == "" {
-			summary.Counters.Healthy++
-		} else {
-			summary.Counters.Failed++
+			summary.Counters.Total++
+			if u.Error == "" {
+				summary.Counters.Healthy++
+				c.Healthy++
+			} else {
+				summary.Counters.Failed++
+				c.Failed++
+			}
+			if u.Stale {
+				summary.Counters.Stale++
+			}
 		}
+		summary.Clusters = append(summary.Clusters, c)
 	}
 
 	return summary
 }
+
+// clusterAlertGroups returns a copy of passed alert groups where Alertmanager
+// instances from the same cluster are merged into a single instance, it's
+// used for responses rendered by the UI so that it shows one Alertmanager per
+// cluster and silences are only created once on every cluster
+func clusterAlertGroups(groups []models.AlertGroup) []models.AlertGroup {
+	clustered := make([]models.AlertGroup, len(groups))
+	for i, ag := range groups {
+		alerts := make(models.AlertList, len(ag.Alerts))
+		for j, alert := range ag.Alerts {
+			alert.Alertmanager = alertmanager.MergeClusterInstances(alert.Alertmanager)
+			alert.UpdateFingerprints()
+			alerts[j] = alert
+		}
+		ag.Alerts = alerts
+		ag.Hash = ag.ContentFingerprint()
+		clustered[i] = ag
+	}
+	return clustered
+}
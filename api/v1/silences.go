@@ -0,0 +1,74 @@
+package v1
+
+// Silence states, those are returned in the State field of ManagedSilence
+const (
+	SilenceStateActive  = "active"
+	SilenceStatePending = "pending"
+	SilenceStateExpired = "expired"
+)
+
+// ManagedSilence is a silence collected from all Alertmanager instances,
+// identical silences found on multiple instances are merged into a single one,
+// it's returned by /silences.json
+type ManagedSilence struct {
+	Silence
+	State string `json:"state"`
+	// names of all Alertmanager instances this silence was found on
+	Alertmanagers []string `json:"alertmanagers"`
+	// number of alerts matching this silence on any instance
+	AlertCount int `json:"alertCount"`
+	// true if the silence will end soon while still matching some alerts
+	Expiring bool `json:"expiring"`
+	// true if the silence didn't match any alert for a long time
+	Stale bool `json:"stale"`
+}
+
+// SilencesResponse is the structure of JSON response returned by
+// /silences.json
+type SilencesResponse struct {
+	Status   string           `json:"status"`
+	Error    string           `json:"error,omitempty"`
+	Silences []ManagedSilence `json:"silences"`
+}
+
+// SilenceRequest is the structure of JSON request sent to /api/silences,
+// silence will be created once on every Alertmanager cluster listed in
+// Alertmanagers, those can be names of clusters or instances
+type SilenceRequest struct {
+	Silence       Silence  `json:"silence"`
+	Alertmanagers []string `json:"alertmanagers"`
+}
+
+// SilenceResult holds the result of creating a silence on a single
+// Alertmanager cluster, Alertmanager is the name of the instance used to
+// create it, Error is empty if the silence was created
+type SilenceResult struct {
+	Cluster      string `json:"cluster"`
+	Alertmanager string `json:"alertmanager"`
+	SilenceID    string `json:"silenceID"`
+	Error        string `json:"error"`
+}
+
+// SilenceResponse is the structure of JSON response returned by /api/silences
+type SilenceResponse struct {
+	Status  string          `json:"status"`
+	Error   string          `json:"error,omitempty"`
+	Results []SilenceResult `json:"results"`
+}
+
+// SilencePreviewCounters holds the number of alerts a silence would match,
+// grouped by Alertmanager instance and by receiver
+type SilencePreviewCounters struct {
+	Total         int            `json:"total"`
+	Alertmanagers map[string]int `json:"alertmanagers"`
+	Receivers     map[string]int `json:"receivers"`
+}
+
+// SilencePreviewResponse is the structure of JSON response returned by
+// /api/silences/preview
+type SilencePreviewResponse struct {
+	Status      string                 `json:"status"`
+	Error       string                 `json:"error,omitempty"`
+	AlertGroups []AlertGroup           `json:"groups"`
+	Counters    SilencePreviewCounters `json:"counters"`
+}
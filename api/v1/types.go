@@ -0,0 +1,213 @@
+// Package v1 contains types of JSON requests and responses used by the unsee
+// API (/api/v1/alerts and silence endpoints), those types are part of the
+// public API and can be imported by other projects, fields are only added to
+// them in backward compatible way, any incompatible change will bump
+// SchemaVersion
+package v1
+
+import "time"
+
+// SchemaVersion is the version of the response schema, it's returned in every
+// response from /api/v1 endpoints
+const SchemaVersion = 1
+
+// Names of optional response fields that can be selected using the fields
+// query argument
+const (
+	FieldColors    = "colors"
+	FieldCounters  = "counters"
+	FieldFilters   = "filters"
+	FieldUpstreams = "upstreams"
+)
+
+// Fields is the list of all optional response fields, all of them are included
+// in the response if no fields query argument was passed
+var Fields = []string{FieldColors, FieldCounters, FieldFilters, FieldUpstreams}
+
+// ErrorResponse is returned by all /api/v1 endpoints if the request failed
+type ErrorResponse struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Status        string `json:"status"`
+	Error         string `json:"error"`
+}
+
+// AlertsResponse is the structure of JSON response returned by /api/v1/alerts,
+// Groups only contains a single page of alert groups, NextCursor should be
+// passed as the cursor query argument to get the next page, it's empty on the
+// last page
+type AlertsResponse struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	Status        string       `json:"status"`
+	Timestamp     time.Time    `json:"timestamp"`
+	Version       string       `json:"version"`
+	Groups        []AlertGroup `json:"groups"`
+	// number of alert groups and alerts on all pages
+	TotalGroups int    `json:"totalGroups"`
+	TotalAlerts int    `json:"totalAlerts"`
+	NextCursor  string `json:"nextCursor,omitempty"`
+	// optional fields, those are only set if selected with fields query
+	// argument, colors and counters are computed from alerts on all pages
+	Upstreams *AlertmanagerSummary `json:"upstreams,omitempty"`
+	Colors    LabelsColorMap       `json:"colors,omitempty"`
+	Counters  LabelsCountMap       `json:"counters,omitempty"`
+	Filters   []Filter             `json:"filters,omitempty"`
+	// errors found in the filter expression or sort keys, those aren't fatal
+	FilterError *FilterError `json:"filterError,omitempty"`
+	SortError   string       `json:"sortError,omitempty"`
+}
+
+// AlertGroup is a group of alerts, it's either the group created by
+// Alertmanager routes or a group of alerts with the same values of labels
+// passed in the group_by query argument
+type AlertGroup struct {
+	ID         string            `json:"id"`
+	Receiver   string            `json:"receiver"`
+	Labels     map[string]string `json:"labels"`
+	Alerts     []Alert           `json:"alerts"`
+	Hash       string            `json:"hash"`
+	StateCount map[string]int    `json:"stateCount"`
+}
+
+// Alert is a single alert deduplicated across all Alertmanager instances
+type Alert struct {
+	Fingerprint  string                 `json:"fingerprint"`
+	Labels       map[string]string      `json:"labels"`
+	Annotations  []Annotation           `json:"annotations"`
+	StartsAt     time.Time              `json:"startsAt"`
+	EndsAt       time.Time              `json:"endsAt"`
+	State        string                 `json:"state"`
+	Receiver     string                 `json:"receiver"`
+	Alertmanager []AlertmanagerInstance `json:"alertmanager"`
+	Links        []Link                 `json:"links"`
+}
+
+// Annotation is a single alert annotation
+type Annotation struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Visible bool   `json:"visible"`
+	IsLink  bool   `json:"isLink"`
+}
+
+// Link is a reference to an external system found in a silence comment,
+// annotation or label value
+type Link struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	URL    string `json:"url"`
+	Source string `json:"source"`
+	Key    string `json:"key,omitempty"`
+}
+
+// AlertmanagerInstance describes the state of the alert on a single
+// Alertmanager instance
+type AlertmanagerInstance struct {
+	Name        string             `json:"name"`
+	URI         string             `json:"uri"`
+	Cluster     string             `json:"cluster"`
+	Stale       bool               `json:"stale"`
+	StaleSince  time.Time          `json:"staleSince"`
+	State       string             `json:"state"`
+	StartsAt    time.Time          `json:"startsAt"`
+	EndsAt      time.Time          `json:"endsAt"`
+	Source      string             `json:"source"`
+	Silences    map[string]Silence `json:"silences"`
+	InhibitedBy []InhibitingAlert  `json:"inhibitedBy"`
+}
+
+// InhibitingAlert describes an alert that is inhibiting other alerts
+type InhibitingAlert struct {
+	Fingerprint  string            `json:"fingerprint"`
+	Labels       map[string]string `json:"labels"`
+	Alertmanager string            `json:"alertmanager"`
+}
+
+// Silence is a single Alertmanager silence
+type Silence struct {
+	ID        string    `json:"id"`
+	Matchers  []Matcher `json:"matchers"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedAt time.Time `json:"createdAt"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment"`
+	Links     []Link    `json:"links"`
+}
+
+// Matcher is a single silence matcher
+type Matcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+}
+
+// AlertmanagerSummary describes the health of all Alertmanager instances
+type AlertmanagerSummary struct {
+	Counters  AlertmanagerCounters  `json:"counters"`
+	Instances []AlertmanagerStatus  `json:"instances"`
+	Clusters  []AlertmanagerCluster `json:"clusters"`
+}
+
+// AlertmanagerCounters is the number of Alertmanager instances in each state
+type AlertmanagerCounters struct {
+	Total   int `json:"total"`
+	Healthy int `json:"healthy"`
+	Failed  int `json:"failed"`
+	Stale   int `json:"stale"`
+}
+
+// AlertmanagerStatus describes the health of a single Alertmanager instance,
+// Error is empty if the last request to this instance was successful, Stale is
+// set if it failed but data pulled at StaleSince is still used
+type AlertmanagerStatus struct {
+	Name       string    `json:"name"`
+	URI        string    `json:"uri"`
+	Cluster    string    `json:"cluster"`
+	Error      string    `json:"error"`
+	Stale      bool      `json:"stale"`
+	StaleSince time.Time `json:"staleSince"`
+}
+
+// AlertmanagerCluster describes the health of a cluster of Alertmanager
+// instances, Errors lists problems like silences missing on some members
+type AlertmanagerCluster struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+	Healthy int      `json:"healthy"`
+	Failed  int      `json:"failed"`
+	Errors  []string `json:"errors"`
+}
+
+// Color is a RGBA color
+type Color struct {
+	Red   uint8 `json:"red"`
+	Green uint8 `json:"green"`
+	Blue  uint8 `json:"blue"`
+	Alpha uint8 `json:"alpha"`
+}
+
+// LabelColors holds font and background colors for a label
+type LabelColors struct {
+	Font       Color `json:"font"`
+	Background Color `json:"background"`
+}
+
+// LabelsColorMap is a map of "Label Key" -> "Label Value" -> LabelColors
+type LabelsColorMap map[string]map[string]LabelColors
+
+// LabelsCountMap is a map of "Label Key" -> "Label Value" -> number of alerts
+type LabelsCountMap map[string]map[string]int
+
+// Filter describes a single filter from the filter expression
+type Filter struct {
+	Text    string `json:"text"`
+	Hits    int    `json:"hits"`
+	IsValid bool   `json:"isValid"`
+}
+
+// FilterError describes why the filter expression couldn't be parsed,
+// Position is the byte offset in the expression where the error was found
+type FilterError struct {
+	Message  string `json:"message"`
+	Position int    `json:"position"`
+}
@@ -872,8 +872,7 @@ func testAlert(version string, t *testing.T, expectedAlert, gotAlert models.Aler
 						for _, gs := range gotAM.Silences {
 							if es.Comment == gs.Comment &&
 								es.CreatedBy == gs.CreatedBy &&
-								es.JiraID == gs.JiraID &&
-								es.JiraURL == gs.JiraURL {
+								(len(es.Links) == 0 && len(gs.Links) == 0 || reflect.DeepEqual(es.Links, gs.Links)) {
 								foundSilence = true
 							}
 						}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/unsee/api/v1"
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/slices"
+
+	"github.com/gin-gonic/gin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// default number of alert groups returned on a single /api/v1/alerts page
+const apiDefaultPageSize = 100
+
+// apiCursor is the position of the next page, it's passed to the client as
+// an opaque base64 encoded string
+type apiCursor struct {
+	// ID of the last group on the previous page, next page starts after it
+	ID string `json:"id"`
+	// Offset is used if the group with ID is gone
+	Offset int `json:"offset"`
+}
+
+func encodeAPICursor(cursor apiCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeAPICursor(s string) (apiCursor, error) {
+	cursor := apiCursor{}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, fmt.Errorf("Invalid cursor: %s", err)
+	}
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return cursor, fmt.Errorf("Invalid cursor: %s", err)
+	}
+	if cursor.Offset < 0 {
+		return cursor, fmt.Errorf("Invalid cursor offset: %d", cursor.Offset)
+	}
+	return cursor, nil
+}
+
+// paginateGroups returns a single page of groups starting after the position
+// from the cursor and the cursor for the next page, which is empty if this is
+// the last page
+func paginateGroups(groups []models.AlertGroup, cursor *apiCursor, limit int) ([]models.AlertGroup, string) {
+	start := 0
+	if cursor != nil {
+		start = cursor.Offset
+		for i, ag := range groups {
+			if ag.ID == cursor.ID {
+				start = i + 1
+				break
+			}
+		}
+	}
+	if start > len(groups) {
+		start = len(groups)
+	}
+	end := start + limit
+	if end >= len(groups) {
+		return groups[start:], ""
+	}
+	return groups[start:end], encodeAPICursor(apiCursor{ID: groups[end-1].ID, Offset: end})
+}
+
+// getFieldsFromQuery returns the list of optional fields that should be
+// included in the response, all fields are included if fields query argument
+// wasn't passed
+func getFieldsFromQuery(c *gin.Context) ([]string, error) {
+	values, found := c.GetQueryArray("fields")
+	if !found {
+		return v1.Fields, nil
+	}
+	fields := []string{}
+	for _, value := range values {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if !slices.StringInSlice(v1.Fields, field) {
+				return nil, fmt.Errorf("Invalid field '%s', valid fields are: %s", field, strings.Join(v1.Fields, ", "))
+			}
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+func apiError(c *gin.Context, start time.Time, code int, err string) {
+	c.JSON(code, v1.ErrorResponse{
+		SchemaVersion: v1.SchemaVersion,
+		Status:        "error",
+		Error:         err,
+	})
+	log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), code, c.Request.Method, c.Request.RequestURI, time.Since(start))
+}
+
+// apiAlerts endpoint, json, versioned API returning alert groups split into
+// pages, it accepts the same q, group_by and sort query arguments as
+// alerts.json, along with limit (number of groups per page), cursor (from the
+// previous page nextCursor) and fields (comma separated list of optional
+// fields to include)
+func apiAlerts(c *gin.Context) {
+	noCache(c)
+	start := time.Now()
+
+	limit := apiDefaultPageSize
+	if v, found := c.GetQuery("limit"); found {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			apiError(c, start, http.StatusBadRequest, fmt.Sprintf("Invalid limit value '%s', it must be a positive integer", v))
+			return
+		}
+		limit = l
+	}
+
+	var cursor *apiCursor
+	if v := c.Query("cursor"); v != "" {
+		cur, err := decodeAPICursor(v)
+		if err != nil {
+			apiError(c, start, http.StatusBadRequest, err.Error())
+			return
+		}
+		cursor = &cur
+	}
+
+	fields, err := getFieldsFromQuery(c)
+	if err != nil {
+		apiError(c, start, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// use full URI (including query args) as cache key
+	cacheKey := c.Request.RequestURI
+	if data, found := apiCache.Get(cacheKey); found {
+		c.Data(http.StatusOK, gin.MIMEJSON, data.([]byte))
+		logAlertsView(c, "HIT", time.Since(start))
+		return
+	}
+
+	resp := v1.AlertsResponse{
+		SchemaVersion: v1.SchemaVersion,
+		Status:        "success",
+		Timestamp:     start.UTC(),
+		Version:       version,
+	}
+
+	expression, filterError := getFiltersFromQuery(c.Query("q"))
+	if filterError != nil {
+		resp.FilterError = &v1.FilterError{Message: filterError.Message, Position: filterError.Position}
+	}
+
+	sortBy, err := getSortFromQuery(c)
+	if err != nil {
+		resp.SortError = err.Error()
+		sortBy = []sortKey{}
+	}
+
+	groups, colors, counters := filterAlerts(expression, getGroupByFromQuery(c), sortBy)
+	resp.TotalGroups = len(groups)
+	for _, ag := range groups {
+		resp.TotalAlerts += len(ag.Alerts)
+	}
+
+	page, nextCursor := paginateGroups(groups, cursor, limit)
+	resp.NextCursor = nextCursor
+	resp.Groups = make([]v1.AlertGroup, 0, len(page))
+	for _, ag := range page {
+		resp.Groups = append(resp.Groups, apiAlertGroup(ag))
+	}
+
+	if slices.StringInSlice(fields, v1.FieldUpstreams) {
+		upstreams := apiAlertmanagerSummary(getUpstreams())
+		resp.Upstreams = &upstreams
+	}
+	if slices.StringInSlice(fields, v1.FieldColors) {
+		resp.Colors = apiLabelsColorMap(colors)
+	}
+	if slices.StringInSlice(fields, v1.FieldCounters) {
+		resp.Counters = v1.LabelsCountMap(counters)
+	}
+	if slices.StringInSlice(fields, v1.FieldFilters) {
+		resp.Filters = []v1.Filter{}
+		for _, filter := range expression.Filters() {
+			resp.Filters = append(resp.Filters, v1.Filter{
+				Text:    filter.GetRawText(),
+				Hits:    filter.GetHits(),
+				IsValid: filter.GetIsValid(),
+			})
+		}
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Error(err.Error())
+		panic(err)
+	}
+	apiCache.Set(cacheKey, data, -1)
+
+	c.Data(http.StatusOK, gin.MIMEJSON, data)
+	logAlertsView(c, "MIS", time.Since(start))
+}
+
+// functions below convert internal models into public API types
+
+func apiAlertGroup(ag models.AlertGroup) v1.AlertGroup {
+	group := v1.AlertGroup{
+		ID:         ag.ID,
+		Receiver:   ag.Receiver,
+		Labels:     ag.Labels,
+		Alerts:     make([]v1.Alert, 0, len(ag.Alerts)),
+		Hash:       ag.Hash,
+		StateCount: ag.StateCount,
+	}
+	for _, alert := range ag.Alerts {
+		group.Alerts = append(group.Alerts, apiAlert(alert))
+	}
+	return group
+}
+
+func apiAlert(alert models.Alert) v1.Alert {
+	a := v1.Alert{
+		Fingerprint:  alert.LabelsFingerprint(),
+		Labels:       alert.Labels,
+		Annotations:  make([]v1.Annotation, 0, len(alert.Annotations)),
+		StartsAt:     alert.StartsAt,
+		EndsAt:       alert.EndsAt,
+		State:        alert.State,
+		Receiver:     alert.Receiver,
+		Alertmanager: make([]v1.AlertmanagerInstance, 0, len(alert.Alertmanager)),
+		Links:        apiLinks(alert.Links),
+	}
+	for _, annotation := range alert.Annotations {
+		a.Annotations = append(a.Annotations, v1.Annotation{
+			Name:    annotation.Name,
+			Value:   annotation.Value,
+			Visible: annotation.Visible,
+			IsLink:  annotation.IsLink,
+		})
+	}
+	for _, am := range alert.Alertmanager {
+		instance := v1.AlertmanagerInstance{
+			Name:        am.Name,
+			URI:         am.URI,
+			Cluster:     am.Cluster,
+			Stale:       am.Stale,
+			StaleSince:  am.StaleSince,
+			State:       am.State,
+			StartsAt:    am.StartsAt,
+			EndsAt:      am.EndsAt,
+			Source:      am.Source,
+			Silences:    map[string]v1.Silence{},
+			InhibitedBy: make([]v1.InhibitingAlert, 0, len(am.InhibitedBy)),
+		}
+		for id, silence := range am.Silences {
+			instance.Silences[id] = apiSilence(silence)
+		}
+		for _, ia := range am.InhibitedBy {
+			instance.InhibitedBy = append(instance.InhibitedBy, v1.InhibitingAlert{
+				Fingerprint:  ia.Fingerprint,
+				Labels:       ia.Labels,
+				Alertmanager: ia.Alertmanager,
+			})
+		}
+		a.Alertmanager = append(a.Alertmanager, instance)
+	}
+	return a
+}
+
+func apiSilence(silence models.Silence) v1.Silence {
+	s := v1.Silence{
+		ID:        silence.ID,
+		Matchers:  make([]v1.Matcher, 0, len(silence.Matchers)),
+		StartsAt:  silence.StartsAt,
+		EndsAt:    silence.EndsAt,
+		CreatedAt: silence.CreatedAt,
+		CreatedBy: silence.CreatedBy,
+		Comment:   silence.Comment,
+		Links:     apiLinks(silence.Links),
+	}
+	for _, m := range silence.Matchers {
+		s.Matchers = append(s.Matchers, v1.Matcher{Name: m.Name, Value: m.Value, IsRegex: m.IsRegex})
+	}
+	return s
+}
+
+func apiLinks(links []models.Link) []v1.Link {
+	result := make([]v1.Link, 0, len(links))
+	for _, link := range links {
+		result = append(result, v1.Link{
+			Type:   link.Type,
+			Text:   link.Text,
+			URL:    link.URL,
+			Source: link.Source,
+			Key:    link.Key,
+		})
+	}
+	return result
+}
+
+func apiAlertmanagerSummary(summary models.AlertmanagerAPISummary) v1.AlertmanagerSummary {
+	s := v1.AlertmanagerSummary{
+		Counters: v1.AlertmanagerCounters{
+			Total:   summary.Counters.Total,
+			Healthy: summary.Counters.Healthy,
+			Failed:  summary.Counters.Failed,
+			Stale:   summary.Counters.Stale,
+		},
+		Instances: make([]v1.AlertmanagerStatus, 0, len(summary.Instances)),
+		Clusters:  make([]v1.AlertmanagerCluster, 0, len(summary.Clusters)),
+	}
+	for _, instance := range summary.Instances {
+		s.Instances = append(s.Instances, v1.AlertmanagerStatus{
+			Name:       instance.Name,
+			URI:        instance.URI,
+			Cluster:    instance.Cluster,
+			Error:      instance.Error,
+			Stale:      instance.Stale,
+			StaleSince: instance.StaleSince,
+		})
+	}
+	for _, cluster := range summary.Clusters {
+		s.Clusters = append(s.Clusters, v1.AlertmanagerCluster{
+			Name:    cluster.Name,
+			Members: cluster.Members,
+			Healthy: cluster.Healthy,
+			Failed:  cluster.Failed,
+			Errors:  cluster.Errors,
+		})
+	}
+	return s
+}
+
+func apiLabelsColorMap(colors models.LabelsColorMap) v1.LabelsColorMap {
+	result := v1.LabelsColorMap{}
+	for key, values := range colors {
+		result[key] = map[string]v1.LabelColors{}
+		for value, lc := range values {
+			result[key][value] = v1.LabelColors{
+				Font:       v1.Color(lc.Font),
+				Background: v1.Color(lc.Background),
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cloudflare/unsee/api/v1"
+	"github.com/cloudflare/unsee/internal/mock"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getAPIAlerts(t *testing.T, r *gin.Engine, uri string) v1.AlertsResponse {
+	apiCache.Flush()
+	req, _ := http.NewRequest("GET", uri, nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("GET %s returned status %d: %s", uri, resp.Code, resp.Body.String())
+	}
+	ar := v1.AlertsResponse{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &ar); err != nil {
+		t.Errorf("Failed to unmarshal response from GET %s: %s", uri, err)
+	}
+	if ar.SchemaVersion != v1.SchemaVersion {
+		t.Errorf("GET %s returned schemaVersion=%d, expected %d", uri, ar.SchemaVersion, v1.SchemaVersion)
+	}
+	return ar
+}
+
+func TestAPIAlertsPagination(t *testing.T) {
+	mockConfig()
+	for _, version := range mock.ListAllMocks() {
+		mockAlerts(version)
+		r := ginTestEngine()
+
+		all := getAPIAlerts(t, r, "/api/v1/alerts?limit=1000")
+		if all.TotalGroups != 10 || len(all.Groups) != 10 {
+			t.Errorf("[%s] got %d/%d group(s), expected 10", version, len(all.Groups), all.TotalGroups)
+		}
+		if all.TotalAlerts != 24 {
+			t.Errorf("[%s] got totalAlerts=%d, expected 24", version, all.TotalAlerts)
+		}
+		if all.NextCursor != "" {
+			t.Errorf("[%s] got nextCursor='%s' on the last page", version, all.NextCursor)
+		}
+
+		ids := []string{}
+		uri := "/api/v1/alerts?limit=3"
+		for pages := 0; pages < 10; pages++ {
+			page := getAPIAlerts(t, r, uri)
+			if len(page.Groups) > 3 {
+				t.Errorf("[%s] got %d group(s) with limit=3", version, len(page.Groups))
+			}
+			if page.TotalGroups != all.TotalGroups {
+				t.Errorf("[%s] got totalGroups=%d on page %d, expected %d", version, page.TotalGroups, pages, all.TotalGroups)
+			}
+			for _, ag := range page.Groups {
+				ids = append(ids, ag.ID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			uri = "/api/v1/alerts?limit=3&cursor=" + page.NextCursor
+		}
+		expected := []string{}
+		for _, ag := range all.Groups {
+			expected = append(expected, ag.ID)
+		}
+		if !reflect.DeepEqual(ids, expected) {
+			t.Errorf("[%s] groups from all pages don't match, expected %v, got %v", version, expected, ids)
+		}
+
+		// unknown group ID in the cursor should fall back to the offset
+		page := getAPIAlerts(t, r, "/api/v1/alerts?limit=3&cursor="+encodeAPICursor(apiCursor{ID: "foo", Offset: 9}))
+		if len(page.Groups) != 1 || page.Groups[0].ID != expected[9] {
+			t.Errorf("[%s] cursor offset wasn't used, got %d group(s)", version, len(page.Groups))
+		}
+	}
+}
+
+type apiFieldsTest struct {
+	query     string
+	colors    bool
+	counters  bool
+	filters   bool
+	upstreams bool
+}
+
+var apiFieldsTests = []apiFieldsTest{
+	{query: "", colors: true, counters: true, filters: true, upstreams: true},
+	{query: "fields=", colors: false, counters: false, filters: false, upstreams: false},
+	{query: "fields=counters", colors: false, counters: true, filters: false, upstreams: false},
+	{query: "fields=filters,upstreams", colors: false, counters: false, filters: true, upstreams: true},
+	{query: "fields=colors&fields=counters", colors: true, counters: true, filters: false, upstreams: false},
+}
+
+func TestAPIAlertsFields(t *testing.T) {
+	mockConfig()
+	for _, version := range mock.ListAllMocks() {
+		mockAlerts(version)
+		r := ginTestEngine()
+		for _, testCase := range apiFieldsTests {
+			resp := getAPIAlerts(t, r, "/api/v1/alerts?q=@receiver=by-cluster-service&"+testCase.query)
+			if (len(resp.Colors) > 0) != testCase.colors {
+				t.Errorf("[%s] %s: colors=%v", version, testCase.query, resp.Colors)
+			}
+			if (len(resp.Counters) > 0) != testCase.counters {
+				t.Errorf("[%s] %s: counters=%v", version, testCase.query, resp.Counters)
+			}
+			if (len(resp.Filters) > 0) != testCase.filters {
+				t.Errorf("[%s] %s: filters=%v", version, testCase.query, resp.Filters)
+			}
+			if (resp.Upstreams != nil) != testCase.upstreams {
+				t.Errorf("[%s] %s: upstreams=%v", version, testCase.query, resp.Upstreams)
+			}
+			if len(resp.Groups) == 0 {
+				t.Errorf("[%s] %s: no groups returned", version, testCase.query)
+			}
+		}
+	}
+}
+
+var apiInvalidQueries = []string{
+	"limit=0",
+	"limit=foo",
+	"cursor=foo",
+	"cursor=" + encodeAPICursor(apiCursor{Offset: -1}),
+	"fields=foo",
+	"fields=colors,foo",
+}
+
+func TestAPIAlertsInvalidQuery(t *testing.T) {
+	mockConfig()
+	mockAlerts(mock.ListAllMocks()[0])
+	r := ginTestEngine()
+	for _, query := range apiInvalidQueries {
+		req, _ := http.NewRequest("GET", "/api/v1/alerts?"+query, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("GET /api/v1/alerts?%s returned status %d, expected %d", query, resp.Code, http.StatusBadRequest)
+		}
+		er := v1.ErrorResponse{}
+		json.Unmarshal(resp.Body.Bytes(), &er)
+		if er.Status != "error" || er.Error == "" || er.SchemaVersion != v1.SchemaVersion {
+			t.Errorf("GET /api/v1/alerts?%s returned invalid error response: %s", query, resp.Body.String())
+		}
+	}
+}
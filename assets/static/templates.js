@@ -44,6 +44,7 @@ var templates = {},
         alertGroup: "#alert-group",
         alertGroupTitle: "#alert-group-title",
         alertGroupAnnotations: "#alert-group-annotations",
+        alertGroupLink: "#alert-group-link",
         alertGroupLabels: "#alert-group-labels",
         alertGroupElements: "#alert-group-elements",
         alertGroupSilence: "#alert-group-silence",
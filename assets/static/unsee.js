@@ -28,6 +28,7 @@ const counter = require("./counter");
 const grid = require("./grid");
 const filters = require("./filters");
 const progress = require("./progress");
+const querystring = require("./querystring");
 const silence = require("./silence");
 const summary = require("./summary");
 const templates = require("./templates");
@@ -160,8 +161,18 @@ function upgrade() {
 
 function triggerReload() {
     updateIsReady();
+    var url = "alerts.json?q=" + filters.getFilters().join(",");
+    // pass group_by and sort from the page URL so alerts can be regrouped
+    // and sorted
+    var args = querystring.parse();
+    if (args.group_by !== undefined) {
+        url += "&group_by=" + args.group_by;
+    }
+    if (args.sort !== undefined) {
+        url += "&sort=" + args.sort;
+    }
     $.ajax({
-        url: "alerts.json?q=" + filters.getFilters().join(","),
+        url: url,
         success: function(resp) {
             counter.markSuccess();
             if (needsUpgrade(resp.version)) {
@@ -177,8 +188,9 @@ function triggerReload() {
                         lastTs: watchdog.getLastUpdate()
                     });
                     resume();
-                } else if (resp.upstreams.counters.healthy > 0 ) {
-                    // we have some healthy upstreams, check for failed ones
+                } else if (resp.upstreams.counters.healthy > 0 || resp.upstreams.counters.stale > 0) {
+                    // we have some healthy upstreams or failed ones that still
+                    // have data from earlier pulls, check for failed ones
                     if (resp.upstreams.counters.failed > 0) {
                         var instances = [];
                         resp.upstreams.instances.sort(function(a, b){
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/audit"
+	"github.com/cloudflare/unsee/internal/auth"
+	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/models"
+
+	"github.com/gin-gonic/gin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// auditDefaultLimit is the number of entries returned by the audit log
+	// endpoint if no limit was passed
+	auditDefaultLimit = 100
+	// auditMaxLimit is the maximum number of entries returned by the audit log
+	// endpoint
+	auditMaxLimit = 10000
+)
+
+// auditLog is used to record all silence operations, it's nil unless audit
+// log is enabled in the config
+var auditLog *audit.Logger
+
+func setupAudit() {
+	if config.Config().Audit.Path == "" && config.Config().Audit.Webhook.URI == "" {
+		return
+	}
+
+	l, err := audit.New(audit.Config{
+		Path:           config.Config().Audit.Path,
+		MaxSize:        int64(config.Config().Audit.Rotate.Size) * 1024 * 1024,
+		Backups:        config.Config().Audit.Rotate.Backups,
+		WebhookURI:     config.Config().Audit.Webhook.URI,
+		WebhookTimeout: config.Config().Audit.Webhook.Timeout,
+	})
+	if err != nil {
+		log.Fatalf("Failed to setup audit log: %s", err)
+	}
+	auditLog = l
+}
+
+// newAuditEntry returns an entry for the silence operation performed by the
+// user that sent the request
+func newAuditEntry(c *gin.Context, action, alertmanager, request string) models.AuditEntry {
+	return models.AuditEntry{
+		Timestamp:    time.Now().UTC(),
+		Action:       action,
+		User:         auth.GetUsername(c),
+		ClientIP:     c.ClientIP(),
+		Alertmanager: alertmanager,
+		Request:      request,
+	}
+}
+
+func recordAudit(entry models.AuditEntry) {
+	if auditLog == nil {
+		return
+	}
+	auditLog.Record(entry)
+}
+
+func auditError(c *gin.Context, start time.Time, code int, err string) {
+	c.JSON(code, models.AuditResponse{
+		Status:  "error",
+		Error:   err,
+		Entries: []models.AuditEntry{},
+	})
+	log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), code, c.Request.Method, c.Request.RequestURI, time.Since(start))
+}
+
+// auditEntries endpoint, json, returns most recent silence operations, entries
+// can be filtered using user, alertmanager, silenceID and action query args,
+// limit argument sets the maximum number of entries returned
+func auditEntries(c *gin.Context) {
+	noCache(c)
+	start := time.Now()
+
+	if auditLog == nil || config.Config().Audit.Path == "" {
+		auditError(c, start, http.StatusNotFound, "Audit log is not enabled")
+		return
+	}
+
+	limit := auditDefaultLimit
+	if l, found := c.GetQuery("limit"); found {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > auditMaxLimit {
+			auditError(c, start, http.StatusBadRequest, "Invalid limit value, it must be a number between 1 and "+strconv.Itoa(auditMaxLimit))
+			return
+		}
+		limit = v
+	}
+
+	filters := map[string]string{}
+	for _, key := range []string{"user", "alertmanager", "silenceID", "action"} {
+		if v, found := c.GetQuery(key); found {
+			filters[key] = v
+		}
+	}
+	entries, err := auditLog.Recent(func(entry models.AuditEntry) bool {
+		values := map[string]string{
+			"user":         entry.User,
+			"alertmanager": entry.Alertmanager,
+			"silenceID":    entry.SilenceID,
+			"action":       entry.Action,
+		}
+		for key, v := range filters {
+			if values[key] != v {
+				return false
+			}
+		}
+		return true
+	}, limit)
+	if err != nil {
+		log.Errorf("Failed to read audit log: %s", err)
+		auditError(c, start, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AuditResponse{
+		Status:  "success",
+		Entries: entries,
+	})
+	log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), http.StatusOK, c.Request.Method, c.Request.RequestURI, time.Since(start))
+}
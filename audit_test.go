@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/alertmanager"
+	"github.com/cloudflare/unsee/internal/auth"
+	"github.com/cloudflare/unsee/internal/models"
+
+	httpmock "gopkg.in/jarcoal/httpmock.v1"
+)
+
+func getAuditEntries(t *testing.T, uri string) models.AuditResponse {
+	r := ginTestEngine()
+	req, _ := http.NewRequest("GET", uri, nil)
+	req.Header.Set("X-User", "alice")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("GET %s returned status %d: %s", uri, resp.Code, resp.Body.String())
+	}
+	ar := models.AuditResponse{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &ar); err != nil {
+		t.Fatalf("Failed to decode response: %s", err)
+	}
+	return ar
+}
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unsee-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("AUDIT_PATH", path.Join(dir, "audit.log"))
+	defer os.Unsetenv("AUDIT_PATH")
+	mockConfig()
+	setupAudit()
+	authenticator = auth.NewHeaderAuth("X-User", "X-Groups")
+	defer func() {
+		auditLog.Close()
+		auditLog = nil
+		authenticator = nil
+		mockConfig()
+	}()
+	r := ginTestEngine()
+	setupProxies(alertmanager.GetAlertmanagers())
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("POST", "http://localhost/api/v1/silences",
+		httpmock.NewStringResponder(200, `{"status":"success","data":{"silenceId":"d8a61ca8-ee2e-4076-999f-276f1e986bf3"}}`))
+	httpmock.RegisterResponder("DELETE", "http://localhost/api/v1/silence/d8a61ca8-ee2e-4076-999f-276f1e986bf3",
+		httpmock.NewStringResponder(200, `{"status":"success"}`))
+
+	for _, uri := range []string{"/api/silences", "/proxy/alertmanager/default/api/v1/silences"} {
+		body := validSilence
+		if uri == "/api/silences" {
+			body = `{"silence": ` + validSilence + `, "alertmanagers": ["default"]}`
+		}
+		req, _ := http.NewRequest("POST", uri, bytes.NewBufferString(body))
+		req.Header.Set("X-User", "alice")
+		resp := newCloseNotifyingRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("POST %s returned status %d: %s", uri, resp.Code, resp.Body.String())
+		}
+	}
+
+	req, _ := http.NewRequest("DELETE", "/proxy/alertmanager/default/api/v1/silence/d8a61ca8-ee2e-4076-999f-276f1e986bf3", nil)
+	req.Header.Set("X-User", "bob")
+	resp := newCloseNotifyingRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("DELETE returned status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	ar := getAuditEntries(t, "/audit.json")
+	if len(ar.Entries) != 3 {
+		t.Fatalf("Got %d audit entries while 3 were expected: %v", len(ar.Entries), ar.Entries)
+	}
+	expire := ar.Entries[0]
+	if expire.Action != models.AuditActionExpire || expire.User != "bob" || expire.Status != http.StatusOK ||
+		expire.Alertmanager != "default" || expire.SilenceID != "d8a61ca8-ee2e-4076-999f-276f1e986bf3" {
+		t.Errorf("Invalid expire entry: %v", expire)
+	}
+	for _, create := range ar.Entries[1:] {
+		if create.Action != models.AuditActionCreate || create.User != "alice" || create.Status != http.StatusOK ||
+			create.Alertmanager != "default" || create.SilenceID != "d8a61ca8-ee2e-4076-999f-276f1e986bf3" {
+			t.Errorf("Invalid create entry: %v", create)
+		}
+		silence := models.Silence{}
+		if err := json.Unmarshal([]byte(create.Request), &silence); err != nil || silence.Comment != "Silenced instance" {
+			t.Errorf("Invalid request recorded in create entry: %s", create.Request)
+		}
+	}
+
+	ar = getAuditEntries(t, "/audit.json?user=alice&limit=1")
+	if len(ar.Entries) != 1 || ar.Entries[0].User != "alice" {
+		t.Errorf("Got invalid entries when filtering by user: %v", ar.Entries)
+	}
+	ar = getAuditEntries(t, "/audit.json?action=expire")
+	if len(ar.Entries) != 1 || ar.Entries[0].Action != models.AuditActionExpire {
+		t.Errorf("Got invalid entries when filtering by action: %v", ar.Entries)
+	}
+
+	req, _ = http.NewRequest("GET", "/audit.json?limit=0", nil)
+	req.Header.Set("X-User", "alice")
+	resp = newCloseNotifyingRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("GET /audit.json with invalid limit returned status %d", resp.Code)
+	}
+}
+
+func TestAuditLogDisabled(t *testing.T) {
+	mockConfig()
+	r := ginTestEngine()
+	req, _ := http.NewRequest("GET", "/audit.json", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("GET /audit.json with audit log disabled returned status %d", resp.Code)
+	}
+}
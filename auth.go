@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cloudflare/unsee/internal/auth"
+	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/models"
+
+	"github.com/gin-gonic/gin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// authenticator is used to authenticate all requests, it's nil if
+	// authentication is disabled
+	authenticator auth.Authenticator
+
+	// authorizer is used to check if user can manage silences, it's nil if
+	// there are no authorization rules, it's replaced when configuration is
+	// reloaded
+	authorizer     *auth.Authorizer
+	authorizerLock = sync.RWMutex{}
+)
+
+func newAuthenticator() (auth.Authenticator, error) {
+	switch config.Config().Authentication.Mode {
+	case "":
+		return nil, nil
+	case "basic":
+		users := []auth.BasicUser{}
+		for _, u := range config.Config().Authentication.Basic.Users {
+			if u.Username == "" || u.Password == "" {
+				return nil, fmt.Errorf("Basic authentication users must have a username and a password")
+			}
+			users = append(users, auth.BasicUser{Username: u.Username, Password: u.Password, Groups: u.Groups})
+		}
+		if len(users) == 0 {
+			return nil, fmt.Errorf("No users configured for basic authentication")
+		}
+		return auth.NewBasicAuth(users), nil
+	case "header":
+		if config.Config().Authentication.Header.Name == "" {
+			return nil, fmt.Errorf("No header name configured for header authentication")
+		}
+		return auth.NewHeaderAuth(config.Config().Authentication.Header.Name, config.Config().Authentication.Header.Groups), nil
+	case "oidc":
+		cfg := config.Config().Authentication.OIDC
+		return auth.NewOIDCAuth(auth.OIDCConfig{
+			Issuer:        cfg.Issuer,
+			ClientID:      cfg.Client.ID,
+			ClientSecret:  cfg.Client.Secret,
+			RedirectURL:   cfg.Redirect,
+			Scopes:        cfg.Scopes,
+			UsernameClaim: cfg.Claim,
+			GroupsClaim:   cfg.Groups,
+			SessionSecret: cfg.Session.Secret,
+			SessionTTL:    cfg.Session.TTL,
+			Prefix:        getViewURL("/"),
+			LoginPath:     getViewURL("/auth/login"),
+		})
+	default:
+		return nil, fmt.Errorf("Unknown authentication mode '%s'", config.Config().Authentication.Mode)
+	}
+}
+
+func setupAuthentication() {
+	a, err := newAuthenticator()
+	if err != nil {
+		log.Fatalf("Failed to setup authentication: %s", err)
+	}
+	if a != nil {
+		log.Infof("Authentication mode: %s", config.Config().Authentication.Mode)
+	}
+	authenticator = a
+}
+
+// setupRouterAuth registers login handlers and the authentication middleware,
+// it must be called before any route that requires authentication is
+// registered
+func setupRouterAuth(router *gin.Engine) {
+	if authenticator == nil {
+		return
+	}
+
+	if oa, ok := authenticator.(*auth.OIDCAuth); ok {
+		router.GET(getViewURL("/auth/login"), oa.Login)
+		router.GET(getViewURL("/auth/callback"), oa.Callback)
+		router.GET(getViewURL("/auth/logout"), oa.Logout)
+	}
+
+	// metrics endpoint is the only one that doesn't require authentication,
+	// so Prometheus can scrape it
+	metricsPath := getViewURL("/metrics")
+	middleware := auth.Middleware(authenticator)
+	router.Use(func(c *gin.Context) {
+		if c.Request.URL.Path == metricsPath {
+			return
+		}
+		middleware(c)
+	})
+}
+
+func newAuthorizer() (*auth.Authorizer, error) {
+	if len(config.Config().Authorization.Rules) == 0 {
+		return nil, nil
+	}
+	rules := []auth.Rule{}
+	for _, r := range config.Config().Authorization.Rules {
+		rules = append(rules, auth.Rule{
+			Users:         r.Users,
+			Groups:        r.Groups,
+			Alertmanagers: r.Alertmanagers,
+			Matchers:      r.Matchers,
+		})
+	}
+	return auth.NewAuthorizer(rules)
+}
+
+func setAuthorizer(a *auth.Authorizer) {
+	if a != nil && config.Config().Authentication.Mode == "" {
+		log.Warning("Authorization rules are configured but authentication is disabled, nobody will be able to manage silences")
+	}
+	authorizerLock.Lock()
+	authorizer = a
+	authorizerLock.Unlock()
+}
+
+func setupAuthorization() {
+	a, err := newAuthorizer()
+	if err != nil {
+		log.Fatalf("Failed to setup authorization: %s", err)
+	}
+	setAuthorizer(a)
+}
+
+func getAuthorizer() *auth.Authorizer {
+	authorizerLock.RLock()
+	defer authorizerLock.RUnlock()
+	return authorizer
+}
+
+// checkSilenceAccess returns nil if the user that sent the request is allowed
+// to manage passed silence on given Alertmanager instance
+func checkSilenceAccess(c *gin.Context, alertmanager string, silence models.Silence) error {
+	a := getAuthorizer()
+	if a == nil {
+		return nil
+	}
+	return a.CanSilence(auth.GetUser(c), alertmanager, silence)
+}
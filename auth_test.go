@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/alertmanager"
+	"github.com/cloudflare/unsee/internal/auth"
+	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/mock"
+
+	"github.com/gin-gonic/gin"
+
+	httpmock "gopkg.in/jarcoal/httpmock.v1"
+)
+
+type authModeTest struct {
+	mode    string
+	isValid bool
+}
+
+var authModeTests = []authModeTest{
+	{mode: "", isValid: true},
+	{mode: "header", isValid: true},
+	// there are no users configured
+	{mode: "basic", isValid: false},
+	{mode: "foo", isValid: false},
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	defer os.Unsetenv("AUTHENTICATION_MODE")
+	for _, testCase := range authModeTests {
+		os.Setenv("AUTHENTICATION_MODE", testCase.mode)
+		mockConfig()
+		a, err := newAuthenticator()
+		if testCase.isValid && err != nil {
+			t.Errorf("[%s] newAuthenticator() returned an error: %s", testCase.mode, err)
+		}
+		if !testCase.isValid && err == nil {
+			t.Errorf("[%s] newAuthenticator() didn't return any error", testCase.mode)
+		}
+		if testCase.mode == "" && a != nil {
+			t.Errorf("[%s] newAuthenticator() returned %v with authentication disabled", testCase.mode, a)
+		}
+	}
+	mockConfig()
+}
+
+func TestAuthRequired(t *testing.T) {
+	mockConfig()
+	authenticator = auth.NewBasicAuth([]auth.BasicUser{{Username: "alice", Password: "secret"}})
+	defer func() { authenticator = nil }()
+	r := ginTestEngine()
+
+	for _, uri := range []string{"/", "/alerts.json", "/alerts/stream", "/autocomplete.json?term=a"} {
+		req, _ := http.NewRequest("GET", uri, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s without credentials returned status %d", uri, resp.Code)
+		}
+	}
+
+	for _, uri := range []string{"/api/silences", "/proxy/alertmanager/default/api/v1/silences"} {
+		req, _ := http.NewRequest("POST", uri, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != http.StatusUnauthorized {
+			t.Errorf("POST %s without credentials returned status %d", uri, resp.Code)
+		}
+	}
+
+	apiCache.Flush()
+	req, _ := http.NewRequest("GET", "/alerts.json", nil)
+	req.SetBasicAuth("alice", "secret")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("GET /alerts.json with valid credentials returned status %d", resp.Code)
+	}
+	apiCache.Flush()
+}
+
+func TestAuthExtraRoutes(t *testing.T) {
+	mockConfig()
+	authenticator = auth.NewBasicAuth([]auth.BasicUser{{Username: "alice", Password: "secret"}})
+	defer func() { authenticator = nil }()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	setupRouter(r, func(r *gin.Engine) {
+		r.GET(getViewURL("/metrics"), ok)
+		r.GET("/debug/pprof/", ok)
+	})
+
+	for uri, code := range map[string]int{
+		"/metrics":      http.StatusOK,
+		"/debug/pprof/": http.StatusUnauthorized,
+	} {
+		req, _ := http.NewRequest("GET", uri, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != code {
+			t.Errorf("GET %s without credentials returned status %d, expected %d", uri, resp.Code, code)
+		}
+	}
+}
+
+func TestAuthDisabled(t *testing.T) {
+	mockConfig()
+	if config.Config().Authentication.Mode != "" {
+		t.Fatalf("Authentication mode is set to '%s'", config.Config().Authentication.Mode)
+	}
+	r := ginTestEngine()
+	req, _ := http.NewRequest("GET", "/", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("GET / with authentication disabled returned status %d", resp.Code)
+	}
+}
+
+type silenceAuthorizationTest struct {
+	name   string
+	method string
+	uri    string
+	body   string
+	user   string
+	code   int
+}
+
+func TestSilenceAuthorization(t *testing.T) {
+	mockConfig()
+	versions := mock.ListAllMocks()
+	mockAlerts(versions[len(versions)-1])
+
+	a, err := auth.NewAuthorizer([]auth.Rule{
+		{Users: []string{"alice"}, Matchers: []map[string]string{{"instance": "web.+"}}},
+		{Groups: []string{"admins"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// find a silence that alice isn't allowed to manage
+	am := alertmanager.GetAlertmanagerByName("default")
+	silenceID := ""
+	for _, ag := range am.Alerts() {
+		for _, alert := range ag.Alerts {
+			for _, id := range alert.SilencedBy {
+				silence, err := am.SilenceByID(id)
+				if err == nil && a.CanSilence(&auth.User{Name: "alice"}, am.Name, silence) != nil {
+					silenceID = id
+				}
+			}
+		}
+	}
+	if silenceID == "" {
+		t.Fatal("No silenced alerts found in mock data")
+	}
+
+	authenticator = auth.NewHeaderAuth("X-User", "X-Groups")
+	setAuthorizer(a)
+	defer func() {
+		authenticator = nil
+		setAuthorizer(nil)
+	}()
+	r := ginTestEngine()
+	setupProxies(alertmanager.GetAlertmanagers())
+
+	regexSilence := strings.Replace(validSilence, `"isRegex": false`, `"isRegex": true`, 1)
+	tests := []silenceAuthorizationTest{
+		{
+			name:   "silence in user scope",
+			method: "POST",
+			uri:    "/api/silences",
+			body:   `{"silence": ` + validSilence + `, "alertmanagers": ["default"]}`,
+			user:   "alice",
+			code:   http.StatusOK,
+		},
+		{
+			name:   "silence outside of user scope",
+			method: "POST",
+			uri:    "/api/silences",
+			body:   `{"silence": ` + regexSilence + `, "alertmanagers": ["default"]}`,
+			user:   "alice",
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "user without any rule",
+			method: "POST",
+			uri:    "/api/silences",
+			body:   `{"silence": ` + validSilence + `, "alertmanagers": ["default"]}`,
+			user:   "bob",
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "proxied silence in user scope",
+			method: "POST",
+			uri:    "/proxy/alertmanager/default/api/v1/silences",
+			body:   validSilence,
+			user:   "alice",
+			code:   http.StatusOK,
+		},
+		{
+			name:   "proxied silence outside of user scope",
+			method: "POST",
+			uri:    "/proxy/alertmanager/default/api/v1/silences",
+			body:   regexSilence,
+			user:   "alice",
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "proxied silence with invalid body",
+			method: "POST",
+			uri:    "/proxy/alertmanager/default/api/v1/silences",
+			body:   "{xxx",
+			user:   "alice",
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "editing silence outside of user scope",
+			method: "POST",
+			uri:    "/proxy/alertmanager/default/api/v1/silences",
+			body:   `{"id": "` + silenceID + `", ` + validSilence[1:],
+			user:   "alice",
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "expiring unknown silence",
+			method: "DELETE",
+			uri:    "/proxy/alertmanager/default/api/v1/silence/xxx",
+			user:   "bob:admins",
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "expiring silence as admin",
+			method: "DELETE",
+			uri:    "/proxy/alertmanager/default/api/v1/silence/" + silenceID,
+			user:   "bob:admins",
+			code:   http.StatusOK,
+		},
+		{
+			name:   "expiring silence without any rule",
+			method: "DELETE",
+			uri:    "/proxy/alertmanager/default/api/v1/silence/" + silenceID,
+			user:   "bob",
+			code:   http.StatusForbidden,
+		},
+	}
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	for _, testCase := range tests {
+		httpmock.Reset()
+		httpmock.RegisterResponder("POST", "http://localhost/api/v1/silences",
+			httpmock.NewStringResponder(200, `{"status":"success","data":{"silenceId":"d8a61ca8-ee2e-4076-999f-276f1e986bf3"}}`))
+		httpmock.RegisterResponder("DELETE", "http://localhost/api/v1/silence/"+silenceID,
+			httpmock.NewStringResponder(200, `{"status":"success"}`))
+
+		req, _ := http.NewRequest(testCase.method, testCase.uri, bytes.NewBufferString(testCase.body))
+		// user is passed as username:group
+		user := strings.SplitN(testCase.user, ":", 2)
+		req.Header.Set("X-User", user[0])
+		if len(user) > 1 {
+			req.Header.Set("X-Groups", user[1])
+		}
+		resp := newCloseNotifyingRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != testCase.code {
+			t.Errorf("[%s] %s %s returned status %d while %d was expected: %s",
+				testCase.name, testCase.method, testCase.uri, resp.Code, testCase.code, resp.Body.String())
+		}
+	}
+}
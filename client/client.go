@@ -0,0 +1,378 @@
+// Package client implements a Go client for the unsee API, it can be used to
+// query alerts and to list, preview and create silences.
+// Alerts are queried using the versioned /api/v1/alerts endpoint, which
+// returns the same data as /alerts.json used by the UI, but with a stable
+// response schema.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Option allows to pass functional options to New()
+type Option func(c *Client) error
+
+// Client is used to send requests to a single unsee instance, it's safe for
+// concurrent use
+type Client struct {
+	uri        *url.URL
+	httpClient *http.Client
+	retries    int
+	retryWait  time.Duration
+	username   string
+	password   string
+}
+
+// Error is returned when unsee responds with a status code other than 2xx
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unsee returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unsee returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// New creates a new Client for unsee instance running at given URI, URI should
+// include listen prefix if unsee is configured with one
+func New(uri string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Unsupported URI scheme '%s'", u.Scheme)
+	}
+
+	c := &Client{
+		uri:        u,
+		httpClient: &http.Client{Timeout: time.Second * 30},
+		retries:    2,
+		retryWait:  time.Second,
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// WithTimeout option can be passed to New in order to set a timeout for every
+// request sent to unsee, each retry is a new request with its own timeout,
+// default is 30s, use context passed to each method to limit the total time
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) error {
+		c.httpClient.Timeout = timeout
+		return nil
+	}
+}
+
+// WithHTTPTransport option can be passed to New in order to set a custom HTTP
+// transport (http.RoundTripper implementation)
+func WithHTTPTransport(httpTransport http.RoundTripper) Option {
+	return func(c *Client) error {
+		c.httpClient.Transport = httpTransport
+		return nil
+	}
+}
+
+// WithRetries option can be passed to New in order to control how many times
+// failed requests are retried and how long to wait between retries, only
+// requests that fail with a network error or a 5xx status code are retried,
+// requests creating silences are never retried, default is 2 retries with 1s
+// wait
+func WithRetries(retries int, wait time.Duration) Option {
+	return func(c *Client) error {
+		if retries < 0 {
+			return fmt.Errorf("Invalid number of retries: %d", retries)
+		}
+		c.retries = retries
+		c.retryWait = wait
+		return nil
+	}
+}
+
+// WithBasicAuth option can be passed to New in order to send basic auth
+// credentials with every request
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) error {
+		c.username = username
+		c.password = password
+		return nil
+	}
+}
+
+// AlertsQuery holds all arguments that can be passed to the alerts endpoint,
+// all fields are optional
+type AlertsQuery struct {
+	// Filters is the list of filters, same as used in the UI, example:
+	// []string{"@state=active", "cluster=prod"}
+	Filters []string
+	// GroupBy is the list of label names alerts should be grouped by
+	GroupBy []string
+	// Sort is the list of sort keys, example: []string{"severity", "-startsAt"}
+	Sort []string
+	// Limit is the maximum number of alert groups returned on a single page
+	Limit int
+	// Cursor is the NextCursor value from the previous page
+	Cursor string
+	// Fields is the list of optional fields to include in the response, nil
+	// means all fields and empty slice means none
+	Fields []string
+}
+
+func (q AlertsQuery) values() url.Values {
+	values := url.Values{}
+	if len(q.Filters) > 0 {
+		values.Set("q", strings.Join(q.Filters, ","))
+	}
+	if len(q.GroupBy) > 0 {
+		values.Set("group_by", strings.Join(q.GroupBy, ","))
+	}
+	if len(q.Sort) > 0 {
+		values.Set("sort", strings.Join(q.Sort, ","))
+	}
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Cursor != "" {
+		values.Set("cursor", q.Cursor)
+	}
+	if q.Fields != nil {
+		values.Set("fields", strings.Join(q.Fields, ","))
+	}
+	return values
+}
+
+// Alerts returns a single page of alert groups
+func (c *Client) Alerts(ctx context.Context, query AlertsQuery) (*AlertsResponse, error) {
+	resp := &AlertsResponse{}
+	if err := c.do(ctx, http.MethodGet, "api/v1/alerts", query.values(), nil, true, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// AllAlerts returns alert groups from all pages, it will request pages until
+// there are no more left, all other fields are set from the first page
+func (c *Client) AllAlerts(ctx context.Context, query AlertsQuery) (*AlertsResponse, error) {
+	var result *AlertsResponse
+	for {
+		page, err := c.Alerts(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = page
+		} else {
+			result.Groups = append(result.Groups, page.Groups...)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	result.NextCursor = ""
+	return result, nil
+}
+
+// Autocomplete returns filter hints matching given term
+func (c *Client) Autocomplete(ctx context.Context, term string) ([]string, error) {
+	hints := []string{}
+	if err := c.do(ctx, http.MethodGet, "autocomplete.json", url.Values{"term": []string{term}}, nil, true, &hints); err != nil {
+		return nil, err
+	}
+	return hints, nil
+}
+
+// SilencesQuery holds all arguments that can be passed to the silences
+// endpoint, all fields are optional
+type SilencesQuery struct {
+	Author string
+	// JIRA is the ID of JIRA issue linked in the silence comment
+	JIRA string
+	// Label is label name or name=value pair silence must have a matcher for
+	Label string
+	// State is one of SilenceState* constants
+	State string
+	// ExpiresIn only returns active silences ending within this duration
+	ExpiresIn time.Duration
+	// boolean flags are only used if not nil
+	Unused   *bool
+	Expiring *bool
+	Stale    *bool
+}
+
+func (q SilencesQuery) values() url.Values {
+	values := url.Values{}
+	for name, value := range map[string]string{
+		"author": q.Author,
+		"jira":   q.JIRA,
+		"label":  q.Label,
+		"state":  q.State,
+	} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	if q.ExpiresIn > 0 {
+		values.Set("expiresIn", q.ExpiresIn.String())
+	}
+	for name, value := range map[string]*bool{
+		"unused":   q.Unused,
+		"expiring": q.Expiring,
+		"stale":    q.Stale,
+	} {
+		if value != nil {
+			values.Set(name, strconv.FormatBool(*value))
+		}
+	}
+	return values
+}
+
+// Silences returns silences collected from all Alertmanager instances
+func (c *Client) Silences(ctx context.Context, query SilencesQuery) ([]ManagedSilence, error) {
+	resp := &SilencesResponse{}
+	if err := c.do(ctx, http.MethodGet, "silences.json", query.values(), nil, true, resp); err != nil {
+		return nil, err
+	}
+	return resp.Silences, nil
+}
+
+// PreviewSilence returns all alerts that given silence would match
+func (c *Client) PreviewSilence(ctx context.Context, silence Silence) (*SilencePreviewResponse, error) {
+	resp := &SilencePreviewResponse{}
+	if err := c.do(ctx, http.MethodPost, "api/silences/preview", nil, silence, true, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CreateSilence will create given silence on every listed Alertmanager
+// instance, if it fails on some of them an error is returned along with the
+// response listing results for each instance
+func (c *Client) CreateSilence(ctx context.Context, silence Silence, alertmanagers []string) (*SilenceResponse, error) {
+	resp := &SilenceResponse{}
+	req := SilenceRequest{Silence: silence, Alertmanagers: alertmanagers}
+	// creating silences isn't idempotent so it's never retried
+	err := c.do(ctx, http.MethodPost, "api/silences", nil, req, false, resp)
+	if err != nil && len(resp.Results) == 0 {
+		return nil, err
+	}
+	return resp, err
+}
+
+func (c *Client) endpointURL(endpoint string, query url.Values) string {
+	u := *c.uri
+	u.Path = path.Join("/", u.Path, endpoint)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// do sends a request to unsee and decodes JSON response into out, body is
+// encoded as JSON if not nil, out is also decoded for error responses so that
+// callers can inspect partial results
+func (c *Client) do(ctx context.Context, method, endpoint string, query url.Values, body interface{}, retry bool, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	retries := 0
+	if retry {
+		retries = c.retries
+	}
+
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.retryWait):
+			}
+		}
+
+		var status int
+		status, err = c.send(ctx, method, c.endpointURL(endpoint, query), payload, out)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// only retry network errors and server side failures
+		if status != 0 && status < http.StatusInternalServerError {
+			return err
+		}
+	}
+	return err
+}
+
+// send will send a single request and return response status code, which is
+// 0 if no response was received
+func (c *Client) send(ctx context.Context, method, uri string, payload []byte, out interface{}) (int, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		errResp := struct {
+			Error string `json:"error"`
+		}{}
+		if json.Unmarshal(data, &errResp) == nil {
+			apiErr.Message = errResp.Error
+			json.Unmarshal(data, out)
+		}
+		return resp.StatusCode, apiErr
+	}
+
+	if err = json.Unmarshal(data, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("Failed to decode response from %s: %s", uri, err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,365 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/unsee/client"
+)
+
+func newTestClient(t *testing.T, uri string, opts ...client.Option) *client.Client {
+	opts = append([]client.Option{client.WithRetries(2, 0)}, opts...)
+	c, err := client.New(uri, opts...)
+	if err != nil {
+		t.Fatalf("client.New(%s) failed: %s", uri, err)
+	}
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestNewInvalidURI(t *testing.T) {
+	for _, uri := range []string{"", "localhost:8080", "file:///tmp/unsee", "http://%zz"} {
+		if _, err := client.New(uri); err == nil {
+			t.Errorf("client.New(%s) didn't return any error", uri)
+		}
+	}
+	if _, err := client.New("http://localhost", client.WithRetries(-1, 0)); err == nil {
+		t.Error("client.New() with negative retries didn't return any error")
+	}
+}
+
+type alertsQueryTest struct {
+	query  client.AlertsQuery
+	values string
+}
+
+var alertsQueryTests = []alertsQueryTest{
+	{
+		query:  client.AlertsQuery{},
+		values: "",
+	},
+	{
+		query: client.AlertsQuery{
+			Filters: []string{"@state=active", "cluster=prod"},
+			GroupBy: []string{"cluster", "@receiver"},
+			Sort:    []string{"severity", "-startsAt"},
+			Limit:   5,
+			Cursor:  "abc",
+		},
+		values: "cursor=abc&group_by=cluster%2C%40receiver&limit=5&q=%40state%3Dactive%2Ccluster%3Dprod&sort=severity%2C-startsAt",
+	},
+	{
+		query:  client.AlertsQuery{Fields: []string{}},
+		values: "fields=",
+	},
+	{
+		query:  client.AlertsQuery{Fields: []string{client.FieldColors, client.FieldCounters}},
+		values: "fields=colors%2Ccounters",
+	},
+}
+
+func TestAlerts(t *testing.T) {
+	var values string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prefix/api/v1/alerts" {
+			t.Errorf("Invalid request path: %s", r.URL.Path)
+		}
+		values = r.URL.RawQuery
+		writeJSON(w, http.StatusOK, client.AlertsResponse{
+			SchemaVersion: 1,
+			Status:        "success",
+			Groups: []client.AlertGroup{
+				client.AlertGroup{ID: "1", Alerts: []client.Alert{client.Alert{Labels: map[string]string{"alertname": "Foo"}}}},
+			},
+			TotalGroups: 1,
+			TotalAlerts: 1,
+		})
+	}))
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL+"/prefix/")
+	for _, testCase := range alertsQueryTests {
+		resp, err := c.Alerts(context.Background(), testCase.query)
+		if err != nil {
+			t.Errorf("Alerts(%v) failed: %s", testCase.query, err)
+			continue
+		}
+		if values != testCase.values {
+			t.Errorf("Alerts(%v) sent invalid query args, expected '%s', got '%s'", testCase.query, testCase.values, values)
+		}
+		if resp.TotalAlerts != 1 || len(resp.Groups) != 1 || resp.Groups[0].Alerts[0].Labels["alertname"] != "Foo" {
+			t.Errorf("Alerts(%v) returned invalid response: %v", testCase.query, resp)
+		}
+	}
+}
+
+func TestAllAlerts(t *testing.T) {
+	pages := map[string]client.AlertsResponse{
+		"":   client.AlertsResponse{Groups: []client.AlertGroup{client.AlertGroup{ID: "1"}, client.AlertGroup{ID: "2"}}, NextCursor: "p2", TotalGroups: 5},
+		"p2": client.AlertsResponse{Groups: []client.AlertGroup{client.AlertGroup{ID: "3"}, client.AlertGroup{ID: "4"}}, NextCursor: "p3", TotalGroups: 5},
+		"p3": client.AlertsResponse{Groups: []client.AlertGroup{client.AlertGroup{ID: "5"}}, TotalGroups: 5},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("limit") != "2" {
+			t.Errorf("Invalid limit query arg: %s", r.URL.RawQuery)
+		}
+		page, found := pages[r.URL.Query().Get("cursor")]
+		if !found {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"status": "error", "error": "Invalid cursor"})
+			return
+		}
+		writeJSON(w, http.StatusOK, page)
+	}))
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL)
+	resp, err := c.AllAlerts(context.Background(), client.AlertsQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("AllAlerts() failed: %s", err)
+	}
+	ids := []string{}
+	for _, ag := range resp.Groups {
+		ids = append(ids, ag.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "2", "3", "4", "5"}) {
+		t.Errorf("AllAlerts() returned invalid groups: %v", ids)
+	}
+	if resp.NextCursor != "" || resp.TotalGroups != 5 {
+		t.Errorf("AllAlerts() returned nextCursor='%s' totalGroups=%d", resp.NextCursor, resp.TotalGroups)
+	}
+
+	if _, err := c.AllAlerts(context.Background(), client.AlertsQuery{Limit: 2, Cursor: "foo"}); err == nil {
+		t.Error("AllAlerts() with invalid cursor didn't return any error")
+	}
+}
+
+func TestAutocomplete(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/autocomplete.json" {
+			t.Errorf("Invalid request path: %s", r.URL.Path)
+		}
+		term := r.URL.Query().Get("term")
+		if term == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing term=<token> parameter"})
+			return
+		}
+		writeJSON(w, http.StatusOK, []string{term + "=foo", term + "=bar"})
+	}))
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL)
+	hints, err := c.Autocomplete(context.Background(), "cluster")
+	if err != nil {
+		t.Fatalf("Autocomplete() failed: %s", err)
+	}
+	if !reflect.DeepEqual(hints, []string{"cluster=foo", "cluster=bar"}) {
+		t.Errorf("Autocomplete() returned invalid hints: %v", hints)
+	}
+
+	_, err = c.Autocomplete(context.Background(), "")
+	if apiErr, ok := err.(*client.Error); !ok || apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "missing term=<token> parameter" {
+		t.Errorf("Autocomplete() with empty term returned invalid error: %v", err)
+	}
+}
+
+func TestSilences(t *testing.T) {
+	var values string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/silences.json" {
+			t.Errorf("Invalid request path: %s", r.URL.Path)
+		}
+		values = r.URL.RawQuery
+		silence := client.ManagedSilence{State: client.SilenceStateActive, AlertCount: 2}
+		silence.ID = "abc"
+		writeJSON(w, http.StatusOK, client.SilencesResponse{Status: "success", Silences: []client.ManagedSilence{silence}})
+	}))
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL)
+	stale := false
+	silences, err := c.Silences(context.Background(), client.SilencesQuery{
+		Author:    "me@example.com",
+		State:     client.SilenceStateActive,
+		ExpiresIn: time.Hour,
+		Stale:     &stale,
+	})
+	if err != nil {
+		t.Fatalf("Silences() failed: %s", err)
+	}
+	if expected := "author=me%40example.com&expiresIn=1h0m0s&stale=false&state=active"; values != expected {
+		t.Errorf("Silences() sent invalid query args, expected '%s', got '%s'", expected, values)
+	}
+	if len(silences) != 1 || silences[0].ID != "abc" || silences[0].AlertCount != 2 {
+		t.Errorf("Silences() returned invalid silences: %v", silences)
+	}
+}
+
+func TestPreviewSilence(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/silences/preview" {
+			t.Errorf("Invalid request: %s %s", r.Method, r.URL.Path)
+		}
+		silence := client.Silence{}
+		json.NewDecoder(r.Body).Decode(&silence)
+		writeJSON(w, http.StatusOK, client.SilencePreviewResponse{
+			Status:   "success",
+			Counters: client.SilencePreviewCounters{Total: len(silence.Matchers)},
+		})
+	}))
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL)
+	silence := client.Silence{Matchers: []client.Matcher{client.Matcher{Name: "alertname", Value: "Foo"}}}
+	resp, err := c.PreviewSilence(context.Background(), silence)
+	if err != nil {
+		t.Fatalf("PreviewSilence() failed: %s", err)
+	}
+	if resp.Counters.Total != 1 {
+		t.Errorf("PreviewSilence() returned invalid response: %v", resp)
+	}
+}
+
+func TestCreateSilence(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		req := client.SilenceRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := client.SilenceResponse{Status: "success"}
+		code := http.StatusOK
+		for _, am := range req.Alertmanagers {
+			if am == "broken" {
+				resp.Results = append(resp.Results, client.SilenceResult{Alertmanager: am, Error: "timeout"})
+				resp.Status = "error"
+				resp.Error = "Failed to create silence on some Alertmanager instances"
+				code = http.StatusBadGateway
+			} else {
+				resp.Results = append(resp.Results, client.SilenceResult{Alertmanager: am, SilenceID: req.Silence.Comment})
+			}
+		}
+		writeJSON(w, code, resp)
+	}))
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL)
+	silence := client.Silence{Comment: "abc"}
+	resp, err := c.CreateSilence(context.Background(), silence, []string{"default"})
+	if err != nil {
+		t.Fatalf("CreateSilence() failed: %s", err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].SilenceID != "abc" {
+		t.Errorf("CreateSilence() returned invalid response: %v", resp)
+	}
+
+	// partial failures should return results along with the error and should
+	// never be retried
+	atomic.StoreInt32(&requests, 0)
+	resp, err = c.CreateSilence(context.Background(), silence, []string{"default", "broken"})
+	if apiErr, ok := err.(*client.Error); !ok || apiErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("CreateSilence() returned invalid error: %v", err)
+	}
+	if resp == nil || len(resp.Results) != 2 || resp.Results[1].Error != "timeout" {
+		t.Errorf("CreateSilence() returned invalid response: %v", resp)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("CreateSilence() sent %d request(s), expected 1", n)
+	}
+}
+
+type retryTest struct {
+	retries  int
+	failures int
+	code     int
+	requests int32
+	failed   bool
+}
+
+var retryTests = []retryTest{
+	{retries: 2, failures: 2, code: http.StatusInternalServerError, requests: 3, failed: false},
+	{retries: 1, failures: 2, code: http.StatusServiceUnavailable, requests: 2, failed: true},
+	{retries: 0, failures: 1, code: http.StatusInternalServerError, requests: 1, failed: true},
+	{retries: 2, failures: 1, code: http.StatusBadRequest, requests: 1, failed: true},
+	{retries: 2, failures: 1, code: http.StatusUnauthorized, requests: 1, failed: true},
+}
+
+func TestRetries(t *testing.T) {
+	for _, testCase := range retryTests {
+		var requests int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&requests, 1)
+			if int(n) <= testCase.failures {
+				writeJSON(w, testCase.code, map[string]string{"error": fmt.Sprintf("failure %d", n)})
+				return
+			}
+			writeJSON(w, http.StatusOK, []string{})
+		}))
+
+		c := newTestClient(t, ts.URL, client.WithRetries(testCase.retries, time.Millisecond))
+		_, err := c.Autocomplete(context.Background(), "foo")
+		if (err != nil) != testCase.failed {
+			t.Errorf("%v: got error '%v'", testCase, err)
+		}
+		if n := atomic.LoadInt32(&requests); n != testCase.requests {
+			t.Errorf("%v: sent %d request(s), expected %d", testCase, n, testCase.requests)
+		}
+		ts.Close()
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	done := make(chan bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(time.Second * 5):
+		}
+		writeJSON(w, http.StatusOK, []string{})
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	c := newTestClient(t, ts.URL, client.WithRetries(0, 0))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if _, err := c.Autocomplete(ctx, "foo"); err != context.DeadlineExceeded {
+		t.Errorf("Autocomplete() with context timeout returned invalid error: %v", err)
+	}
+
+	c = newTestClient(t, ts.URL, client.WithRetries(0, 0), client.WithTimeout(time.Millisecond*50))
+	if _, err := c.Autocomplete(context.Background(), "foo"); err == nil {
+		t.Error("Autocomplete() with client timeout didn't return any error")
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "john" || password != "secret" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+			return
+		}
+		writeJSON(w, http.StatusOK, []string{})
+	}))
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL, client.WithBasicAuth("john", "secret"))
+	if _, err := c.Autocomplete(context.Background(), "foo"); err != nil {
+		t.Errorf("Autocomplete() with basic auth failed: %s", err)
+	}
+	c = newTestClient(t, ts.URL)
+	if _, err := c.Autocomplete(context.Background(), "foo"); err == nil {
+		t.Error("Autocomplete() without basic auth didn't return any error")
+	}
+}
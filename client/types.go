@@ -0,0 +1,48 @@
+package client
+
+import "github.com/cloudflare/unsee/api/v1"
+
+// types used in unsee API requests and responses, those are re-exported from
+// the v1 package so that users of this package don't need to import it
+type (
+	AlertsResponse         = v1.AlertsResponse
+	AlertGroup             = v1.AlertGroup
+	Alert                  = v1.Alert
+	Annotation             = v1.Annotation
+	Link                   = v1.Link
+	AlertmanagerInstance   = v1.AlertmanagerInstance
+	InhibitingAlert        = v1.InhibitingAlert
+	AlertmanagerSummary    = v1.AlertmanagerSummary
+	AlertmanagerCounters   = v1.AlertmanagerCounters
+	AlertmanagerStatus     = v1.AlertmanagerStatus
+	Color                  = v1.Color
+	LabelColors            = v1.LabelColors
+	LabelsColorMap         = v1.LabelsColorMap
+	LabelsCountMap         = v1.LabelsCountMap
+	Filter                 = v1.Filter
+	FilterError            = v1.FilterError
+	Silence                = v1.Silence
+	Matcher                = v1.Matcher
+	ManagedSilence         = v1.ManagedSilence
+	SilencesResponse       = v1.SilencesResponse
+	SilenceRequest         = v1.SilenceRequest
+	SilenceResult          = v1.SilenceResult
+	SilenceResponse        = v1.SilenceResponse
+	SilencePreviewCounters = v1.SilencePreviewCounters
+	SilencePreviewResponse = v1.SilencePreviewResponse
+)
+
+// Silence states, those are returned in the State field of ManagedSilence
+const (
+	SilenceStateActive  = v1.SilenceStateActive
+	SilenceStatePending = v1.SilenceStatePending
+	SilenceStateExpired = v1.SilenceStateExpired
+)
+
+// Names of optional fields that can be passed in AlertsQuery.Fields
+const (
+	FieldColors    = v1.FieldColors
+	FieldCounters  = v1.FieldCounters
+	FieldFilters   = v1.FieldFilters
+	FieldUpstreams = v1.FieldUpstreams
+)
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/alertmanager"
+	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/discovery"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// upstreamDiscovery is a single discovery mechanism created from the config
+// together with options used for every Alertmanager instance it finds
+type upstreamDiscovery struct {
+	name       string
+	discoverer discovery.Discoverer
+	options    upstreamOptions
+	// refresh is set for discovery mechanisms that need to be polled, it's
+	// called before every pull from Alertmanager
+	refresh func(ctx context.Context) (bool, error)
+	// watch is set for discovery mechanisms that are notified about changes
+	watch func(ctx context.Context, onChange func())
+}
+
+var (
+	// discoveries holds all discovery mechanisms created from the config, it's
+	// only modified on startup and from the background loop
+	discoveries = []upstreamDiscovery{}
+
+	// discoveryCancel will stop all running discovery watches
+	discoveryCancel = func() {}
+
+	// discoveryUpdates is used to tell the background loop that discovered
+	// targets have changed and the list of Alertmanager instances needs to be
+	// updated
+	discoveryUpdates = make(chan bool, 1)
+
+	// discoveryRefreshTimeout is how long to wait for a discovery mechanism
+	// to fetch the list of targets
+	discoveryRefreshTimeout = time.Minute
+
+	// newKubernetesClient is used to create Kubernetes API clients, tests can
+	// replace it with a fake
+	newKubernetesClient = discovery.NewKubernetesAPIClient
+
+	// dnsResolver is used by DNS discovery, tests can replace it with an
+	// in-memory resolver
+	dnsResolver discovery.Resolver = net.DefaultResolver
+)
+
+// requestDiscoverySync will schedule an update of discovered Alertmanager
+// instances, it never blocks
+func requestDiscoverySync() {
+	select {
+	case discoveryUpdates <- true:
+	default:
+	}
+}
+
+// newDiscoveries creates all discovery mechanisms from the config and fetches
+// the initial list of targets, failing to fetch targets is not an error since
+// watches will keep retrying
+func newDiscoveries() ([]upstreamDiscovery, error) {
+	ds := []upstreamDiscovery{}
+	for _, s := range config.Config().Alertmanager.Servers {
+		if !discovery.IsDNSURI(s.URI) {
+			continue
+		}
+		dd, err := discovery.NewDNSDiscovery(s.Name, s.URI, dnsResolver)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create DNS discovery for Alertmanager '%s': %s", s.Name, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), discoveryRefreshTimeout)
+		_, err = dd.Refresh(ctx)
+		cancel()
+		if err != nil {
+			log.Errorf("DNS discovery for Alertmanager '%s' failed to resolve records: %s", s.Name, err)
+		}
+
+		ds = append(ds, upstreamDiscovery{
+			name:       fmt.Sprintf("DNS discovery for '%s'", s.Name),
+			discoverer: dd,
+			options: upstreamOptions{
+				cluster: s.Cluster,
+				timeout: s.Timeout,
+				proxy:   s.Proxy,
+				tlsCA:   s.TLS.CA,
+				tlsCert: s.TLS.Cert,
+				tlsKey:  s.TLS.Key,
+			},
+			refresh: dd.Refresh,
+		})
+	}
+	for _, f := range config.Config().Alertmanager.Discovery.File {
+		fd, err := discovery.NewFileDiscovery(discovery.FileConfig{
+			Files:  f.Files,
+			Scheme: f.Scheme,
+			Path:   f.Path,
+			Name:   f.Name,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create file discovery for %v: %s", f.Files, err)
+		}
+
+		_, err = fd.Refresh(context.Background())
+		if err != nil {
+			log.Errorf("File discovery for %v failed to read target files: %s", f.Files, err)
+		}
+
+		ds = append(ds, upstreamDiscovery{
+			name:       fmt.Sprintf("file discovery for %v", f.Files),
+			discoverer: fd,
+			options: upstreamOptions{
+				cluster: f.Cluster,
+				timeout: f.Timeout,
+				proxy:   f.Proxy,
+				tlsCA:   f.TLS.CA,
+				tlsCert: f.TLS.Cert,
+				tlsKey:  f.TLS.Key,
+			},
+			refresh: fd.Refresh,
+			watch:   fd.Watch,
+		})
+	}
+	for _, k := range config.Config().Alertmanager.Discovery.Kubernetes {
+		client, err := newKubernetesClient(k.APIServer, k.Kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create Kubernetes discovery for selector '%s': %s", k.Selector, err)
+		}
+		kd, err := discovery.NewKubernetesDiscovery(client, discovery.KubernetesConfig{
+			Namespace: k.Namespace,
+			Selector:  k.Selector,
+			Port:      k.Port,
+			Scheme:    k.Scheme,
+			Path:      k.Path,
+			Name:      k.Name,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create Kubernetes discovery for selector '%s': %s", k.Selector, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), discoveryRefreshTimeout)
+		_, err = kd.Refresh(ctx)
+		cancel()
+		if err != nil {
+			log.Errorf("Kubernetes discovery for selector '%s' failed to list endpoints: %s", k.Selector, err)
+		}
+
+		ds = append(ds, upstreamDiscovery{
+			name:       fmt.Sprintf("Kubernetes discovery for selector '%s'", k.Selector),
+			discoverer: kd,
+			options: upstreamOptions{
+				cluster: k.Cluster,
+				timeout: k.Timeout,
+				proxy:   k.Proxy,
+				tlsCA:   k.TLS.CA,
+				tlsCert: k.TLS.Cert,
+				tlsKey:  k.TLS.Key,
+			},
+			watch: kd.Watch,
+		})
+	}
+	return ds, nil
+}
+
+// startDiscoveries will stop all running discovery watches and start watches
+// for passed discovery mechanisms
+func startDiscoveries(ds []upstreamDiscovery) {
+	discoveryCancel()
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, d := range ds {
+		if d.watch != nil {
+			go d.watch(ctx, requestDiscoverySync)
+		}
+	}
+	discoveries = ds
+	discoveryCancel = cancel
+}
+
+func setupDiscoveries() {
+	ds, err := newDiscoveries()
+	if err != nil {
+		log.Fatal(err)
+	}
+	startDiscoveries(ds)
+}
+
+// refreshDiscoveries will refresh targets of all discovery mechanisms that
+// need to be polled, it returns true if targets of any of them have changed
+func refreshDiscoveries() bool {
+	changed := false
+	for _, d := range discoveries {
+		if d.refresh == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), discoveryRefreshTimeout)
+		c, err := d.refresh(ctx)
+		cancel()
+		if err != nil {
+			log.Errorf("%s failed, keeping last known targets: %s", d.name, err)
+		}
+		changed = changed || c
+	}
+	return changed
+}
+
+// discoveredUpstreams creates Alertmanager instances for all discovered
+// targets, targets with a name or URI already used by another instance are
+// skipped
+func discoveredUpstreams(configured []*alertmanager.Alertmanager, reusable map[string]*alertmanager.Alertmanager) ([]*alertmanager.Alertmanager, error) {
+	names := map[string]bool{}
+	uris := map[string]bool{}
+	for _, am := range configured {
+		names[am.Name] = true
+		uris[am.URI] = true
+	}
+
+	upstreams := []*alertmanager.Alertmanager{}
+	for _, d := range discoveries {
+		targets, err := d.discoverer.Targets()
+		if err != nil {
+			log.Errorf("Failed to get targets from %s: %s", d.name, err)
+			continue
+		}
+		for _, target := range targets {
+			if names[target.Name] || uris[target.URI] {
+				log.Warningf("[%s] Alertmanager found by %s conflicts with another instance, skipping it", target.Name, d.name)
+				continue
+			}
+			names[target.Name] = true
+			uris[target.URI] = true
+
+			if am, found := reusable[target.Name]; found && am.URI == target.URI && am.Cluster == d.options.cluster {
+				upstreams = append(upstreams, am)
+				continue
+			}
+			am, err := newUpstream(target.Name, target.URI, d.options)
+			if err != nil {
+				return nil, err
+			}
+			upstreams = append(upstreams, am)
+		}
+	}
+	return upstreams, nil
+}
+
+// syncUpstreams will update the list of Alertmanager instances with currently
+// discovered targets, it returns true if the list has changed
+func syncUpstreams() (bool, error) {
+	current := alertmanager.GetAlertmanagers()
+	reusable := map[string]*alertmanager.Alertmanager{}
+	for _, am := range current {
+		reusable[am.Name] = am
+	}
+
+	upstreams, err := newUpstreams(reusable)
+	if err != nil {
+		return false, err
+	}
+
+	changed := len(upstreams) != len(current)
+	for _, am := range upstreams {
+		if reusable[am.Name] != am {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	err = alertmanager.SetAlertmanagers(upstreams)
+	if err != nil {
+		return false, err
+	}
+	err = setupProxies(upstreams)
+	if err != nil {
+		alertmanager.SetAlertmanagers(current)
+		return false, err
+	}
+	apiCache.Flush()
+	return true, nil
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/alertmanager"
+	"github.com/cloudflare/unsee/internal/discovery"
+
+	cache "github.com/patrickmn/go-cache"
+)
+
+type fakeKubernetesClient struct {
+	lock   sync.Mutex
+	list   discovery.EndpointsList
+	events chan discovery.EndpointsEvent
+}
+
+func (c *fakeKubernetesClient) ListEndpoints(ctx context.Context, namespace, selector string) (*discovery.EndpointsList, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	list := c.list
+	return &list, nil
+}
+
+func (c *fakeKubernetesClient) WatchEndpoints(ctx context.Context, namespace, selector, resourceVersion string) (<-chan discovery.EndpointsEvent, error) {
+	return c.events, nil
+}
+
+func alertmanagerEndpoints(pods ...string) discovery.Endpoints {
+	subset := discovery.EndpointSubset{Ports: []discovery.EndpointPort{discovery.EndpointPort{Name: "web", Port: 9093}}}
+	for _, pod := range pods {
+		subset.Addresses = append(subset.Addresses, discovery.EndpointAddress{
+			IP:        "10.0.0." + pod[len(pod)-1:],
+			TargetRef: &discovery.ObjectReference{Kind: "Pod", Name: pod, Namespace: "monitoring"},
+		})
+	}
+	return discovery.Endpoints{
+		Metadata: discovery.ObjectMeta{Namespace: "monitoring", Name: "alertmanager"},
+		Subsets:  []discovery.EndpointSubset{subset},
+	}
+}
+
+const discoveryTestConfig = `alertmanager:
+  interval: 1m
+  servers:
+    - name: default
+      uri: http://localhost
+      timeout: 40s
+  discovery:
+    kubernetes:
+      - namespace: monitoring
+        selector: app=alertmanager
+        port: web
+        name: "k8s-{{ .Pod }}"
+        proxy: true
+`
+
+func TestKubernetesDiscoveryUpstreams(t *testing.T) {
+	mockConfig()
+	if apiCache == nil {
+		apiCache = cache.New(cache.NoExpiration, 10*time.Second)
+	}
+
+	client := &fakeKubernetesClient{
+		list: discovery.EndpointsList{
+			Items: []discovery.Endpoints{alertmanagerEndpoints("alertmanager-1", "alertmanager-2")},
+		},
+		events: make(chan discovery.EndpointsEvent),
+	}
+	defer func(f func(string, string) (discovery.KubernetesClient, error)) { newKubernetesClient = f }(newKubernetesClient)
+	newKubernetesClient = func(apiServer, kubeconfig string) (discovery.KubernetesClient, error) {
+		return client, nil
+	}
+
+	dir, err := ioutil.TempDir("", "unsee-discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("CONFIG_DIR", dir)
+	defer func() {
+		os.Unsetenv("CONFIG_DIR")
+		if err := reloadConfig(); err != nil {
+			t.Errorf("Failed to restore original config: %s", err)
+		}
+		if len(discoveries) != 0 {
+			t.Errorf("Expected no discovery after restoring config, got %d", len(discoveries))
+		}
+		if len(alertmanager.GetAlertmanagers()) != 1 {
+			t.Errorf("Expected 1 Alertmanager after restoring config, got %d", len(alertmanager.GetAlertmanagers()))
+		}
+	}()
+
+	err = ioutil.WriteFile(path.Join(dir, "unsee.yaml"), []byte(discoveryTestConfig), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() failed: %s", err)
+	}
+
+	for _, name := range []string{"default", "k8s-alertmanager-1", "k8s-alertmanager-2"} {
+		if alertmanager.GetAlertmanagerByName(name) == nil {
+			t.Errorf("Alertmanager '%s' isn't registered", name)
+		}
+	}
+	am := alertmanager.GetAlertmanagerByName("k8s-alertmanager-1")
+	if am == nil || am.URI != "http://10.0.0.1:9093" || !am.ProxyRequests {
+		t.Fatalf("Invalid discovered Alertmanager: %v", am)
+	}
+
+	// second replica is gone and a new one is added
+	client.events <- discovery.EndpointsEvent{
+		Type:   discovery.WatchEventModified,
+		Object: alertmanagerEndpoints("alertmanager-1", "alertmanager-3"),
+	}
+	select {
+	case <-discoveryUpdates:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timeout waiting for discovery update")
+	}
+	changed, err := syncUpstreams()
+	if err != nil || !changed {
+		t.Fatalf("syncUpstreams() returned changed=%v err=%v", changed, err)
+	}
+	if alertmanager.GetAlertmanagerByName("k8s-alertmanager-2") != nil {
+		t.Error("Alertmanager 'k8s-alertmanager-2' is still registered")
+	}
+	if alertmanager.GetAlertmanagerByName("k8s-alertmanager-3") == nil {
+		t.Error("Alertmanager 'k8s-alertmanager-3' isn't registered")
+	}
+	if alertmanager.GetAlertmanagerByName("k8s-alertmanager-1") != am {
+		t.Error("Alertmanager 'k8s-alertmanager-1' wasn't reused")
+	}
+	proxiesLock.RLock()
+	_, found := proxies["k8s-alertmanager-3"]
+	proxiesLock.RUnlock()
+	if !found {
+		t.Error("Proxy for Alertmanager 'k8s-alertmanager-3' wasn't created")
+	}
+
+	if changed, err = syncUpstreams(); err != nil || changed {
+		t.Errorf("syncUpstreams() without any changes returned changed=%v err=%v", changed, err)
+	}
+
+	// reload without any changes keeps discovered instances
+	if err = reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() failed: %s", err)
+	}
+	if alertmanager.GetAlertmanagerByName("k8s-alertmanager-1") != am {
+		t.Error("Alertmanager 'k8s-alertmanager-1' wasn't reused after reload")
+	}
+}
+
+type fakeResolver struct {
+	lock    sync.Mutex
+	records map[string][]*net.SRV
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	records, found := r.records[name]
+	if !found {
+		return "", nil, fmt.Errorf("lookup %s: no such host", name)
+	}
+	return name, records, nil
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return nil, fmt.Errorf("lookup %s: no such host", host)
+}
+
+const dnsDiscoveryTestConfig = `alertmanager:
+  interval: 1m
+  servers:
+    - name: default
+      uri: http://localhost
+      timeout: 40s
+    - name: ha
+      uri: dns+srv://_alertmanager._tcp.example.com
+      timeout: 10s
+`
+
+func TestDNSDiscoveryUpstreams(t *testing.T) {
+	mockConfig()
+	if apiCache == nil {
+		apiCache = cache.New(cache.NoExpiration, 10*time.Second)
+	}
+
+	resolver := &fakeResolver{
+		records: map[string][]*net.SRV{
+			"_alertmanager._tcp.example.com": []*net.SRV{
+				&net.SRV{Target: "am1.example.com.", Port: 9093},
+				&net.SRV{Target: "am2.example.com.", Port: 9093},
+			},
+		},
+	}
+	defer func(r discovery.Resolver) { dnsResolver = r }(dnsResolver)
+	dnsResolver = resolver
+
+	dir, err := ioutil.TempDir("", "unsee-discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("CONFIG_DIR", dir)
+	defer func() {
+		os.Unsetenv("CONFIG_DIR")
+		if err := reloadConfig(); err != nil {
+			t.Errorf("Failed to restore original config: %s", err)
+		}
+		if len(alertmanager.GetAlertmanagers()) != 1 {
+			t.Errorf("Expected 1 Alertmanager after restoring config, got %d", len(alertmanager.GetAlertmanagers()))
+		}
+	}()
+
+	err = ioutil.WriteFile(path.Join(dir, "unsee.yaml"), []byte(dnsDiscoveryTestConfig), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() failed: %s", err)
+	}
+	if len(alertmanager.GetAlertmanagers()) != 3 {
+		t.Errorf("Expected 3 Alertmanagers after reload, got %d", len(alertmanager.GetAlertmanagers()))
+	}
+	am := alertmanager.GetAlertmanagerByName("ha-am1.example.com:9093")
+	if am == nil || am.URI != "http://am1.example.com:9093" || am.RequestTimeout != time.Second*10 {
+		t.Fatalf("Invalid discovered Alertmanager: %v", am)
+	}
+
+	if refreshDiscoveries() {
+		t.Error("refreshDiscoveries() without DNS changes returned true")
+	}
+
+	resolver.lock.Lock()
+	resolver.records["_alertmanager._tcp.example.com"] = []*net.SRV{
+		&net.SRV{Target: "am1.example.com.", Port: 9093},
+		&net.SRV{Target: "am3.example.com.", Port: 9093},
+	}
+	resolver.lock.Unlock()
+	if !refreshDiscoveries() {
+		t.Fatal("refreshDiscoveries() after DNS change returned false")
+	}
+	if changed, err := syncUpstreams(); err != nil || !changed {
+		t.Fatalf("syncUpstreams() returned changed=%v err=%v", changed, err)
+	}
+	if alertmanager.GetAlertmanagerByName("ha-am1.example.com:9093") != am {
+		t.Error("Alertmanager 'ha-am1.example.com:9093' wasn't reused")
+	}
+	if alertmanager.GetAlertmanagerByName("ha-am2.example.com:9093") != nil {
+		t.Error("Alertmanager 'ha-am2.example.com:9093' is still registered")
+	}
+	if alertmanager.GetAlertmanagerByName("ha-am3.example.com:9093") == nil {
+		t.Error("Alertmanager 'ha-am3.example.com:9093' isn't registered")
+	}
+
+	// failed lookups keep all discovered instances
+	resolver.lock.Lock()
+	delete(resolver.records, "_alertmanager._tcp.example.com")
+	resolver.lock.Unlock()
+	if refreshDiscoveries() {
+		t.Error("refreshDiscoveries() after failed lookup returned true")
+	}
+	if len(alertmanager.GetAlertmanagers()) != 3 {
+		t.Errorf("Expected 3 Alertmanagers after failed lookup, got %d", len(alertmanager.GetAlertmanagers()))
+	}
+}
+
+func TestFileDiscoveryUpstreams(t *testing.T) {
+	mockConfig()
+	if apiCache == nil {
+		apiCache = cache.New(cache.NoExpiration, 10*time.Second)
+	}
+
+	dir, err := ioutil.TempDir("", "unsee-discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	targetsFile := path.Join(dir, "targets.yaml")
+	err = ioutil.WriteFile(targetsFile, []byte("- targets: [am1.example.com:9093, am2.example.com:9093]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("CONFIG_DIR", dir)
+	defer func() {
+		os.Unsetenv("CONFIG_DIR")
+		if err := reloadConfig(); err != nil {
+			t.Errorf("Failed to restore original config: %s", err)
+		}
+		if len(alertmanager.GetAlertmanagers()) != 1 {
+			t.Errorf("Expected 1 Alertmanager after restoring config, got %d", len(alertmanager.GetAlertmanagers()))
+		}
+	}()
+
+	config := "alertmanager:\n  interval: 1m\n  discovery:\n    file:\n      - files: [" + targetsFile + "]\n        timeout: 5s\n        proxy: true\n"
+	err = ioutil.WriteFile(path.Join(dir, "unsee.yaml"), []byte(config), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() failed: %s", err)
+	}
+	// default Alertmanager is still configured via env
+	if len(alertmanager.GetAlertmanagers()) != 3 {
+		t.Errorf("Expected 3 Alertmanagers after reload, got %d", len(alertmanager.GetAlertmanagers()))
+	}
+	am := alertmanager.GetAlertmanagerByName("am1.example.com:9093")
+	if am == nil || am.URI != "http://am1.example.com:9093" || am.RequestTimeout != time.Second*5 || !am.ProxyRequests {
+		t.Fatalf("Invalid discovered Alertmanager: %v", am)
+	}
+
+	err = ioutil.WriteFile(targetsFile, []byte("- targets: [am1.example.com:9093]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !refreshDiscoveries() {
+		t.Fatal("refreshDiscoveries() after target file change returned false")
+	}
+	if changed, err := syncUpstreams(); err != nil || !changed {
+		t.Fatalf("syncUpstreams() returned changed=%v err=%v", changed, err)
+	}
+	if len(alertmanager.GetAlertmanagers()) != 2 {
+		t.Errorf("Expected 2 Alertmanagers after target file change, got %d", len(alertmanager.GetAlertmanagers()))
+	}
+	if alertmanager.GetAlertmanagerByName("am1.example.com:9093") != am {
+		t.Error("Alertmanager 'am1.example.com:9093' wasn't reused")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/history"
+	"github.com/cloudflare/unsee/internal/models"
+
+	"github.com/gin-gonic/gin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// historyStore is used to record alert state changes, it's nil unless alert
+// history is enabled in the config
+var historyStore *history.Store
+
+func setupHistory() {
+	if config.Config().History.Path == "" {
+		return
+	}
+
+	store, err := history.Open(config.Config().History.Path)
+	if err != nil {
+		log.Fatalf("Failed to open alert history database '%s': %s", config.Config().History.Path, err)
+	}
+	historyStore = store
+}
+
+func historyError(c *gin.Context, start time.Time, code int, err string) {
+	c.JSON(code, models.AlertHistoryResponse{
+		Status:    "error",
+		Error:     err,
+		Timelines: []models.AlertTimeline{},
+	})
+	log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), code, c.Request.Method, c.Request.RequestURI, time.Since(start))
+}
+
+// alertHistory endpoint, json, returns recorded state changes for a single
+// alert passed as fingerprint=<labels fingerprint> or for all alerts with
+// labels matching filters passed as q=<filters>
+func alertHistory(c *gin.Context) {
+	noCache(c)
+	start := time.Now()
+
+	if historyStore == nil {
+		historyError(c, start, http.StatusNotFound, "Alert history is not enabled")
+		return
+	}
+
+	resp := models.AlertHistoryResponse{
+		Status:    "success",
+		Timelines: []models.AlertTimeline{},
+	}
+
+	if fingerprint, found := c.GetQuery("fingerprint"); found {
+		timeline, err := historyStore.Timeline(fingerprint)
+		if err != nil {
+			historyError(c, start, http.StatusNotFound, err.Error())
+			return
+		}
+		resp.Timelines = append(resp.Timelines, timeline)
+	} else {
+		expression, filterError := getFiltersFromQuery(c.Query("q"))
+		if filterError != nil {
+			historyError(c, start, http.StatusBadRequest, fmt.Sprintf("Invalid filter expression: %s at position %d", filterError.Message, filterError.Position))
+			return
+		}
+		timelines, err := historyStore.Search(func(labels map[string]string) bool {
+			// only label filters are useful here, history doesn't keep
+			// any other alert attributes
+			alert := models.Alert{Labels: labels}
+			return expression.Match(&alert, 0)
+		})
+		if err != nil {
+			log.Errorf("Failed to read alert history: %s", err)
+			historyError(c, start, http.StatusInternalServerError, err.Error())
+			return
+		}
+		resp.Timelines = timelines
+	}
+
+	c.JSON(http.StatusOK, resp)
+	log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), http.StatusOK, c.Request.Method, c.Request.RequestURI, time.Since(start))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/history"
+	"github.com/cloudflare/unsee/internal/mock"
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+func TestAlertHistoryDisabled(t *testing.T) {
+	mockConfig()
+	r := ginTestEngine()
+	req, _ := http.NewRequest("GET", "/history.json?q=alertname=Host_Down", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("GET /history.json returned status %d with history disabled", resp.Code)
+	}
+}
+
+func TestAlertHistory(t *testing.T) {
+	mockConfig()
+
+	dir, err := ioutil.TempDir("", "unsee-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, version := range mock.ListAllMocks() {
+		t.Logf("Testing alert history using mock files from Alertmanager %s", version)
+
+		store, err := history.Open(path.Join(dir, version+".db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		historyStore = store
+		mockAlerts(version)
+		r := ginTestEngine()
+
+		req, _ := http.NewRequest("GET", "/history.json?q=alertname=Host_Down,cluster=dev", nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("GET /history.json returned status %d", resp.Code)
+		}
+
+		ur := models.AlertHistoryResponse{}
+		json.Unmarshal(resp.Body.Bytes(), &ur)
+		if len(ur.Timelines) != 3 {
+			t.Errorf("[%s] Expected 3 timelines, got %d", version, len(ur.Timelines))
+		}
+		for _, timeline := range ur.Timelines {
+			if timeline.Labels["alertname"] != "Host_Down" || timeline.Labels["cluster"] != "dev" {
+				t.Errorf("[%s] Timeline for alert with unexpected labels: %v", version, timeline.Labels)
+			}
+			if len(timeline.Events) != 1 || timeline.Events[0].Alertmanager != "default" {
+				t.Errorf("[%s] Expected a single event from 'default' Alertmanager, got %v", version, timeline.Events)
+			}
+		}
+
+		if len(ur.Timelines) > 0 {
+			fp := ur.Timelines[0].Fingerprint
+			req, _ := http.NewRequest("GET", "/history.json?fingerprint="+fp, nil)
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			if resp.Code != http.StatusOK {
+				t.Errorf("GET /history.json?fingerprint=%s returned status %d", fp, resp.Code)
+			}
+			ur := models.AlertHistoryResponse{}
+			json.Unmarshal(resp.Body.Bytes(), &ur)
+			if len(ur.Timelines) != 1 || ur.Timelines[0].Fingerprint != fp {
+				t.Errorf("[%s] Expected a single timeline for fingerprint %s, got %v", version, fp, ur.Timelines)
+			}
+		}
+
+		req, _ = http.NewRequest("GET", "/history.json?fingerprint=foo", nil)
+		resp = httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != http.StatusNotFound {
+			t.Errorf("GET /history.json?fingerprint=foo returned status %d", resp.Code)
+		}
+
+		historyStore = nil
+		store.Close()
+	}
+}
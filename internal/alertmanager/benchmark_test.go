@@ -29,7 +29,7 @@ func BenchmarkDedupAutocomplete(b *testing.B) {
 func BenchmarkDedupColors(b *testing.B) {
 	os.Setenv("LABELS_COLOR_UNIQUE", "cluster instance @receiver")
 	os.Setenv("ALERTMANAGER_URI", "http://localhost")
-	config.Config.Read()
+	config.Read()
 	if err := pullAlerts(); err != nil {
 		b.Error(err)
 	}
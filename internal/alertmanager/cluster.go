@@ -0,0 +1,305 @@
+package alertmanager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/slices"
+)
+
+// Cluster is a group of Alertmanager instances that are replicas of each
+// other, all members share silences so they should be presented to the user
+// as a single Alertmanager
+type Cluster struct {
+	Name    string
+	Members []*Alertmanager
+}
+
+// GetClusters returns all defined Alertmanager instances grouped into
+// clusters, clusters are sorted by name
+func GetClusters() []Cluster {
+	return groupClusters(GetAlertmanagers())
+}
+
+// GetClusterByName returns the cluster with given name, if there's no such
+// cluster then the cluster that Alertmanager instance with given name belongs
+// to is returned, nil is returned if neither is found
+func GetClusterByName(name string) *Cluster {
+	clusters := GetClusters()
+	for i, cluster := range clusters {
+		if cluster.Name == name {
+			return &clusters[i]
+		}
+	}
+	for i, cluster := range clusters {
+		for _, am := range cluster.Members {
+			if am.Name == name {
+				return &clusters[i]
+			}
+		}
+	}
+	return nil
+}
+
+// groupClusters will group passed Alertmanager instances into clusters.
+// Instances with a configured cluster name are grouped using that name, all
+// other instances are grouped using peers reported by the status API, two
+// instances are part of the same cluster if either one lists the other as a
+// peer. Detected clusters are named after the member with the lowest name, so
+// the name doesn't change when other replicas are added or removed, instances
+// not peered with any other instance form a single member cluster named after
+// that instance.
+func groupClusters(upstreams []*Alertmanager) []Cluster {
+	ams := make([]*Alertmanager, len(upstreams))
+	copy(ams, upstreams)
+	sort.Slice(ams, func(i, j int) bool {
+		return ams[i].Name < ams[j].Name
+	})
+
+	clusters := []Cluster{}
+	configured := map[string]int{}
+	detected := []*Alertmanager{}
+	for _, am := range ams {
+		if am.Cluster == "" {
+			detected = append(detected, am)
+			continue
+		}
+		i, found := configured[am.Cluster]
+		if !found {
+			i = len(clusters)
+			configured[am.Cluster] = i
+			clusters = append(clusters, Cluster{Name: am.Cluster, Members: []*Alertmanager{}})
+		}
+		clusters[i].Members = append(clusters[i].Members, am)
+	}
+
+	// every detected instance starts in its own group, groups are joined
+	// whenever two instances are peers
+	group := make([]int, len(detected))
+	for i := range group {
+		group[i] = i
+	}
+	root := func(i int) int {
+		for group[i] != i {
+			i = group[i]
+		}
+		return i
+	}
+	for i := range detected {
+		for j := i + 1; j < len(detected); j++ {
+			if arePeers(detected[i], detected[j]) {
+				group[root(j)] = root(i)
+			}
+		}
+	}
+
+	members := map[int][]*Alertmanager{}
+	roots := []int{}
+	for i, am := range detected {
+		r := root(i)
+		if _, found := members[r]; !found {
+			roots = append(roots, r)
+		}
+		members[r] = append(members[r], am)
+	}
+	for _, r := range roots {
+		// instances are sorted so the first member has the lowest name
+		clusters = append(clusters, Cluster{Name: members[r][0].Name, Members: members[r]})
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Name < clusters[j].Name
+	})
+	return clusters
+}
+
+// arePeers returns true if one of passed instances lists the other as its
+// cluster peer, instances with identical peer names are never peers since
+// older Alertmanager versions use MAC addresses as names and those are often
+// identical for unrelated instances running in containers
+func arePeers(a, b *Alertmanager) bool {
+	aName, aPeers := a.peers()
+	bName, bPeers := b.peers()
+	if aName == "" || bName == "" || aName == bName {
+		return false
+	}
+	return slices.StringInSlice(aPeers, bName) || slices.StringInSlice(bPeers, aName)
+}
+
+// MembersByHealth returns all members of the cluster, healthy members are
+// returned first
+func (c *Cluster) MembersByHealth() []*Alertmanager {
+	healthy := []*Alertmanager{}
+	failed := []*Alertmanager{}
+	for _, am := range c.Members {
+		if am.Error() == "" {
+			healthy = append(healthy, am)
+		} else {
+			failed = append(failed, am)
+		}
+	}
+	return append(healthy, failed...)
+}
+
+// Errors returns a list of problems found when comparing data pulled from
+// healthy members of the cluster, like members that don't list each other as
+// peers or silences that are missing on some members
+func (c *Cluster) Errors() []string {
+	errs := []string{}
+
+	healthy := []*Alertmanager{}
+	for _, am := range c.Members {
+		if am.Error() == "" {
+			healthy = append(healthy, am)
+		}
+	}
+
+	for i, a := range healthy {
+		for _, b := range healthy[i+1:] {
+			aName, _ := a.peers()
+			bName, _ := b.peers()
+			// peers are unknown for versions without clustering support
+			if aName == "" || bName == "" {
+				continue
+			}
+			if !arePeers(a, b) {
+				errs = append(errs, fmt.Sprintf("Alertmanager '%s' and '%s' are not cluster peers", a.Name, b.Name))
+			}
+		}
+	}
+
+	// expired silences can be garbage collected at different times so only
+	// active and pending ones are compared
+	now := time.Now()
+	silences := map[string]map[string]bool{}
+	all := map[string]bool{}
+	for _, am := range healthy {
+		silences[am.Name] = map[string]bool{}
+		for _, silence := range am.Silences() {
+			if silence.State(now) == models.SilenceStateExpired {
+				continue
+			}
+			silences[am.Name][silence.ID] = true
+			all[silence.ID] = true
+		}
+	}
+	for _, am := range healthy {
+		missing := 0
+		for id := range all {
+			if !silences[am.Name][id] {
+				missing++
+			}
+		}
+		if missing > 0 {
+			errs = append(errs, fmt.Sprintf("Alertmanager '%s' is missing %d silence(s) found on other cluster members", am.Name, missing))
+		}
+	}
+
+	return errs
+}
+
+// clusterNames returns a map of Alertmanager instance names to the name of
+// the cluster they belong to
+func clusterNames(clusters []Cluster) map[string]string {
+	names := map[string]string{}
+	for _, cluster := range clusters {
+		for _, am := range cluster.Members {
+			names[am.Name] = cluster.Name
+		}
+	}
+	return names
+}
+
+// MergeClusterInstances returns a copy of passed Alertmanager instances where
+// all instances from the same cluster are merged into a single instance named
+// after that cluster, the URI of a healthy member is used if there's any
+func MergeClusterInstances(instances []models.AlertmanagerInstance) []models.AlertmanagerInstance {
+	merged := []models.AlertmanagerInstance{}
+	index := map[string]int{}
+	healthyURI := map[string]bool{}
+	for _, instance := range instances {
+		cluster := instance.Cluster
+		if cluster == "" {
+			cluster = instance.Name
+		}
+		healthy := false
+		if am := GetAlertmanagerByName(instance.Name); am != nil && am.Error() == "" {
+			healthy = true
+		}
+
+		i, found := index[cluster]
+		if !found {
+			index[cluster] = len(merged)
+			healthyURI[cluster] = healthy
+			m := instance
+			m.Name = cluster
+			m.Cluster = cluster
+			m.Members = []string{instance.Name}
+			m.Silences = map[string]models.Silence{}
+			for id, silence := range instance.Silences {
+				m.Silences[id] = silence
+			}
+			m.InhibitedBy = append([]models.InhibitingAlert{}, instance.InhibitedBy...)
+			merged = append(merged, m)
+			continue
+		}
+
+		m := &merged[i]
+		m.Members = append(m.Members, instance.Name)
+		if healthy && !healthyURI[cluster] {
+			m.URI = instance.URI
+			healthyURI[cluster] = true
+		}
+		m.State = mergeAlertStates(m.State, instance.State)
+		if instance.StartsAt.Before(m.StartsAt) {
+			m.StartsAt = instance.StartsAt
+		}
+		if instance.EndsAt.After(m.EndsAt) {
+			m.EndsAt = instance.EndsAt
+		}
+		if m.Source == "" {
+			m.Source = instance.Source
+		}
+		// merged instance is only stale if data from all members is stale
+		if !instance.Stale {
+			m.Stale = false
+			m.StaleSince = time.Time{}
+		} else if m.Stale && instance.StaleSince.After(m.StaleSince) {
+			m.StaleSince = instance.StaleSince
+		}
+		for id, silence := range instance.Silences {
+			m.Silences[id] = silence
+		}
+		for _, inhibitor := range instance.InhibitedBy {
+			known := false
+			for _, existing := range m.InhibitedBy {
+				if existing.Fingerprint == inhibitor.Fingerprint {
+					known = true
+				}
+			}
+			if !known {
+				m.InhibitedBy = append(m.InhibitedBy, inhibitor)
+			}
+		}
+	}
+
+	for i := range merged {
+		sort.Strings(merged[i].Members)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Name < merged[j].Name
+	})
+	return merged
+}
+
+// mergeAlertStates returns the most important of passed alert states
+func mergeAlertStates(a, b string) string {
+	for _, state := range []string{models.AlertStateActive, models.AlertStateSuppressed} {
+		if a == state || b == state {
+			return state
+		}
+	}
+	return models.AlertStateUnprocessed
+}
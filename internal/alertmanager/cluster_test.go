@@ -0,0 +1,253 @@
+package alertmanager
+
+import (
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/mock"
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+type peersTest struct {
+	mockVersion string
+	name        string
+	peers       []string
+}
+
+var peersTests = []peersTest{
+	{mockVersion: "0.5.0", name: "", peers: []string{}},
+	{mockVersion: "0.14.0", name: "02:42:ac:11:00:02", peers: []string{"02:42:ac:11:00:02"}},
+	{mockVersion: "0.16.0", name: "01CBHJQ8X4T0Z1QM7BJ8G3TZ8S", peers: []string{"01CBHJQ8X4T0Z1QM7BJ8G3TZ8S"}},
+}
+
+func TestDetectPeers(t *testing.T) {
+	for _, test := range peersTests {
+		uri := "file://" + path.Dir(mock.GetAbsoluteMockPath("api", test.mockVersion))
+		am, err := NewAlertmanager("test", uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		am.detectVersion()
+		name, peers := am.peers()
+		if name != test.name {
+			t.Errorf("Peer name mismatch for mock %s, expected '%s', got '%s'", test.mockVersion, test.name, name)
+		}
+		if !reflect.DeepEqual(peers, test.peers) {
+			t.Errorf("Peers mismatch for mock %s, expected %v, got %v", test.mockVersion, test.peers, peers)
+		}
+	}
+}
+
+// newPeeredAlertmanager returns an Alertmanager instance that reports passed
+// cluster peers
+func newPeeredAlertmanager(t *testing.T, name, cluster, peerName string, peers ...string) *Alertmanager {
+	am, err := NewAlertmanager(name, "http://"+name, WithCluster(cluster))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := &alertmanagerPeers{Name: peerName}
+	for _, peer := range peers {
+		status.Peers = append(status.Peers, struct {
+			Name string `json:"name"`
+		}{Name: peer})
+	}
+	if peerName != "" {
+		am.setPeers(status)
+	}
+	return am
+}
+
+func clusterMembers(clusters []Cluster) map[string][]string {
+	result := map[string][]string{}
+	for _, cluster := range clusters {
+		result[cluster.Name] = []string{}
+		for _, am := range cluster.Members {
+			result[cluster.Name] = append(result[cluster.Name], am.Name)
+		}
+	}
+	return result
+}
+
+func TestGroupClusters(t *testing.T) {
+	upstreams := []*Alertmanager{
+		// configured cluster, peers are ignored
+		newPeeredAlertmanager(t, "prod2", "prod", "p2", "p1", "p2"),
+		newPeeredAlertmanager(t, "prod1", "prod", "p1", "p1", "p2", "a1"),
+		// detected cluster, only one member lists the other one as a peer
+		newPeeredAlertmanager(t, "am1", "", "a1", "a1", "a2"),
+		newPeeredAlertmanager(t, "am2", "", "a2", "a2"),
+		// detected cluster joined using a common peer
+		newPeeredAlertmanager(t, "am3", "", "a3", "a2", "a3"),
+		// same peer name as another instance, not a peer
+		newPeeredAlertmanager(t, "dev1", "", "d1", "d1"),
+		newPeeredAlertmanager(t, "dev2", "", "d1", "d1"),
+		// no peers reported
+		newPeeredAlertmanager(t, "old", "", ""),
+	}
+
+	expected := map[string][]string{
+		"prod": []string{"prod1", "prod2"},
+		"am1":  []string{"am1", "am2", "am3"},
+		"dev1": []string{"dev1"},
+		"dev2": []string{"dev2"},
+		"old":  []string{"old"},
+	}
+	clusters := groupClusters(upstreams)
+	if got := clusterMembers(clusters); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Invalid clusters, expected %v, got %v", expected, got)
+	}
+	for i := 1; i < len(clusters); i++ {
+		if clusters[i-1].Name > clusters[i].Name {
+			t.Errorf("Clusters are not sorted: %s > %s", clusters[i-1].Name, clusters[i].Name)
+		}
+	}
+
+	// cluster name must not change when a replica goes away
+	expected = map[string][]string{"am1": []string{"am1", "am2"}}
+	clusters = groupClusters(upstreams[2:4])
+	if got := clusterMembers(clusters); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Invalid clusters after removing a member, expected %v, got %v", expected, got)
+	}
+}
+
+func TestClusterErrors(t *testing.T) {
+	now := time.Now()
+	active := models.Silence{ID: "active", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}
+	expired := models.Silence{ID: "expired", StartsAt: now.Add(-time.Hour * 2), EndsAt: now.Add(-time.Hour)}
+
+	am1 := newPeeredAlertmanager(t, "am1", "prod", "a1", "a1", "a2")
+	am1.silences = map[string]models.Silence{active.ID: active, expired.ID: expired}
+	am2 := newPeeredAlertmanager(t, "am2", "prod", "a2", "a1", "a2")
+	am2.silences = map[string]models.Silence{active.ID: active}
+	am3 := newPeeredAlertmanager(t, "am3", "prod", "a3", "a3")
+	am3.silences = map[string]models.Silence{}
+	failed := newPeeredAlertmanager(t, "failed", "prod", "f1", "f1")
+	failed.setError("connection refused")
+
+	type clusterErrorsTest struct {
+		members []*Alertmanager
+		errors  []string
+	}
+	for _, test := range []clusterErrorsTest{
+		{
+			members: []*Alertmanager{am1, am2},
+			errors:  []string{},
+		},
+		{
+			members: []*Alertmanager{am1, am2, failed},
+			errors:  []string{},
+		},
+		{
+			members: []*Alertmanager{am1, am3},
+			errors: []string{
+				"Alertmanager 'am1' and 'am3' are not cluster peers",
+				"Alertmanager 'am3' is missing 1 silence(s) found on other cluster members",
+			},
+		},
+	} {
+		cluster := Cluster{Name: "prod", Members: test.members}
+		if errs := cluster.Errors(); !reflect.DeepEqual(errs, test.errors) {
+			t.Errorf("Invalid errors for %v, expected %v, got %v", clusterMembers([]Cluster{cluster}), test.errors, errs)
+		}
+	}
+
+	cluster := Cluster{Name: "prod", Members: []*Alertmanager{failed, am1, am2}}
+	members := []string{}
+	for _, am := range cluster.MembersByHealth() {
+		members = append(members, am.Name)
+	}
+	if expected := []string{"am1", "am2", "failed"}; !reflect.DeepEqual(members, expected) {
+		t.Errorf("MembersByHealth() returned %v while %v was expected", members, expected)
+	}
+}
+
+func TestMergeClusterInstances(t *testing.T) {
+	t1 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	instances := []models.AlertmanagerInstance{
+		models.AlertmanagerInstance{
+			Name:        "prod2",
+			URI:         "http://prod2",
+			Cluster:     "prod",
+			Stale:       true,
+			StaleSince:  t1,
+			State:       models.AlertStateSuppressed,
+			StartsAt:    t1,
+			EndsAt:      t1,
+			Silences:    map[string]models.Silence{"s1": models.Silence{ID: "s1"}},
+			InhibitedBy: []models.InhibitingAlert{},
+		},
+		models.AlertmanagerInstance{
+			Name:        "dev",
+			URI:         "http://dev",
+			Cluster:     "dev",
+			State:       models.AlertStateUnprocessed,
+			Silences:    map[string]models.Silence{},
+			InhibitedBy: []models.InhibitingAlert{},
+		},
+		models.AlertmanagerInstance{
+			Name:       "prod1",
+			URI:        "http://prod1",
+			Cluster:    "prod",
+			Stale:      true,
+			StaleSince: t2,
+			State:      models.AlertStateActive,
+			StartsAt:   t2,
+			EndsAt:     t2,
+			Source:     "http://prometheus",
+			Silences: map[string]models.Silence{
+				"s1": models.Silence{ID: "s1"},
+				"s2": models.Silence{ID: "s2"},
+			},
+			InhibitedBy: []models.InhibitingAlert{models.InhibitingAlert{Fingerprint: "fp1"}},
+		},
+	}
+
+	expected := []models.AlertmanagerInstance{
+		models.AlertmanagerInstance{
+			Name:        "dev",
+			URI:         "http://dev",
+			Cluster:     "dev",
+			Members:     []string{"dev"},
+			State:       models.AlertStateUnprocessed,
+			Silences:    map[string]models.Silence{},
+			InhibitedBy: []models.InhibitingAlert{},
+		},
+		models.AlertmanagerInstance{
+			Name:       "prod",
+			URI:        "http://prod2",
+			Cluster:    "prod",
+			Members:    []string{"prod1", "prod2"},
+			Stale:      true,
+			StaleSince: t2,
+			State:      models.AlertStateActive,
+			StartsAt:   t1,
+			EndsAt:     t2,
+			Source:     "http://prometheus",
+			Silences: map[string]models.Silence{
+				"s1": models.Silence{ID: "s1"},
+				"s2": models.Silence{ID: "s2"},
+			},
+			InhibitedBy: []models.InhibitingAlert{models.InhibitingAlert{Fingerprint: "fp1"}},
+		},
+	}
+	merged := MergeClusterInstances(instances)
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Invalid merged instances, expected %+v, got %+v", expected, merged)
+	}
+	// passed instances are not modified
+	if len(instances[0].Silences) != 1 {
+		t.Errorf("Silences of passed instance were modified: %v", instances[0].Silences)
+	}
+
+	// merged instance isn't stale if any member has fresh data
+	instances[2].Stale = false
+	instances[2].StaleSince = time.Time{}
+	for _, m := range MergeClusterInstances(instances) {
+		if m.Name == "prod" && (m.Stale || !m.StaleSince.IsZero()) {
+			t.Errorf("Merged instance is stale while only some members are: %+v", m)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package alertmanager
 
 import (
+	"fmt"
 	"sort"
+	"time"
 
 	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/filters"
 	"github.com/cloudflare/unsee/internal/models"
 	"github.com/cloudflare/unsee/internal/slices"
 	"github.com/cloudflare/unsee/internal/transform"
+	"github.com/cnf/structhash"
 )
 
 // DedupAlerts will collect alert groups from all defined Alertmanager
@@ -15,7 +19,12 @@ func DedupAlerts() []models.AlertGroup {
 	uniqueGroups := map[string][]models.AlertGroup{}
 
 	upstreams := GetAlertmanagers()
+	clusters := clusterNames(groupClusters(upstreams))
+	staleSince := map[string]time.Time{}
 	for _, am := range upstreams {
+		if stale, lastPull := am.Stale(); stale {
+			staleSince[am.Name] = lastPull
+		}
 		groups := am.Alerts()
 		for _, ag := range groups {
 			if _, found := uniqueGroups[ag.ID]; !found {
@@ -33,7 +42,7 @@ func DedupAlerts() []models.AlertGroup {
 			for _, alert := range ag.Alerts {
 				// remove all alerts for receiver(s) that the user doesn't
 				// want to see in the UI
-				if transform.StripReceivers(config.Config.Receivers.Keep, config.Config.Receivers.Strip, alert.Receiver) {
+				if transform.StripReceivers(config.Config().Receivers.Keep, config.Config().Receivers.Strip, alert.Receiver) {
 					continue
 				}
 				alertLFP := alert.LabelsFingerprint()
@@ -54,6 +63,16 @@ func DedupAlerts() []models.AlertGroup {
 					if alert.EndsAt.After(a.EndsAt) {
 						a.EndsAt = alert.EndsAt
 					}
+					// merge fingerprints of inhibiting alerts, a new slice is
+					// needed since the old one is shared with the upstream
+					inhibitedBy := append([]string{}, a.InhibitedBy...)
+					for _, fp := range alert.InhibitedBy {
+						if !slices.StringInSlice(inhibitedBy, fp) {
+							inhibitedBy = append(inhibitedBy, fp)
+						}
+					}
+					sort.Strings(inhibitedBy)
+					a.InhibitedBy = inhibitedBy
 					// update map
 					alerts[alertLFP] = a
 					// and append alert state to the slice
@@ -73,7 +92,7 @@ func DedupAlerts() []models.AlertGroup {
 		ag.Alerts = models.AlertList{}
 		for _, alert := range alerts {
 			// strip labels user doesn't want to see in the UI
-			alert.Labels = transform.StripLables(config.Config.Labels.Keep, config.Config.Labels.Strip, alert.Labels)
+			alert.Labels = transform.StripLables(config.Config().Labels.Keep, config.Config().Labels.Strip, alert.Labels)
 			// calculate final alert state based on the most important value found
 			// in the list of states from all instances
 			alertLFP := alert.LabelsFingerprint()
@@ -84,6 +103,11 @@ func DedupAlerts() []models.AlertGroup {
 			} else {
 				alert.State = models.AlertStateUnprocessed
 			}
+			alert.Alertmanager = resolveInhibitors(alert.Alertmanager, upstreams)
+			for i, am := range alert.Alertmanager {
+				alert.Alertmanager[i].Cluster = clusters[am.Name]
+				alert.Alertmanager[i].StaleSince, alert.Alertmanager[i].Stale = staleSince[am.Name]
+			}
 			// sort Alertmanager instances for every alert
 			sort.Slice(alert.Alertmanager, func(i, j int) bool {
 				return alert.Alertmanager[i].Name < alert.Alertmanager[j].Name
@@ -104,6 +128,109 @@ func DedupAlerts() []models.AlertGroup {
 	return dedupedGroups
 }
 
+// DedupSilences will collect silences from all defined Alertmanager upstreams
+// and deduplicate them, identical silences from clustered Alertmanager
+// instances will be returned once
+func DedupSilences() []models.ManagedSilence {
+	now := time.Now()
+	silences := dedupSilences(now)
+	markSilences(silences, now)
+	return silences
+}
+
+func dedupSilences(now time.Time) []models.ManagedSilence {
+	uniqueSilences := map[string]*models.ManagedSilence{}
+	// fingerprints of all alerts matched by each unique silence
+	matchedAlerts := map[string]map[string]bool{}
+
+	for _, am := range GetAlertmanagers() {
+		alerts := map[string]models.Alert{}
+		for _, ag := range am.Alerts() {
+			for _, alert := range ag.Alerts {
+				alerts[alert.LabelsFingerprint()] = alert
+			}
+		}
+
+		for _, silence := range am.Silences() {
+			key := fmt.Sprintf("%x", structhash.Sha1(silence, 1))
+			ms, found := uniqueSilences[key]
+			if !found {
+				ms = &models.ManagedSilence{
+					Silence:       silence,
+					State:         silence.State(now),
+					Alertmanagers: []string{},
+				}
+				uniqueSilences[key] = ms
+				matchedAlerts[key] = map[string]bool{}
+			}
+			ms.Alertmanagers = append(ms.Alertmanagers, am.Name)
+			for fp, alert := range alerts {
+				if filters.SilenceMatchesAlert(&silence, &alert) {
+					matchedAlerts[key][fp] = true
+				}
+			}
+		}
+	}
+
+	dedupedSilences := []models.ManagedSilence{}
+	for key, ms := range uniqueSilences {
+		ms.AlertCount = len(matchedAlerts[key])
+		sort.Strings(ms.Alertmanagers)
+		dedupedSilences = append(dedupedSilences, *ms)
+	}
+
+	// silences ending first are returned first, use ID to make the order stable
+	sort.Slice(dedupedSilences, func(i, j int) bool {
+		if dedupedSilences[i].EndsAt.Equal(dedupedSilences[j].EndsAt) {
+			return dedupedSilences[i].ID < dedupedSilences[j].ID
+		}
+		return dedupedSilences[i].EndsAt.Before(dedupedSilences[j].EndsAt)
+	})
+
+	return dedupedSilences
+}
+
+// resolveInhibitors returns a copy of Alertmanager instances with labels of
+// all inhibiting alerts filled in
+func resolveInhibitors(instances []models.AlertmanagerInstance, upstreams []*Alertmanager) []models.AlertmanagerInstance {
+	resolved := make([]models.AlertmanagerInstance, len(instances))
+	for i, instance := range instances {
+		resolved[i] = instance
+		if len(instance.InhibitedBy) == 0 {
+			continue
+		}
+		resolved[i].InhibitedBy = make([]models.InhibitingAlert, len(instance.InhibitedBy))
+		for j, inhibitor := range instance.InhibitedBy {
+			if am := findInhibitor(inhibitor.Fingerprint, instance.Name, upstreams); am != nil {
+				labels, _ := am.alertLabels(inhibitor.Fingerprint)
+				inhibitor.Labels = transform.StripLables(config.Config().Labels.Keep, config.Config().Labels.Strip, labels)
+				inhibitor.Alertmanager = am.Name
+			}
+			resolved[i].InhibitedBy[j] = inhibitor
+		}
+	}
+	return resolved
+}
+
+// findInhibitor returns the upstream that has an alert with given fingerprint,
+// the instance that reported the inhibited alert is checked first since
+// inhibition is evaluated by every Alertmanager using its own alerts
+func findInhibitor(fingerprint, name string, upstreams []*Alertmanager) *Alertmanager {
+	for _, am := range upstreams {
+		if am.Name == name {
+			if _, found := am.alertLabels(fingerprint); found {
+				return am
+			}
+		}
+	}
+	for _, am := range upstreams {
+		if _, found := am.alertLabels(fingerprint); found {
+			return am
+		}
+	}
+	return nil
+}
+
 // DedupColors returns a color map merged from all Alertmanager upstream color
 // maps
 func DedupColors() models.LabelsColorMap {
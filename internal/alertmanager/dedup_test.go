@@ -1,14 +1,22 @@
 package alertmanager_test
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/cloudflare/unsee/internal/alertmanager"
 	"github.com/cloudflare/unsee/internal/config"
 	"github.com/cloudflare/unsee/internal/mock"
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/transform"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -55,12 +63,14 @@ func TestDedupAlerts(t *testing.T) {
 }
 
 func TestDedupAlertsWithoutLabels(t *testing.T) {
-	config.Config.Labels.Keep = []string{"xyz"}
+	defer config.Set(config.Config())
+	cfg := *config.Config()
+	cfg.Labels.Keep = []string{"xyz"}
+	config.Set(&cfg)
 	if err := pullAlerts(); err != nil {
 		t.Error(err)
 	}
 	alertGroups := alertmanager.DedupAlerts()
-	config.Config.Labels.Keep = []string{}
 
 	if len(alertGroups) != 10 {
 		t.Errorf("Expected %d alert groups, got %d", 10, len(alertGroups))
@@ -75,6 +85,155 @@ func TestDedupAlertsWithoutLabels(t *testing.T) {
 	}
 }
 
+func TestDedupRelabeledAlerts(t *testing.T) {
+	cfg := *config.Config()
+	cfg.Receivers.Strip = []string{}
+	config.Set(&cfg)
+	if err := pullAlerts(); err != nil {
+		t.Fatal(err)
+	}
+	hostDown := 0
+	for _, ag := range alertmanager.DedupAlerts() {
+		for _, alert := range ag.Alerts {
+			if alert.Labels["alertname"] == "Host_Down" {
+				hostDown++
+			}
+		}
+	}
+	if hostDown == 0 {
+		t.Fatal("No Host_Down alerts found in mock files")
+	}
+
+	err := transform.ParseRelabelRules([]models.RelabelRule{
+		models.RelabelRule{Action: "drop", SourceLabels: []string{"alertname"}, Regex: "Host_Down"},
+		models.RelabelRule{SourceLabels: []string{"instance"}, TargetLabel: "host"},
+		models.RelabelRule{Action: "labeldrop", Regex: "instance"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transform.ParseRelabelRules([]models.RelabelRule{})
+	if err := pullAlerts(); err != nil {
+		t.Fatal(err)
+	}
+
+	totalAlerts := 0
+	for _, ag := range alertmanager.DedupAlerts() {
+		if len(ag.Alerts) == 0 {
+			t.Errorf("Alert group without any alert: %v", ag.Labels)
+		}
+		if _, found := ag.Labels["instance"]; found {
+			t.Errorf("Alert group wasn't relabeled: %v", ag.Labels)
+		}
+		for _, alert := range ag.Alerts {
+			totalAlerts++
+			if alert.Labels["alertname"] == "Host_Down" {
+				t.Errorf("Dropped alert found: %v", alert.Labels)
+			}
+			if _, found := alert.Labels["instance"]; found {
+				t.Errorf("Alert wasn't relabeled: %v", alert.Labels)
+			}
+			if alert.Labels["host"] == "" {
+				t.Errorf("Alert is missing relabeled host label: %v", alert.Labels)
+			}
+		}
+	}
+	if totalAlerts != 24-hostDown {
+		t.Errorf("Expected %d total alerts, got %d", 24-hostDown, totalAlerts)
+	}
+}
+
+func TestDedupKeepRelabeledAlerts(t *testing.T) {
+	cfg := *config.Config()
+	cfg.Receivers.Strip = []string{}
+	config.Set(&cfg)
+	if err := pullAlerts(); err != nil {
+		t.Fatal(err)
+	}
+	groups := len(alertmanager.DedupAlerts())
+	nodeExporter := 0
+	for _, ag := range alertmanager.DedupAlerts() {
+		for _, alert := range ag.Alerts {
+			if alert.Labels["job"] == "node_exporter" {
+				nodeExporter++
+			}
+		}
+	}
+	if nodeExporter == 0 {
+		t.Fatal("No node_exporter alerts found in mock files")
+	}
+
+	// job label is never used for grouping, so this rule must only apply to
+	// alerts and not to alert groups
+	err := transform.ParseRelabelRules([]models.RelabelRule{
+		models.RelabelRule{Action: "keep", SourceLabels: []string{"job"}, Regex: "node_exporter"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transform.ParseRelabelRules([]models.RelabelRule{})
+	if err := pullAlerts(); err != nil {
+		t.Fatal(err)
+	}
+
+	alertGroups := alertmanager.DedupAlerts()
+	if len(alertGroups) <= 1 || len(alertGroups) >= groups {
+		t.Errorf("Expected between 1 and %d alert groups, got %d", groups, len(alertGroups))
+	}
+	totalAlerts := 0
+	for _, ag := range alertGroups {
+		if ag.Labels["alertname"] == "" {
+			t.Errorf("Alert group labels were dropped: %v", ag.Labels)
+		}
+		for _, alert := range ag.Alerts {
+			totalAlerts++
+			if alert.Labels["job"] != "node_exporter" {
+				t.Errorf("Alert that should be dropped found: %v", alert.Labels)
+			}
+		}
+	}
+	if totalAlerts != nodeExporter {
+		t.Errorf("Expected %d total alerts, got %d", nodeExporter, totalAlerts)
+	}
+}
+
+func TestDedupRelabeledGroupLabels(t *testing.T) {
+	// instance label is only present on alerts, so key will be different for
+	// alerts in the same group
+	err := transform.ParseRelabelRules([]models.RelabelRule{
+		models.RelabelRule{SourceLabels: []string{"alertname", "instance"}, Regex: "(.*);(.*)", TargetLabel: "key", Replacement: "$1-$2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transform.ParseRelabelRules([]models.RelabelRule{})
+	if err := pullAlerts(); err != nil {
+		t.Fatal(err)
+	}
+
+	mixed := 0
+	for _, ag := range alertmanager.DedupAlerts() {
+		keys := map[string]bool{}
+		for _, alert := range ag.Alerts {
+			keys[alert.Labels["key"]] = true
+			for name, value := range ag.Labels {
+				if alert.Labels[name] != value {
+					t.Errorf("Alert group label %s=%s doesn't match alert labels %v", name, value, alert.Labels)
+				}
+			}
+		}
+		if len(keys) > 1 {
+			mixed++
+			if _, found := ag.Labels["key"]; found {
+				t.Errorf("Alert group has key label while its alerts have different values: %v", ag.Labels)
+			}
+		}
+	}
+	if mixed == 0 {
+		t.Error("No alert group with different instance labels found in mock files")
+	}
+}
+
 func TestDedupAutocomplete(t *testing.T) {
 	if err := pullAlerts(); err != nil {
 		t.Error(err)
@@ -82,10 +241,11 @@ func TestDedupAutocomplete(t *testing.T) {
 	ac := alertmanager.DedupAutocomplete()
 	// since we have alertmanager instance per mock adding new mocks will increase
 	// the number of hints, so we need to calculate the expected value here
-	// there should be 56 hints excluding @alertmanager ones, use that as our base
-	// and add 2 hints per alertmanager instance (= and != hints)
+	// there should be 60 hints excluding @alertmanager and @cluster ones, use
+	// that as our base and add 2 hints per alertmanager instance (= and !=
+	// hints) and 2 more for the cluster every instance forms on its own
 	mockCount := len(mock.ListAllMockURIs())
-	expected := 56 + mockCount*2
+	expected := 60 + mockCount*4
 	if len(ac) != expected {
 		t.Errorf("Expected %d autocomplete hints, got %d", expected, len(ac))
 	}
@@ -94,7 +254,7 @@ func TestDedupAutocomplete(t *testing.T) {
 func TestDedupColors(t *testing.T) {
 	os.Setenv("LABELS_COLOR_UNIQUE", "cluster instance @receiver")
 	os.Setenv("ALERTMANAGER_URI", "http://localhost")
-	config.Config.Read()
+	config.Read()
 	if err := pullAlerts(); err != nil {
 		t.Error(err)
 	}
@@ -108,7 +268,7 @@ func TestDedupColors(t *testing.T) {
 func TestStripReceivers(t *testing.T) {
 	os.Setenv("RECEIVERS_STRIP", "by-name by-cluster-service")
 	os.Setenv("ALERTMANAGER_URI", "http://localhost")
-	config.Config.Read()
+	config.Read()
 	if err := pullAlerts(); err != nil {
 		t.Error(err)
 	}
@@ -117,3 +277,210 @@ func TestStripReceivers(t *testing.T) {
 		t.Errorf("Expected no alerts after stripping all receivers, got %d", len(alerts))
 	}
 }
+
+// copyMock will copy all mock files for given version to a temporary
+// directory, files will be passed to the modify function before writing
+func copyMock(t *testing.T, version string, modify func(name string, content []byte) []byte) string {
+	dir, err := ioutil.TempDir("", "unsee-mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := mock.GetAbsoluteMockPath("", version)
+	err = filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		dst := path.Join(dir, rel)
+		if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dst, modify(rel, content), 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestDedupInhibitedAlerts(t *testing.T) {
+	// mark the first alert as inhibited by the second one
+	dir := copyMock(t, "0.16.0", func(name string, content []byte) []byte {
+		if name != "api/v2/alerts/groups" {
+			return content
+		}
+		return bytes.Replace(content,
+			[]byte(`"inhibitedBy": [],
+                    "silencedBy": [],
+                    "state": "active"`),
+			[]byte(`"inhibitedBy": ["54c2f185e49cfccb", "0000000000000000"],
+                    "silencedBy": [],
+                    "state": "suppressed"`), 1)
+	})
+	defer os.RemoveAll(dir)
+
+	// previous tests might have stripped all receivers
+	cfg := *config.Config()
+	cfg.Receivers.Strip = []string{}
+	config.Set(&cfg)
+
+	upstreams := alertmanager.GetAlertmanagers()
+	defer alertmanager.SetAlertmanagers(upstreams)
+
+	am, err := alertmanager.NewAlertmanager("inhibited", "file://"+dir, alertmanager.WithRequestTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := alertmanager.SetAlertmanagers([]*alertmanager.Alertmanager{am}); err != nil {
+		t.Fatal(err)
+	}
+	if err := am.Pull(); err != nil {
+		t.Fatal(err)
+	}
+
+	inhibited := 0
+	for _, ag := range alertmanager.DedupAlerts() {
+		for _, alert := range ag.Alerts {
+			if !alert.IsInhibited() {
+				continue
+			}
+			inhibited++
+			expected := []models.InhibitingAlert{
+				{Fingerprint: "0000000000000000"},
+				{
+					Fingerprint: "54c2f185e49cfccb",
+					Labels: map[string]string{
+						"alertname": "HTTP_Probe_Failed",
+						"cluster":   "dev",
+						"instance":  "web1",
+						"job":       "node_exporter",
+					},
+					Alertmanager: "inhibited",
+				},
+			}
+			if !reflect.DeepEqual(alert.Alertmanager[0].InhibitedBy, expected) {
+				t.Errorf("Invalid inhibiting alerts, expected %v, got %v", expected, alert.Alertmanager[0].InhibitedBy)
+			}
+		}
+	}
+	if inhibited != 1 {
+		t.Errorf("Expected 1 inhibited alert, got %d", inhibited)
+	}
+}
+
+func TestDedupSilences(t *testing.T) {
+	// two instances of the same cluster will return the same silences
+	upstreams := alertmanager.GetAlertmanagers()
+	defer alertmanager.SetAlertmanagers(upstreams)
+
+	dir := copyMock(t, "0.16.0", func(name string, content []byte) []byte {
+		return content
+	})
+	defer os.RemoveAll(dir)
+
+	uris := map[string]string{
+		"cluster1": "file://" + mock.GetAbsoluteMockPath("", "0.16.0"),
+		"cluster2": "file://" + dir,
+	}
+	cluster := []*alertmanager.Alertmanager{}
+	for name, uri := range uris {
+		am, err := alertmanager.NewAlertmanager(name, uri, alertmanager.WithRequestTimeout(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cluster = append(cluster, am)
+	}
+	if err := alertmanager.SetAlertmanagers(cluster); err != nil {
+		t.Fatal(err)
+	}
+	if err := pullAlerts(); err != nil {
+		t.Fatal(err)
+	}
+
+	silences := alertmanager.DedupSilences()
+	if len(silences) != 3 {
+		t.Fatalf("Expected %d silences, got %d", 3, len(silences))
+	}
+	alertCounts := map[string]int{
+		"9a32b09e-0c74-4f69-8ad9-600bdcc7b4cc": 1,
+		"1167d99e-60dd-4576-b514-64cf03891be2": 3,
+		"f70e2eae-1d71-497b-9dd1-3d83b30aaf63": 1,
+	}
+	for _, silence := range silences {
+		if !reflect.DeepEqual(silence.Alertmanagers, []string{"cluster1", "cluster2"}) {
+			t.Errorf("[%s] Invalid list of Alertmanager instances: %v", silence.ID, silence.Alertmanagers)
+		}
+		if silence.State != models.SilenceStateActive {
+			t.Errorf("[%s] Expected state %s, got %s", silence.ID, models.SilenceStateActive, silence.State)
+		}
+		if silence.AlertCount != alertCounts[silence.ID] {
+			t.Errorf("[%s] Expected %d matching alerts, got %d", silence.ID, alertCounts[silence.ID], silence.AlertCount)
+		}
+	}
+}
+
+func TestCheckSilences(t *testing.T) {
+	// make the web1 silence match a host that doesn't have any alert
+	dir := copyMock(t, "0.16.0", func(name string, content []byte) []byte {
+		if !strings.HasSuffix(name, "/silences") {
+			return content
+		}
+		return bytes.Replace(content, []byte(`"value": "web1"`), []byte(`"value": "web999"`), 1)
+	})
+	defer os.RemoveAll(dir)
+
+	upstreams := alertmanager.GetAlertmanagers()
+	defer alertmanager.SetAlertmanagers(upstreams)
+	am, err := alertmanager.NewAlertmanager("checks", "file://"+dir, alertmanager.WithRequestTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := alertmanager.SetAlertmanagers([]*alertmanager.Alertmanager{am}); err != nil {
+		t.Fatal(err)
+	}
+
+	defer config.Set(config.Config())
+	// all mock silences end in 2063, so use a long horizon to mark them as
+	// expiring
+	cfg := *config.Config()
+	cfg.Silences.Expiring = time.Hour * 24 * 365 * 100
+	cfg.Silences.Stale = time.Nanosecond
+	cfg.Receivers.Strip = []string{}
+	config.Set(&cfg)
+
+	if err := pullAlerts(); err != nil {
+		t.Fatal(err)
+	}
+	alertmanager.CheckSilences()
+	time.Sleep(time.Millisecond)
+
+	unused := "9a32b09e-0c74-4f69-8ad9-600bdcc7b4cc"
+	silences := alertmanager.DedupSilences()
+	if len(silences) != 3 {
+		t.Fatalf("Expected %d silences, got %d", 3, len(silences))
+	}
+	for _, silence := range silences {
+		if silence.ID == unused {
+			if !silence.Stale || silence.Expiring {
+				t.Errorf("[%s] Unused silence should be stale and not expiring: %v", silence.ID, silence)
+			}
+		} else if silence.Stale || !silence.Expiring {
+			t.Errorf("[%s] Silence with alerts should be expiring and not stale: %v", silence.ID, silence)
+		}
+	}
+
+	// both checks are disabled with 0 duration
+	disabled := *config.Config()
+	disabled.Silences.Expiring = 0
+	disabled.Silences.Stale = 0
+	config.Set(&disabled)
+	for _, silence := range alertmanager.DedupSilences() {
+		if silence.Stale || silence.Expiring {
+			t.Errorf("[%s] Silence was marked with checks disabled: %v", silence.ID, silence)
+		}
+	}
+}
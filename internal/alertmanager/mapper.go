@@ -2,6 +2,7 @@ package alertmanager
 
 import (
 	"github.com/cloudflare/unsee/internal/mapper"
+	"github.com/cloudflare/unsee/internal/mapper/v016"
 	"github.com/cloudflare/unsee/internal/mapper/v04"
 	"github.com/cloudflare/unsee/internal/mapper/v05"
 	"github.com/cloudflare/unsee/internal/mapper/v061"
@@ -14,6 +15,11 @@ func init() {
 	mapper.RegisterAlertMapper(v05.AlertMapper{})
 	mapper.RegisterAlertMapper(v061.AlertMapper{})
 	mapper.RegisterAlertMapper(v062.AlertMapper{})
+	mapper.RegisterAlertMapper(v016.AlertMapper{})
 	mapper.RegisterSilenceMapper(v04.SilenceMapper{})
 	mapper.RegisterSilenceMapper(v05.SilenceMapper{})
+	mapper.RegisterSilenceMapper(v016.SilenceMapper{})
+	mapper.RegisterSilenceCreator(v04.SilenceCreator{})
+	mapper.RegisterSilenceCreator(v05.SilenceCreator{})
+	mapper.RegisterSilenceCreator(v016.SilenceCreator{})
 }
@@ -3,10 +3,12 @@ package alertmanager
 import "github.com/prometheus/client_golang/prometheus"
 
 type unseeCollector struct {
-	collectedAlerts *prometheus.Desc
-	collectedGroups *prometheus.Desc
-	cyclesTotal     *prometheus.Desc
-	errorsTotal     *prometheus.Desc
+	collectedAlerts  *prometheus.Desc
+	collectedGroups  *prometheus.Desc
+	cyclesTotal      *prometheus.Desc
+	errorsTotal      *prometheus.Desc
+	expiringSilences *prometheus.Desc
+	staleSilences    *prometheus.Desc
 }
 
 func newUnseeCollector() *unseeCollector {
@@ -35,6 +37,18 @@ func newUnseeCollector() *unseeCollector {
 			[]string{"alertmanager", "endpoint"},
 			prometheus.Labels{},
 		),
+		expiringSilences: prometheus.NewDesc(
+			"unsee_silences_expiring_count",
+			"Number of silences that will expire soon while still matching some alerts",
+			[]string{"alertmanager"},
+			prometheus.Labels{},
+		),
+		staleSilences: prometheus.NewDesc(
+			"unsee_silences_stale_count",
+			"Number of silences that are not matching any alert for a long time",
+			[]string{"alertmanager"},
+			prometheus.Labels{},
+		),
 	}
 }
 
@@ -43,6 +57,8 @@ func (c *unseeCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.collectedGroups
 	ch <- c.cyclesTotal
 	ch <- c.errorsTotal
+	ch <- c.expiringSilences
+	ch <- c.staleSilences
 }
 
 func (c *unseeCollector) Collect(ch chan<- prometheus.Metric) {
@@ -66,6 +82,20 @@ func (c *unseeCollector) Collect(ch chan<- prometheus.Metric) {
 			)
 		}
 
+		expiring, stale := silenceCheckCounts(am.Name)
+		ch <- prometheus.MustNewConstMetric(
+			c.expiringSilences,
+			prometheus.GaugeValue,
+			expiring,
+			am.Name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			c.staleSilences,
+			prometheus.GaugeValue,
+			stale,
+			am.Name,
+		)
+
 		// receiver name -> count
 		groupsByReceiver := map[string]float64{}
 		// receiver name -> state -> count
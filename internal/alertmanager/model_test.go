@@ -1,7 +1,16 @@
 package alertmanager
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/mock"
+	"github.com/cloudflare/unsee/internal/uri"
 )
 
 type uriTest struct {
@@ -60,3 +69,205 @@ func TestAlertmanagerURI(t *testing.T) {
 		}
 	}
 }
+
+type versionTest struct {
+	mockVersion     string
+	expectedVersion string
+}
+
+var versionTests = []versionTest{
+	// only v1 API is available
+	{
+		mockVersion:     "0.14.0",
+		expectedVersion: "0.14.0",
+	},
+	// both v1 and v2 API are available, v2 should be used
+	{
+		mockVersion:     "0.16.0",
+		expectedVersion: "0.16.0",
+	},
+}
+
+func TestDetectVersion(t *testing.T) {
+	for _, test := range versionTests {
+		uri := "file://" + path.Dir(mock.GetAbsoluteMockPath("api", test.mockVersion))
+		am, err := NewAlertmanager("test", uri)
+		if err != nil {
+			t.Error(err)
+		}
+		version := am.detectVersion()
+		if version != test.expectedVersion {
+			t.Errorf("Version mismatch for mock %s, expected '%s', got '%s'",
+				test.mockVersion, test.expectedVersion, version)
+		}
+	}
+}
+
+func TestAlertFingerprint(t *testing.T) {
+	// fingerprint returned by Alertmanager for this alert in mock files
+	labels := map[string]string{
+		"alertname": "Free_Disk_Space_Too_Low",
+		"cluster":   "staging",
+		"instance":  "server5",
+		"job":       "node_exporter",
+	}
+	if fp := alertFingerprint(labels); fp != "f87343c11c74a3f4" {
+		t.Errorf("alertFingerprint() returned '%s' while 'f87343c11c74a3f4' was expected", fp)
+	}
+}
+
+type staleDataTest struct {
+	cycles      int
+	age         time.Duration
+	lastPull    time.Duration
+	failedPulls int
+	keep        bool
+}
+
+var staleDataTests = []staleDataTest{
+	// no policy configured, data is cleared on first failure
+	{cycles: 0, age: 0, lastPull: time.Minute, failedPulls: 1, keep: false},
+	{cycles: 2, age: 0, lastPull: time.Hour, failedPulls: 1, keep: true},
+	{cycles: 2, age: 0, lastPull: time.Hour, failedPulls: 2, keep: true},
+	{cycles: 2, age: 0, lastPull: time.Hour, failedPulls: 3, keep: false},
+	{cycles: 0, age: time.Hour, lastPull: time.Minute, failedPulls: 100, keep: true},
+	{cycles: 0, age: time.Hour, lastPull: time.Hour * 2, failedPulls: 1, keep: false},
+	{cycles: 2, age: time.Hour, lastPull: time.Minute, failedPulls: 3, keep: false},
+	{cycles: 2, age: time.Hour, lastPull: time.Hour * 2, failedPulls: 1, keep: false},
+	// nothing was ever pulled
+	{cycles: 2, age: time.Hour, lastPull: 0, failedPulls: 1, keep: false},
+}
+
+func TestCanKeepStaleData(t *testing.T) {
+	defer config.Set(config.Config())
+
+	now := time.Now()
+	for _, test := range staleDataTests {
+		cfg := *config.Config()
+		cfg.Alertmanager.Stale.Cycles = test.cycles
+		cfg.Alertmanager.Stale.Age = test.age
+		config.Set(&cfg)
+		lastPull := time.Time{}
+		if test.lastPull > 0 {
+			lastPull = now.Add(-test.lastPull)
+		}
+		if keep := canKeepStaleData(lastPull, test.failedPulls, now); keep != test.keep {
+			t.Errorf("canKeepStaleData() returned %v for %+v", keep, test)
+		}
+	}
+}
+
+func TestPullKeepsStaleData(t *testing.T) {
+	defer config.Set(config.Config())
+	cfg := *config.Config()
+	cfg.Alertmanager.Stale.Cycles = 1
+	config.Set(&cfg)
+
+	am, err := NewAlertmanager("test", "file://"+path.Dir(mock.GetAbsoluteMockPath("api", "0.16.0")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = am.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	alerts := len(am.Alerts())
+	if alerts == 0 {
+		t.Fatal("No alerts pulled from mock")
+	}
+	if stale, _ := am.Stale(); stale {
+		t.Error("Alertmanager is stale after a successful pull")
+	}
+
+	// make all following pulls fail
+	am.URI = "file:///nonexistent"
+	am.reader, err = uri.NewReader(am.URI, am.RequestTimeout, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = am.Pull(); err == nil {
+		t.Fatal("Pull() didn't fail")
+	}
+	stale, lastPull := am.Stale()
+	if !stale || lastPull.IsZero() {
+		t.Errorf("Alertmanager should be stale after first failed pull, got stale=%v lastPull=%v", stale, lastPull)
+	}
+	if am.Error() == "" {
+		t.Error("Error wasn't set after failed pull")
+	}
+	if len(am.Alerts()) != alerts {
+		t.Errorf("Expected %d stale alerts, got %d", alerts, len(am.Alerts()))
+	}
+
+	if err = am.Pull(); err == nil {
+		t.Fatal("Pull() didn't fail")
+	}
+	if stale, _ := am.Stale(); stale {
+		t.Error("Alertmanager is still stale after exceeding the number of failed pulls")
+	}
+	if len(am.Alerts()) != 0 {
+		t.Errorf("Expected no alerts after exceeding the number of failed pulls, got %d", len(am.Alerts()))
+	}
+}
+
+func TestPullIsAtomic(t *testing.T) {
+	defer config.Set(config.Config())
+	cfg := *config.Config()
+	cfg.Alertmanager.Stale.Cycles = 1
+	config.Set(&cfg)
+
+	am, err := NewAlertmanager("test", "file://"+path.Dir(mock.GetAbsoluteMockPath("api", "0.16.0")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = am.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	alerts := len(am.Alerts())
+	silences := len(am.Silences())
+	if alerts == 0 || silences == 0 {
+		t.Fatalf("No alerts or silences pulled from mock, got %d alert group(s) and %d silence(s)", alerts, silences)
+	}
+
+	// upstream with no silences and no alerts endpoint, so pulling silences
+	// succeeds but pulling alerts fails
+	dir, err := ioutil.TempDir("", "unsee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, version := range []string{"v1", "v2"} {
+		status, err := ioutil.ReadFile(mock.GetAbsoluteMockPath(filepath.Join("api", version, "status"), "0.16.0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		empty := `[]`
+		if version == "v1" {
+			empty = `{"status": "success", "data": []}`
+		}
+		for name, content := range map[string][]byte{"status": status, "silences": []byte(empty)} {
+			p := filepath.Join(dir, "api", version, name)
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(p, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	am.URI = "file://" + dir
+	am.reader, err = uri.NewReader(am.URI, am.RequestTimeout, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = am.Pull(); err == nil {
+		t.Fatal("Pull() didn't fail")
+	}
+	if len(am.Alerts()) != alerts {
+		t.Errorf("Expected %d alert group(s) from the last pull, got %d", alerts, len(am.Alerts()))
+	}
+	if len(am.Silences()) != silences {
+		t.Errorf("Expected %d silence(s) from the last pull, got %d", silences, len(am.Silences()))
+	}
+}
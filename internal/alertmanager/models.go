@@ -15,6 +15,7 @@ import (
 	"github.com/cloudflare/unsee/internal/models"
 	"github.com/cloudflare/unsee/internal/transform"
 	"github.com/cloudflare/unsee/internal/uri"
+	"github.com/prometheus/common/model"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -24,6 +25,15 @@ const (
 	labelValueErrorsSilences = "silences"
 )
 
+// alertData holds alert groups and all data derived from them in a single
+// pull, it's stored together with silences only if the whole pull succeeded
+type alertData struct {
+	alertGroups  []models.AlertGroup
+	colors       models.LabelsColorMap
+	autocomplete []models.Autocomplete
+	fingerprints map[string]map[string]string
+}
+
 type alertmanagerMetrics struct {
 	cycles float64
 	errors map[string]float64
@@ -34,6 +44,9 @@ type Alertmanager struct {
 	URI            string        `json:"uri"`
 	RequestTimeout time.Duration `json:"timeout"`
 	Name           string        `json:"name"`
+	// name of the cluster this instance was configured to be part of, if
+	// empty then the cluster is detected using peers from the status API
+	Cluster string `json:"cluster"`
 	// whenever this instance should be proxied
 	ProxyRequests bool `json:"proxyRequests"`
 	// reader instances are specific to URI scheme we collect from
@@ -48,15 +61,67 @@ type Alertmanager struct {
 	silences     map[string]models.Silence
 	colors       models.LabelsColorMap
 	autocomplete []models.Autocomplete
-	lastError    string
+	// labels of every alert indexed by the fingerprint Alertmanager uses for
+	// it, needed to resolve alerts listed in InhibitedBy
+	fingerprints map[string]map[string]string
+	// cluster peer name of this instance and names of all its peers, those
+	// are kept when pulling fails so that cluster membership doesn't change
+	// while some instances are down
+	peerName  string
+	peerNames []string
+	// Alertmanager version detected during the last pull
+	version   string
+	lastError string
+	// time of the last successful pull and the number of pulls that failed
+	// since then, used to decide if previously pulled data can still be used
+	lastPull    time.Time
+	failedPulls int
 	// metrics tracked per alertmanager instance
 	metrics alertmanagerMetrics
 }
 
+// detectVersionV2 will try to read Alertmanager version using the v2 API,
+// it returns an empty string if the v2 API isn't available
+func (am *Alertmanager) detectVersionV2() string {
+	url, err := uri.JoinURL(am.URI, "api/v2/status")
+	if err != nil {
+		log.Errorf("Failed to join url '%s' and path 'api/v2/status': %s", am.SanitizedURI(), err)
+		return ""
+	}
+
+	ver := alertmanagerVersionV2{}
+
+	// older Alertmanager versions don't have the v2 API at all, so failures
+	// here are expected and we only log those on debug level
+	source, err := am.reader.Read(url)
+	if err != nil {
+		log.Debugf("[%s] %s request failed: %s", am.Name, uri.SanitizeURI(url), err)
+		return ""
+	}
+	defer source.Close()
+
+	err = json.NewDecoder(source).Decode(&ver)
+	if err != nil {
+		log.Debugf("[%s] %s failed to decode as JSON: %s", am.Name, uri.SanitizeURI(url), err)
+		return ""
+	}
+
+	if ver.VersionInfo.Version != "" {
+		am.setPeers(ver.Cluster)
+	}
+	return ver.VersionInfo.Version
+}
+
 func (am *Alertmanager) detectVersion() string {
 	// if everything fails assume Alertmanager is at latest possible version
 	defaultVersion := "999.0.0"
 
+	// prefer the v2 API if it's available
+	if version := am.detectVersionV2(); version != "" {
+		log.Infof("[%s] Remote Alertmanager version: %s", am.Name, version)
+		return version
+	}
+
 	url, err := uri.JoinURL(am.URI, "api/v1/status")
 	if err != nil {
 		log.Errorf("Failed to join url '%s' and path 'api/v1/status': %s", am.SanitizedURI(), err)
@@ -90,30 +155,76 @@ func (am *Alertmanager) detectVersion() string {
 		return defaultVersion
 	}
 
+	if ver.Data.ClusterStatus != nil {
+		am.setPeers(ver.Data.ClusterStatus)
+	} else {
+		am.setPeers(ver.Data.MeshStatus)
+	}
+
 	log.Infof("[%s] Remote Alertmanager version: %s", am.Name, ver.Data.VersionInfo.Version)
 	return ver.Data.VersionInfo.Version
 }
 
+// setPeers stores cluster peers reported by the status API, Alertmanager
+// versions without clustering support will pass nil
+func (am *Alertmanager) setPeers(status *alertmanagerPeers) {
+	name := ""
+	peers := []string{}
+	if status != nil {
+		name = status.Name
+		for _, peer := range status.Peers {
+			peers = append(peers, peer.Name)
+		}
+	}
+	sort.Strings(peers)
+
+	am.lock.Lock()
+	am.peerName = name
+	am.peerNames = peers
+	am.lock.Unlock()
+}
+
+// clusterName returns the name of the cluster this instance is part of
+func (am *Alertmanager) clusterName() string {
+	if name, found := clusterNames(GetClusters())[am.Name]; found {
+		return name
+	}
+	if am.Cluster != "" {
+		return am.Cluster
+	}
+	return am.Name
+}
+
+// peers returns the cluster peer name of this instance and names of all its
+// peers
+func (am *Alertmanager) peers() (string, []string) {
+	am.lock.RLock()
+	defer am.lock.RUnlock()
+
+	return am.peerName, am.peerNames
+}
+
 func (am *Alertmanager) clearData() {
 	am.lock.Lock()
 	am.alertGroups = []models.AlertGroup{}
 	am.silences = map[string]models.Silence{}
 	am.colors = models.LabelsColorMap{}
 	am.autocomplete = []models.Autocomplete{}
+	am.fingerprints = map[string]map[string]string{}
 	am.lock.Unlock()
 }
 
-func (am *Alertmanager) pullSilences(version string) error {
+func (am *Alertmanager) pullSilences(version string) (map[string]models.Silence, error) {
 	mapper, err := mapper.GetSilenceMapper(version)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// generate full URL to collect silences from
 	url, err := mapper.AbsoluteURL(am.URI)
 	if err != nil {
 		log.Errorf("[%s] Failed to generate silences endpoint URL: %s", am.Name, err)
-		return err
+		return nil, err
 	}
 	// append query args if mapper needs those
 	queryArgs := mapper.QueryArgs()
@@ -126,29 +237,25 @@ func (am *Alertmanager) pullSilences(version string) error {
 	source, err := am.reader.Read(url)
 	if err != nil {
 		log.Errorf("[%s] %s request failed: %s", am.Name, uri.SanitizeURI(url), err)
-		return err
+		return nil, err
 	}
 	defer source.Close()
 
 	// decode body text
 	silences, err := mapper.Decode(source)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	log.Infof("[%s] Got %d silences(s) in %s", am.Name, len(silences), time.Since(start))
 
-	log.Infof("[%s] Detecting JIRA links in silences (%d)", am.Name, len(silences))
+	log.Infof("[%s] Detecting links in silences (%d)", am.Name, len(silences))
 	silenceMap := map[string]models.Silence{}
 	for _, silence := range silences {
-		silence.JiraID, silence.JiraURL = transform.DetectJIRAs(&silence)
+		silence.Links = transform.DetectSilenceLinks(&silence)
 		silenceMap[silence.ID] = silence
 	}
 
-	am.lock.Lock()
-	am.silences = silenceMap
-	am.lock.Unlock()
-
-	return nil
+	return silenceMap, nil
 }
 
 // this is the URI of this Alertmanager we put in JSON reponse
@@ -156,7 +263,7 @@ func (am *Alertmanager) pullSilences(version string) error {
 func (am *Alertmanager) publicURI() string {
 	if am.ProxyRequests {
 		sub := fmt.Sprintf("/proxy/alertmanager/%s", am.Name)
-		uri := path.Join(config.Config.Listen.Prefix, sub)
+		uri := path.Join(config.Config().Listen.Prefix, sub)
 		if strings.HasSuffix(sub, "/") {
 			// if sub path had trailing slash then add it here, since path.Join will
 			// skip it
@@ -167,17 +274,17 @@ func (am *Alertmanager) publicURI() string {
 	return am.URI
 }
 
-func (am *Alertmanager) pullAlerts(version string) error {
+func (am *Alertmanager) pullAlerts(version string, silenceMap map[string]models.Silence) (*alertData, error) {
 	mapper, err := mapper.GetAlertMapper(version)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// generate full URL to collect alerts from
 	url, err := mapper.AbsoluteURL(am.URI)
 	if err != nil {
 		log.Errorf("[%s] Failed to generate alerts endpoint URL: %s", am.Name, err)
-		return err
+		return nil, err
 	}
 
 	// append query args if mapper needs those
@@ -191,30 +298,49 @@ func (am *Alertmanager) pullAlerts(version string) error {
 	source, err := am.reader.Read(url)
 	if err != nil {
 		log.Errorf("[%s] %s request failed: %s", am.Name, uri.SanitizeURI(url), err)
-		return err
+		return nil, err
 	}
 	defer source.Close()
 
 	// decode body text
 	groups, err := mapper.Decode(source)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	log.Infof("[%s] Got %d alert group(s) in %s", am.Name, len(groups), time.Since(start))
 
 	log.Infof("[%s] Deduplicating alert groups (%d)", am.Name, len(groups))
 	uniqueGroups := map[string]models.AlertGroup{}
 	uniqueAlerts := map[string]map[string]models.Alert{}
+	fingerprints := map[string]map[string]string{}
 	for _, ag := range groups {
+		// group labels are derived from relabeled alerts so they always
+		// match labels of alerts in the group
+		alertLabels := make([]map[string]string, 0, len(ag.Alerts))
+		for _, alert := range ag.Alerts {
+			alertLabels = append(alertLabels, alert.Labels)
+		}
+		groupLabels, relabeled := transform.RelabelGroup(ag.Labels, alertLabels)
+		ag.Labels = groupLabels
 		agID := ag.LabelsFingerprint()
-		if _, found := uniqueGroups[agID]; !found {
-			uniqueGroups[agID] = models.AlertGroup{
-				Receiver: ag.Receiver,
-				Labels:   ag.Labels,
-				ID:       agID,
+		for i, alert := range ag.Alerts {
+			labels := relabeled[i]
+			if labels == nil {
+				continue
 			}
-		}
-		for _, alert := range ag.Alerts {
+			// groups are only created if any alert in it wasn't dropped
+			if _, found := uniqueGroups[agID]; !found {
+				uniqueGroups[agID] = models.AlertGroup{
+					Receiver: ag.Receiver,
+					Labels:   ag.Labels,
+					ID:       agID,
+				}
+			}
+			// Alertmanager references inhibiting alerts using fingerprints
+			// of their original labels
+			fingerprints[alertFingerprint(alert.Labels)] = labels
+			alert.Labels = labels
+
 			if _, found := uniqueAlerts[agID]; !found {
 				uniqueAlerts[agID] = map[string]models.Alert{}
 			}
@@ -229,6 +355,7 @@ func (am *Alertmanager) pullAlerts(version string) error {
 	dedupedGroups := []models.AlertGroup{}
 	colors := models.LabelsColorMap{}
 	autocompleteMap := map[string]models.Autocomplete{}
+	cluster := am.clusterName()
 
 	log.Infof("[%s] Processing unique alert groups (%d)", am.Name, len(uniqueGroups))
 	for _, ag := range uniqueGroups {
@@ -237,20 +364,27 @@ func (am *Alertmanager) pullAlerts(version string) error {
 
 			silences := map[string]models.Silence{}
 			for _, silenceID := range alert.SilencedBy {
-				silence, err := am.SilenceByID(silenceID)
-				if err == nil {
+				if silence, found := silenceMap[silenceID]; found {
 					silences[silenceID] = silence
 				}
 			}
+			// inhibiting alerts are resolved when alerts from all upstreams
+			// are merged, only fingerprints are known here
+			inhibitedBy := []models.InhibitingAlert{}
+			for _, fp := range alert.InhibitedBy {
+				inhibitedBy = append(inhibitedBy, models.InhibitingAlert{Fingerprint: fp})
+			}
 			alert.Alertmanager = []models.AlertmanagerInstance{
 				models.AlertmanagerInstance{
-					Name:     am.Name,
-					URI:      am.publicURI(),
-					State:    alert.State,
-					StartsAt: alert.StartsAt,
-					EndsAt:   alert.EndsAt,
-					Source:   alert.GeneratorURL,
-					Silences: silences,
+					Name:        am.Name,
+					URI:         am.publicURI(),
+					Cluster:     cluster,
+					State:       alert.State,
+					StartsAt:    alert.StartsAt,
+					EndsAt:      alert.EndsAt,
+					Source:      alert.GeneratorURL,
+					Silences:    silences,
+					InhibitedBy: inhibitedBy,
 				},
 			}
 
@@ -259,6 +393,8 @@ func (am *Alertmanager) pullAlerts(version string) error {
 				transform.ColorLabel(colors, k, v)
 			}
 
+			alert.Links = transform.DetectAlertLinks(&alert)
+
 			alert.UpdateFingerprints()
 			alerts = append(alerts, alert)
 		}
@@ -282,13 +418,12 @@ func (am *Alertmanager) pullAlerts(version string) error {
 		autocomplete = append(autocomplete, hint)
 	}
 
-	am.lock.Lock()
-	am.alertGroups = dedupedGroups
-	am.colors = colors
-	am.autocomplete = autocomplete
-	am.lock.Unlock()
-
-	return nil
+	return &alertData{
+		alertGroups:  dedupedGroups,
+		colors:       colors,
+		autocomplete: autocomplete,
+		fingerprints: fingerprints,
+	}, nil
 }
 
 // Pull data from upstream Alertmanager instance
@@ -297,26 +432,90 @@ func (am *Alertmanager) Pull() error {
 
 	version := am.detectVersion()
 
-	err := am.pullSilences(version)
+	// silences and alerts are only stored if both were pulled, so alerts are
+	// never shown next to silences from a different pull
+	silences, err := am.pullSilences(version)
 	if err != nil {
-		am.clearData()
-		am.setError(err.Error())
+		am.pullFailed(err)
 		am.metrics.errors[labelValueErrorsSilences]++
 		return err
 	}
 
-	err = am.pullAlerts(version)
+	alerts, err := am.pullAlerts(version, silences)
 	if err != nil {
-		am.clearData()
-		am.setError(err.Error())
+		am.pullFailed(err)
 		am.metrics.errors[labelValueErrorsAlerts]++
 		return err
 	}
 
+	am.lock.Lock()
+	am.version = version
+	am.silences = silences
+	am.alertGroups = alerts.alertGroups
+	am.colors = alerts.colors
+	am.autocomplete = alerts.autocomplete
+	am.fingerprints = alerts.fingerprints
 	am.lastError = ""
+	am.lastPull = time.Now()
+	am.failedPulls = 0
+	am.lock.Unlock()
 	return nil
 }
 
+// pullFailed records a failed pull, data from the last successful pull is
+// kept for as long as the stale data policy allows it and cleared after that
+func (am *Alertmanager) pullFailed(err error) {
+	am.lock.Lock()
+	am.lastError = err.Error()
+	am.failedPulls++
+	keep := canKeepStaleData(am.lastPull, am.failedPulls, time.Now())
+	if !keep {
+		am.lastPull = time.Time{}
+	}
+	lastPull := am.lastPull
+	am.lock.Unlock()
+
+	if keep {
+		log.Warningf("[%s] Pull failed, keeping data pulled at %s", am.Name, lastPull.Format(time.RFC3339))
+	} else {
+		am.clearData()
+	}
+}
+
+// canKeepStaleData returns true if data pulled at lastPull can still be used
+// after the given number of failed pulls, staleness is limited by both the
+// number of failed pulls and the age of data, a zero limit isn't enforced,
+// stale data is never kept if neither limit is set
+func canKeepStaleData(lastPull time.Time, failedPulls int, now time.Time) bool {
+	policy := config.Config().Alertmanager.Stale
+	if policy.Cycles <= 0 && policy.Age <= 0 {
+		return false
+	}
+	if lastPull.IsZero() {
+		return false
+	}
+	if policy.Cycles > 0 && failedPulls > policy.Cycles {
+		return false
+	}
+	if policy.Age > 0 && now.Sub(lastPull) > policy.Age {
+		return false
+	}
+	return true
+}
+
+// Stale returns true if the last pull from this instance failed and data from
+// an earlier pull is still used, the time of that earlier pull is returned
+// together with it
+func (am *Alertmanager) Stale() (bool, time.Time) {
+	am.lock.RLock()
+	defer am.lock.RUnlock()
+
+	if am.failedPulls > 0 && !am.lastPull.IsZero() {
+		return true, am.lastPull
+	}
+	return false, time.Time{}
+}
+
 // Alerts returns a copy of all alert groups
 func (am *Alertmanager) Alerts() []models.AlertGroup {
 	am.lock.RLock()
@@ -327,6 +526,18 @@ func (am *Alertmanager) Alerts() []models.AlertGroup {
 	return alerts
 }
 
+// Silences returns a copy of all silences
+func (am *Alertmanager) Silences() []models.Silence {
+	am.lock.RLock()
+	defer am.lock.RUnlock()
+
+	silences := make([]models.Silence, 0, len(am.silences))
+	for _, silence := range am.silences {
+		silences = append(silences, silence)
+	}
+	return silences
+}
+
 // SilenceByID allows to query for a silence by it's ID, returns error if not found
 func (am *Alertmanager) SilenceByID(id string) (models.Silence, error) {
 	am.lock.RLock()
@@ -339,6 +550,25 @@ func (am *Alertmanager) SilenceByID(id string) (models.Silence, error) {
 	return s, nil
 }
 
+// alertLabels returns labels of the alert with given Alertmanager fingerprint
+func (am *Alertmanager) alertLabels(fingerprint string) (map[string]string, bool) {
+	am.lock.RLock()
+	defer am.lock.RUnlock()
+
+	labels, found := am.fingerprints[fingerprint]
+	return labels, found
+}
+
+// alertFingerprint returns the fingerprint Alertmanager uses for an alert with
+// given labels
+func alertFingerprint(labels map[string]string) string {
+	ls := model.LabelSet{}
+	for k, v := range labels {
+		ls[model.LabelName(k)] = model.LabelValue(v)
+	}
+	return ls.Fingerprint().String()
+}
+
 // Colors returns a copy of all color maps
 func (am *Alertmanager) Colors() models.LabelsColorMap {
 	am.lock.RLock()
@@ -0,0 +1,94 @@
+package alertmanager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+var (
+	// unusedSilences tracks when each silence was first seen not matching any
+	// alert, it's needed to tell if the silence is stale
+	unusedSilences = map[string]time.Time{}
+	// number of expiring and stale silences found on each Alertmanager
+	// instance during the last check, exported as metrics
+	expiringSilences  = map[string]float64{}
+	staleSilences     = map[string]float64{}
+	silenceChecksLock = sync.RWMutex{}
+)
+
+// CheckSilences will look for silences that are about to expire while still
+// matching some alerts and for silences that don't match any alert for too
+// long, it should be called after pulling data from all upstreams
+func CheckSilences() {
+	now := time.Now()
+	silences := dedupSilences(now)
+
+	silenceChecksLock.Lock()
+	seen := map[string]bool{}
+	for _, silence := range silences {
+		seen[silence.ID] = true
+		if silence.State != models.SilenceStateActive || silence.AlertCount > 0 {
+			delete(unusedSilences, silence.ID)
+		} else if _, found := unusedSilences[silence.ID]; !found {
+			unusedSilences[silence.ID] = now
+		}
+	}
+	// forget about silences that are gone
+	for id := range unusedSilences {
+		if !seen[id] {
+			delete(unusedSilences, id)
+		}
+	}
+	silenceChecksLock.Unlock()
+
+	markSilences(silences, now)
+
+	expiring := map[string]float64{}
+	stale := map[string]float64{}
+	for _, silence := range silences {
+		for _, am := range silence.Alertmanagers {
+			if silence.Expiring {
+				expiring[am]++
+			}
+			if silence.Stale {
+				stale[am]++
+			}
+		}
+	}
+
+	silenceChecksLock.Lock()
+	expiringSilences = expiring
+	staleSilences = stale
+	silenceChecksLock.Unlock()
+}
+
+// markSilences sets Expiring and Stale flags on all passed silences
+func markSilences(silences []models.ManagedSilence, now time.Time) {
+	silenceChecksLock.RLock()
+	defer silenceChecksLock.RUnlock()
+
+	for i, silence := range silences {
+		if silence.State != models.SilenceStateActive {
+			continue
+		}
+		if silence.AlertCount > 0 {
+			horizon := config.Config().Silences.Expiring
+			silences[i].Expiring = horizon > 0 && silence.EndsAt.Before(now.Add(horizon))
+		} else if since, found := unusedSilences[silence.ID]; found {
+			threshold := config.Config().Silences.Stale
+			silences[i].Stale = threshold > 0 && now.Sub(since) >= threshold
+		}
+	}
+}
+
+// silenceCheckCounts returns the number of expiring and stale silences for
+// given Alertmanager instance
+func silenceCheckCounts(name string) (expiring, stale float64) {
+	silenceChecksLock.RLock()
+	defer silenceChecksLock.RUnlock()
+
+	return expiringSilences[name], staleSilences[name]
+}
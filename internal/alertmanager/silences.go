@@ -0,0 +1,72 @@
+package alertmanager
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/cloudflare/unsee/internal/mapper"
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/uri"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateSilence will send given silence to this Alertmanager instance and
+// return the ID of the silence that was created, HTTP status code of the
+// Alertmanager response is also returned (0 if no response was received)
+func (am *Alertmanager) CreateSilence(silence models.Silence) (string, int, error) {
+	u, err := url.Parse(am.URI)
+	if err != nil {
+		return "", 0, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", 0, fmt.Errorf("Unsupported URI scheme '%s', silences can only be sent to http:// and https:// URIs", u.Scheme)
+	}
+
+	// use the version detected during the last pull, same as when reading
+	// silences, so new silences are sent to the API that instance supports
+	am.lock.RLock()
+	version := am.version
+	am.lock.RUnlock()
+	if version == "" {
+		version = am.detectVersion()
+	}
+	creator, err := mapper.GetSilenceCreator(version)
+	if err != nil {
+		return "", 0, err
+	}
+
+	url, err := creator.AbsoluteURL(am.URI)
+	if err != nil {
+		return "", 0, err
+	}
+
+	body, err := creator.Encode(silence)
+	if err != nil {
+		return "", 0, err
+	}
+
+	client := http.Client{
+		Timeout:   am.RequestTimeout,
+		Transport: am.HTTPTransport,
+	}
+	log.Infof("[%s] POST %s", am.Name, uri.SanitizeURI(url))
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	silenceID, err := creator.Decode(resp.Body)
+	if err != nil {
+		return "", resp.StatusCode, err
+	}
+	if silenceID == "" {
+		return "", resp.StatusCode, fmt.Errorf("Request to %s failed with %s", uri.SanitizeURI(url), resp.Status)
+	}
+
+	log.Infof("[%s] Created silence %s", am.Name, silenceID)
+	return silenceID, resp.StatusCode, nil
+}
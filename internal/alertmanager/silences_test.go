@@ -0,0 +1,100 @@
+package alertmanager
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/models"
+
+	httpmock "gopkg.in/jarcoal/httpmock.v1"
+)
+
+type createSilenceStatusTest struct {
+	version   string
+	uri       string
+	responder httpmock.Responder
+	silenceID string
+	status    int
+	failed    bool
+}
+
+var createSilenceStatusTests = []createSilenceStatusTest{
+	{
+		version:   "0.4.2",
+		uri:       "http://localhost/api/v1/silences",
+		responder: httpmock.NewStringResponder(http.StatusOK, `{"status":"success","data":{"silenceId":1}}`),
+		silenceID: "1",
+		status:    http.StatusOK,
+	},
+	{
+		version:   "0.15.0",
+		uri:       "http://localhost/api/v1/silences",
+		responder: httpmock.NewStringResponder(http.StatusOK, `{"status":"success","data":{"silenceId":"silence1"}}`),
+		silenceID: "silence1",
+		status:    http.StatusOK,
+	},
+	{
+		version:   "0.15.0",
+		uri:       "http://localhost/api/v1/silences",
+		responder: httpmock.NewStringResponder(http.StatusBadRequest, `{"status":"error","error":"start time must be before end time"}`),
+		status:    http.StatusBadRequest,
+		failed:    true,
+	},
+	{
+		version:   "0.16.0",
+		uri:       "http://localhost/api/v2/silences",
+		responder: httpmock.NewStringResponder(http.StatusOK, `{"silenceID":"silence1"}`),
+		silenceID: "silence1",
+		status:    http.StatusOK,
+	},
+	{
+		version:   "0.16.0",
+		uri:       "http://localhost/api/v2/silences",
+		responder: httpmock.NewStringResponder(http.StatusBadRequest, `"start time must be before end time"`),
+		status:    http.StatusBadRequest,
+		failed:    true,
+	},
+	{
+		version:   "0.16.0",
+		uri:       "http://localhost/api/v2/silences",
+		responder: httpmock.NewStringResponder(http.StatusInternalServerError, "Internal Server Error"),
+		status:    http.StatusInternalServerError,
+		failed:    true,
+	},
+	{
+		version: "0.16.0",
+		uri:     "http://localhost/api/v2/silences",
+		responder: func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		},
+		status: 0,
+		failed: true,
+	},
+}
+
+func TestCreateSilenceStatus(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	am, err := NewAlertmanager("test", "http://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range createSilenceStatusTests {
+		// pretend that version was detected during a pull
+		am.version = test.version
+		httpmock.Reset()
+		httpmock.RegisterResponder("POST", test.uri, test.responder)
+		silenceID, status, err := am.CreateSilence(models.Silence{})
+		if status != test.status {
+			t.Errorf("[%s] CreateSilence() returned status %d while %d was expected", test.version, status, test.status)
+		}
+		if (err != nil) != test.failed {
+			t.Errorf("[%s] CreateSilence() returned error %v, expected failure: %v", test.version, err, test.failed)
+		}
+		if silenceID != test.silenceID {
+			t.Errorf("[%s] CreateSilence() returned silence ID '%s' while '%s' was expected", test.version, silenceID, test.silenceID)
+		}
+	}
+}
@@ -17,6 +17,9 @@ type Option func(am *Alertmanager) error
 
 var (
 	upstreams = map[string]*Alertmanager{}
+	// upstreamsLock protects the upstreams map, it can be replaced when
+	// configuration is reloaded
+	upstreamsLock = sync.RWMutex{}
 )
 
 // NewAlertmanager creates a new Alertmanager instance
@@ -25,6 +28,7 @@ func NewAlertmanager(name, upstreamURI string, opts ...Option) (*Alertmanager, e
 		URI:            upstreamURI,
 		RequestTimeout: time.Second * 10,
 		Name:           name,
+		peerNames:      []string{},
 		lock:           sync.RWMutex{},
 		alertGroups:    []models.AlertGroup{},
 		silences:       map[string]models.Silence{},
@@ -57,22 +61,64 @@ func NewAlertmanager(name, upstreamURI string, opts ...Option) (*Alertmanager, e
 // RegisterAlertmanager will add an Alertmanager instance to the list of
 // instances used when pulling alerts from upstreams
 func RegisterAlertmanager(am *Alertmanager) error {
-	if _, found := upstreams[am.Name]; found {
+	upstreamsLock.Lock()
+	defer upstreamsLock.Unlock()
+
+	if err := checkConflicts(upstreams, am); err != nil {
+		return err
+	}
+	upstreams[am.Name] = am
+	log.Infof("[%s] Configured Alertmanager source at %s (proxied: %v)", am.Name, am.URI, am.ProxyRequests)
+	return nil
+}
+
+// SetAlertmanagers will replace the list of all Alertmanager instances used
+// when pulling alerts from upstreams, if there are any conflicts between
+// passed instances an error is returned and current list is kept
+func SetAlertmanagers(ams []*Alertmanager) error {
+	newUpstreams := map[string]*Alertmanager{}
+	for _, am := range ams {
+		if err := checkConflicts(newUpstreams, am); err != nil {
+			return err
+		}
+		newUpstreams[am.Name] = am
+	}
+
+	upstreamsLock.Lock()
+	defer upstreamsLock.Unlock()
+
+	for name, am := range newUpstreams {
+		if current, found := upstreams[name]; !found || current != am {
+			log.Infof("[%s] Configured Alertmanager source at %s (proxied: %v)", am.Name, am.URI, am.ProxyRequests)
+		}
+	}
+	for name := range upstreams {
+		if _, found := newUpstreams[name]; !found {
+			log.Infof("[%s] Removed Alertmanager source", name)
+		}
+	}
+	upstreams = newUpstreams
+	return nil
+}
+
+func checkConflicts(ams map[string]*Alertmanager, am *Alertmanager) error {
+	if _, found := ams[am.Name]; found {
 		return fmt.Errorf("Alertmanager upstream '%s' already exist", am.Name)
 	}
 
-	for _, existingAM := range upstreams {
+	for _, existingAM := range ams {
 		if existingAM.URI == am.URI {
 			return fmt.Errorf("Alertmanager upstream '%s' already collects from '%s'", existingAM.Name, existingAM.URI)
 		}
 	}
-	upstreams[am.Name] = am
-	log.Infof("[%s] Configured Alertmanager source at %s (proxied: %v)", am.Name, am.URI, am.ProxyRequests)
 	return nil
 }
 
 // GetAlertmanagers returns a list of all defined Alertmanager instances
 func GetAlertmanagers() []*Alertmanager {
+	upstreamsLock.RLock()
+	defer upstreamsLock.RUnlock()
+
 	ams := []*Alertmanager{}
 	for _, am := range upstreams {
 		ams = append(ams, am)
@@ -83,6 +129,9 @@ func GetAlertmanagers() []*Alertmanager {
 // GetAlertmanagerByName returns an instance of Alertmanager by name or nil
 // if not found
 func GetAlertmanagerByName(name string) *Alertmanager {
+	upstreamsLock.RLock()
+	defer upstreamsLock.RUnlock()
+
 	am, found := upstreams[name]
 	if found {
 		return am
@@ -99,6 +148,16 @@ func WithProxy(proxied bool) Option {
 	}
 }
 
+// WithCluster option can be passed to NewAlertmanager in order to make this
+// instance part of a named cluster instead of detecting the cluster using
+// peers reported by Alertmanager
+func WithCluster(name string) Option {
+	return func(am *Alertmanager) error {
+		am.Cluster = name
+		return nil
+	}
+}
+
 // WithRequestTimeout option can be passed to NewAlertmanager in order to set
 // a custom timeout for Alertmanager upstream requests
 func WithRequestTimeout(timeout time.Duration) Option {
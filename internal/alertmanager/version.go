@@ -1,12 +1,33 @@
 package alertmanager
 
+// alertmanagerPeers is the cluster status returned by the status API, older
+// versions call it meshStatus, it's used to tell which Alertmanager instances
+// are replicas of each other
+type alertmanagerPeers struct {
+	Name  string `json:"name"`
+	Peers []struct {
+		Name string `json:"name"`
+	} `json:"peers"`
+}
+
 // AlertmanagerVersion is what api/v1/status returns, we only use it to check
-// version, so we skip all other keys (except for status)
+// version and cluster peers, so we skip all other keys (except for status)
 type alertmanagerVersion struct {
 	Status string `json:"status"`
 	Data   struct {
 		VersionInfo struct {
 			Version string `json:"version"`
 		} `json:"versionInfo"`
+		MeshStatus    *alertmanagerPeers `json:"meshStatus"`
+		ClusterStatus *alertmanagerPeers `json:"clusterStatus"`
 	} `json:"data"`
 }
+
+// alertmanagerVersionV2 is what api/v2/status returns, there's no status or
+// data wrapper in the v2 API
+type alertmanagerVersionV2 struct {
+	VersionInfo struct {
+		Version string `json:"version"`
+	} `json:"versionInfo"`
+	Cluster *alertmanagerPeers `json:"cluster"`
+}
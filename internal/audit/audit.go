@@ -0,0 +1,245 @@
+// Package audit records all silence operations performed through unsee in
+// a rotated JSON lines file and optionally sends them to a webhook
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/models"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// webhookQueueSize is the number of entries waiting to be sent to the webhook,
+// new entries are dropped if the queue is full
+const webhookQueueSize = 1024
+
+// Config holds all audit log options
+type Config struct {
+	// Path to the audit log file, entries are not written to a file if empty
+	Path string
+	// MaxSize is the size in bytes at which the file is rotated
+	MaxSize int64
+	// Backups is the number of rotated files to keep
+	Backups int
+	// WebhookURI is the URI every entry will be POSTed to, entries are not
+	// sent anywhere if empty
+	WebhookURI     string
+	WebhookTimeout time.Duration
+}
+
+// Logger writes audit entries to a file and sends them to a webhook
+type Logger struct {
+	config  Config
+	lock    sync.Mutex
+	file    *os.File
+	size    int64
+	queue   chan models.AuditEntry
+	webhook sync.WaitGroup
+}
+
+// New returns Logger for given config, file is opened (or created if
+// missing) in append mode
+func New(config Config) (*Logger, error) {
+	if config.Path != "" && config.MaxSize <= 0 {
+		return nil, fmt.Errorf("Invalid audit log max size %d", config.MaxSize)
+	}
+	if config.Backups < 0 {
+		return nil, fmt.Errorf("Invalid audit log backups count %d", config.Backups)
+	}
+
+	l := Logger{config: config}
+	if config.Path != "" {
+		if err := l.open(); err != nil {
+			return nil, err
+		}
+	}
+	if config.WebhookURI != "" {
+		l.queue = make(chan models.AuditEntry, webhookQueueSize)
+		l.webhook.Add(1)
+		go l.sendToWebhook()
+	}
+	return &l, nil
+}
+
+func (l *Logger) open() error {
+	f, err := os.OpenFile(l.config.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+// backupPath returns the path of rotated file with given index, 0 is the
+// current file
+func (l *Logger) backupPath(i int) string {
+	if i == 0 {
+		return l.config.Path
+	}
+	return fmt.Sprintf("%s.%d", l.config.Path, i)
+}
+
+// rotate will shift all backups by one, oldest backup is removed
+func (l *Logger) rotate() error {
+	err := l.file.Close()
+	l.file = nil
+	if err != nil {
+		return err
+	}
+	if l.config.Backups == 0 {
+		if err := os.Remove(l.config.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for i := l.config.Backups; i > 0; i-- {
+		err := os.Rename(l.backupPath(i-1), l.backupPath(i))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return l.open()
+}
+
+// Record will write given entry to the file and queue it for the webhook,
+// errors are logged since failing to record an entry shouldn't fail the
+// silence operation that already happened
+func (l *Logger) Record(entry models.AuditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("Failed to encode audit log entry: %s", err)
+		return
+	}
+	line = append(line, '\n')
+
+	if l.config.Path != "" {
+		l.lock.Lock()
+		if l.file != nil && l.size > 0 && l.size+int64(len(line)) > l.config.MaxSize {
+			if err := l.rotate(); err != nil {
+				log.Errorf("Failed to rotate audit log file '%s': %s", l.config.Path, err)
+			}
+		}
+		// file might be closed if the last rotation failed
+		if l.file == nil {
+			if err := l.open(); err != nil {
+				log.Errorf("Failed to open audit log file '%s': %s", l.config.Path, err)
+			}
+		}
+		if l.file != nil {
+			n, err := l.file.Write(line)
+			l.size += int64(n)
+			if err != nil {
+				log.Errorf("Failed to write audit log entry to '%s': %s", l.config.Path, err)
+			}
+		}
+		l.lock.Unlock()
+	}
+
+	if l.queue != nil {
+		select {
+		case l.queue <- entry:
+		default:
+			log.Errorf("Audit log webhook queue is full, dropping entry for silence '%s'", entry.SilenceID)
+		}
+	}
+}
+
+func (l *Logger) sendToWebhook() {
+	defer l.webhook.Done()
+	client := http.Client{Timeout: l.config.WebhookTimeout}
+	for entry := range l.queue {
+		body, err := json.Marshal(entry)
+		if err != nil {
+			log.Errorf("Failed to encode audit log entry: %s", err)
+			continue
+		}
+		resp, err := client.Post(l.config.WebhookURI, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Errorf("Failed to send audit log entry to webhook: %s", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Errorf("Audit log webhook returned %s", resp.Status)
+		}
+	}
+}
+
+// Recent returns up to limit most recent entries matching the filter, newest
+// entries first, all rotated files are searched
+func (l *Logger) Recent(match func(models.AuditEntry) bool, limit int) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	if l.config.Path == "" {
+		return entries, nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for i := 0; i <= l.config.Backups && len(entries) < limit; i++ {
+		found, err := readEntries(l.backupPath(i), match)
+		if err != nil {
+			if os.IsNotExist(err) {
+				break
+			}
+			return nil, err
+		}
+		// files are in chronological order, so read them backwards
+		for j := len(found) - 1; j >= 0 && len(entries) < limit; j-- {
+			entries = append(entries, found[j])
+		}
+	}
+	return entries, nil
+}
+
+func readEntries(path string, match func(models.AuditEntry) bool) ([]models.AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []models.AuditEntry{}
+	scanner := bufio.NewScanner(f)
+	// request bodies can make lines longer than the default limit
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		entry := models.AuditEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Warningf("Skipping invalid audit log entry in '%s': %s", path, err)
+			continue
+		}
+		if match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Close will close the file and wait for all queued entries to be sent to
+// the webhook
+func (l *Logger) Close() error {
+	if l.queue != nil {
+		close(l.queue)
+		l.webhook.Wait()
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.file != nil {
+		return l.file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package audit_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/audit"
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "unsee-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func matchAll(models.AuditEntry) bool {
+	return true
+}
+
+func TestRecordAndRecent(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	l, err := audit.New(audit.Config{Path: path.Join(dir, "audit.log"), MaxSize: 1024 * 1024, Backups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for i := 0; i < 10; i++ {
+		l.Record(models.AuditEntry{
+			Action:    models.AuditActionCreate,
+			User:      fmt.Sprintf("user%d", i%2),
+			SilenceID: fmt.Sprintf("%d", i),
+		})
+	}
+
+	entries, err := l.Recent(matchAll, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Recent() returned %d entries while 3 were expected", len(entries))
+	}
+	for i, id := range []string{"9", "8", "7"} {
+		if entries[i].SilenceID != id {
+			t.Errorf("Entry %d has silence ID '%s' while '%s' was expected", i, entries[i].SilenceID, id)
+		}
+	}
+
+	entries, err = l.Recent(func(entry models.AuditEntry) bool {
+		return entry.User == "user0"
+	}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Errorf("Recent() returned %d entries for user0 while 5 were expected", len(entries))
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	logPath := path.Join(dir, "audit.log")
+	line, _ := json.Marshal(models.AuditEntry{SilenceID: "0"})
+	// every file can hold 2 entries
+	l, err := audit.New(audit.Config{Path: logPath, MaxSize: int64(len(line)+1) * 2, Backups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	for i := 0; i < 8; i++ {
+		l.Record(models.AuditEntry{SilenceID: fmt.Sprintf("%d", i)})
+	}
+
+	for _, p := range []string{logPath, logPath + ".1", logPath + ".2"} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("Rotated file is missing: %s", err)
+		}
+	}
+	if _, err := os.Stat(logPath + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Too many backups were kept")
+	}
+
+	// oldest 2 entries were removed with the oldest backup
+	entries, err := l.Recent(matchAll, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 6 {
+		t.Fatalf("Recent() returned %d entries while 6 were expected", len(entries))
+	}
+	if entries[0].SilenceID != "7" || entries[5].SilenceID != "2" {
+		t.Errorf("Recent() returned entries in wrong order: %v", entries)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	logPath := path.Join(dir, "audit.log")
+	l, err := audit.New(audit.Config{Path: logPath, MaxSize: 1024, Backups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(models.AuditEntry{SilenceID: "1"})
+	l.Close()
+
+	// entries from previous runs are kept
+	l, err = audit.New(audit.Config{Path: logPath, MaxSize: 1024, Backups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.Record(models.AuditEntry{SilenceID: "2"})
+
+	entries, err := l.Recent(matchAll, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Recent() returned %d entries while 2 were expected", len(entries))
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	lock := sync.Mutex{}
+	received := []models.AuditEntry{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := models.AuditEntry{}
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			t.Errorf("Failed to decode webhook request: %s", err)
+		}
+		lock.Lock()
+		received = append(received, entry)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	l, err := audit.New(audit.Config{WebhookURI: server.URL, WebhookTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(models.AuditEntry{SilenceID: "1", Action: models.AuditActionCreate})
+	l.Record(models.AuditEntry{SilenceID: "1", Action: models.AuditActionExpire})
+	// close will wait for all queued entries to be sent
+	l.Close()
+
+	if len(received) != 2 {
+		t.Fatalf("Webhook received %d entries while 2 were expected", len(received))
+	}
+	if received[1].Action != models.AuditActionExpire {
+		t.Errorf("Webhook received entries in wrong order: %v", received)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, config := range []audit.Config{
+		{Path: "/tmp/audit.log", MaxSize: 0},
+		{Path: "/tmp/audit.log", MaxSize: 1024, Backups: -1},
+		{Path: "/nonexistent/audit.log", MaxSize: 1024},
+	} {
+		if _, err := audit.New(config); err == nil {
+			t.Errorf("New() didn't return any error for %v", config)
+		}
+	}
+}
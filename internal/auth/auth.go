@@ -0,0 +1,147 @@
+// Package auth implements authentication middleware for the gin router and
+// authorization rules for managing silences
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userKey is the gin context key holding the authenticated user
+const userKey = "unsee.user"
+
+// User is the authenticated user that sent the request
+type User struct {
+	Name   string
+	Groups []string
+}
+
+// Authenticator is implemented by every supported authentication mode
+type Authenticator interface {
+	// Authenticate returns the user that sent the request, it's nil if the
+	// request isn't authenticated
+	Authenticate(r *http.Request) *User
+	// Unauthorized responds to requests that are not authenticated
+	Unauthorized(c *gin.Context)
+}
+
+// Middleware will reject all requests that can't be authenticated using
+// passed Authenticator, authenticated user can be read from the context
+// using GetUser() or GetUsername()
+func Middleware(a Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := a.Authenticate(c.Request)
+		if user == nil || user.Name == "" {
+			a.Unauthorized(c)
+			c.Abort()
+			return
+		}
+		c.Set(userKey, user)
+		c.Next()
+	}
+}
+
+// GetUser returns the user that sent the request, it's nil if authentication
+// is disabled
+func GetUser(c *gin.Context) *User {
+	if v, found := c.Get(userKey); found {
+		if user, ok := v.(*User); ok {
+			return user
+		}
+	}
+	return nil
+}
+
+// GetUsername returns the name of the user that sent the request, it's empty
+// if authentication is disabled
+func GetUsername(c *gin.Context) string {
+	if user := GetUser(c); user != nil {
+		return user.Name
+	}
+	return ""
+}
+
+// BasicUser is a static user for basic authentication
+type BasicUser struct {
+	Username string
+	Password string
+	Groups   []string
+}
+
+// BasicAuth authenticates requests using HTTP basic auth with a static list
+// of users
+type BasicAuth struct {
+	users map[string]BasicUser
+}
+
+// NewBasicAuth returns BasicAuth for given list of users
+func NewBasicAuth(users []BasicUser) *BasicAuth {
+	ba := BasicAuth{users: map[string]BasicUser{}}
+	for _, u := range users {
+		ba.users[u.Username] = u
+	}
+	return &ba
+}
+
+// Authenticate checks credentials passed in the Authorization header
+func (ba *BasicAuth) Authenticate(r *http.Request) *User {
+	username, password, ok := r.BasicAuth()
+	if !ok || username == "" {
+		return nil
+	}
+	u, found := ba.users[username]
+	if !found {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(password), []byte(u.Password)) != 1 {
+		return nil
+	}
+	return &User{Name: u.Username, Groups: u.Groups}
+}
+
+// Unauthorized will ask the browser for credentials
+func (ba *BasicAuth) Unauthorized(c *gin.Context) {
+	c.Header("WWW-Authenticate", "Basic realm=\"unsee\"")
+	c.String(http.StatusUnauthorized, "Unauthorized")
+}
+
+// HeaderAuth trusts the username passed in a request header, it should only
+// be used if unsee is running behind an authentication proxy that always
+// sets this header
+type HeaderAuth struct {
+	header       string
+	groupsHeader string
+}
+
+// NewHeaderAuth returns HeaderAuth reading username from given header and
+// a comma separated list of groups from groupsHeader, groups are not read if
+// groupsHeader is empty
+func NewHeaderAuth(header, groupsHeader string) *HeaderAuth {
+	return &HeaderAuth{header: header, groupsHeader: groupsHeader}
+}
+
+// Authenticate returns the user from request headers
+func (ha *HeaderAuth) Authenticate(r *http.Request) *User {
+	username := r.Header.Get(ha.header)
+	if username == "" {
+		return nil
+	}
+	user := User{Name: username, Groups: []string{}}
+	if ha.groupsHeader != "" {
+		for _, group := range strings.Split(r.Header.Get(ha.groupsHeader), ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				user.Groups = append(user.Groups, group)
+			}
+		}
+	}
+	return &user
+}
+
+// Unauthorized responds with 401, if the header is missing then there's a
+// problem with the authentication proxy and there's nothing user can do
+func (ha *HeaderAuth) Unauthorized(c *gin.Context) {
+	c.String(http.StatusUnauthorized, "Unauthorized")
+}
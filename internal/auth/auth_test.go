@@ -0,0 +1,132 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testRouter(a auth.Authenticator) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(auth.Middleware(a))
+	r.GET("/", func(c *gin.Context) {
+		user := auth.GetUser(c)
+		c.String(http.StatusOK, "%s %v", auth.GetUsername(c), user.Groups)
+	})
+	return r
+}
+
+type authTest struct {
+	name     string
+	prepare  func(r *http.Request)
+	code     int
+	response string
+}
+
+var basicAuthTests = []authTest{
+	{
+		name:    "no credentials",
+		prepare: func(r *http.Request) {},
+		code:    http.StatusUnauthorized,
+	},
+	{
+		name:     "valid credentials",
+		prepare:  func(r *http.Request) { r.SetBasicAuth("alice", "secret") },
+		code:     http.StatusOK,
+		response: "alice [ops]",
+	},
+	{
+		name:    "invalid password",
+		prepare: func(r *http.Request) { r.SetBasicAuth("alice", "foo") },
+		code:    http.StatusUnauthorized,
+	},
+	{
+		name:    "unknown user",
+		prepare: func(r *http.Request) { r.SetBasicAuth("bob", "secret") },
+		code:    http.StatusUnauthorized,
+	},
+	{
+		name:    "empty password",
+		prepare: func(r *http.Request) { r.SetBasicAuth("alice", "") },
+		code:    http.StatusUnauthorized,
+	},
+}
+
+var headerAuthTests = []authTest{
+	{
+		name:    "no header",
+		prepare: func(r *http.Request) {},
+		code:    http.StatusUnauthorized,
+	},
+	{
+		name:    "empty header",
+		prepare: func(r *http.Request) { r.Header.Set("X-User", "") },
+		code:    http.StatusUnauthorized,
+	},
+	{
+		name:     "header with username",
+		prepare:  func(r *http.Request) { r.Header.Set("X-User", "alice") },
+		code:     http.StatusOK,
+		response: "alice []",
+	},
+	{
+		name: "header with username and groups",
+		prepare: func(r *http.Request) {
+			r.Header.Set("X-User", "alice")
+			r.Header.Set("X-Groups", "ops, dev,,")
+		},
+		code:     http.StatusOK,
+		response: "alice [ops dev]",
+	},
+}
+
+func runAuthTests(t *testing.T, a auth.Authenticator, tests []authTest) {
+	r := testRouter(a)
+	for _, testCase := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		testCase.prepare(req)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != testCase.code {
+			t.Errorf("[%s] Got status %d while %d was expected", testCase.name, resp.Code, testCase.code)
+		}
+		if testCase.code == http.StatusOK && resp.Body.String() != testCase.response {
+			t.Errorf("[%s] Got response '%s' while '%s' was expected", testCase.name, resp.Body.String(), testCase.response)
+		}
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	a := auth.NewBasicAuth([]auth.BasicUser{{Username: "alice", Password: "secret", Groups: []string{"ops"}}})
+	runAuthTests(t, a, basicAuthTests)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	resp := httptest.NewRecorder()
+	testRouter(a).ServeHTTP(resp, req)
+	if resp.Header().Get("WWW-Authenticate") == "" {
+		t.Error("WWW-Authenticate header is missing from 401 response")
+	}
+}
+
+func TestHeaderAuth(t *testing.T) {
+	runAuthTests(t, auth.NewHeaderAuth("X-User", "X-Groups"), headerAuthTests)
+}
+
+func TestGetUsernameWithoutAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, auth.GetUsername(c))
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Body.String() != "" {
+		t.Errorf("GetUsername() returned '%s' with no authentication", resp.Body.String())
+	}
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/slices"
+)
+
+// Rule grants users and groups permission to manage silences, empty
+// Alertmanagers list means that all Alertmanager instances are allowed, empty
+// Matchers list means that silences can match any alert
+type Rule struct {
+	Users         []string
+	Groups        []string
+	Alertmanagers []string
+	// Matchers is a list of label sets, each label value is a regexp, silence
+	// must have an equality matcher for every label from one of those sets
+	// with a value matching that regexp
+	Matchers []map[string]string
+}
+
+type labelSet map[string]*regexp.Regexp
+
+func (ls labelSet) String() string {
+	matchers := []string{}
+	for name, re := range ls {
+		matchers = append(matchers, fmt.Sprintf("%s=~%s", name, re.String()))
+	}
+	sort.Strings(matchers)
+	return strings.Join(matchers, ",")
+}
+
+type rule struct {
+	users         []string
+	groups        []string
+	alertmanagers []string
+	labelSets     []labelSet
+}
+
+func (r *rule) appliesTo(user *User) bool {
+	if user == nil {
+		return false
+	}
+	if slices.StringInSlice(r.users, user.Name) {
+		return true
+	}
+	for _, group := range user.Groups {
+		if slices.StringInSlice(r.groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) allowsAlertmanager(name string) bool {
+	return len(r.alertmanagers) == 0 || slices.StringInSlice(r.alertmanagers, name)
+}
+
+func (r *rule) allowsSilence(silence models.Silence) bool {
+	if len(r.labelSets) == 0 {
+		return true
+	}
+	for _, ls := range r.labelSets {
+		if labelSetCovers(ls, silence) {
+			return true
+		}
+	}
+	return false
+}
+
+// labelSetCovers returns true if every label in the set has an equality
+// matcher in the silence with a value allowed by the set, regex and negative
+// matchers could match alerts with other label values so those are ignored
+func labelSetCovers(ls labelSet, silence models.Silence) bool {
+	for name, re := range ls {
+		found := false
+		for _, m := range silence.Matchers {
+			if m.Name == name && !m.IsRegex && re.MatchString(m.Value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Authorizer decides who can manage silences on which Alertmanager instance
+type Authorizer struct {
+	rules []rule
+}
+
+// NewAuthorizer validates all rules and returns Authorizer for those
+func NewAuthorizer(rules []Rule) (*Authorizer, error) {
+	a := Authorizer{rules: []rule{}}
+	for i, r := range rules {
+		if len(r.Users) == 0 && len(r.Groups) == 0 {
+			return nil, fmt.Errorf("Authorization rule %d has no users or groups", i)
+		}
+		parsed := rule{
+			users:         r.Users,
+			groups:        r.Groups,
+			alertmanagers: r.Alertmanagers,
+			labelSets:     []labelSet{},
+		}
+		for _, matchers := range r.Matchers {
+			if len(matchers) == 0 {
+				return nil, fmt.Errorf("Authorization rule %d has an empty label set", i)
+			}
+			ls := labelSet{}
+			for name, value := range matchers {
+				re, err := regexp.Compile("^(?:" + value + ")$")
+				if err != nil {
+					return nil, fmt.Errorf("Authorization rule %d has invalid regexp for label '%s': %s", i, name, err)
+				}
+				ls[name] = re
+			}
+			parsed.labelSets = append(parsed.labelSets, ls)
+		}
+		a.rules = append(a.rules, parsed)
+	}
+	return &a, nil
+}
+
+// CanSilence returns nil if the user is allowed to manage passed silence on
+// given Alertmanager instance, or an error explaining why it's not allowed
+func (a *Authorizer) CanSilence(user *User, alertmanager string, silence models.Silence) error {
+	username := ""
+	if user != nil {
+		username = user.Name
+	}
+
+	applies := false
+	allowedSets := []string{}
+	for _, r := range a.rules {
+		if !r.appliesTo(user) {
+			continue
+		}
+		applies = true
+		if !r.allowsAlertmanager(alertmanager) {
+			continue
+		}
+		if r.allowsSilence(silence) {
+			return nil
+		}
+		for _, ls := range r.labelSets {
+			allowedSets = append(allowedSets, ls.String())
+		}
+	}
+
+	if !applies {
+		return fmt.Errorf("user '%s' is not allowed to manage silences", username)
+	}
+	if len(allowedSets) == 0 {
+		return fmt.Errorf("user '%s' is not allowed to manage silences on Alertmanager '%s'", username, alertmanager)
+	}
+	return fmt.Errorf("silence would match alerts outside of the scope allowed for user '%s' on Alertmanager '%s', silence must have equality matchers for one of these label sets: %s",
+		username, alertmanager, strings.Join(allowedSets, " or "))
+}
@@ -0,0 +1,135 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/auth"
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+var authorizationRules = []auth.Rule{
+	{
+		Users:         []string{"alice"},
+		Alertmanagers: []string{"staging"},
+	},
+	{
+		Groups:        []string{"ops"},
+		Alertmanagers: []string{"prod"},
+		Matchers: []map[string]string{
+			{"team": "ops"},
+			{"cluster": "prod-.+", "service": "db"},
+		},
+	},
+}
+
+type authorizationTest struct {
+	name         string
+	user         *auth.User
+	alertmanager string
+	matchers     string
+	err          string
+}
+
+var authorizationTests = []authorizationTest{
+	{
+		name:         "no user",
+		alertmanager: "staging",
+		matchers:     `[{"name": "alertname", "value": "Foo"}]`,
+		err:          "user '' is not allowed to manage silences",
+	},
+	{
+		name:         "user without any rule",
+		user:         &auth.User{Name: "bob", Groups: []string{"dev"}},
+		alertmanager: "staging",
+		matchers:     `[{"name": "alertname", "value": "Foo"}]`,
+		err:          "user 'bob' is not allowed to manage silences",
+	},
+	{
+		name:         "user allowed on every silence",
+		user:         &auth.User{Name: "alice"},
+		alertmanager: "staging",
+		matchers:     `[{"name": "alertname", "value": ".+", "isRegex": true}]`,
+	},
+	{
+		name:         "user on Alertmanager that isn't allowed",
+		user:         &auth.User{Name: "alice"},
+		alertmanager: "prod",
+		matchers:     `[{"name": "alertname", "value": "Foo"}]`,
+		err:          "user 'alice' is not allowed to manage silences on Alertmanager 'prod'",
+	},
+	{
+		name:         "group with matching label set",
+		user:         &auth.User{Name: "bob", Groups: []string{"ops"}},
+		alertmanager: "prod",
+		matchers:     `[{"name": "alertname", "value": "Foo"}, {"name": "team", "value": "ops"}]`,
+	},
+	{
+		name:         "group with matching label set using regexp",
+		user:         &auth.User{Name: "bob", Groups: []string{"ops"}},
+		alertmanager: "prod",
+		matchers:     `[{"name": "cluster", "value": "prod-1"}, {"name": "service", "value": "db"}]`,
+	},
+	{
+		name:         "group with partially matching label set",
+		user:         &auth.User{Name: "bob", Groups: []string{"ops"}},
+		alertmanager: "prod",
+		matchers:     `[{"name": "cluster", "value": "prod-1"}]`,
+		err:          "silence would match alerts outside of the scope allowed for user 'bob' on Alertmanager 'prod', silence must have equality matchers for one of these label sets: team=~^(?:ops)$ or cluster=~^(?:prod-.+)$,service=~^(?:db)$",
+	},
+	{
+		name:         "group with regex matcher",
+		user:         &auth.User{Name: "bob", Groups: []string{"ops"}},
+		alertmanager: "prod",
+		matchers:     `[{"name": "team", "value": "ops", "isRegex": true}]`,
+		err:          "silence would match alerts outside of the scope",
+	},
+	{
+		name:         "group with label value that isn't allowed",
+		user:         &auth.User{Name: "bob", Groups: []string{"ops"}},
+		alertmanager: "prod",
+		matchers:     `[{"name": "team", "value": "ops2"}]`,
+		err:          "silence would match alerts outside of the scope",
+	},
+}
+
+func TestCanSilence(t *testing.T) {
+	a, err := auth.NewAuthorizer(authorizationRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range authorizationTests {
+		silence := models.Silence{}
+		err := json.Unmarshal([]byte(`{"matchers": `+testCase.matchers+`}`), &silence)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = a.CanSilence(testCase.user, testCase.alertmanager, silence)
+		if testCase.err == "" && err != nil {
+			t.Errorf("[%s] CanSilence() returned an error: %s", testCase.name, err)
+		}
+		if testCase.err != "" {
+			if err == nil {
+				t.Errorf("[%s] CanSilence() didn't return any error", testCase.name)
+			} else if !strings.HasPrefix(err.Error(), testCase.err) {
+				t.Errorf("[%s] CanSilence() returned error '%s' while '%s' was expected", testCase.name, err, testCase.err)
+			}
+		}
+	}
+}
+
+var invalidAuthorizationRules = [][]auth.Rule{
+	{{Alertmanagers: []string{"prod"}}},
+	{{Users: []string{"alice"}, Matchers: []map[string]string{{}}}},
+	{{Users: []string{"alice"}, Matchers: []map[string]string{{"team": "("}}}},
+}
+
+func TestNewAuthorizerInvalidRules(t *testing.T) {
+	for _, rules := range invalidAuthorizationRules {
+		if _, err := auth.NewAuthorizer(rules); err == nil {
+			t.Errorf("NewAuthorizer() didn't return any error for %v", rules)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// sessionCookie holds the username of the authenticated user
+	sessionCookie = "unsee_session"
+	// stateCookie holds the state of login requests sent to the provider
+	stateCookie = "unsee_oidc_state"
+	// loginTTL is how long users have to log in with the provider
+	loginTTL = time.Minute * 10
+)
+
+// OIDCConfig holds all OpenID Connect options
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL must point to the Callback handler, it's registered with the
+	// provider so it can't be generated from requests
+	RedirectURL string
+	Scopes      []string
+	// UsernameClaim is the name of the ID token claim used as the username
+	UsernameClaim string
+	// GroupsClaim is the name of the ID token claim with the list of groups
+	// user belongs to, groups are not read if empty
+	GroupsClaim string
+	// SessionSecret is used to sign cookies, random secret will be used if
+	// empty, which means that all sessions are lost on restart
+	SessionSecret string
+	SessionTTL    time.Duration
+	// Prefix is the URL prefix unsee is listening on, it's used as the cookie
+	// path and users are redirected there after logging out
+	Prefix string
+	// LoginPath is the path where Login handler is registered
+	LoginPath string
+}
+
+// OIDCAuth authenticates users with an OpenID Connect provider using the
+// authorization code flow, authenticated users get a session cookie
+type OIDCAuth struct {
+	config   OIDCConfig
+	client   *http.Client
+	signer   *signer
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+type loginState struct {
+	State   string `json:"state"`
+	Nonce   string `json:"nonce"`
+	Next    string `json:"next"`
+	Expires int64  `json:"expires"`
+}
+
+type session struct {
+	Username string   `json:"username"`
+	Groups   []string `json:"groups"`
+	Expires  int64    `json:"expires"`
+}
+
+// NewOIDCAuth returns OIDCAuth for given config, provider metadata is fetched
+// using OpenID Connect discovery
+func NewOIDCAuth(config OIDCConfig) (*OIDCAuth, error) {
+	if config.Issuer == "" || config.ClientID == "" {
+		return nil, fmt.Errorf("OpenID Connect issuer and client ID are required")
+	}
+	if config.RedirectURL == "" {
+		return nil, fmt.Errorf("OpenID Connect redirect URL is required")
+	}
+	if config.UsernameClaim == "" {
+		return nil, fmt.Errorf("OpenID Connect username claim is required")
+	}
+	if config.SessionTTL <= 0 {
+		return nil, fmt.Errorf("Invalid session TTL value '%v'", config.SessionTTL)
+	}
+
+	secret := config.SessionSecret
+	if secret == "" {
+		log.Warning("No session secret configured, using a random one, all sessions will be lost on restart")
+		var err error
+		secret, err = randomString(32)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hasOpenID := false
+	for _, scope := range config.Scopes {
+		if scope == oidc.ScopeOpenID {
+			hasOpenID = true
+		}
+	}
+	if !hasOpenID {
+		config.Scopes = append([]string{oidc.ScopeOpenID}, config.Scopes...)
+	}
+
+	client := &http.Client{Timeout: time.Second * 30}
+	// provider keys are fetched using the context passed here, so it must
+	// never be cancelled
+	provider, err := oidc.NewProvider(oidc.ClientContext(context.Background(), client), config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("OpenID Connect discovery failed: %s", err)
+	}
+
+	return &OIDCAuth{
+		config: config,
+		client: client,
+		signer: &signer{secret: []byte(secret)},
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  config.RedirectURL,
+			Scopes:       config.Scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+// Authenticate returns the user from a valid session cookie
+func (oa *OIDCAuth) Authenticate(r *http.Request) *User {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	s := session{}
+	if err := oa.signer.verify(cookie.Value, &s); err != nil {
+		return nil
+	}
+	if time.Now().Unix() > s.Expires {
+		return nil
+	}
+	return &User{Name: s.Username, Groups: s.Groups}
+}
+
+// Unauthorized will redirect browsers to the login page, all other requests
+// will get a 401 response
+func (oa *OIDCAuth) Unauthorized(c *gin.Context) {
+	if c.Request.Method == http.MethodGet && strings.Contains(c.GetHeader("Accept"), "text/html") {
+		c.Redirect(http.StatusFound, oa.config.LoginPath+"?next="+url.QueryEscape(c.Request.RequestURI))
+		return
+	}
+	c.String(http.StatusUnauthorized, "Unauthorized")
+}
+
+// Login handler redirects users to the OpenID Connect provider
+func (oa *OIDCAuth) Login(c *gin.Context) {
+	state, err := randomString(16)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	next := c.Query("next")
+	if !isLocalPath(next) {
+		next = oa.config.Prefix
+	}
+
+	value, err := oa.signer.sign(loginState{
+		State:   state,
+		Nonce:   nonce,
+		Next:    next,
+		Expires: time.Now().Add(loginTTL).Unix(),
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	oa.setCookie(c, stateCookie, value, int(loginTTL.Seconds()))
+
+	c.Redirect(http.StatusFound, oa.oauth2.AuthCodeURL(state, oidc.Nonce(nonce)))
+}
+
+// Callback handler is where users are redirected to after logging in with
+// the OpenID Connect provider, it will validate the response and create
+// a new session
+func (oa *OIDCAuth) Callback(c *gin.Context) {
+	user, next, err := oa.handleCallback(c)
+	// state is only valid for a single login attempt
+	oa.setCookie(c, stateCookie, "", -1)
+	if err != nil {
+		log.Warningf("[%s] OpenID Connect login failed: %s", c.ClientIP(), err)
+		c.String(http.StatusUnauthorized, "Authentication failed: %s", err)
+		return
+	}
+
+	value, err := oa.signer.sign(session{
+		Username: user.Name,
+		Groups:   user.Groups,
+		Expires:  time.Now().Add(oa.config.SessionTTL).Unix(),
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	oa.setCookie(c, sessionCookie, value, int(oa.config.SessionTTL.Seconds()))
+	log.Infof("[%s] User '%s' logged in", c.ClientIP(), user.Name)
+	c.Redirect(http.StatusFound, next)
+}
+
+// Logout handler removes the session cookie
+func (oa *OIDCAuth) Logout(c *gin.Context) {
+	oa.setCookie(c, sessionCookie, "", -1)
+	c.Redirect(http.StatusFound, oa.config.Prefix)
+}
+
+func (oa *OIDCAuth) handleCallback(c *gin.Context) (*User, string, error) {
+	if e := c.Query("error"); e != "" {
+		return nil, "", fmt.Errorf("provider returned an error: %s", e)
+	}
+
+	cookie, err := c.Request.Cookie(stateCookie)
+	if err != nil {
+		return nil, "", fmt.Errorf("missing login state cookie")
+	}
+	ls := loginState{}
+	if err := oa.signer.verify(cookie.Value, &ls); err != nil {
+		return nil, "", fmt.Errorf("invalid login state cookie: %s", err)
+	}
+	if time.Now().Unix() > ls.Expires {
+		return nil, "", fmt.Errorf("login state expired")
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(ls.State)) != 1 {
+		return nil, "", fmt.Errorf("state mismatch")
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		return nil, "", fmt.Errorf("missing authorization code")
+	}
+	ctx := oidc.ClientContext(c.Request.Context(), oa.client)
+	token, err := oa.oauth2.Exchange(ctx, code)
+	if err != nil {
+		return nil, "", fmt.Errorf("token request failed: %s", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, "", fmt.Errorf("token response is missing ID token")
+	}
+
+	// verifier checks the signature, issuer, audience and expiry of the token
+	idToken, err := oa.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid ID token: %s", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(ls.Nonce)) != 1 {
+		return nil, "", fmt.Errorf("ID token nonce mismatch")
+	}
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, "", fmt.Errorf("malformed ID token claims: %s", err)
+	}
+	username, _ := claims[oa.config.UsernameClaim].(string)
+	if username == "" {
+		return nil, "", fmt.Errorf("ID token has no '%s' claim", oa.config.UsernameClaim)
+	}
+	user := User{Name: username, Groups: []string{}}
+	if oa.config.GroupsClaim != "" {
+		groups, _ := claims[oa.config.GroupsClaim].([]interface{})
+		for _, g := range groups {
+			if group, ok := g.(string); ok {
+				user.Groups = append(user.Groups, group)
+			}
+		}
+	}
+
+	return &user, ls.Next, nil
+}
+
+// setCookie sets a cookie valid for maxAge seconds, negative maxAge will
+// remove the cookie
+func (oa *OIDCAuth) setCookie(c *gin.Context, name, value string, maxAge int) {
+	secure := strings.HasPrefix(oa.config.RedirectURL, "https://")
+	c.SetCookie(name, value, maxAge, oa.config.Prefix, "", secure, true)
+}
+
+// isLocalPath returns true if the path points to this host, it's used to
+// avoid open redirects
+func isLocalPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.HasPrefix(p, "/\\")
+}
@@ -0,0 +1,355 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mockProvider is a minimal OpenID Connect provider, it issues ID tokens for
+// the code "valid-code" and the claims can be modified by tests
+type mockProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	nonce  string
+	claims map[string]interface{}
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{
+					"kty": "RSA",
+					"kid": "key1",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "unsee" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		if r.PostFormValue("code") != "valid-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "foo",
+			"id_token":     p.idToken(t),
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	p.reset()
+	return p
+}
+
+func (p *mockProvider) reset() {
+	p.claims = map[string]interface{}{
+		"iss":    p.server.URL,
+		"aud":    "unsee",
+		"sub":    "123",
+		"email":  "alice@example.com",
+		"groups": []string{"ops", "dev"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func (p *mockProvider) idToken(t *testing.T) string {
+	claims := map[string]interface{}{"nonce": p.nonce}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "key1"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hashed := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func oidcTestRouter(t *testing.T, p *mockProvider) *gin.Engine {
+	oa, err := auth.NewOIDCAuth(auth.OIDCConfig{
+		Issuer:        p.server.URL,
+		ClientID:      "unsee",
+		ClientSecret:  "secret",
+		RedirectURL:   "http://example.com/auth/callback",
+		Scopes:        []string{"email"},
+		UsernameClaim: "email",
+		GroupsClaim:   "groups",
+		SessionSecret: "session-secret",
+		SessionTTL:    time.Hour,
+		Prefix:        "/",
+		LoginPath:     "/auth/login",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/auth/login", oa.Login)
+	r.GET("/auth/callback", oa.Callback)
+	r.GET("/auth/logout", oa.Logout)
+	r.Use(auth.Middleware(oa))
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "%s %v", auth.GetUsername(c), auth.GetUser(c).Groups)
+	})
+	return r
+}
+
+func getCookie(resp *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range (&http.Response{Header: resp.Header()}).Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// login will start the login flow and return the state cookie and the state
+// sent to the provider, nonce is stored in the provider
+func login(t *testing.T, r *gin.Engine, p *mockProvider, next string) (*http.Cookie, string) {
+	req := httptest.NewRequest("GET", "/auth/login?next="+url.QueryEscape(next), nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusFound {
+		t.Fatalf("Login returned status %d", resp.Code)
+	}
+
+	location, err := url.Parse(resp.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), p.server.URL+"/authorize?") {
+		t.Errorf("Login redirected to '%s'", location)
+	}
+	q := location.Query()
+	if q.Get("client_id") != "unsee" {
+		t.Errorf("Invalid client_id '%s'", q.Get("client_id"))
+	}
+	if q.Get("scope") != "openid email" {
+		t.Errorf("Invalid scope '%s'", q.Get("scope"))
+	}
+	if q.Get("redirect_uri") != "http://example.com/auth/callback" {
+		t.Errorf("Invalid redirect_uri '%s'", q.Get("redirect_uri"))
+	}
+	p.nonce = q.Get("nonce")
+
+	cookie := getCookie(resp, "unsee_oidc_state")
+	if cookie == nil {
+		t.Fatal("Login didn't set the state cookie")
+	}
+	return cookie, q.Get("state")
+}
+
+func callback(r *gin.Engine, cookie *http.Cookie, state, code string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/auth/callback?code="+code+"&state="+url.QueryEscape(state), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestOIDCLogin(t *testing.T) {
+	p := newMockProvider(t)
+	defer p.server.Close()
+	r := oidcTestRouter(t, p)
+
+	// browsers are redirected to the login page
+	req := httptest.NewRequest("GET", "/?q=foo", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusFound || resp.Header().Get("Location") != "/auth/login?next=%2F%3Fq%3Dfoo" {
+		t.Errorf("Unauthenticated browser request returned %d with Location '%s'", resp.Code, resp.Header().Get("Location"))
+	}
+
+	// API requests get 401
+	req = httptest.NewRequest("GET", "/", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("Unauthenticated API request returned %d", resp.Code)
+	}
+
+	cookie, state := login(t, r, p, "/?q=foo")
+	resp = callback(r, cookie, state, "valid-code")
+	if resp.Code != http.StatusFound {
+		t.Fatalf("Callback returned %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp.Header().Get("Location") != "/?q=foo" {
+		t.Errorf("Callback redirected to '%s'", resp.Header().Get("Location"))
+	}
+	session := getCookie(resp, "unsee_session")
+	if session == nil {
+		t.Fatal("Callback didn't set the session cookie")
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(session)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || resp.Body.String() != "alice@example.com [ops dev]" {
+		t.Errorf("Authenticated request returned %d with body '%s'", resp.Code, resp.Body.String())
+	}
+
+	// tampered session cookie is rejected
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: session.Name, Value: "x" + session.Value})
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("Request with tampered session cookie returned %d", resp.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/auth/logout", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if cookie := getCookie(resp, "unsee_session"); cookie == nil || cookie.MaxAge >= 0 {
+		t.Errorf("Logout didn't remove the session cookie: %v", cookie)
+	}
+}
+
+func TestOIDCLoginOpenRedirect(t *testing.T) {
+	p := newMockProvider(t)
+	defer p.server.Close()
+	r := oidcTestRouter(t, p)
+
+	for _, next := range []string{"//evil.example.com/", "http://evil.example.com/", "/\\evil.example.com"} {
+		cookie, state := login(t, r, p, next)
+		resp := callback(r, cookie, state, "valid-code")
+		if resp.Code != http.StatusFound || resp.Header().Get("Location") != "/" {
+			t.Errorf("[%s] Callback returned %d with Location '%s'", next, resp.Code, resp.Header().Get("Location"))
+		}
+	}
+}
+
+type oidcCallbackTest struct {
+	name     string
+	claims   map[string]interface{}
+	code     string
+	state    string
+	noCookie bool
+	nonce    string
+}
+
+var oidcCallbackTests = []oidcCallbackTest{
+	{name: "invalid code", code: "invalid-code"},
+	{name: "state mismatch", state: "foo"},
+	{name: "missing state cookie", noCookie: true},
+	{name: "nonce mismatch", nonce: "foo"},
+	{name: "expired token", claims: map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()}},
+	{name: "invalid audience", claims: map[string]interface{}{"aud": "foo"}},
+	{name: "invalid issuer", claims: map[string]interface{}{"iss": "http://evil.example.com"}},
+	{name: "missing username claim", claims: map[string]interface{}{"email": ""}},
+}
+
+func TestOIDCCallbackErrors(t *testing.T) {
+	p := newMockProvider(t)
+	defer p.server.Close()
+	r := oidcTestRouter(t, p)
+
+	for _, testCase := range oidcCallbackTests {
+		p.reset()
+		for k, v := range testCase.claims {
+			p.claims[k] = v
+		}
+
+		cookie, state := login(t, r, p, "/")
+		if testCase.state != "" {
+			state = testCase.state
+		}
+		if testCase.noCookie {
+			cookie = nil
+		}
+		if testCase.nonce != "" {
+			p.nonce = testCase.nonce
+		}
+		code := "valid-code"
+		if testCase.code != "" {
+			code = testCase.code
+		}
+
+		resp := callback(r, cookie, state, code)
+		if resp.Code != http.StatusUnauthorized {
+			t.Errorf("[%s] Callback returned %d while 401 was expected", testCase.name, resp.Code)
+		}
+		if cookie := getCookie(resp, "unsee_session"); cookie != nil {
+			t.Errorf("[%s] Callback set the session cookie", testCase.name)
+		}
+	}
+}
+
+func TestOIDCDiscoveryFailure(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := auth.NewOIDCAuth(auth.OIDCConfig{
+		Issuer:        server.URL,
+		ClientID:      "unsee",
+		RedirectURL:   "http://example.com/auth/callback",
+		UsernameClaim: "email",
+		SessionTTL:    time.Hour,
+	})
+	if err == nil {
+		t.Error("NewOIDCAuth() didn't return any error when discovery failed")
+	}
+}
+
+func TestOIDCRedirectURLRequired(t *testing.T) {
+	p := newMockProvider(t)
+	defer p.server.Close()
+
+	_, err := auth.NewOIDCAuth(auth.OIDCConfig{
+		Issuer:        p.server.URL,
+		ClientID:      "unsee",
+		UsernameClaim: "email",
+		SessionTTL:    time.Hour,
+	})
+	if err == nil {
+		t.Error("NewOIDCAuth() didn't return any error without a redirect URL")
+	}
+}
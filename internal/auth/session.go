@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// signer encodes values stored in cookies, those are signed so users can't
+// modify them but they're not encrypted, so they must not contain secrets
+type signer struct {
+	secret []byte
+}
+
+func (s *signer) mac(payload string) string {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// sign returns JSON encoded value with the signature appended
+func (s *signer) sign(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + s.mac(payload), nil
+}
+
+// verify checks the signature and decodes signed value into v
+func (s *signer) verify(value string, v interface{}) error {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return fmt.Errorf("Invalid signed value")
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(s.mac(parts[0]))) {
+		return fmt.Errorf("Invalid signature")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// randomString returns a random, URL safe string with n bytes of entropy
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
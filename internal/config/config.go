@@ -6,6 +6,7 @@ import (
 	"flag"
 	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/cloudflare/unsee/internal/uri"
@@ -17,11 +18,15 @@ import (
 )
 
 var (
-	// Config will hold final configuration read from the file and flags
-	Config configSchema
+	// current holds a pointer to the configuration in use, it's replaced as a
+	// whole when configuration is reloaded, so it's safe to read from any
+	// goroutine
+	current atomic.Value
 )
 
 func init() {
+	current.Store(&configSchema{})
+
 	pflag.Duration("alertmanager.interval", time.Minute,
 		"Interval for fetching data from Alertmanager servers")
 	pflag.String("alertmanager.name", "default",
@@ -32,6 +37,10 @@ func init() {
 		"Timeout for requests sent to the Alertmanager server (only used with simplified config)")
 	pflag.Bool("alertmanager.proxy", false,
 		"Proxy all client requests to Alertmanager via unsee (only used with simplified config)")
+	pflag.Int("alertmanager.stale.cycles", 0,
+		"Number of failed pulls from an Alertmanager server during which alerts from the last successful pull are kept")
+	pflag.Duration("alertmanager.stale.age", 0,
+		"Maximum age of alerts kept from an Alertmanager server after failed pulls, no limit if 0")
 
 	pflag.Bool(
 		"annotations.default.hidden", false,
@@ -41,15 +50,61 @@ func init() {
 	pflag.StringSlice("annotations.visible", []string{},
 		"List of annotations that are visible by default")
 
+	pflag.String("audit.path", "",
+		"Path to the audit log file with all silence operations, file audit log is disabled if empty")
+	pflag.Int("audit.rotate.size", 100,
+		"Size in megabytes at which the audit log file is rotated")
+	pflag.Int("audit.rotate.backups", 5,
+		"Number of rotated audit log files to keep")
+	pflag.String("audit.webhook.uri", "",
+		"URI to send every audit log entry to, webhook is disabled if empty")
+	pflag.Duration("audit.webhook.timeout", time.Second*10,
+		"Timeout for requests sent to the audit log webhook")
+
+	pflag.String("authentication.mode", "",
+		"Authentication mode, one of: basic, header and oidc, authentication is disabled if empty")
+	pflag.String("authentication.header.name", "X-Forwarded-User",
+		"Name of the header with the username set by the authentication proxy (only used with header mode)")
+	pflag.String("authentication.header.groups", "",
+		"Name of the header with a comma separated list of groups user belongs to (only used with header mode)")
+	pflag.String("authentication.oidc.issuer", "",
+		"OpenID Connect issuer URL (only used with oidc mode)")
+	pflag.String("authentication.oidc.client.id", "",
+		"OpenID Connect client ID (only used with oidc mode)")
+	pflag.String("authentication.oidc.client.secret", "",
+		"OpenID Connect client secret (only used with oidc mode)")
+	pflag.String("authentication.oidc.redirect", "",
+		"OpenID Connect redirect URL, it must point to the /auth/callback path (required for oidc mode)")
+	pflag.StringSlice("authentication.oidc.scopes", []string{"openid", "email"},
+		"List of OpenID Connect scopes to request (only used with oidc mode)")
+	pflag.String("authentication.oidc.claim", "email",
+		"OpenID Connect ID token claim used as the username (only used with oidc mode)")
+	pflag.String("authentication.oidc.groups", "groups",
+		"OpenID Connect ID token claim with the list of groups user belongs to (only used with oidc mode)")
+	pflag.String("authentication.oidc.session.secret", "",
+		"Secret used to sign session cookies, random secret is generated on startup if empty (only used with oidc mode)")
+	pflag.Duration("authentication.oidc.session.ttl", time.Hour*24,
+		"How long user sessions are valid for (only used with oidc mode)")
+
 	pflag.String("config.dir", ".",
 		"Directory with configuration file to read")
 	pflag.String("config.file", "unsee",
 		"Name of the configuration file to read")
+	pflag.Bool("config.watch", false,
+		"Reload configuration when the configuration file is modified")
 
 	pflag.Bool("debug", false, "Enable debug mode")
 
 	pflag.StringSlice("filters.default", []string{}, "List of default filters")
 
+	pflag.StringSlice("grouping.by", []string{},
+		"List of label names used to group alerts, groups from Alertmanager are used if empty")
+
+	pflag.String("history.path", "",
+		"Path to the alert history database file, history is disabled if empty")
+	pflag.Duration("history.retention", time.Hour*24*7,
+		"How long to keep alert history for")
+
 	pflag.StringSlice("labels.color.static", []string{},
 		"List of label names that should have the same (but distinct) color")
 	pflag.StringSlice("labels.color.unique", []string{},
@@ -73,11 +128,66 @@ func init() {
 
 	pflag.String("sentry.public", "", "Sentry DSN for Go exceptions")
 	pflag.String("sentry.private", "", "Sentry DSN for JavaScript exceptions")
+
+	pflag.Duration("silences.expiring", time.Hour,
+		"Silences ending within this duration while still matching alerts are reported as expiring")
+	pflag.Duration("silences.stale", time.Hour*24,
+		"Silences not matching any alert for longer than this duration are reported as stale")
+
+	pflag.StringSlice("sorting.default", []string{},
+		"List of keys used to sort alerts if no sort query argument was passed")
+	pflag.String("sorting.severity.label", "severity",
+		"Name of the label with alert severity, used when sorting alerts by severity")
+	pflag.StringSlice("sorting.severity.values", []string{"critical", "error", "warning", "info"},
+		"List of severity label values from the most to the least important one")
 }
 
-// ReadConfig will read all sources of configuration, merge all keys and
-// populate global Config variable, it should be only called on startup
-func (config *configSchema) Read() {
+// Config returns the configuration in use, returned value is shared with all
+// other goroutines so it must never be modified, a modified copy needs to be
+// passed to Set() instead
+func Config() *configSchema {
+	return current.Load().(*configSchema)
+}
+
+// Set will replace the configuration in use with passed one
+func Set(config *configSchema) {
+	current.Store(config)
+}
+
+// Read will read all sources of configuration, merge all keys and use the
+// result as the configuration in use, it should be only called on startup
+func Read() {
+	config, err := Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	Set(config)
+}
+
+// Load will read all sources of configuration and return the result without
+// replacing the configuration in use, it's used to reload configuration
+func Load() (*configSchema, error) {
+	config := &configSchema{}
+	err := config.read()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// FileUsed returns the path of the configuration file that was read, it's
+// empty if no file was found
+func (config *configSchema) FileUsed() string {
+	return config.fileUsed
+}
+
+// WatchFile returns true if the configuration file should be watched for
+// changes and reloaded
+func (config *configSchema) WatchFile() bool {
+	return config.watchFile
+}
+
+func (config *configSchema) read() error {
 	v := viper.New()
 
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
@@ -102,20 +212,44 @@ func (config *configSchema) Read() {
 	log.Infof("Reading configuration file %s.yaml", path.Join(configDir, configFile))
 	err := v.ReadInConfig()
 	if v.ConfigFileUsed() != "" && err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	if v.ConfigFileUsed() != "" {
 		log.Infof("Config file used: %s", v.ConfigFileUsed())
 	}
+	config.fileUsed = v.ConfigFileUsed()
+	config.watchFile = v.GetBool("config.watch")
 
 	config.Alertmanager.Servers = []alertmanagerConfig{}
 	config.Alertmanager.Interval = v.GetDuration("alertmanager.interval")
+	config.Alertmanager.Stale.Cycles = v.GetInt("alertmanager.stale.cycles")
+	config.Alertmanager.Stale.Age = v.GetDuration("alertmanager.stale.age")
 	config.Annotations.Default.Hidden = v.GetBool("annotations.default.hidden")
 	config.Annotations.Hidden = v.GetStringSlice("annotations.hidden")
 	config.Annotations.Visible = v.GetStringSlice("annotations.visible")
+	config.Audit.Path = v.GetString("audit.path")
+	config.Audit.Rotate.Size = v.GetInt("audit.rotate.size")
+	config.Audit.Rotate.Backups = v.GetInt("audit.rotate.backups")
+	config.Audit.Webhook.URI = v.GetString("audit.webhook.uri")
+	config.Audit.Webhook.Timeout = v.GetDuration("audit.webhook.timeout")
+	config.Authentication.Mode = v.GetString("authentication.mode")
+	config.Authentication.Header.Name = v.GetString("authentication.header.name")
+	config.Authentication.Header.Groups = v.GetString("authentication.header.groups")
+	config.Authentication.OIDC.Issuer = v.GetString("authentication.oidc.issuer")
+	config.Authentication.OIDC.Client.ID = v.GetString("authentication.oidc.client.id")
+	config.Authentication.OIDC.Client.Secret = v.GetString("authentication.oidc.client.secret")
+	config.Authentication.OIDC.Redirect = v.GetString("authentication.oidc.redirect")
+	config.Authentication.OIDC.Scopes = v.GetStringSlice("authentication.oidc.scopes")
+	config.Authentication.OIDC.Claim = v.GetString("authentication.oidc.claim")
+	config.Authentication.OIDC.Groups = v.GetString("authentication.oidc.groups")
+	config.Authentication.OIDC.Session.Secret = v.GetString("authentication.oidc.session.secret")
+	config.Authentication.OIDC.Session.TTL = v.GetDuration("authentication.oidc.session.ttl")
 	config.Debug = v.GetBool("debug")
 	config.Filters.Default = v.GetStringSlice("filters.default")
+	config.Grouping.By = v.GetStringSlice("grouping.by")
+	config.History.Path = v.GetString("history.path")
+	config.History.Retention = v.GetDuration("history.retention")
 	config.Labels.Color.Static = v.GetStringSlice("labels.color.static")
 	config.Labels.Color.Unique = v.GetStringSlice("labels.color.unique")
 	config.Labels.Keep = v.GetStringSlice("labels.keep")
@@ -129,15 +263,56 @@ func (config *configSchema) Read() {
 	config.Receivers.Strip = v.GetStringSlice("receivers.strip")
 	config.Sentry.Private = v.GetString("sentry.private")
 	config.Sentry.Public = v.GetString("sentry.public")
+	config.Silences.Expiring = v.GetDuration("silences.expiring")
+	config.Silences.Stale = v.GetDuration("silences.stale")
+	config.Sorting.Default = v.GetStringSlice("sorting.default")
+	config.Sorting.Severity.Label = v.GetString("sorting.severity.label")
+	config.Sorting.Severity.Values = v.GetStringSlice("sorting.severity.values")
 
 	err = v.UnmarshalKey("alertmanager.servers", &config.Alertmanager.Servers)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	config.Alertmanager.Discovery.File = []fileDiscoveryConfig{}
+	err = v.UnmarshalKey("alertmanager.discovery.file", &config.Alertmanager.Discovery.File)
+	if err != nil {
+		return err
+	}
+
+	config.Alertmanager.Discovery.Kubernetes = []kubernetesDiscoveryConfig{}
+	err = v.UnmarshalKey("alertmanager.discovery.kubernetes", &config.Alertmanager.Discovery.Kubernetes)
+	if err != nil {
+		return err
+	}
+
+	config.Authentication.Basic.Users = []authUser{}
+	err = v.UnmarshalKey("authentication.basic.users", &config.Authentication.Basic.Users)
+	if err != nil {
+		return err
+	}
+
+	config.Authorization.Rules = []authorizationRule{}
+	err = v.UnmarshalKey("authorization.rules", &config.Authorization.Rules)
+	if err != nil {
+		return err
 	}
 
 	err = v.UnmarshalKey("jira", &config.JIRA)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	config.Relabel = []relabelRule{}
+	err = v.UnmarshalKey("relabel", &config.Relabel)
+	if err != nil {
+		return err
+	}
+
+	config.Links = []linkRule{}
+	err = v.UnmarshalKey("links", &config.Links)
+	if err != nil {
+		return err
 	}
 
 	// accept single Alertmanager server from flag/env if nothing is set yet
@@ -152,6 +327,8 @@ func (config *configSchema) Read() {
 			},
 		}
 	}
+
+	return nil
 }
 
 // LogValues will dump runtime config to logs
@@ -165,6 +342,7 @@ func (config *configSchema) LogValues() {
 		server := alertmanagerConfig{
 			Name:    s.Name,
 			URI:     uri.SanitizeURI(s.URI),
+			Cluster: s.Cluster,
 			Timeout: s.Timeout,
 			TLS:     s.TLS,
 			Proxy:   s.Proxy,
@@ -173,9 +351,35 @@ func (config *configSchema) LogValues() {
 	}
 	cfg.Alertmanager.Servers = servers
 
+	// Kubernetes API server URIs might have credentials
+	kubernetes := []kubernetesDiscoveryConfig{}
+	for _, k := range cfg.Alertmanager.Discovery.Kubernetes {
+		k.APIServer = uri.SanitizeURI(k.APIServer)
+		kubernetes = append(kubernetes, k)
+	}
+	cfg.Alertmanager.Discovery.Kubernetes = kubernetes
+
+	// webhook URI might have credentials
+	if cfg.Audit.Webhook.URI != "" {
+		cfg.Audit.Webhook.URI = uri.SanitizeURI(cfg.Audit.Webhook.URI)
+	}
+
+	// replace all authentication secrets with 'xxx'
+	users := []authUser{}
+	for _, u := range cfg.Authentication.Basic.Users {
+		users = append(users, authUser{Username: u.Username, Password: "xxx", Groups: u.Groups})
+	}
+	cfg.Authentication.Basic.Users = users
+	if cfg.Authentication.OIDC.Client.Secret != "" {
+		cfg.Authentication.OIDC.Client.Secret = "xxx"
+	}
+	if cfg.Authentication.OIDC.Session.Secret != "" {
+		cfg.Authentication.OIDC.Session.Secret = "xxx"
+	}
+
 	// replace secret in Sentry DNS with 'xxx'
-	if config.Sentry.Private != "" {
-		config.Sentry.Private = uri.SanitizeURI(config.Sentry.Private)
+	if cfg.Sentry.Private != "" {
+		cfg.Sentry.Private = uri.SanitizeURI(cfg.Sentry.Private)
 	}
 
 	out, err := yaml.Marshal(cfg)
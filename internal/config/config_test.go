@@ -1,7 +1,9 @@
 package config
 
 import (
+	"io/ioutil"
 	"os"
+	"path"
 	"testing"
 	"time"
 
@@ -17,16 +19,39 @@ import (
 func resetEnv() {
 	unseeEnvVariables := []string{
 		"ALERTMANAGER_INTERVAL",
+		"ALERTMANAGER_STALE_CYCLES",
+		"ALERTMANAGER_STALE_AGE",
 		"ALERTMANAGER_URI",
 		"ALERTMANAGER_NAME",
 		"ALERTMANAGET_TIMEOUT",
 		"ANNOTATIONS_DEFAULT_HIDDEN",
 		"ANNOTATIONS_HIDDEN",
 		"ANNOTATIONS_VISIBLE",
+		"AUDIT_PATH",
+		"AUDIT_ROTATE_SIZE",
+		"AUDIT_ROTATE_BACKUPS",
+		"AUDIT_WEBHOOK_URI",
+		"AUDIT_WEBHOOK_TIMEOUT",
+		"AUTHENTICATION_MODE",
+		"AUTHENTICATION_HEADER_NAME",
+		"AUTHENTICATION_HEADER_GROUPS",
+		"AUTHENTICATION_OIDC_ISSUER",
+		"AUTHENTICATION_OIDC_CLIENT_ID",
+		"AUTHENTICATION_OIDC_CLIENT_SECRET",
+		"AUTHENTICATION_OIDC_REDIRECT",
+		"AUTHENTICATION_OIDC_SCOPES",
+		"AUTHENTICATION_OIDC_CLAIM",
+		"AUTHENTICATION_OIDC_GROUPS",
+		"AUTHENTICATION_OIDC_SESSION_SECRET",
+		"AUTHENTICATION_OIDC_SESSION_TTL",
 		"CONFIG_DIR",
 		"CONFIG_FILE",
+		"CONFIG_WATCH",
 		"DEBUG",
 		"FILTERS_DEFAULT",
+		"GROUPING_BY",
+		"HISTORY_PATH",
+		"HISTORY_RETENTION",
 		"LABELS_COLOR_STATIC",
 		"LABELS_COLOR_UNIQUE",
 		"LABELS_KEEP",
@@ -40,6 +65,11 @@ func resetEnv() {
 		"RECEIVERS_STRIP",
 		"SENTRY_PRIVATE",
 		"SENTRY_PUBLIC",
+		"SILENCES_EXPIRING",
+		"SILENCES_STALE",
+		"SORTING_DEFAULT",
+		"SORTING_SEVERITY_LABEL",
+		"SORTING_SEVERITY_VALUES",
 
 		"HOST",
 		"PORT",
@@ -53,26 +83,71 @@ func resetEnv() {
 func testReadConfig(t *testing.T) {
 	expectedConfig := `alertmanager:
   interval: 1s
+  stale:
+    cycles: 3
+    age: 5m0s
   servers:
   - name: default
     uri: http://localhost
+    cluster: ""
     timeout: 40s
     proxy: false
     tls:
       ca: ""
       cert: ""
       key: ""
+  discovery:
+    file: []
+    kubernetes: []
 annotations:
   default:
     hidden: true
   hidden: []
   visible:
   - summary
+audit:
+  path: ""
+  rotate:
+    size: 100
+    backups: 5
+  webhook:
+    uri: ""
+    timeout: 10s
+authentication:
+  mode: ""
+  basic:
+    users: []
+  header:
+    name: X-Forwarded-User
+    groups: ""
+  oidc:
+    issuer: ""
+    client:
+      id: ""
+      secret: ""
+    redirect: ""
+    scopes:
+    - openid
+    - email
+    claim: email
+    groups: groups
+    session:
+      secret: ""
+      ttl: 24h0m0s
+authorization:
+  rules: []
 debug: true
 filters:
   default:
   - '@state=active'
   - foo=bar
+grouping:
+  by:
+  - cluster
+  - '@receiver'
+history:
+  path: ""
+  retention: 168h0m0s
 labels:
   keep:
   - foo
@@ -96,15 +171,29 @@ log:
   config: true
   level: info
 jira: []
+links: []
 receivers:
   keep: []
   strip: []
+relabel: []
 sentry:
   private: secret key
   public: public key
+silences:
+  expiring: 1h0m0s
+  stale: 24h0m0s
+sorting:
+  default: []
+  severity:
+    label: severity
+    values:
+    - critical
+    - error
+    - warning
+    - info
 `
 
-	configDump, err := yaml.Marshal(Config)
+	configDump, err := yaml.Marshal(Config())
 	if err != nil {
 		t.Error(err)
 	}
@@ -129,11 +218,14 @@ func TestReadConfig(t *testing.T) {
 	resetEnv()
 	log.SetLevel(log.ErrorLevel)
 	os.Setenv("ALERTMANAGER_INTERVAL", "1s")
+	os.Setenv("ALERTMANAGER_STALE_CYCLES", "3")
+	os.Setenv("ALERTMANAGER_STALE_AGE", "5m")
 	os.Setenv("ALERTMANAGER_URI", "http://localhost")
 	os.Setenv("ANNOTATIONS_DEFAULT_HIDDEN", "true")
 	os.Setenv("ANNOTATIONS_VISIBLE", "summary")
 	os.Setenv("DEBUG", "true")
 	os.Setenv("FILTERS_DEFAULT", "@state=active foo=bar")
+	os.Setenv("GROUPING_BY", "cluster @receiver")
 	os.Setenv("LABELS_COLOR_STATIC", "a bb ccc")
 	os.Setenv("LABELS_COLOR_UNIQUE", "f gg")
 	os.Setenv("LABELS_KEEP", "foo bar")
@@ -142,7 +234,7 @@ func TestReadConfig(t *testing.T) {
 	os.Setenv("LISTEN_PORT", "80")
 	os.Setenv("SENTRY_PRIVATE", "secret key")
 	os.Setenv("SENTRY_PUBLIC", "public key")
-	Config.Read()
+	Read()
 	testReadConfig(t)
 }
 
@@ -154,23 +246,78 @@ func TestReadSimpleConfig(t *testing.T) {
 	os.Setenv("ALERTMANAGER_TIMEOUT", "15s")
 	os.Setenv("ALERTMANAGER_PROXY", "true")
 	os.Setenv("ALERTMANAGER_INTERVAL", "3m")
-	Config.Read()
-	if len(Config.Alertmanager.Servers) != 1 {
-		t.Errorf("Expected 1 Alertmanager server, got %d", len(Config.Alertmanager.Servers))
+	Read()
+	if len(Config().Alertmanager.Servers) != 1 {
+		t.Errorf("Expected 1 Alertmanager server, got %d", len(Config().Alertmanager.Servers))
 	} else {
-		am := Config.Alertmanager.Servers[0]
+		am := Config().Alertmanager.Servers[0]
 		if am.Name != "single" {
 			t.Errorf("Expect Alertmanager name 'single' got '%s'", am.Name)
 		}
 		if am.Timeout != time.Second*15 {
 			t.Errorf("Expect Alertmanager timeout '%v' got '%v'", time.Second*15, am.Timeout)
 		}
-		if Config.Alertmanager.Interval != time.Minute*3 {
-			t.Errorf("Expect Alertmanager timeout '%v' got '%v'", time.Minute*3, Config.Alertmanager.Interval)
+		if Config().Alertmanager.Interval != time.Minute*3 {
+			t.Errorf("Expect Alertmanager timeout '%v' got '%v'", time.Minute*3, Config().Alertmanager.Interval)
 		}
 	}
 }
 
+func TestLoadConfig(t *testing.T) {
+	resetEnv()
+	log.SetLevel(log.ErrorLevel)
+
+	dir, err := ioutil.TempDir("", "unsee-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := path.Join(dir, "unsee.yaml")
+
+	os.Setenv("CONFIG_DIR", dir)
+	os.Setenv("ALERTMANAGER_URI", "http://localhost")
+	Read()
+	current := Config()
+	if current.FileUsed() != "" {
+		t.Errorf("FileUsed() returned '%s' with no config file present", current.FileUsed())
+	}
+
+	err = ioutil.WriteFile(configFile, []byte("log:\n  level: debug\nlabels:\n  strip:\n    - foo\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %s", err)
+	}
+	if loaded.Log.Level != "debug" || len(loaded.Labels.Strip) != 1 {
+		t.Errorf("Load() didn't read the config file: %v", loaded)
+	}
+	if loaded.FileUsed() != configFile {
+		t.Errorf("FileUsed() returned '%s', expected '%s'", loaded.FileUsed(), configFile)
+	}
+	if Config() != current || current.Log.Level == "debug" {
+		t.Errorf("Config in use was modified by Load(): %v", Config())
+	}
+
+	Set(loaded)
+	if Config() != loaded {
+		t.Errorf("Config() didn't return config passed to Set()")
+	}
+
+	err = ioutil.WriteFile(configFile, []byte("log: [\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Load(); err == nil {
+		t.Error("Load() didn't return any error for invalid config file")
+	}
+	if Config() != loaded {
+		t.Errorf("Config was modified after failed Load(): %v", Config())
+	}
+	resetEnv()
+}
+
 type urlSecretTest struct {
 	raw       string
 	sanitized string
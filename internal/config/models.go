@@ -5,6 +5,7 @@ import "time"
 type alertmanagerConfig struct {
 	Name    string
 	URI     string
+	Cluster string
 	Timeout time.Duration
 	Proxy   bool
 	TLS     struct {
@@ -14,15 +15,86 @@ type alertmanagerConfig struct {
 	}
 }
 
+type fileDiscoveryConfig struct {
+	Files   []string
+	Scheme  string
+	Path    string
+	Name    string
+	Cluster string
+	Timeout time.Duration
+	Proxy   bool
+	TLS     struct {
+		CA   string
+		Cert string
+		Key  string
+	}
+}
+
+type kubernetesDiscoveryConfig struct {
+	APIServer  string
+	Kubeconfig string
+	Namespace  string
+	Selector   string
+	Port       string
+	Scheme     string
+	Path       string
+	Name       string
+	Cluster    string
+	Timeout    time.Duration
+	Proxy      bool
+	TLS        struct {
+		CA   string
+		Cert string
+		Key  string
+	}
+}
+
+type authUser struct {
+	Username string
+	Password string
+	Groups   []string
+}
+
+type authorizationRule struct {
+	Users         []string
+	Groups        []string
+	Alertmanagers []string
+	Matchers      []map[string]string
+}
+
 type jiraRule struct {
 	Regex string
 	URI   string
 }
 
+type relabelRule struct {
+	SourceLabels []string `mapstructure:"source_labels" yaml:"source_labels"`
+	Separator    string
+	Regex        string
+	TargetLabel  string `mapstructure:"target_label" yaml:"target_label"`
+	Replacement  string
+	Action       string
+}
+
+type linkRule struct {
+	Name    string
+	Regex   string
+	URI     string
+	Sources []string
+}
+
 type configSchema struct {
 	Alertmanager struct {
 		Interval time.Duration
-		Servers  []alertmanagerConfig
+		Stale    struct {
+			Cycles int
+			Age    time.Duration
+		}
+		Servers   []alertmanagerConfig
+		Discovery struct {
+			File       []fileDiscoveryConfig
+			Kubernetes []kubernetesDiscoveryConfig
+		}
 	}
 	Annotations struct {
 		Default struct {
@@ -31,10 +103,56 @@ type configSchema struct {
 		Hidden  []string
 		Visible []string
 	}
+	Audit struct {
+		Path   string
+		Rotate struct {
+			Size    int
+			Backups int
+		}
+		Webhook struct {
+			URI     string
+			Timeout time.Duration
+		}
+	}
+	Authentication struct {
+		Mode  string
+		Basic struct {
+			Users []authUser
+		}
+		Header struct {
+			Name   string
+			Groups string
+		}
+		OIDC struct {
+			Issuer string
+			Client struct {
+				ID     string
+				Secret string
+			}
+			Redirect string
+			Scopes   []string
+			Claim    string
+			Groups   string
+			Session  struct {
+				Secret string
+				TTL    time.Duration
+			}
+		}
+	}
+	Authorization struct {
+		Rules []authorizationRule
+	}
 	Debug   bool
 	Filters struct {
 		Default []string
 	}
+	Grouping struct {
+		By []string
+	}
+	History struct {
+		Path      string
+		Retention time.Duration
+	}
 	Labels struct {
 		Keep  []string
 		Strip []string
@@ -53,12 +171,29 @@ type configSchema struct {
 		Level  string
 	}
 	JIRA      []jiraRule
+	Links     []linkRule
 	Receivers struct {
 		Keep  []string
 		Strip []string
 	}
-	Sentry struct {
+	Relabel []relabelRule
+	Sentry  struct {
 		Private string
 		Public  string
 	}
+	Silences struct {
+		Expiring time.Duration
+		Stale    time.Duration
+	}
+	Sorting struct {
+		Default  []string
+		Severity struct {
+			Label  string
+			Values []string
+		}
+	}
+	// those are not part of the config file, they're only needed to
+	// reload it
+	fileUsed  string
+	watchFile bool
 }
@@ -0,0 +1,63 @@
+// Package discovery implements dynamic discovery of Alertmanager instances,
+// every discovery mechanism returns a list of targets and unsee will create
+// an Alertmanager upstream for each of them
+package discovery
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/template"
+)
+
+// Target is a single Alertmanager instance found by discovery
+type Target struct {
+	Name string
+	URI  string
+}
+
+// Discoverer is implemented by every discovery mechanism
+type Discoverer interface {
+	// Targets returns the list of currently known targets sorted by name
+	Targets() ([]Target, error)
+}
+
+// ParseNameTemplate will parse the template used to generate target names,
+// defaultTemplate is used if text is empty
+func ParseNameTemplate(text, defaultTemplate string) (*template.Template, error) {
+	if text == "" {
+		text = defaultTemplate
+	}
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid name template '%s': %s", text, err)
+	}
+	return tmpl, nil
+}
+
+func executeNameTemplate(tmpl *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	if buf.Len() == 0 {
+		return "", fmt.Errorf("Name template '%s' generated an empty name", tmpl.Root.String())
+	}
+	return buf.String(), nil
+}
+
+// sortTargets sorts targets by name and drops any target with a duplicated
+// name, the first target is kept
+func sortTargets(targets []Target) []Target {
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].Name < targets[j].Name
+	})
+	result := []Target{}
+	for i, target := range targets {
+		if i > 0 && targets[i-1].Name == target.Name {
+			continue
+		}
+		result = append(result, target)
+	}
+	return result
+}
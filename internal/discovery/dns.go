@@ -0,0 +1,139 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Resolver is used to resolve DNS records, it's implemented by net.Resolver
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// supported DNS discovery URI schemes, scheme of discovered URIs will be
+// https if it's suffixed with +https, http otherwise
+const (
+	dnsSchemeSRV = "dns+srv"
+	dnsSchemeA   = "dns+a"
+)
+
+// IsDNSURI returns true if passed URI should be resolved using DNS discovery
+func IsDNSURI(uri string) bool {
+	return strings.HasPrefix(uri, "dns+")
+}
+
+// DNSDiscovery resolves SRV or A/AAAA records and returns a target for every
+// resolved address
+type DNSDiscovery struct {
+	name     string
+	uri      *url.URL
+	srv      bool
+	scheme   string
+	resolver Resolver
+	lock     sync.RWMutex
+	targets  []Target
+}
+
+// NewDNSDiscovery creates a new instance of DNS discovery for given URI, name
+// is used as a prefix for all target names. Supported URI formats are:
+// dns+srv://_service._proto.domain[/path] and dns+a://domain:port[/path],
+// append +https to the scheme to use https for discovered URIs
+func NewDNSDiscovery(name, uri string, resolver Resolver) (*DNSDiscovery, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid DNS discovery URI '%s': %s", uri, err)
+	}
+
+	d := DNSDiscovery{name: name, uri: u, scheme: "http", resolver: resolver, targets: []Target{}}
+	recordScheme := u.Scheme
+	if strings.HasSuffix(recordScheme, "+https") {
+		recordScheme = strings.TrimSuffix(recordScheme, "+https")
+		d.scheme = "https"
+	}
+	switch recordScheme {
+	case dnsSchemeSRV:
+		d.srv = true
+		if u.Port() != "" {
+			return nil, fmt.Errorf("Invalid DNS discovery URI '%s': port is not allowed for SRV records", uri)
+		}
+	case dnsSchemeA:
+		if u.Port() == "" {
+			return nil, fmt.Errorf("Invalid DNS discovery URI '%s': port is required for A records", uri)
+		}
+	default:
+		return nil, fmt.Errorf("Invalid DNS discovery URI '%s': unsupported scheme '%s'", uri, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("Invalid DNS discovery URI '%s': missing domain name", uri)
+	}
+	return &d, nil
+}
+
+// Targets returns the list of targets found in the last Refresh call
+func (d *DNSDiscovery) Targets() ([]Target, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.targets, nil
+}
+
+// Refresh will resolve DNS records and replace all known targets, it returns
+// true if targets have changed, if resolving fails then current targets are
+// kept
+func (d *DNSDiscovery) Refresh(ctx context.Context) (bool, error) {
+	addrs, err := d.resolve(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	targets := []Target{}
+	for _, addr := range addrs {
+		u := *d.uri
+		u.Scheme = d.scheme
+		u.Host = addr
+		targets = append(targets, Target{
+			Name: fmt.Sprintf("%s-%s", d.name, addr),
+			URI:  u.String(),
+		})
+	}
+	targets = sortTargets(targets)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if reflect.DeepEqual(targets, d.targets) {
+		return false, nil
+	}
+	d.targets = targets
+	return true, nil
+}
+
+// resolve returns a list of host:port addresses
+func (d *DNSDiscovery) resolve(ctx context.Context) ([]string, error) {
+	addrs := []string{}
+	if d.srv {
+		_, records, err := d.resolver.LookupSRV(ctx, "", "", d.uri.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			host := strings.TrimSuffix(r.Target, ".")
+			addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(r.Port))))
+		}
+		return addrs, nil
+	}
+
+	hosts, err := d.resolver.LookupHost(ctx, d.uri.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range hosts {
+		addrs = append(addrs, net.JoinHostPort(host, d.uri.Port()))
+	}
+	return addrs, nil
+}
@@ -0,0 +1,289 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FileTargetGroup is a single entry in a target file, it uses the same format
+// as Prometheus file_sd_configs
+type FileTargetGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+}
+
+// FileConfig holds options for file discovery
+type FileConfig struct {
+	// Files is a list of target files or directories with target files, only
+	// files with .json, .yml or .yaml extension are read from directories
+	Files []string
+	// Scheme is used to generate the URI, http is used if empty, it can be
+	// overwritten for a group of targets with the __scheme__ label
+	Scheme string
+	// Path is appended to the URI
+	Path string
+	// Name is the template used to generate the name of each Alertmanager
+	Name string
+}
+
+// FileNameData is passed to the name template
+type FileNameData struct {
+	// Address is the target from the file, in host:port format
+	Address string
+	// Labels are labels set for the group of targets
+	Labels map[string]string
+}
+
+// DefaultFileName is the default template for names of Alertmanager instances
+// found using file discovery
+const DefaultFileName = "{{ .Address }}"
+
+// fileWatchDelay is how long to wait after the last change to target files
+// before reading them, tools will often write files in a few steps
+var fileWatchDelay = time.Second
+
+// FileDiscovery reads target files and returns a target for every address
+// listed in those files
+type FileDiscovery struct {
+	config  FileConfig
+	name    *template.Template
+	lock    sync.RWMutex
+	files   map[string][]Target
+	targets []Target
+}
+
+// NewFileDiscovery creates a new instance of file discovery, targets are only
+// read after calling Refresh
+func NewFileDiscovery(config FileConfig) (*FileDiscovery, error) {
+	if len(config.Files) == 0 {
+		return nil, errors.New("File discovery requires at least one file")
+	}
+	if config.Scheme == "" {
+		config.Scheme = "http"
+	}
+	if config.Scheme != "http" && config.Scheme != "https" {
+		return nil, fmt.Errorf("Invalid file discovery scheme '%s'", config.Scheme)
+	}
+	name, err := ParseNameTemplate(config.Name, DefaultFileName)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDiscovery{
+		config:  config,
+		name:    name,
+		files:   map[string][]Target{},
+		targets: []Target{},
+	}, nil
+}
+
+// Targets returns the list of targets found in the last Refresh call
+func (d *FileDiscovery) Targets() ([]Target, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.targets, nil
+}
+
+// Refresh will read all target files and replace all known targets, it returns
+// true if targets have changed. If any file can't be read or parsed then last
+// known targets from that file are kept and an error is returned.
+func (d *FileDiscovery) Refresh(ctx context.Context) (bool, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	paths, errs := d.listFiles()
+	files := map[string][]Target{}
+	for _, path := range paths {
+		targets, err := d.readFile(path)
+		if err != nil {
+			errs = append(errs, err.Error())
+			if old, found := d.files[path]; found {
+				files[path] = old
+			}
+			continue
+		}
+		files[path] = targets
+	}
+	d.files = files
+
+	targets := []Target{}
+	for _, path := range paths {
+		targets = append(targets, files[path]...)
+	}
+	targets = sortTargets(targets)
+
+	changed := !reflect.DeepEqual(targets, d.targets)
+	d.targets = targets
+
+	if len(errs) > 0 {
+		return changed, errors.New(strings.Join(errs, ", "))
+	}
+	return changed, nil
+}
+
+// Watch will keep watching target files for changes until ctx is done,
+// onChange is called every time targets change
+func (d *FileDiscovery) Watch(ctx context.Context, onChange func()) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Errorf("Failed to watch target files: %s", err)
+		return
+	}
+	defer watcher.Close()
+
+	// watch directories with target files since tools like kubernetes will
+	// often replace files rather than write to them
+	for _, path := range d.config.Files {
+		dir := filepath.Clean(path)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+		if err = watcher.Add(dir); err != nil {
+			log.Errorf("Failed to watch target files in %s: %s", dir, err)
+		}
+	}
+
+	var delay <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if d.isTargetFile(event.Name) {
+				delay = time.After(fileWatchDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("Error while watching target files: %s", err)
+		case <-delay:
+			delay = nil
+			changed, err := d.Refresh(ctx)
+			if err != nil {
+				log.Errorf("File discovery failed: %s", err)
+			}
+			if changed {
+				onChange()
+			}
+		}
+	}
+}
+
+func isTargetFileExt(path string) bool {
+	switch filepath.Ext(path) {
+	case ".json", ".yml", ".yaml":
+		return true
+	}
+	return false
+}
+
+// isTargetFile returns true if path is one of configured files or a file
+// with a valid extension inside one of configured directories
+func (d *FileDiscovery) isTargetFile(path string) bool {
+	path = filepath.Clean(path)
+	for _, p := range d.config.Files {
+		p = filepath.Clean(p)
+		if path == p {
+			return true
+		}
+		if filepath.Dir(path) == p && isTargetFileExt(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// listFiles returns a sorted list of all target files, missing files are
+// skipped
+func (d *FileDiscovery) listFiles() ([]string, []string) {
+	paths := []string{}
+	errs := []string{}
+	for _, p := range d.config.Files {
+		p = filepath.Clean(p)
+		info, err := os.Stat(p)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err.Error())
+			}
+			continue
+		}
+		if !info.IsDir() {
+			paths = append(paths, p)
+			continue
+		}
+		entries, err := ioutil.ReadDir(p)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isTargetFileExt(entry.Name()) {
+				paths = append(paths, filepath.Join(p, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths, errs
+}
+
+func (d *FileDiscovery) readFile(path string) ([]Target, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []FileTargetGroup{}
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(content, &groups)
+	} else {
+		err = yaml.Unmarshal(content, &groups)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %s", path, err)
+	}
+
+	targets := []Target{}
+	for _, group := range groups {
+		scheme := d.config.Scheme
+		if s, found := group.Labels["__scheme__"]; found {
+			if s != "http" && s != "https" {
+				return nil, fmt.Errorf("Invalid __scheme__ label value '%s' in %s", s, path)
+			}
+			scheme = s
+		}
+		for _, address := range group.Targets {
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				return nil, fmt.Errorf("Invalid target '%s' in %s: %s", address, path, err)
+			}
+			name, err := executeNameTemplate(d.name, FileNameData{Address: address, Labels: group.Labels})
+			if err != nil {
+				return nil, fmt.Errorf("Failed to generate name for target '%s' in %s: %s", address, path, err)
+			}
+			targets = append(targets, Target{
+				Name: name,
+				URI:  fmt.Sprintf("%s://%s%s", scheme, address, d.config.Path),
+			})
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,180 @@
+package discovery
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeTargetFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const jsonTargets = `[
+  {
+    "targets": ["am1.example.com:9093", "am2.example.com:9093"],
+    "labels": {"cluster": "prod"}
+  }
+]`
+
+const yamlTargets = `- targets:
+    - am.staging.example.com:9093
+  labels:
+    cluster: staging
+    __scheme__: https
+`
+
+func TestFileTargets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unsee-file-sd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTargetFile(t, filepath.Join(dir, "prod.json"), jsonTargets)
+	writeTargetFile(t, filepath.Join(dir, "staging.yml"), yamlTargets)
+	writeTargetFile(t, filepath.Join(dir, "README.md"), "not a target file")
+
+	type fileTargetsTest struct {
+		config  FileConfig
+		targets []Target
+	}
+	tests := []fileTargetsTest{
+		{
+			config: FileConfig{Files: []string{dir}},
+			targets: []Target{
+				Target{Name: "am.staging.example.com:9093", URI: "https://am.staging.example.com:9093"},
+				Target{Name: "am1.example.com:9093", URI: "http://am1.example.com:9093"},
+				Target{Name: "am2.example.com:9093", URI: "http://am2.example.com:9093"},
+			},
+		},
+		{
+			config: FileConfig{
+				Files:  []string{filepath.Join(dir, "prod.json"), filepath.Join(dir, "missing.json")},
+				Scheme: "https",
+				Path:   "/alertmanager",
+				Name:   "{{ .Labels.cluster }}-{{ .Address }}",
+			},
+			targets: []Target{
+				Target{Name: "prod-am1.example.com:9093", URI: "https://am1.example.com:9093/alertmanager"},
+				Target{Name: "prod-am2.example.com:9093", URI: "https://am2.example.com:9093/alertmanager"},
+			},
+		},
+	}
+
+	for _, testCase := range tests {
+		d, err := NewFileDiscovery(testCase.config)
+		if err != nil {
+			t.Errorf("NewFileDiscovery(%v) failed: %s", testCase.config, err)
+			continue
+		}
+		if _, err = d.Refresh(context.Background()); err != nil {
+			t.Errorf("Refresh() failed: %s", err)
+			continue
+		}
+		targets, _ := d.Targets()
+		if !reflect.DeepEqual(targets, testCase.targets) {
+			t.Errorf("Invalid targets for %v, expected %v, got %v", testCase.config, testCase.targets, targets)
+		}
+	}
+}
+
+func TestFileInvalidConfig(t *testing.T) {
+	for _, config := range []FileConfig{
+		FileConfig{},
+		FileConfig{Files: []string{"targets.json"}, Scheme: "ftp"},
+		FileConfig{Files: []string{"targets.json"}, Name: "{{ .Address "},
+	} {
+		if _, err := NewFileDiscovery(config); err == nil {
+			t.Errorf("NewFileDiscovery(%v) didn't return any error", config)
+		}
+	}
+}
+
+func TestFileInvalidTargets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unsee-file-sd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "targets.json")
+	d, err := NewFileDiscovery(FileConfig{Files: []string{path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTargetFile(t, path, jsonTargets)
+	if changed, err := d.Refresh(context.Background()); err != nil || !changed {
+		t.Fatalf("Refresh() returned changed=%v err=%v", changed, err)
+	}
+	expected, _ := d.Targets()
+
+	for _, content := range []string{
+		"{",
+		`[{"targets": ["am1.example.com"]}]`,
+		`[{"targets": ["am1.example.com:9093"], "labels": {"__scheme__": "ftp"}}]`,
+	} {
+		writeTargetFile(t, path, content)
+		if _, err := d.Refresh(context.Background()); err == nil {
+			t.Errorf("Refresh() didn't return any error for %s", content)
+		}
+		// last valid targets are kept
+		targets, _ := d.Targets()
+		if !reflect.DeepEqual(targets, expected) {
+			t.Errorf("Targets were modified after invalid file %s, expected %v, got %v", content, expected, targets)
+		}
+	}
+
+	os.Remove(path)
+	if changed, err := d.Refresh(context.Background()); err != nil || !changed {
+		t.Errorf("Refresh() after removing the file returned changed=%v err=%v", changed, err)
+	}
+	if targets, _ := d.Targets(); len(targets) != 0 {
+		t.Errorf("Expected no targets after removing the file, got %v", targets)
+	}
+}
+
+func TestFileWatch(t *testing.T) {
+	defer func(delay time.Duration) { fileWatchDelay = delay }(fileWatchDelay)
+	fileWatchDelay = time.Millisecond * 10
+
+	dir, err := ioutil.TempDir("", "unsee-file-sd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := NewFileDiscovery(FileConfig{Files: []string{dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan bool, 10)
+	go d.Watch(ctx, func() { changes <- true })
+	// give the watcher some time to start
+	time.Sleep(time.Millisecond * 100)
+
+	writeTargetFile(t, filepath.Join(dir, "staging.yaml"), yamlTargets)
+	select {
+	case <-changes:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timeout waiting for target file change")
+	}
+	expected := []Target{Target{Name: "am.staging.example.com:9093", URI: "https://am.staging.example.com:9093"}}
+	targets, _ := d.Targets()
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("Invalid targets, expected %v, got %v", expected, targets)
+	}
+}
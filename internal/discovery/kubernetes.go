@@ -0,0 +1,713 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// those are only the parts of Kubernetes API objects needed for discovery
+
+// ObjectMeta is the metadata of a Kubernetes API object
+type ObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	Labels          map[string]string `json:"labels"`
+	ResourceVersion string            `json:"resourceVersion"`
+}
+
+// ObjectReference points to the object backing an endpoint address, usually
+// a pod
+type ObjectReference struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// EndpointAddress is a single IP address of the endpoint
+type EndpointAddress struct {
+	IP        string           `json:"ip"`
+	Hostname  string           `json:"hostname"`
+	NodeName  string           `json:"nodeName"`
+	TargetRef *ObjectReference `json:"targetRef"`
+}
+
+// EndpointPort is a single port of the endpoint
+type EndpointPort struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// EndpointSubset is a group of addresses sharing the same set of ports,
+// only ready addresses are used for discovery
+type EndpointSubset struct {
+	Addresses         []EndpointAddress `json:"addresses"`
+	NotReadyAddresses []EndpointAddress `json:"notReadyAddresses"`
+	Ports             []EndpointPort    `json:"ports"`
+}
+
+// Endpoints is the Kubernetes Endpoints object
+type Endpoints struct {
+	Metadata ObjectMeta       `json:"metadata"`
+	Subsets  []EndpointSubset `json:"subsets"`
+}
+
+// EndpointsList is the response of the Endpoints list API call
+type EndpointsList struct {
+	Metadata ObjectMeta  `json:"metadata"`
+	Items    []Endpoints `json:"items"`
+}
+
+// Status is the object of watch error events
+type Status struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// Kubernetes watch event types
+const (
+	WatchEventAdded    = "ADDED"
+	WatchEventModified = "MODIFIED"
+	WatchEventDeleted  = "DELETED"
+	WatchEventBookmark = "BOOKMARK"
+	WatchEventError    = "ERROR"
+)
+
+// EndpointsEvent is a single event from the Endpoints watch API call, Status
+// is only set for error events and bookmark events only carry the resource
+// version in the object metadata
+type EndpointsEvent struct {
+	Type   string
+	Object Endpoints
+	Status Status
+}
+
+// ErrKubernetesVersionExpired is returned when the resource version used to
+// start a watch is too old, all objects need to be listed again
+var ErrKubernetesVersionExpired = errors.New("Kubernetes resource version is too old")
+
+// KubernetesClient is used to list and watch Endpoints objects
+type KubernetesClient interface {
+	// ListEndpoints returns all Endpoints objects in the namespace matching
+	// the label selector, all namespaces are used if namespace is empty
+	ListEndpoints(ctx context.Context, namespace, selector string) (*EndpointsList, error)
+	// WatchEndpoints returns a channel with all changes made to Endpoints
+	// objects after given resource version, the channel is closed when the
+	// watch ends
+	WatchEndpoints(ctx context.Context, namespace, selector, resourceVersion string) (<-chan EndpointsEvent, error)
+}
+
+const (
+	inClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+var (
+	// kubernetesRequestTimeout is how long a list call can take, watch calls
+	// can take that long on top of kubernetesWatchTimeout
+	kubernetesRequestTimeout = time.Minute
+	// kubernetesWatchTimeout is how long the API server will keep a watch
+	// open, the watch is then resumed from the last seen resource version
+	kubernetesWatchTimeout = time.Minute * 5
+)
+
+type kubernetesAPIClient struct {
+	apiServer string
+	// tokenFile is read for every request since service account tokens are
+	// rotated, token is only used if there's no token file
+	token      string
+	tokenFile  string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// NewKubernetesAPIClient returns a client talking to Kubernetes API server,
+// the kubeconfig file is used if set and apiServer will override the server
+// URI from it, if neither is set then in-cluster configuration from the
+// service account is used
+func NewKubernetesAPIClient(apiServer, kubeconfig string) (KubernetesClient, error) {
+	var c *kubernetesAPIClient
+	var tlsConfig *tls.Config
+	var err error
+	switch {
+	case kubeconfig != "":
+		c, tlsConfig, err = loadKubeconfig(kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load kubeconfig from %s: %s", kubeconfig, err)
+		}
+	case apiServer != "":
+		c, tlsConfig = &kubernetesAPIClient{}, &tls.Config{}
+	default:
+		c, tlsConfig, err = inClusterConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if apiServer != "" {
+		c.apiServer = apiServer
+	}
+	if c.apiServer == "" {
+		return nil, errors.New("Kubernetes API server URI is not set")
+	}
+	c.apiServer = strings.TrimSuffix(c.apiServer, "/")
+	c.httpClient = &http.Client{
+		// there's no client timeout since it would also apply to reading
+		// watch responses, requests are limited using the context instead
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   time.Second * 30,
+				KeepAlive: time.Second * 30,
+			}).DialContext,
+			TLSHandshakeTimeout:   time.Second * 10,
+			ResponseHeaderTimeout: time.Second * 30,
+			TLSClientConfig:       tlsConfig,
+		},
+	}
+	return c, nil
+}
+
+func inClusterConfig() (*kubernetesAPIClient, *tls.Config, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, nil, errors.New("Kubernetes API server URI and kubeconfig are not set and unsee is not running inside a Kubernetes cluster")
+	}
+	if _, err := ioutil.ReadFile(inClusterTokenFile); err != nil {
+		return nil, nil, err
+	}
+	ca, err := ioutil.ReadFile(inClusterCAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, nil, fmt.Errorf("Failed to load CA certificate from %s", inClusterCAFile)
+	}
+	c := &kubernetesAPIClient{
+		apiServer: "https://" + net.JoinHostPort(host, port),
+		tokenFile: inClusterTokenFile,
+	}
+	return c, &tls.Config{RootCAs: pool}, nil
+}
+
+// kubeconfigFile is the part of kubeconfig format needed to connect to the
+// cluster from the current context
+type kubeconfigFile struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string      `yaml:"token"`
+			TokenFile             string      `yaml:"tokenFile"`
+			ClientCertificate     string      `yaml:"client-certificate"`
+			ClientCertificateData string      `yaml:"client-certificate-data"`
+			ClientKey             string      `yaml:"client-key"`
+			ClientKeyData         string      `yaml:"client-key-data"`
+			Username              string      `yaml:"username"`
+			Password              string      `yaml:"password"`
+			Exec                  interface{} `yaml:"exec"`
+			AuthProvider          interface{} `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+func loadKubeconfig(path string) (*kubernetesAPIClient, *tls.Config, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	kc := kubeconfigFile{}
+	if err = yaml.Unmarshal(content, &kc); err != nil {
+		return nil, nil, err
+	}
+	// relative paths are resolved against the kubeconfig file location
+	dir := filepath.Dir(path)
+
+	var clusterName, userName string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext {
+			clusterName, userName, found = c.Context.Cluster, c.Context.User, true
+		}
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("context '%s' not found", kc.CurrentContext)
+	}
+
+	client := &kubernetesAPIClient{}
+	tlsConfig := &tls.Config{}
+	found = false
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		client.apiServer = c.Cluster.Server
+		tlsConfig.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		ca, err := kubeconfigData(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority, dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ca != nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, nil, fmt.Errorf("failed to load CA certificate for cluster '%s'", clusterName)
+			}
+		}
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("cluster '%s' not found", clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		if u.User.Exec != nil || u.User.AuthProvider != nil {
+			return nil, nil, fmt.Errorf("user '%s' uses a credential plugin, which is not supported", userName)
+		}
+		client.token = u.User.Token
+		if u.User.TokenFile != "" {
+			client.tokenFile = kubeconfigPath(u.User.TokenFile, dir)
+		}
+		client.username, client.password = u.User.Username, u.User.Password
+		cert, err := kubeconfigData(u.User.ClientCertificateData, u.User.ClientCertificate, dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := kubeconfigData(u.User.ClientKeyData, u.User.ClientKey, dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cert != nil || key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid client certificate for user '%s': %s", userName, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+	}
+	return client, tlsConfig, nil
+}
+
+// kubeconfigData returns base64 encoded data if set, or the content of the
+// file otherwise, nil is returned if neither is set
+func kubeconfigData(data, file, dir string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return ioutil.ReadFile(kubeconfigPath(file, dir))
+	}
+	return nil, nil
+}
+
+func kubeconfigPath(path, dir string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func (c *kubernetesAPIClient) get(ctx context.Context, namespace string, query url.Values) (*http.Response, error) {
+	path := "/api/v1/endpoints"
+	if namespace != "" {
+		path = fmt.Sprintf("/api/v1/namespaces/%s/endpoints", url.PathEscape(namespace))
+	}
+	req, err := http.NewRequest(http.MethodGet, c.apiServer+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	token := c.token
+	if c.tokenFile != "" {
+		content, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(content))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusGone {
+		resp.Body.Close()
+		return nil, ErrKubernetesVersionExpired
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("Kubernetes API request %s failed with status %d: %s", req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (c *kubernetesAPIClient) ListEndpoints(ctx context.Context, namespace, selector string) (*EndpointsList, error) {
+	ctx, cancel := context.WithTimeout(ctx, kubernetesRequestTimeout)
+	defer cancel()
+
+	resp, err := c.get(ctx, namespace, url.Values{"labelSelector": []string{selector}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	list := EndpointsList{}
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (c *kubernetesAPIClient) WatchEndpoints(ctx context.Context, namespace, selector, resourceVersion string) (<-chan EndpointsEvent, error) {
+	// API server should end the watch after timeoutSeconds, the context
+	// timeout is there in case the connection is lost without being closed
+	ctx, cancel := context.WithTimeout(ctx, kubernetesWatchTimeout+kubernetesRequestTimeout)
+	resp, err := c.get(ctx, namespace, url.Values{
+		"labelSelector":       []string{selector},
+		"resourceVersion":     []string{resourceVersion},
+		"watch":               []string{"true"},
+		"allowWatchBookmarks": []string{"true"},
+		"timeoutSeconds":      []string{strconv.Itoa(int(kubernetesWatchTimeout.Seconds()))},
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	events := make(chan EndpointsEvent)
+	go func() {
+		defer cancel()
+		defer close(events)
+		defer resp.Body.Close()
+		// watch response is a stream of JSON encoded events, the object of
+		// error events is a Status instead of Endpoints
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			raw := struct {
+				Type   string          `json:"type"`
+				Object json.RawMessage `json:"object"`
+			}{}
+			if err := decoder.Decode(&raw); err != nil {
+				return
+			}
+			event := EndpointsEvent{Type: raw.Type}
+			var err error
+			if raw.Type == WatchEventError {
+				err = json.Unmarshal(raw.Object, &event.Status)
+			} else {
+				err = json.Unmarshal(raw.Object, &event.Object)
+			}
+			if err != nil {
+				event = EndpointsEvent{Type: WatchEventError, Status: Status{Message: err.Error()}}
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// KubernetesConfig holds options for Kubernetes discovery
+type KubernetesConfig struct {
+	Namespace string
+	// Selector is the label selector used to find Endpoints objects
+	Selector string
+	// Port is the name or number of the Alertmanager port, it can be empty if
+	// there's only one port
+	Port string
+	// Scheme is used to generate the URI, http is used if empty
+	Scheme string
+	// Path is appended to the URI
+	Path string
+	// Name is the template used to generate the name of each Alertmanager
+	Name string
+}
+
+// KubernetesNameData is passed to the name template
+type KubernetesNameData struct {
+	Namespace string
+	Service   string
+	Pod       string
+	Hostname  string
+	IP        string
+	Port      int
+}
+
+// DefaultKubernetesName is the default template for names of Alertmanager
+// instances found using Kubernetes discovery
+const DefaultKubernetesName = "{{ .Namespace }}-{{ .Pod }}"
+
+// kubernetesRetryDelay is how long to wait before listing all objects again
+// after a failed watch or list call
+var kubernetesRetryDelay = time.Second * 5
+
+// KubernetesDiscovery watches Endpoints objects and returns a target for every
+// ready address
+type KubernetesDiscovery struct {
+	client    KubernetesClient
+	config    KubernetesConfig
+	name      *template.Template
+	lock      sync.RWMutex
+	endpoints map[string]Endpoints
+	targets   []Target
+	version   string
+}
+
+// NewKubernetesDiscovery creates a new instance of Kubernetes discovery, it
+// needs to be started with Refresh and Watch calls
+func NewKubernetesDiscovery(client KubernetesClient, config KubernetesConfig) (*KubernetesDiscovery, error) {
+	if config.Selector == "" {
+		return nil, errors.New("Kubernetes discovery requires a label selector")
+	}
+	if config.Scheme == "" {
+		config.Scheme = "http"
+	}
+	if config.Scheme != "http" && config.Scheme != "https" {
+		return nil, fmt.Errorf("Invalid Kubernetes discovery scheme '%s'", config.Scheme)
+	}
+	name, err := ParseNameTemplate(config.Name, DefaultKubernetesName)
+	if err != nil {
+		return nil, err
+	}
+	return &KubernetesDiscovery{
+		client:    client,
+		config:    config,
+		name:      name,
+		endpoints: map[string]Endpoints{},
+		targets:   []Target{},
+	}, nil
+}
+
+// Targets returns the list of targets found in the last Refresh or Watch call
+func (d *KubernetesDiscovery) Targets() ([]Target, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.targets, nil
+}
+
+// Refresh will list all Endpoints objects and replace all known targets, it
+// returns true if targets have changed
+func (d *KubernetesDiscovery) Refresh(ctx context.Context) (bool, error) {
+	list, err := d.client.ListEndpoints(ctx, d.config.Namespace, d.config.Selector)
+	if err != nil {
+		return false, err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.endpoints = map[string]Endpoints{}
+	for _, ep := range list.Items {
+		d.endpoints[endpointsKey(ep)] = ep
+	}
+	d.version = list.Metadata.ResourceVersion
+	return d.updateTargets(), nil
+}
+
+// Watch will keep watching for changes to Endpoints objects until ctx is
+// done, onChange is called every time targets change. Watches closed by the
+// API server are resumed from the last seen resource version, if the watch
+// fails or the version has expired all objects are listed again.
+func (d *KubernetesDiscovery) Watch(ctx context.Context, onChange func()) {
+	for {
+		err := d.watch(ctx, onChange)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			continue
+		}
+		// there's no need to wait if the version has expired, it's expected
+		// to happen when there were no changes for a while
+		if err != ErrKubernetesVersionExpired {
+			log.Errorf("Kubernetes discovery for '%s' failed: %s", d.config.Selector, err)
+			if !sleepContext(ctx, kubernetesRetryDelay) {
+				return
+			}
+		}
+		for {
+			changed, err := d.Refresh(ctx)
+			if err == nil {
+				if changed {
+					onChange()
+				}
+				break
+			}
+			log.Errorf("Kubernetes discovery for '%s' failed: %s", d.config.Selector, err)
+			if !sleepContext(ctx, kubernetesRetryDelay) {
+				return
+			}
+		}
+	}
+}
+
+func (d *KubernetesDiscovery) watch(ctx context.Context, onChange func()) error {
+	d.lock.RLock()
+	version := d.version
+	d.lock.RUnlock()
+
+	events, err := d.client.WatchEndpoints(ctx, d.config.Namespace, d.config.Selector, version)
+	if err != nil {
+		return err
+	}
+	for event := range events {
+		if event.Type == WatchEventError {
+			if event.Status.Code == http.StatusGone {
+				return ErrKubernetesVersionExpired
+			}
+			return fmt.Errorf("watch returned an error: %s", event.Status.Message)
+		}
+		if d.handleEvent(event) {
+			onChange()
+		}
+	}
+	return nil
+}
+
+func (d *KubernetesDiscovery) handleEvent(event EndpointsEvent) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if event.Object.Metadata.ResourceVersion != "" {
+		d.version = event.Object.Metadata.ResourceVersion
+	}
+	key := endpointsKey(event.Object)
+	switch event.Type {
+	case WatchEventAdded, WatchEventModified:
+		d.endpoints[key] = event.Object
+	case WatchEventDeleted:
+		delete(d.endpoints, key)
+	default:
+		return false
+	}
+	return d.updateTargets()
+}
+
+// updateTargets regenerates the list of targets from all known Endpoints
+// objects, it must be called with the lock held
+func (d *KubernetesDiscovery) updateTargets() bool {
+	// objects are sorted so the same target is kept when names are duplicated
+	keys := make([]string, 0, len(d.endpoints))
+	for key := range d.endpoints {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	targets := []Target{}
+	for _, key := range keys {
+		ep := d.endpoints[key]
+		for _, subset := range ep.Subsets {
+			port, found := d.findPort(subset.Ports)
+			if !found {
+				continue
+			}
+			for _, addr := range subset.Addresses {
+				data := KubernetesNameData{
+					Namespace: ep.Metadata.Namespace,
+					Service:   ep.Metadata.Name,
+					Pod:       addr.IP,
+					Hostname:  addr.Hostname,
+					IP:        addr.IP,
+					Port:      port,
+				}
+				if addr.TargetRef != nil && addr.TargetRef.Kind == "Pod" {
+					data.Pod = addr.TargetRef.Name
+				}
+				name, err := executeNameTemplate(d.name, data)
+				if err != nil {
+					log.Errorf("Kubernetes discovery for '%s' failed to generate name for %s: %s", d.config.Selector, addr.IP, err)
+					continue
+				}
+				uri := fmt.Sprintf("%s://%s%s", d.config.Scheme, net.JoinHostPort(addr.IP, strconv.Itoa(port)), d.config.Path)
+				targets = append(targets, Target{Name: name, URI: uri})
+			}
+		}
+	}
+	targets = sortTargets(targets)
+	if reflect.DeepEqual(targets, d.targets) {
+		return false
+	}
+	d.targets = targets
+	return true
+}
+
+func (d *KubernetesDiscovery) findPort(ports []EndpointPort) (int, bool) {
+	if d.config.Port == "" {
+		if len(ports) == 1 {
+			return ports[0].Port, true
+		}
+		return 0, false
+	}
+	for _, p := range ports {
+		if p.Name == d.config.Port || strconv.Itoa(p.Port) == d.config.Port {
+			return p.Port, true
+		}
+	}
+	return 0, false
+}
+
+func endpointsKey(ep Endpoints) string {
+	return ep.Metadata.Namespace + "/" + ep.Metadata.Name
+}
+
+// sleepContext waits for given duration, it returns false if ctx was done
+// before that
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,451 @@
+package discovery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeKubernetesClient struct {
+	lock     sync.Mutex
+	list     EndpointsList
+	listErr  error
+	versions []string
+	// every watch call will send a new events channel here
+	watches chan chan EndpointsEvent
+}
+
+func (c *fakeKubernetesClient) ListEndpoints(ctx context.Context, namespace, selector string) (*EndpointsList, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.listErr != nil {
+		return nil, c.listErr
+	}
+	list := c.list
+	return &list, nil
+}
+
+func (c *fakeKubernetesClient) WatchEndpoints(ctx context.Context, namespace, selector, resourceVersion string) (<-chan EndpointsEvent, error) {
+	c.lock.Lock()
+	c.versions = append(c.versions, resourceVersion)
+	c.lock.Unlock()
+	events := make(chan EndpointsEvent)
+	c.watches <- events
+	return events, nil
+}
+
+func newEndpoints(namespace, name string, ports []EndpointPort, pods ...string) Endpoints {
+	ep := Endpoints{Metadata: ObjectMeta{Namespace: namespace, Name: name}}
+	subset := EndpointSubset{Ports: ports}
+	for i, pod := range pods {
+		subset.Addresses = append(subset.Addresses, EndpointAddress{
+			IP:        "10.0.0." + strconv.Itoa(i+1),
+			TargetRef: &ObjectReference{Kind: "Pod", Name: pod, Namespace: namespace},
+		})
+	}
+	ep.Subsets = []EndpointSubset{subset}
+	return ep
+}
+
+var webPort = []EndpointPort{EndpointPort{Name: "web", Port: 9093}}
+
+type kubernetesTargetsTest struct {
+	config    KubernetesConfig
+	endpoints []Endpoints
+	targets   []Target
+}
+
+var kubernetesTargetsTests = []kubernetesTargetsTest{
+	{
+		config:    KubernetesConfig{Selector: "app=alertmanager"},
+		endpoints: []Endpoints{},
+		targets:   []Target{},
+	},
+	{
+		config:    KubernetesConfig{Selector: "app=alertmanager"},
+		endpoints: []Endpoints{newEndpoints("monitoring", "alertmanager", webPort, "alertmanager-0", "alertmanager-1")},
+		targets: []Target{
+			Target{Name: "monitoring-alertmanager-0", URI: "http://10.0.0.1:9093"},
+			Target{Name: "monitoring-alertmanager-1", URI: "http://10.0.0.2:9093"},
+		},
+	},
+	{
+		config: KubernetesConfig{
+			Selector: "app=alertmanager",
+			Port:     "web",
+			Scheme:   "https",
+			Path:     "/alertmanager",
+			Name:     "{{ .Service }}.{{ .Pod }}:{{ .Port }}",
+		},
+		endpoints: []Endpoints{
+			newEndpoints("monitoring", "alertmanager", []EndpointPort{EndpointPort{Name: "mesh", Port: 6783}, EndpointPort{Name: "web", Port: 9093}}, "alertmanager-0"),
+			newEndpoints("other", "am", webPort, "am-0"),
+		},
+		targets: []Target{
+			Target{Name: "alertmanager.alertmanager-0:9093", URI: "https://10.0.0.1:9093/alertmanager"},
+			Target{Name: "am.am-0:9093", URI: "https://10.0.0.1:9093/alertmanager"},
+		},
+	},
+	{
+		// port can't be guessed if there are multiple ports
+		config:    KubernetesConfig{Selector: "app=alertmanager"},
+		endpoints: []Endpoints{newEndpoints("monitoring", "alertmanager", []EndpointPort{EndpointPort{Name: "mesh", Port: 6783}, EndpointPort{Name: "web", Port: 9093}}, "alertmanager-0")},
+		targets:   []Target{},
+	},
+	{
+		config:    KubernetesConfig{Selector: "app=alertmanager", Port: "9093"},
+		endpoints: []Endpoints{newEndpoints("monitoring", "alertmanager", []EndpointPort{EndpointPort{Name: "mesh", Port: 6783}, EndpointPort{Name: "web", Port: 9093}}, "alertmanager-0")},
+		targets:   []Target{Target{Name: "monitoring-alertmanager-0", URI: "http://10.0.0.1:9093"}},
+	},
+	{
+		// duplicated names are dropped, objects are sorted so the same one
+		// is always kept
+		config: KubernetesConfig{Selector: "app=alertmanager", Name: "{{ .Pod }}"},
+		endpoints: []Endpoints{
+			newEndpoints("other", "alertmanager", webPort, "alertmanager-0"),
+			newEndpoints("monitoring", "alertmanager", []EndpointPort{EndpointPort{Name: "web", Port: 9094}}, "alertmanager-0"),
+		},
+		targets: []Target{Target{Name: "alertmanager-0", URI: "http://10.0.0.1:9094"}},
+	},
+}
+
+func TestKubernetesTargets(t *testing.T) {
+	for _, testCase := range kubernetesTargetsTests {
+		client := &fakeKubernetesClient{list: EndpointsList{Items: testCase.endpoints}}
+		d, err := NewKubernetesDiscovery(client, testCase.config)
+		if err != nil {
+			t.Errorf("NewKubernetesDiscovery(%v) failed: %s", testCase.config, err)
+			continue
+		}
+		if _, err = d.Refresh(context.Background()); err != nil {
+			t.Errorf("Refresh() failed: %s", err)
+			continue
+		}
+		targets, _ := d.Targets()
+		if !reflect.DeepEqual(targets, testCase.targets) {
+			t.Errorf("Invalid targets for %v, expected %v, got %v", testCase.config, testCase.targets, targets)
+		}
+	}
+}
+
+func TestKubernetesInvalidConfig(t *testing.T) {
+	for _, config := range []KubernetesConfig{
+		KubernetesConfig{},
+		KubernetesConfig{Selector: "app=alertmanager", Scheme: "ftp"},
+		KubernetesConfig{Selector: "app=alertmanager", Name: "{{ .Pod "},
+	} {
+		if _, err := NewKubernetesDiscovery(&fakeKubernetesClient{}, config); err == nil {
+			t.Errorf("NewKubernetesDiscovery(%v) didn't return any error", config)
+		}
+	}
+}
+
+func waitForTargets(t *testing.T, d *KubernetesDiscovery, changes chan bool, expected []Target) {
+	select {
+	case <-changes:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Timeout waiting for targets %v", expected)
+	}
+	targets, _ := d.Targets()
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("Invalid targets, expected %v, got %v", expected, targets)
+	}
+}
+
+func waitForWatch(t *testing.T, client *fakeKubernetesClient, version string) chan EndpointsEvent {
+	select {
+	case events := <-client.watches:
+		client.lock.Lock()
+		defer client.lock.Unlock()
+		if v := client.versions[len(client.versions)-1]; v != version {
+			t.Errorf("Watch started from resource version %q, expected %q", v, version)
+		}
+		return events
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Timeout waiting for a watch from resource version %q", version)
+	}
+	return nil
+}
+
+func TestKubernetesWatch(t *testing.T) {
+	// watch should never need to wait when resuming or after expired version
+	defer func(delay time.Duration) { kubernetesRetryDelay = delay }(kubernetesRetryDelay)
+	kubernetesRetryDelay = time.Hour
+
+	client := &fakeKubernetesClient{
+		list: EndpointsList{
+			Metadata: ObjectMeta{ResourceVersion: "1"},
+			Items:    []Endpoints{newEndpoints("monitoring", "alertmanager", webPort, "alertmanager-0")},
+		},
+		watches: make(chan chan EndpointsEvent),
+	}
+	d, err := NewKubernetesDiscovery(client, KubernetesConfig{Selector: "app=alertmanager"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := d.Refresh(context.Background()); err != nil || !changed {
+		t.Fatalf("Refresh() returned changed=%v err=%v", changed, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan bool, 10)
+	go d.Watch(ctx, func() { changes <- true })
+	events := waitForWatch(t, client, "1")
+
+	// a new replica is added
+	ep := newEndpoints("monitoring", "alertmanager", webPort, "alertmanager-0", "alertmanager-1")
+	ep.Metadata.ResourceVersion = "2"
+	events <- EndpointsEvent{Type: WatchEventModified, Object: ep}
+	waitForTargets(t, d, changes, []Target{
+		Target{Name: "monitoring-alertmanager-0", URI: "http://10.0.0.1:9093"},
+		Target{Name: "monitoring-alertmanager-1", URI: "http://10.0.0.2:9093"},
+	})
+
+	// another service is created
+	events <- EndpointsEvent{Type: WatchEventAdded, Object: newEndpoints("other", "am", webPort, "am-0")}
+	waitForTargets(t, d, changes, []Target{
+		Target{Name: "monitoring-alertmanager-0", URI: "http://10.0.0.1:9093"},
+		Target{Name: "monitoring-alertmanager-1", URI: "http://10.0.0.2:9093"},
+		Target{Name: "other-am-0", URI: "http://10.0.0.1:9093"},
+	})
+
+	// and removed
+	events <- EndpointsEvent{Type: WatchEventDeleted, Object: newEndpoints("other", "am", nil)}
+	waitForTargets(t, d, changes, []Target{
+		Target{Name: "monitoring-alertmanager-0", URI: "http://10.0.0.1:9093"},
+		Target{Name: "monitoring-alertmanager-1", URI: "http://10.0.0.2:9093"},
+	})
+
+	// watch closed by the API server is resumed from the bookmarked version
+	events <- EndpointsEvent{Type: WatchEventBookmark, Object: Endpoints{Metadata: ObjectMeta{ResourceVersion: "5"}}}
+	close(events)
+	events = waitForWatch(t, client, "5")
+
+	// expired version will trigger a new list call
+	client.lock.Lock()
+	client.list = EndpointsList{Metadata: ObjectMeta{ResourceVersion: "7"}}
+	client.lock.Unlock()
+	events <- EndpointsEvent{Type: WatchEventError, Status: Status{Code: http.StatusGone, Reason: "Expired"}}
+	waitForTargets(t, d, changes, []Target{})
+	waitForWatch(t, client, "7")
+
+	select {
+	case <-changes:
+		t.Error("Targets changed without any event")
+	default:
+	}
+}
+
+func TestKubernetesWatchError(t *testing.T) {
+	defer func(delay time.Duration) { kubernetesRetryDelay = delay }(kubernetesRetryDelay)
+	kubernetesRetryDelay = time.Millisecond
+
+	client := &fakeKubernetesClient{
+		list:    EndpointsList{Metadata: ObjectMeta{ResourceVersion: "1"}},
+		watches: make(chan chan EndpointsEvent),
+	}
+	d, err := NewKubernetesDiscovery(client, KubernetesConfig{Selector: "app=alertmanager"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan bool, 10)
+	go d.Watch(ctx, func() { changes <- true })
+	events := waitForWatch(t, client, "1")
+
+	// failed list calls are retried until they succeed
+	client.lock.Lock()
+	client.listErr = errors.New("connection refused")
+	client.lock.Unlock()
+	events <- EndpointsEvent{Type: WatchEventError, Status: Status{Code: http.StatusInternalServerError}}
+	time.Sleep(time.Millisecond * 50)
+	client.lock.Lock()
+	client.listErr = nil
+	client.list = EndpointsList{
+		Metadata: ObjectMeta{ResourceVersion: "3"},
+		Items:    []Endpoints{newEndpoints("monitoring", "alertmanager", webPort, "alertmanager-0")},
+	}
+	client.lock.Unlock()
+	waitForTargets(t, d, changes, []Target{Target{Name: "monitoring-alertmanager-0", URI: "http://10.0.0.1:9093"}})
+	waitForWatch(t, client, "3")
+}
+
+func TestKubernetesRefreshError(t *testing.T) {
+	client := &fakeKubernetesClient{listErr: errors.New("connection refused")}
+	d, err := NewKubernetesDiscovery(client, KubernetesConfig{Selector: "app=alertmanager"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Refresh(context.Background()); err == nil {
+		t.Error("Refresh() didn't return any error")
+	}
+}
+
+func TestKubernetesAPIClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/monitoring/endpoints" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("labelSelector") != "app=alertmanager" {
+			t.Errorf("Invalid label selector: %s", r.URL.RawQuery)
+		}
+		encoder := json.NewEncoder(w)
+		if r.URL.Query().Get("watch") != "true" {
+			encoder.Encode(EndpointsList{
+				Metadata: ObjectMeta{ResourceVersion: "10"},
+				Items:    []Endpoints{newEndpoints("monitoring", "alertmanager", webPort, "alertmanager-0")},
+			})
+			return
+		}
+		if r.URL.Query().Get("resourceVersion") == "1" {
+			http.Error(w, "too old resource version", http.StatusGone)
+			return
+		}
+		if r.URL.Query().Get("resourceVersion") != "10" || r.URL.Query().Get("allowWatchBookmarks") != "true" || r.URL.Query().Get("timeoutSeconds") != "300" {
+			t.Errorf("Invalid watch query: %s", r.URL.RawQuery)
+		}
+		encoder.Encode(map[string]interface{}{"type": WatchEventAdded, "object": newEndpoints("monitoring", "alertmanager", webPort, "alertmanager-1")})
+		encoder.Encode(map[string]interface{}{"type": WatchEventBookmark, "object": Endpoints{Metadata: ObjectMeta{ResourceVersion: "12"}}})
+		encoder.Encode(map[string]interface{}{"type": WatchEventError, "object": Status{Code: http.StatusGone, Message: "too old resource version"}})
+	}))
+	defer ts.Close()
+
+	client, err := NewKubernetesAPIClient(ts.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := client.ListEndpoints(context.Background(), "monitoring", "app=alertmanager")
+	if err != nil {
+		t.Fatalf("ListEndpoints() failed: %s", err)
+	}
+	if list.Metadata.ResourceVersion != "10" || len(list.Items) != 1 {
+		t.Errorf("Invalid list response: %v", list)
+	}
+
+	events, err := client.WatchEndpoints(context.Background(), "monitoring", "app=alertmanager", "10")
+	if err != nil {
+		t.Fatalf("WatchEndpoints() failed: %s", err)
+	}
+	received := []EndpointsEvent{}
+	for event := range events {
+		received = append(received, event)
+	}
+	expected := []EndpointsEvent{
+		EndpointsEvent{Type: WatchEventAdded, Object: newEndpoints("monitoring", "alertmanager", webPort, "alertmanager-1")},
+		EndpointsEvent{Type: WatchEventBookmark, Object: Endpoints{Metadata: ObjectMeta{ResourceVersion: "12"}}},
+		EndpointsEvent{Type: WatchEventError, Status: Status{Code: http.StatusGone, Message: "too old resource version"}},
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Invalid watch events, expected %v, got %v", expected, received)
+	}
+
+	if _, err = client.WatchEndpoints(context.Background(), "monitoring", "app=alertmanager", "1"); err != ErrKubernetesVersionExpired {
+		t.Errorf("WatchEndpoints() returned %v for an expired version", err)
+	}
+	if _, err = client.ListEndpoints(context.Background(), "default", "app=alertmanager"); err == nil {
+		t.Error("ListEndpoints() didn't return any error on 404 response")
+	}
+}
+
+func writeKubeconfig(t *testing.T, path, server, user string) {
+	err := ioutil.WriteFile(path, []byte(`apiVersion: v1
+kind: Config
+clusters:
+  - name: test
+    cluster:
+      server: `+server+`
+users:
+  - name: unsee
+    user:
+`+user+`
+contexts:
+  - name: test
+    context:
+      cluster: test
+      user: unsee
+current-context: test
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKubernetesAPIClientKubeconfig(t *testing.T) {
+	tokens := make(chan string, 1)
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens <- r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(EndpointsList{})
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "unsee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	tokenFile := filepath.Join(dir, "token")
+	ca := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}))
+	// server is overwritten by the apiserver option
+	writeKubeconfig(t, kubeconfig, "https://kubernetes.invalid\n      certificate-authority-data: "+ca, "      tokenFile: token")
+
+	client, err := NewKubernetesAPIClient(ts.URL, kubeconfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// token file is read for every request so rotated tokens are used
+	for _, token := range []string{"one", "two"} {
+		if err = ioutil.WriteFile(tokenFile, []byte(token+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = client.ListEndpoints(context.Background(), "", "app=alertmanager"); err != nil {
+			t.Fatalf("ListEndpoints() failed: %s", err)
+		}
+		if auth := <-tokens; auth != "Bearer "+token {
+			t.Errorf("Invalid Authorization header %q, expected token %q", auth, token)
+		}
+	}
+
+	for _, user := range []string{
+		"      exec:\n        command: aws",
+		"      auth-provider:\n        name: gcp",
+		"      client-certificate-data: bm90IGEgY2VydA==",
+	} {
+		writeKubeconfig(t, kubeconfig, ts.URL, user)
+		if _, err = NewKubernetesAPIClient("", kubeconfig); err == nil {
+			t.Errorf("NewKubernetesAPIClient() didn't return any error for user %q", user)
+		}
+	}
+	writeKubeconfig(t, kubeconfig, "", "      token: secret")
+	if _, err = NewKubernetesAPIClient("", kubeconfig); err == nil {
+		t.Error("NewKubernetesAPIClient() didn't return any error for a kubeconfig without a server")
+	}
+	if _, err = NewKubernetesAPIClient("", filepath.Join(dir, "missing")); err == nil {
+		t.Error("NewKubernetesAPIClient() didn't return any error for a missing kubeconfig")
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		if _, err = NewKubernetesAPIClient("", ""); err == nil {
+			t.Error("NewKubernetesAPIClient() didn't return any error outside of a Kubernetes cluster")
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package filters
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+// ParseError is returned when a filter expression can't be parsed, Position
+// is the byte offset in the expression where the error was found
+type ParseError struct {
+	Message  string
+	Position int
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+}
+
+type tokenType int
+
+const (
+	tokenStart tokenType = iota
+	tokenEOF
+	tokenFilter
+	tokenComma
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLeftParen
+	tokenRightParen
+)
+
+var keywords = map[string]tokenType{
+	"AND": tokenAnd,
+	"OR":  tokenOr,
+	"NOT": tokenNot,
+}
+
+type token struct {
+	kind     tokenType
+	text     string
+	position int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenFilter:
+		return fmt.Sprintf("filter '%s'", t.text)
+	default:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// keywordAt returns the keyword token type if there's a keyword starting at
+// given position, keywords must be followed by a space, parenthesis, comma
+// or the end of expression
+func keywordAt(text string, pos int) (tokenType, string, bool) {
+	for word, kind := range keywords {
+		if !strings.HasPrefix(text[pos:], word) {
+			continue
+		}
+		end := pos + len(word)
+		if end == len(text) || isSpace(text[end]) || strings.IndexByte("(),", text[end]) >= 0 {
+			return kind, word, true
+		}
+	}
+	return tokenEOF, "", false
+}
+
+// tokenize splits filter expression into tokens, everything that's not
+// a keyword, parenthesis or a comma is a filter, filters can contain spaces
+// and balanced parenthesis (for regex values). AND and OR are only keywords
+// when they follow a complete filter, NOT is only a keyword where a filter is
+// expected, so it can be used inside filter values. Anything wrapped in double
+// quotes is part of the filter, this allows to use keywords, commas and
+// unbalanced parenthesis in filter values
+func tokenize(text string) ([]token, error) {
+	tokens := []token{}
+	pos := 0
+	for {
+		for pos < len(text) && isSpace(text[pos]) {
+			pos++
+		}
+		if pos >= len(text) {
+			break
+		}
+
+		switch text[pos] {
+		case '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", position: pos})
+			pos++
+			continue
+		case ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", position: pos})
+			pos++
+			continue
+		case ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", position: pos})
+			pos++
+			continue
+		}
+
+		if kind, word, ok := keywordAt(text, pos); ok {
+			tokens = append(tokens, token{kind: kind, text: word, position: pos})
+			pos += len(word)
+			continue
+		}
+
+		start := pos
+		depth := 0
+	scan:
+		for pos < len(text) {
+			switch c := text[pos]; {
+			case c == '\\':
+				pos++
+			case c == '"':
+				quote := pos
+				for pos++; pos < len(text) && text[pos] != '"'; pos++ {
+					if text[pos] == '\\' {
+						pos++
+					}
+				}
+				if pos >= len(text) {
+					return nil, &ParseError{Message: "Unclosed '\"'", Position: quote}
+				}
+			case c == '(':
+				depth++
+			case c == ')':
+				if depth == 0 {
+					break scan
+				}
+				depth--
+			case c == ',' && depth == 0:
+				break scan
+			case isSpace(c):
+				next := pos
+				for next < len(text) && isSpace(text[next]) {
+					next++
+				}
+				if next < len(text) {
+					if kind, _, ok := keywordAt(text, next); ok && kind != tokenNot {
+						break scan
+					}
+				}
+			}
+			pos++
+		}
+		if pos > len(text) {
+			pos = len(text)
+		}
+		tokens = append(tokens, token{kind: tokenFilter, text: strings.TrimRight(text[start:pos], " \t\r\n"), position: start})
+	}
+	return append(tokens, token{kind: tokenEOF, position: len(text)}), nil
+}
+
+type expressionNode interface {
+	eval(alert *models.Alert, matches int) (isMatch bool, isValid bool)
+	isValid() bool
+}
+
+type filterNode struct {
+	filter FilterT
+}
+
+func (n *filterNode) eval(alert *models.Alert, matches int) (bool, bool) {
+	if !n.filter.GetIsValid() {
+		return false, false
+	}
+	return n.filter.Match(alert, matches), true
+}
+
+func (n *filterNode) isValid() bool {
+	return n.filter.GetIsValid()
+}
+
+type andNode struct {
+	children []expressionNode
+}
+
+// eval will call every child node, even if we already know the result, so
+// that hits are counted for every filter
+func (n *andNode) eval(alert *models.Alert, matches int) (bool, bool) {
+	isMatch, isValid := true, false
+	for _, child := range n.children {
+		m, v := child.eval(alert, matches)
+		if v {
+			isValid = true
+			if !m {
+				isMatch = false
+			}
+		}
+	}
+	return isMatch && isValid, isValid
+}
+
+func (n *andNode) isValid() bool {
+	for _, child := range n.children {
+		if child.isValid() {
+			return true
+		}
+	}
+	return false
+}
+
+type orNode struct {
+	children []expressionNode
+}
+
+func (n *orNode) eval(alert *models.Alert, matches int) (bool, bool) {
+	isMatch, isValid := false, false
+	for _, child := range n.children {
+		m, v := child.eval(alert, matches)
+		if v {
+			isValid = true
+			if m {
+				isMatch = true
+			}
+		}
+	}
+	return isMatch, isValid
+}
+
+func (n *orNode) isValid() bool {
+	for _, child := range n.children {
+		if child.isValid() {
+			return true
+		}
+	}
+	return false
+}
+
+type notNode struct {
+	child expressionNode
+}
+
+func (n *notNode) eval(alert *models.Alert, matches int) (bool, bool) {
+	m, v := n.child.eval(alert, matches)
+	if !v {
+		return false, false
+	}
+	return !m, true
+}
+
+func (n *notNode) isValid() bool {
+	return n.child.isValid()
+}
+
+type parser struct {
+	tokens  []token
+	pos     int
+	last    tokenType
+	filters []FilterT
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	p.last = t.kind
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) newFilter(text string) expressionNode {
+	f := NewFilter(text)
+	p.filters = append(p.filters, f)
+	return &filterNode{filter: f}
+}
+
+// parseOr handles the lowest priority operator:
+// or := and ( "OR" and )*
+func (p *parser) parseOr() (expressionNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []expressionNode{node}
+	for p.peek().kind == tokenOr {
+		p.next()
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &orNode{children: children}, nil
+}
+
+// parseAnd handles commas and AND keyword:
+// and := unary ( ( "," | "AND" ) unary )*
+func (p *parser) parseAnd() (expressionNode, error) {
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	children := []expressionNode{node}
+	for p.peek().kind == tokenComma || p.peek().kind == tokenAnd {
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &andNode{children: children}, nil
+}
+
+// parseUnary handles negation, groups and single filters:
+// unary := "NOT" unary | "(" or ")" | filter
+func (p *parser) parseUnary() (expressionNode, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenNot:
+		p.next()
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	case tokenLeftParen:
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenRightParen {
+			return nil, &ParseError{
+				Message:  fmt.Sprintf("Unclosed '(' from position %d, expected ')' but got %s", t.position, p.peek()),
+				Position: p.peek().position,
+			}
+		}
+		p.next()
+		return node, nil
+	case tokenFilter:
+		p.next()
+		return p.newFilter(t.text), nil
+	case tokenComma, tokenEOF:
+		// empty filters in a comma separated list are allowed, UI will send
+		// those, treat it just like any other filter so it's reported back
+		if p.last == tokenStart || p.last == tokenComma {
+			return p.newFilter(""), nil
+		}
+	}
+	return nil, &ParseError{
+		Message:  fmt.Sprintf("Expected a filter, got %s", t),
+		Position: t.position,
+	}
+}
+
+// Expression is a parsed filter expression, it's a tree of filters combined
+// using AND (or a comma), OR, NOT and parenthesis for grouping
+type Expression struct {
+	root    expressionNode
+	filters []FilterT
+}
+
+// ParseExpression will parse filter expression, if the expression is invalid
+// ParseError is returned along with an empty expression that doesn't match
+// any alert
+func ParseExpression(text string) (*Expression, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return &Expression{filters: []FilterT{}}, err
+	}
+	p := parser{tokens: tokens, last: tokenStart, filters: []FilterT{}}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = &ParseError{
+			Message:  fmt.Sprintf("Unexpected %s", p.peek()),
+			Position: p.peek().position,
+		}
+	}
+	if err != nil {
+		return &Expression{filters: []FilterT{}}, err
+	}
+	return &Expression{root: root, filters: p.filters}, nil
+}
+
+// Filters returns all filters from the expression in the order they appear in
+func (e *Expression) Filters() []FilterT {
+	return e.filters
+}
+
+// IsValid returns true if there's at least one valid filter used in the
+// expression, invalid filters are ignored when matching alerts
+func (e *Expression) IsValid() bool {
+	return e.root != nil && e.root.isValid()
+}
+
+// Match returns true if alert matches the expression, all alerts will match
+// if there are no valid filters and none will match if the expression failed
+// to parse, every valid filter is always evaluated so hits are counted
+// correctly for each of them
+func (e *Expression) Match(alert *models.Alert, matches int) bool {
+	if e.root == nil {
+		return false
+	}
+	isMatch, isValid := e.root.eval(alert, matches)
+	if !isValid {
+		return true
+	}
+	return isMatch
+}
@@ -0,0 +1,291 @@
+package filters_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/filters"
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+type expressionTest struct {
+	Expression string
+	Filters    []string
+	IsValid    bool
+	Error      string
+	Position   int
+	Alert      models.Alert
+	IsMatch    bool
+	Hits       []int
+}
+
+var expressionTests = []expressionTest{
+	expressionTest{
+		Expression: "",
+		Filters:    []string{""},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"foo": "bar"}},
+		IsMatch:    true,
+		Hits:       []int{1},
+	},
+	expressionTest{
+		Expression: "foo=bar,bar=foo",
+		Filters:    []string{"foo=bar", "bar=foo"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"foo": "bar"}},
+		IsMatch:    false,
+		Hits:       []int{1, 0},
+	},
+	expressionTest{
+		Expression: "foo=bar AND bar=foo",
+		Filters:    []string{"foo=bar", "bar=foo"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"foo": "bar", "bar": "foo"}},
+		IsMatch:    true,
+		Hits:       []int{1, 1},
+	},
+	expressionTest{
+		Expression: "foo=bar,",
+		Filters:    []string{"foo=bar", ""},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"foo": "bar"}},
+		IsMatch:    true,
+		Hits:       []int{1, 1},
+	},
+	expressionTest{
+		Expression: "foo=bar OR foo=baz",
+		Filters:    []string{"foo=bar", "foo=baz"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"foo": "baz"}},
+		IsMatch:    true,
+		Hits:       []int{0, 1},
+	},
+	expressionTest{
+		Expression: "foo=bar OR foo=baz",
+		Filters:    []string{"foo=bar", "foo=baz"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"foo": "xxx"}},
+		IsMatch:    false,
+		Hits:       []int{0, 0},
+	},
+	expressionTest{
+		Expression: "NOT foo=bar",
+		Filters:    []string{"foo=bar"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"foo": "bar"}},
+		IsMatch:    false,
+		Hits:       []int{1},
+	},
+	expressionTest{
+		Expression: "NOT NOT foo=bar",
+		Filters:    []string{"foo=bar"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"foo": "bar"}},
+		IsMatch:    true,
+		Hits:       []int{1},
+	},
+	expressionTest{
+		Expression: "a=1,b=2 OR c=3",
+		Filters:    []string{"a=1", "b=2", "c=3"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"c": "3"}},
+		IsMatch:    true,
+		Hits:       []int{0, 0, 1},
+	},
+	expressionTest{
+		Expression: "a=1,(b=2 OR c=3)",
+		Filters:    []string{"a=1", "b=2", "c=3"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"c": "3"}},
+		IsMatch:    false,
+		Hits:       []int{0, 0, 1},
+	},
+	expressionTest{
+		Expression: "(cluster=a OR cluster=b), NOT (instance=~(web1|web2))",
+		Filters:    []string{"cluster=a", "cluster=b", "instance=~(web1|web2)"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"cluster": "b", "instance": "web3"}},
+		IsMatch:    true,
+		Hits:       []int{0, 1, 0},
+	},
+	expressionTest{
+		Expression: "(cluster=a OR cluster=b), NOT instance=~(web1|web2)",
+		Filters:    []string{"cluster=a", "cluster=b", "instance=~(web1|web2)"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"cluster": "b", "instance": "web2"}},
+		IsMatch:    false,
+		Hits:       []int{0, 1, 1},
+	},
+	expressionTest{
+		Expression: "summary=~disk is full OR summary=~host down",
+		Filters:    []string{"summary=~disk is full", "summary=~host down"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"summary": "host down"}},
+		IsMatch:    true,
+		Hits:       []int{0, 1},
+	},
+	expressionTest{
+		Expression: "ORACLE=1 OR NOTE=2",
+		Filters:    []string{"ORACLE=1", "NOTE=2"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"NOTE": "2"}},
+		IsMatch:    true,
+		Hits:       []int{0, 1},
+	},
+	expressionTest{
+		// invalid filters are ignored
+		Expression: "foo==bar OR bar=foo",
+		Filters:    []string{"foo==bar", "bar=foo"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"bar": "foo"}},
+		IsMatch:    true,
+		Hits:       []int{0, 1},
+	},
+	expressionTest{
+		// no valid filters, so everything matches
+		Expression: "NOT foo==bar",
+		Filters:    []string{"foo==bar"},
+		IsValid:    false,
+		Alert:      models.Alert{Labels: map[string]string{"foo": "bar"}},
+		IsMatch:    true,
+		Hits:       []int{0},
+	},
+	expressionTest{
+		Expression: "foo=bar OR",
+		Error:      "Expected a filter, got end of expression",
+		Position:   10,
+		IsMatch:    false,
+	},
+	expressionTest{
+		Expression: "(foo=bar",
+		Error:      "Unclosed '(' from position 0, expected ')' but got end of expression",
+		Position:   8,
+		IsMatch:    false,
+	},
+	expressionTest{
+		Expression: "foo=bar)",
+		Error:      "Unexpected ')'",
+		Position:   7,
+		IsMatch:    false,
+	},
+	expressionTest{
+		Expression: "(foo=bar) NOT bar=foo",
+		Error:      "Unexpected 'NOT'",
+		Position:   10,
+		IsMatch:    false,
+	},
+	expressionTest{
+		Expression: "foo=bar NOT bar=foo",
+		Filters:    []string{"foo=bar NOT bar=foo"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"foo": "bar NOT bar=foo"}},
+		IsMatch:    true,
+		Hits:       []int{1},
+	},
+	expressionTest{
+		Expression: "summary=~Disk is NOT full",
+		Filters:    []string{"summary=~Disk is NOT full"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"summary": "Disk is NOT full"}},
+		IsMatch:    true,
+		Hits:       []int{1},
+	},
+	expressionTest{
+		Expression: "foo=OR bar",
+		Filters:    []string{"foo=OR bar"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"foo": "OR bar"}},
+		IsMatch:    true,
+		Hits:       []int{1},
+	},
+	expressionTest{
+		Expression: `foo="bar OR baz, (x" OR foo=baz`,
+		Filters:    []string{`foo="bar OR baz, (x"`, "foo=baz"},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"foo": "bar OR baz, (x"}},
+		IsMatch:    true,
+		Hits:       []int{1, 0},
+	},
+	expressionTest{
+		Expression: `foo="say \"hi\""`,
+		Filters:    []string{`foo="say \"hi\""`},
+		IsValid:    true,
+		Alert:      models.Alert{Labels: map[string]string{"foo": `say "hi"`}},
+		IsMatch:    true,
+		Hits:       []int{1},
+	},
+	expressionTest{
+		Expression: `foo="bar OR baz`,
+		Error:      `Unclosed '"'`,
+		Position:   4,
+		IsMatch:    false,
+	},
+	expressionTest{
+		Expression: "foo=bar,()",
+		Error:      "Expected a filter, got ')'",
+		Position:   9,
+		IsMatch:    false,
+	},
+	expressionTest{
+		Expression: "OR foo=bar",
+		Error:      "Expected a filter, got 'OR'",
+		Position:   0,
+		IsMatch:    false,
+	},
+}
+
+func TestParseExpression(t *testing.T) {
+	for _, et := range expressionTests {
+		expression, err := filters.ParseExpression(et.Expression)
+		if et.Error != "" {
+			if err == nil {
+				t.Errorf("[%s] Expected error '%s', got nil", et.Expression, et.Error)
+				continue
+			}
+			parseError, ok := err.(*filters.ParseError)
+			if !ok {
+				t.Errorf("[%s] Expected *ParseError, got %T", et.Expression, err)
+				continue
+			}
+			if parseError.Message != et.Error {
+				t.Errorf("[%s] Expected error '%s', got '%s'", et.Expression, et.Error, parseError.Message)
+			}
+			if parseError.Position != et.Position {
+				t.Errorf("[%s] Expected error at position %d, got %d", et.Expression, et.Position, parseError.Position)
+			}
+		} else if err != nil {
+			t.Errorf("[%s] Unexpected error: %s", et.Expression, err)
+			continue
+		}
+
+		texts := []string{}
+		for _, f := range expression.Filters() {
+			texts = append(texts, f.GetRawText())
+		}
+		if et.Filters == nil {
+			et.Filters = []string{}
+		}
+		if !reflect.DeepEqual(texts, et.Filters) {
+			t.Errorf("[%s] Expected filters %q, got %q", et.Expression, et.Filters, texts)
+		}
+		if expression.IsValid() != et.IsValid {
+			t.Errorf("[%s] IsValid() returned %v, expected %v", et.Expression, expression.IsValid(), et.IsValid)
+		}
+
+		alert := models.Alert(et.Alert)
+		if m := expression.Match(&alert, 0); m != et.IsMatch {
+			t.Errorf("[%s] Match() returned %v, expected %v", et.Expression, m, et.IsMatch)
+		}
+
+		hits := []int{}
+		for _, f := range expression.Filters() {
+			hits = append(hits, f.GetHits())
+		}
+		if et.Hits == nil {
+			et.Hits = []int{}
+		}
+		if !reflect.DeepEqual(hits, et.Hits) {
+			t.Errorf("[%s] Expected hits %v, got %v", et.Expression, et.Hits, hits)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package filters
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/cloudflare/unsee/internal/models"
 	"github.com/cloudflare/unsee/internal/slices"
@@ -51,6 +52,16 @@ func (filter *alertFilter) GetIsValid() bool {
 
 type newFilterFactory func() FilterT
 
+// unquoteValue strips double quotes from a filter value wrapped in those,
+// quotes escaped with a backslash are unescaped, all other escape sequences
+// are kept since those are needed for regex values
+func unquoteValue(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' || strings.HasSuffix(value, `\"`) {
+		return value
+	}
+	return strings.Replace(value[1:len(value)-1], `\"`, `"`, -1)
+}
+
 // NewFilter creates new filter object from filter expression like "key=value"
 // expression will be parsed and best filter implementation and value matcher
 // will be selected
@@ -71,6 +82,7 @@ func NewFilter(expression string) FilterT {
 	matched, _ := result["matched"]
 	operator, _ := result["operator"]
 	value, _ := result["value"]
+	value = unquoteValue(value)
 
 	if matched == "" && operator == "" && value == "" {
 		// no "filter=" part, just the value, use fuzzy filter
@@ -79,7 +91,7 @@ func NewFilter(expression string) FilterT {
 		if err != nil {
 			f.init("", nil, expression, false, expression)
 		} else {
-			f.init("", &matcher, expression, true, expression)
+			f.init("", &matcher, expression, true, unquoteValue(expression))
 		}
 		return f
 	}
@@ -0,0 +1,64 @@
+package filters
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+type clusterFilter struct {
+	alertFilter
+}
+
+func (filter *clusterFilter) Match(alert *models.Alert, matches int) bool {
+	if filter.IsValid {
+		var isMatch bool
+		for _, am := range alert.Alertmanager {
+			if filter.Matcher.Compare(am.Cluster, filter.Value) {
+				isMatch = true
+			}
+		}
+		if isMatch {
+			filter.Hits++
+		}
+		return isMatch
+	}
+	e := fmt.Sprintf("Match() called on invalid filter %#v", filter)
+	panic(e)
+}
+
+func newClusterFilter() FilterT {
+	f := clusterFilter{}
+	return &f
+}
+
+func clusterAutocomplete(name string, operators []string, alerts []models.Alert) []models.Autocomplete {
+	tokens := map[string]models.Autocomplete{}
+	for _, alert := range alerts {
+		for _, am := range alert.Alertmanager {
+			if am.Cluster == "" {
+				continue
+			}
+			for _, operator := range operators {
+				switch operator {
+				case equalOperator, notEqualOperator:
+					token := fmt.Sprintf("%s%s%s", name, operator, am.Cluster)
+					tokens[token] = makeAC(
+						token,
+						[]string{
+							name,
+							strings.TrimPrefix(name, "@"),
+							name + operator,
+						},
+					)
+				}
+			}
+		}
+	}
+	acData := []models.Autocomplete{}
+	for _, token := range tokens {
+		acData = append(acData, token)
+	}
+	return acData
+}
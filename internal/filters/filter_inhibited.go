@@ -0,0 +1,159 @@
+package filters
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+type inhibitedFilter struct {
+	alertFilter
+}
+
+func (filter *inhibitedFilter) init(name string, matcher *matcherT, rawText string, isValid bool, value string) {
+	filter.Matched = name
+	if matcher != nil {
+		filter.Matcher = *matcher
+	}
+	filter.RawText = rawText
+	filter.IsValid = isValid
+	if filter.IsValid {
+		val, err := strconv.ParseBool(value)
+		if err != nil {
+			filter.IsValid = false
+		} else {
+			filter.Value = val
+		}
+	}
+}
+
+func (filter *inhibitedFilter) Match(alert *models.Alert, matches int) bool {
+	if filter.IsValid {
+		isMatch := filter.Matcher.Compare(alert.IsInhibited(), filter.Value)
+		if isMatch {
+			filter.Hits++
+		}
+		return isMatch
+	}
+	e := fmt.Sprintf("Match() called on invalid filter %#v", filter)
+	panic(e)
+}
+
+func newInhibitedFilter() FilterT {
+	f := inhibitedFilter{}
+	return &f
+}
+
+func inhibitedAutocomplete(name string, operators []string, alerts []models.Alert) []models.Autocomplete {
+	tokens := []models.Autocomplete{}
+	// only suggest this filter if there are any inhibited alerts
+	var hasInhibited bool
+	for _, alert := range alerts {
+		if alert.IsInhibited() {
+			hasInhibited = true
+		}
+	}
+	if !hasInhibited {
+		return tokens
+	}
+	for _, operator := range operators {
+		for _, value := range []string{"true", "false"} {
+			tokens = append(tokens, makeAC(
+				name+operator+value,
+				[]string{
+					name,
+					strings.TrimPrefix(name, "@"),
+					name + operator,
+				},
+			))
+		}
+	}
+	return tokens
+}
+
+// inhibitedByFilter matches alerts using labels of alerts inhibiting them,
+// the value is a label filter, e.g. @inhibited_by=severity=critical
+type inhibitedByFilter struct {
+	alertFilter
+	labelFilter FilterT
+}
+
+func (filter *inhibitedByFilter) init(name string, matcher *matcherT, rawText string, isValid bool, value string) {
+	filter.Matched = name
+	if matcher != nil {
+		filter.Matcher = *matcher
+	}
+	filter.RawText = rawText
+	filter.IsValid = isValid
+	filter.Value = value
+	if filter.IsValid {
+		f := NewFilter(value)
+		if _, ok := f.(*labelFilter); !ok || !f.GetIsValid() {
+			filter.IsValid = false
+		} else {
+			filter.labelFilter = f
+		}
+	}
+}
+
+func (filter *inhibitedByFilter) Match(alert *models.Alert, matches int) bool {
+	if filter.IsValid {
+		var isInhibited bool
+		if alert.IsInhibited() {
+			for _, am := range alert.Alertmanager {
+				for _, inhibitor := range am.InhibitedBy {
+					if len(inhibitor.Labels) > 0 && filter.labelFilter.Match(&models.Alert{Labels: inhibitor.Labels}, 0) {
+						isInhibited = true
+					}
+				}
+			}
+		}
+		isMatch := isInhibited
+		if filter.Matcher.GetOperator() == notEqualOperator {
+			isMatch = !isInhibited
+		}
+		if isMatch {
+			filter.Hits++
+		}
+		return isMatch
+	}
+	e := fmt.Sprintf("Match() called on invalid filter %#v", filter)
+	panic(e)
+}
+
+func newInhibitedByFilter() FilterT {
+	f := inhibitedByFilter{}
+	return &f
+}
+
+func inhibitedByAutocomplete(name string, operators []string, alerts []models.Alert) []models.Autocomplete {
+	tokens := map[string]models.Autocomplete{}
+	for _, alert := range alerts {
+		if !alert.IsInhibited() {
+			continue
+		}
+		for _, am := range alert.Alertmanager {
+			for _, inhibitor := range am.InhibitedBy {
+				for key, value := range inhibitor.Labels {
+					for _, operator := range operators {
+						token := fmt.Sprintf("%s%s%s=%s", name, operator, key, value)
+						tokens[token] = makeAC(token, []string{
+							name,
+							strings.TrimPrefix(name, "@"),
+							fmt.Sprintf("%s%s", name, operator),
+							key,
+							value,
+						})
+					}
+				}
+			}
+		}
+	}
+	acData := []models.Autocomplete{}
+	for _, token := range tokens {
+		acData = append(acData, token)
+	}
+	return acData
+}
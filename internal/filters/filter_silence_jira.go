@@ -19,9 +19,16 @@ func (filter *silenceJiraFilter) Match(alert *models.Alert, matches int) bool {
 				for _, am := range alert.Alertmanager {
 					silence, found := am.Silences[silenceID]
 					if found {
-						m := filter.Matcher.Compare(silence.JiraID, filter.Value)
-						if m {
-							isMatch = m
+						jiraIDs := silence.LinksOfType("jira")
+						// silences without any JIRA link are compared using
+						// an empty string
+						if len(jiraIDs) == 0 {
+							jiraIDs = []string{""}
+						}
+						for _, jiraID := range jiraIDs {
+							if filter.Matcher.Compare(jiraID, filter.Value) {
+								isMatch = true
+							}
 						}
 					}
 				}
@@ -50,14 +57,17 @@ func sinceJiraIDAutocomplete(name string, operators []string, alerts []models.Al
 			for _, silenceID := range alert.SilencedBy {
 				for _, am := range alert.Alertmanager {
 					silence, found := am.Silences[silenceID]
-					if found && silence.JiraID != "" {
+					if !found {
+						continue
+					}
+					for _, jiraID := range silence.LinksOfType("jira") {
 						for _, operator := range operators {
-							token := fmt.Sprintf("%s%s%s", name, operator, silence.JiraID)
+							token := fmt.Sprintf("%s%s%s", name, operator, jiraID)
 							tokens[token] = makeAC(token, []string{
 								name,
 								strings.TrimPrefix(name, "@"),
 								fmt.Sprintf("%s%s", name, operator),
-								silence.JiraID,
+								jiraID,
 							})
 						}
 					}
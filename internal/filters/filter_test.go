@@ -88,7 +88,7 @@ var tests = []filterTest{
 		Expression: "@silence_jira=1",
 		IsValid:    true,
 		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
-		Silence:    models.Silence{ID: "1", JiraID: "1"},
+		Silence:    models.Silence{ID: "1", Links: []models.Link{models.Link{Type: "jira", Text: "1"}}},
 		IsMatch:    true,
 	},
 	filterTest{
@@ -102,14 +102,14 @@ var tests = []filterTest{
 		Expression: "@silence_jira!=3",
 		IsValid:    true,
 		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
-		Silence:    models.Silence{ID: "1", JiraID: "x"},
+		Silence:    models.Silence{ID: "1", Links: []models.Link{models.Link{Type: "jira", Text: "x"}}},
 		IsMatch:    true,
 	},
 	filterTest{
 		Expression: "@silence_jira!=4",
 		IsValid:    true,
 		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
-		Silence:    models.Silence{ID: "1", JiraID: "4"},
+		Silence:    models.Silence{ID: "1", Links: []models.Link{models.Link{Type: "jira", Text: "4"}}},
 		IsMatch:    false,
 	},
 	filterTest{
@@ -123,35 +123,35 @@ var tests = []filterTest{
 		Expression: "@silence_jira=~abc",
 		IsValid:    true,
 		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
-		Silence:    models.Silence{ID: "1", JiraID: "xxabcxx"},
+		Silence:    models.Silence{ID: "1", Links: []models.Link{models.Link{Type: "jira", Text: "xxabcxx"}}},
 		IsMatch:    true,
 	},
 	filterTest{
 		Expression: "@silence_jira=~abc",
 		IsValid:    true,
 		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
-		Silence:    models.Silence{ID: "1", JiraID: "xxx"},
+		Silence:    models.Silence{ID: "1", Links: []models.Link{models.Link{Type: "jira", Text: "xxx"}}},
 		IsMatch:    false,
 	},
 	filterTest{
 		Expression: "@silence_jira=~",
 		IsValid:    false,
 		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
-		Silence:    models.Silence{ID: "1", JiraID: "xxx"},
+		Silence:    models.Silence{ID: "1", Links: []models.Link{models.Link{Type: "jira", Text: "xxx"}}},
 		IsMatch:    false,
 	},
 	filterTest{
 		Expression: "@silence_jira~=",
 		IsValid:    false,
 		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
-		Silence:    models.Silence{ID: "1", JiraID: "xxx"},
+		Silence:    models.Silence{ID: "1", Links: []models.Link{models.Link{Type: "jira", Text: "xxx"}}},
 		IsMatch:    false,
 	},
 	filterTest{
 		Expression: "@silence_jira~=1",
 		IsValid:    false,
 		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
-		Silence:    models.Silence{ID: "1", JiraID: "xxx"},
+		Silence:    models.Silence{ID: "1", Links: []models.Link{models.Link{Type: "jira", Text: "xxx"}}},
 		IsMatch:    false,
 	},
 
@@ -212,6 +212,48 @@ var tests = []filterTest{
 		IsMatch:    false,
 	},
 
+	filterTest{
+		Expression: "@silence_expires<1h",
+		IsValid:    true,
+		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
+		Silence:    models.Silence{ID: "1", EndsAt: time.Now().Add(time.Minute * 30)},
+		IsMatch:    true,
+	},
+	filterTest{
+		Expression: "@silence_expires<1h",
+		IsValid:    true,
+		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
+		Silence:    models.Silence{ID: "1", EndsAt: time.Now().Add(time.Hour * 2)},
+		IsMatch:    false,
+	},
+	filterTest{
+		Expression: "@silence_expires>1h",
+		IsValid:    true,
+		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
+		Silence:    models.Silence{ID: "1", EndsAt: time.Now().Add(time.Hour * 2)},
+		IsMatch:    true,
+	},
+	filterTest{
+		Expression: "@silence_expires<1h",
+		IsValid:    true,
+		Alert:      models.Alert{State: "active"},
+		IsMatch:    false,
+	},
+	filterTest{
+		Expression: "@silence_expires=1h",
+		IsValid:    false,
+		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
+		Silence:    models.Silence{ID: "1", EndsAt: time.Now().Add(time.Minute * 30)},
+		IsMatch:    false,
+	},
+	filterTest{
+		Expression: "@silence_expires<foo",
+		IsValid:    false,
+		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
+		Silence:    models.Silence{ID: "1", EndsAt: time.Now().Add(time.Minute * 30)},
+		IsMatch:    false,
+	},
+
 	filterTest{
 		Expression: "@age<1h",
 		IsValid:    true,
@@ -434,10 +476,30 @@ var tests = []filterTest{
 	},
 	filterTest{
 		Expression: "@inhibited=true",
-		IsValid:    false,
+		IsValid:    true,
+		Alert:      models.Alert{},
+		IsMatch:    false,
 	},
 	filterTest{
 		Expression: "@inhibited!=false",
+		IsValid:    true,
+		Alert:      models.Alert{},
+		IsMatch:    false,
+	},
+	filterTest{
+		Expression: "@inhibited=true",
+		IsValid:    true,
+		Alert:      models.Alert{State: "suppressed", InhibitedBy: []string{"1"}},
+		IsMatch:    true,
+	},
+	filterTest{
+		Expression: "@inhibited=false",
+		IsValid:    true,
+		Alert:      models.Alert{State: "suppressed", SilencedBy: []string{"1"}},
+		IsMatch:    true,
+	},
+	filterTest{
+		Expression: "@inhibited=xx",
 		IsValid:    false,
 	},
 	filterTest{
@@ -480,6 +542,34 @@ var tests = []filterTest{
 		Alert:      models.Alert{},
 		IsMatch:    true,
 	},
+	filterTest{
+		Expression: "@cluster=prod",
+		IsValid:    true,
+		Alert:      models.Alert{},
+		IsMatch:    true,
+	},
+	filterTest{
+		Expression: "@cluster=test",
+		IsValid:    true,
+		Alert:      models.Alert{},
+		IsMatch:    false,
+	},
+	filterTest{
+		Expression: "@cluster=~pro",
+		IsValid:    true,
+		Alert:      models.Alert{},
+		IsMatch:    true,
+	},
+	filterTest{
+		Expression: "@cluster!=prod",
+		IsValid:    true,
+		Alert:      models.Alert{},
+		IsMatch:    false,
+	},
+	filterTest{
+		Expression: "@cluster>prod",
+		IsValid:    false,
+	},
 }
 
 func TestFilters(t *testing.T) {
@@ -494,8 +584,9 @@ func TestFilters(t *testing.T) {
 		if &ft.Silence != nil {
 			alert.Alertmanager = []models.AlertmanagerInstance{
 				models.AlertmanagerInstance{
-					Name: am.Name,
-					URI:  am.URI,
+					Name:    am.Name,
+					URI:     am.URI,
+					Cluster: "prod",
 					Silences: map[string]models.Silence{
 						ft.Silence.ID: ft.Silence,
 					},
@@ -612,3 +703,108 @@ func TestLimitFilter(t *testing.T) {
 		}
 	}
 }
+
+type inhibitedByFilterTest struct {
+	Expression string
+	IsValid    bool
+	Alert      models.Alert
+	Inhibitors []models.InhibitingAlert
+	IsMatch    bool
+}
+
+var inhibitedAlert = models.Alert{State: "suppressed", InhibitedBy: []string{"fp1"}}
+
+var inhibitedByTests = []inhibitedByFilterTest{
+	inhibitedByFilterTest{
+		Expression: "@inhibited_by=severity=critical",
+		IsValid:    true,
+		Alert:      inhibitedAlert,
+		Inhibitors: []models.InhibitingAlert{
+			{Fingerprint: "fp1", Labels: map[string]string{"severity": "critical"}},
+		},
+		IsMatch: true,
+	},
+	inhibitedByFilterTest{
+		Expression: "@inhibited_by=alertname=~Down",
+		IsValid:    true,
+		Alert:      inhibitedAlert,
+		Inhibitors: []models.InhibitingAlert{
+			{Fingerprint: "fp1", Labels: map[string]string{"alertname": "Host_Down"}},
+		},
+		IsMatch: true,
+	},
+	inhibitedByFilterTest{
+		Expression: "@inhibited_by=severity=critical",
+		IsValid:    true,
+		Alert:      inhibitedAlert,
+		Inhibitors: []models.InhibitingAlert{
+			{Fingerprint: "fp1", Labels: map[string]string{"severity": "warning"}},
+		},
+		IsMatch: false,
+	},
+	inhibitedByFilterTest{
+		Expression: "@inhibited_by!=severity=critical",
+		IsValid:    true,
+		Alert:      inhibitedAlert,
+		Inhibitors: []models.InhibitingAlert{
+			{Fingerprint: "fp1", Labels: map[string]string{"severity": "warning"}},
+		},
+		IsMatch: true,
+	},
+	inhibitedByFilterTest{
+		Expression: "@inhibited_by=severity!=critical",
+		IsValid:    true,
+		Alert:      inhibitedAlert,
+		Inhibitors: []models.InhibitingAlert{
+			{Fingerprint: "fp1"},
+		},
+		IsMatch: false,
+	},
+	inhibitedByFilterTest{
+		Expression: "@inhibited_by=severity=critical",
+		IsValid:    true,
+		Alert:      models.Alert{State: "active"},
+		IsMatch:    false,
+	},
+	inhibitedByFilterTest{
+		Expression: "@inhibited_by!=severity=critical",
+		IsValid:    true,
+		Alert:      models.Alert{State: "active"},
+		IsMatch:    true,
+	},
+	inhibitedByFilterTest{
+		Expression: "@inhibited_by=critical",
+		IsValid:    false,
+	},
+	inhibitedByFilterTest{
+		Expression: "@inhibited_by=@state=active",
+		IsValid:    false,
+	},
+	inhibitedByFilterTest{
+		Expression: "@inhibited_by=~severity=critical",
+		IsValid:    false,
+	},
+}
+
+func TestInhibitedByFilter(t *testing.T) {
+	for _, ft := range inhibitedByTests {
+		alert := models.Alert(ft.Alert)
+		alert.Alertmanager = []models.AlertmanagerInstance{
+			models.AlertmanagerInstance{Name: "test", InhibitedBy: ft.Inhibitors},
+		}
+
+		f := filters.NewFilter(ft.Expression)
+		if f.GetIsValid() != ft.IsValid {
+			t.Errorf("[%s] GetIsValid() returned %#v while %#v was expected", ft.Expression, f.GetIsValid(), ft.IsValid)
+		}
+		if f.GetIsValid() {
+			m := f.Match(&alert, 0)
+			if m != ft.IsMatch {
+				t.Errorf("[%s] Match() returned %#v while %#v was expected, inhibitors: %v", ft.Expression, m, ft.IsMatch, ft.Inhibitors)
+			}
+			if ft.IsMatch && f.GetHits() != 1 {
+				t.Errorf("[%s] GetHits() returned %#v after match, expected 1", ft.Expression, f.GetHits())
+			}
+		}
+	}
+}
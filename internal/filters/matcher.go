@@ -95,17 +95,27 @@ type regexpMatcher struct {
 	abstractMatcher
 }
 
+// compileCached returns compiled regexp for given expression, compiled
+// regexps are kept in matchCache so we don't need to compile them every time
+func compileCached(expression string) (*regexp.Regexp, error) {
+	r, found := matchCache.Get(expression)
+	if found {
+		return r.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	matchCache.Set(expression, re, 1*time.Minute)
+	return re, nil
+}
+
 func (matcher *regexpMatcher) Compare(valA, valB interface{}) bool {
-	r, found := matchCache.Get(valB.(string))
-	if !found {
-		var err error
-		r, err = regexp.Compile("(?i)" + valB.(string))
-		if err != nil {
-			return false
-		}
-		matchCache.Set(valB.(string), r, 1*time.Minute)
+	r, err := compileCached("(?i)" + valB.(string))
+	if err != nil {
+		return false
 	}
-	return r.(*regexp.Regexp).MatchString(valA.(string))
+	return r.MatchString(valA.(string))
 }
 
 type negativeRegexMatcher struct {
@@ -47,6 +47,13 @@ var AllFilters = []filterConfig{
 		Factory:            newAlertmanagerInstanceFilter,
 		Autocomplete:       alertmanagerInstanceAutocomplete,
 	},
+	filterConfig{
+		Label:              "@cluster",
+		LabelRe:            regexp.MustCompile("^@cluster$"),
+		SupportedOperators: []string{regexpOperator, negativeRegexOperator, equalOperator, notEqualOperator},
+		Factory:            newClusterFilter,
+		Autocomplete:       clusterAutocomplete,
+	},
 	filterConfig{
 		Label:              "@state",
 		LabelRe:            regexp.MustCompile("^@state$"),
@@ -82,6 +89,27 @@ var AllFilters = []filterConfig{
 		Factory:            newSilenceAuthorFilter,
 		Autocomplete:       sinceAuthorAutocomplete,
 	},
+	filterConfig{
+		Label:              "@silence_expires",
+		LabelRe:            regexp.MustCompile("^@silence_expires$"),
+		SupportedOperators: []string{lessThanOperator, moreThanOperator},
+		Factory:            newSilenceExpiresFilter,
+		Autocomplete:       silenceExpiresAutocomplete,
+	},
+	filterConfig{
+		Label:              "@inhibited",
+		LabelRe:            regexp.MustCompile("^@inhibited$"),
+		SupportedOperators: []string{equalOperator, notEqualOperator},
+		Factory:            newInhibitedFilter,
+		Autocomplete:       inhibitedAutocomplete,
+	},
+	filterConfig{
+		Label:              "@inhibited_by",
+		LabelRe:            regexp.MustCompile("^@inhibited_by$"),
+		SupportedOperators: []string{equalOperator, notEqualOperator},
+		Factory:            newInhibitedByFilter,
+		Autocomplete:       inhibitedByAutocomplete,
+	},
 	filterConfig{
 		Label:              "@limit",
 		LabelRe:            regexp.MustCompile("^@limit$"),
@@ -0,0 +1,27 @@
+package filters
+
+import (
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+// SilenceMatchesAlert returns true if given silence would match an alert,
+// it uses the same rules as Alertmanager: all matchers must match, regex
+// matchers are anchored and case sensitive, missing labels are treated as
+// labels with an empty value
+func SilenceMatchesAlert(silence *models.Silence, alert *models.Alert) bool {
+	if len(silence.Matchers) == 0 {
+		return false
+	}
+	for _, m := range silence.Matchers {
+		value := alert.Labels[m.Name]
+		if m.IsRegex {
+			r, err := compileCached("^(?:" + m.Value + ")$")
+			if err != nil || !r.MatchString(value) {
+				return false
+			}
+		} else if value != m.Value {
+			return false
+		}
+	}
+	return true
+}
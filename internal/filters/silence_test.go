@@ -0,0 +1,73 @@
+package filters_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/filters"
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+type silenceMatchTest struct {
+	matchers string
+	labels   map[string]string
+	isMatch  bool
+}
+
+var silenceMatchTests = []silenceMatchTest{
+	silenceMatchTest{
+		matchers: `[]`,
+		labels:   map[string]string{"foo": "bar"},
+		isMatch:  false,
+	},
+	silenceMatchTest{
+		matchers: `[{"name": "foo", "value": "bar"}]`,
+		labels:   map[string]string{"foo": "bar"},
+		isMatch:  true,
+	},
+	silenceMatchTest{
+		matchers: `[{"name": "foo", "value": "bar"}, {"name": "bar", "value": "foo"}]`,
+		labels:   map[string]string{"foo": "bar"},
+		isMatch:  false,
+	},
+	silenceMatchTest{
+		matchers: `[{"name": "foo", "value": "BAR"}]`,
+		labels:   map[string]string{"foo": "bar"},
+		isMatch:  false,
+	},
+	silenceMatchTest{
+		matchers: `[{"name": "foo", "value": "b.+", "isRegex": true}]`,
+		labels:   map[string]string{"foo": "bar"},
+		isMatch:  true,
+	},
+	silenceMatchTest{
+		matchers: `[{"name": "foo", "value": "ba", "isRegex": true}]`,
+		labels:   map[string]string{"foo": "bar"},
+		isMatch:  false,
+	},
+	silenceMatchTest{
+		matchers: `[{"name": "foo", "value": "b(", "isRegex": true}]`,
+		labels:   map[string]string{"foo": "b("},
+		isMatch:  false,
+	},
+	silenceMatchTest{
+		matchers: `[{"name": "foo", "value": "|bar", "isRegex": true}]`,
+		labels:   map[string]string{"bar": "foo"},
+		isMatch:  true,
+	},
+}
+
+func TestSilenceMatchesAlert(t *testing.T) {
+	for _, testCase := range silenceMatchTests {
+		silence := models.Silence{}
+		err := json.Unmarshal([]byte(`{"matchers": `+testCase.matchers+`}`), &silence)
+		if err != nil {
+			t.Fatal(err)
+		}
+		alert := models.Alert{Labels: testCase.labels}
+		if isMatch := filters.SilenceMatchesAlert(&silence, &alert); isMatch != testCase.isMatch {
+			t.Errorf("SilenceMatchesAlert(%s, %v) returned %t while %t was expected",
+				testCase.matchers, testCase.labels, isMatch, testCase.isMatch)
+		}
+	}
+}
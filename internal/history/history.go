@@ -0,0 +1,331 @@
+// Package history records alert state changes reported by Alertmanager
+// instances in a local BoltDB file
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+var (
+	// alerts bucket maps labels fingerprint to alertRecord
+	bucketAlerts = []byte("alerts")
+	// states bucket has a nested bucket for every Alertmanager instance, each
+	// mapping labels fingerprint to the last state reported by that instance
+	bucketStates = []byte("states")
+	// events bucket has a nested bucket for every labels fingerprint, each
+	// mapping timestamp + Alertmanager name to AlertHistoryEvent
+	bucketEvents = []byte("events")
+)
+
+type alertRecord struct {
+	Labels    map[string]string `json:"labels"`
+	FirstSeen time.Time         `json:"firstSeen"`
+	LastSeen  time.Time         `json:"lastSeen"`
+}
+
+// Store keeps alert history in a BoltDB file
+type Store struct {
+	db *bolt.DB
+}
+
+// Open will open (or create if missing) the database file at given path
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketAlerts, bucketStates, bucketEvents} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close the database file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// eventKey returns a key that sorts events by the time they were recorded
+func eventKey(ts time.Time, alertmanager string) []byte {
+	key := make([]byte, 8, 8+len(alertmanager))
+	binary.BigEndian.PutUint64(key, uint64(ts.UnixNano()))
+	return append(key, []byte(alertmanager)...)
+}
+
+func putEvent(tx *bolt.Tx, fingerprint string, event models.AlertHistoryEvent) error {
+	b, err := tx.Bucket(bucketEvents).CreateBucketIfNotExists([]byte(fingerprint))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return b.Put(eventKey(event.Timestamp, event.Alertmanager), data)
+}
+
+// Record compares alert groups pulled from given Alertmanager instance with
+// the state previously recorded for it and stores an event for every alert
+// that is new, changed state or is no longer reported (resolved)
+func (s *Store) Record(alertmanager string, ts time.Time, groups []models.AlertGroup) error {
+	// the same alert can be present in multiple groups if it's routed to
+	// multiple receivers, it will have the same state in all of them
+	current := map[string]models.Alert{}
+	for _, ag := range groups {
+		for _, alert := range ag.Alerts {
+			fp := alert.LabelsFingerprint()
+			if _, found := current[fp]; !found {
+				current[fp] = alert
+			}
+		}
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		alerts := tx.Bucket(bucketAlerts)
+		states, err := tx.Bucket(bucketStates).CreateBucketIfNotExists([]byte(alertmanager))
+		if err != nil {
+			return err
+		}
+
+		for fp, alert := range current {
+			record := alertRecord{Labels: alert.Labels, FirstSeen: ts}
+			if data := alerts.Get([]byte(fp)); data != nil {
+				if err := json.Unmarshal(data, &record); err != nil {
+					return err
+				}
+			}
+			record.LastSeen = ts
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := alerts.Put([]byte(fp), data); err != nil {
+				return err
+			}
+
+			if string(states.Get([]byte(fp))) == alert.State {
+				continue
+			}
+			if err := states.Put([]byte(fp), []byte(alert.State)); err != nil {
+				return err
+			}
+			event := models.AlertHistoryEvent{Timestamp: ts, Alertmanager: alertmanager, State: alert.State}
+			if err := putEvent(tx, fp, event); err != nil {
+				return err
+			}
+		}
+
+		resolved := []string{}
+		err = states.ForEach(func(k, v []byte) error {
+			if _, found := current[string(k)]; !found {
+				resolved = append(resolved, string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, fp := range resolved {
+			if err := states.Delete([]byte(fp)); err != nil {
+				return err
+			}
+			event := models.AlertHistoryEvent{Timestamp: ts, Alertmanager: alertmanager, State: models.AlertStateResolved}
+			if err := putEvent(tx, fp, event); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Retain will resolve all alerts last reported by Alertmanager instances that
+// are not on the passed list and remove recorded state for those instances,
+// otherwise alerts from instances removed from the config or no longer found
+// by discovery would never be resolved
+func (s *Store) Retain(alertmanagers []string, ts time.Time) error {
+	keep := map[string]bool{}
+	for _, name := range alertmanagers {
+		keep[name] = true
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		states := tx.Bucket(bucketStates)
+
+		removed := []string{}
+		err := states.ForEach(func(k, v []byte) error {
+			if !keep[string(k)] {
+				removed = append(removed, string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, alertmanager := range removed {
+			b := states.Bucket([]byte(alertmanager))
+			if b == nil {
+				continue
+			}
+			err := b.ForEach(func(k, v []byte) error {
+				event := models.AlertHistoryEvent{Timestamp: ts, Alertmanager: alertmanager, State: models.AlertStateResolved}
+				return putEvent(tx, string(k), event)
+			})
+			if err != nil {
+				return err
+			}
+			if err := states.DeleteBucket([]byte(alertmanager)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func readTimeline(tx *bolt.Tx, fingerprint string, data []byte) (models.AlertTimeline, error) {
+	record := alertRecord{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return models.AlertTimeline{}, err
+	}
+
+	timeline := models.AlertTimeline{
+		Fingerprint: fingerprint,
+		Labels:      record.Labels,
+		FirstSeen:   record.FirstSeen,
+		LastSeen:    record.LastSeen,
+		Events:      []models.AlertHistoryEvent{},
+	}
+
+	b := tx.Bucket(bucketEvents).Bucket([]byte(fingerprint))
+	if b == nil {
+		return timeline, nil
+	}
+	err := b.ForEach(func(k, v []byte) error {
+		event := models.AlertHistoryEvent{}
+		if err := json.Unmarshal(v, &event); err != nil {
+			return err
+		}
+		timeline.Events = append(timeline.Events, event)
+		return nil
+	})
+	return timeline, err
+}
+
+// Timeline returns recorded history for the alert with given labels
+// fingerprint, error is returned if there's no history for it
+func (s *Store) Timeline(fingerprint string) (models.AlertTimeline, error) {
+	var timeline models.AlertTimeline
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketAlerts).Get([]byte(fingerprint))
+		if data == nil {
+			return fmt.Errorf("No history found for alert '%s'", fingerprint)
+		}
+		var err error
+		timeline, err = readTimeline(tx, fingerprint, data)
+		return err
+	})
+	return timeline, err
+}
+
+// Search returns recorded history for every alert with labels accepted by
+// the match function, timelines are sorted by the time alerts were first seen
+func (s *Store) Search(match func(labels map[string]string) bool) ([]models.AlertTimeline, error) {
+	timelines := []models.AlertTimeline{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketAlerts).ForEach(func(k, v []byte) error {
+			record := alertRecord{}
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if !match(record.Labels) {
+				return nil
+			}
+			timeline, err := readTimeline(tx, string(k), v)
+			if err != nil {
+				return err
+			}
+			timelines = append(timelines, timeline)
+			return nil
+		})
+	})
+	sort.SliceStable(timelines, func(i, j int) bool {
+		return timelines[i].FirstSeen.Before(timelines[j].FirstSeen)
+	})
+	return timelines, err
+}
+
+// Prune removes all events recorded before given time and all alerts that
+// were last seen before it
+func (s *Store) Prune(before time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		alerts := tx.Bucket(bucketAlerts)
+		states := tx.Bucket(bucketStates)
+		events := tx.Bucket(bucketEvents)
+
+		expired := []string{}
+		err := alerts.ForEach(func(k, v []byte) error {
+			record := alertRecord{}
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if record.LastSeen.Before(before) {
+				expired = append(expired, string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, fp := range expired {
+			if err := alerts.Delete([]byte(fp)); err != nil {
+				return err
+			}
+			err := states.ForEach(func(k, v []byte) error {
+				return states.Bucket(k).Delete([]byte(fp))
+			})
+			if err != nil {
+				return err
+			}
+			if events.Bucket([]byte(fp)) != nil {
+				if err := events.DeleteBucket([]byte(fp)); err != nil {
+					return err
+				}
+			}
+		}
+
+		cutoff := eventKey(before, "")
+		return events.ForEach(func(k, v []byte) error {
+			b := events.Bucket(k)
+			if b == nil {
+				return nil
+			}
+			c := b.Cursor()
+			for key, _ := c.First(); key != nil && bytes.Compare(key, cutoff) < 0; key, _ = c.First() {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
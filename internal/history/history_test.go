@@ -0,0 +1,251 @@
+package history_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/history"
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+func openStore(t *testing.T) (*history.Store, func()) {
+	dir, err := ioutil.TempDir("", "unsee-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := history.Open(path.Join(dir, "history.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func newAlert(state string, labels map[string]string) models.Alert {
+	alert := models.Alert{Labels: labels, State: state}
+	alert.UpdateFingerprints()
+	return alert
+}
+
+func newGroups(alerts ...models.Alert) []models.AlertGroup {
+	return []models.AlertGroup{{Receiver: "default", Alerts: alerts}}
+}
+
+type historyStep struct {
+	alertmanager string
+	groups       []models.AlertGroup
+}
+
+type historyTest struct {
+	name   string
+	steps  []historyStep
+	events []models.AlertHistoryEvent
+}
+
+var (
+	labelsWeb1 = map[string]string{"alertname": "Host_Down", "instance": "web1"}
+	labelsWeb2 = map[string]string{"alertname": "Host_Down", "instance": "web2"}
+	baseTime   = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+var historyTests = []historyTest{
+	{
+		name: "alert pulled once",
+		steps: []historyStep{
+			{"am1", newGroups(newAlert(models.AlertStateActive, labelsWeb1))},
+		},
+		events: []models.AlertHistoryEvent{
+			{Timestamp: baseTime, Alertmanager: "am1", State: models.AlertStateActive},
+		},
+	},
+	{
+		name: "unchanged state is recorded once",
+		steps: []historyStep{
+			{"am1", newGroups(newAlert(models.AlertStateActive, labelsWeb1))},
+			{"am1", newGroups(newAlert(models.AlertStateActive, labelsWeb1))},
+		},
+		events: []models.AlertHistoryEvent{
+			{Timestamp: baseTime, Alertmanager: "am1", State: models.AlertStateActive},
+		},
+	},
+	{
+		name: "alert flapping",
+		steps: []historyStep{
+			{"am1", newGroups(newAlert(models.AlertStateActive, labelsWeb1))},
+			{"am1", newGroups(newAlert(models.AlertStateSuppressed, labelsWeb1))},
+			{"am1", newGroups(newAlert(models.AlertStateActive, labelsWeb2))},
+			{"am1", newGroups(newAlert(models.AlertStateActive, labelsWeb1))},
+		},
+		events: []models.AlertHistoryEvent{
+			{Timestamp: baseTime, Alertmanager: "am1", State: models.AlertStateActive},
+			{Timestamp: baseTime.Add(time.Minute), Alertmanager: "am1", State: models.AlertStateSuppressed},
+			{Timestamp: baseTime.Add(time.Minute * 2), Alertmanager: "am1", State: models.AlertStateResolved},
+			{Timestamp: baseTime.Add(time.Minute * 3), Alertmanager: "am1", State: models.AlertStateActive},
+		},
+	},
+	{
+		name: "alert reported by multiple Alertmanager instances",
+		steps: []historyStep{
+			{"am1", newGroups(newAlert(models.AlertStateActive, labelsWeb1))},
+			{"am2", newGroups(newAlert(models.AlertStateUnprocessed, labelsWeb1))},
+			{"am2", newGroups(newAlert(models.AlertStateActive, labelsWeb1))},
+			{"am1", newGroups()},
+		},
+		events: []models.AlertHistoryEvent{
+			{Timestamp: baseTime, Alertmanager: "am1", State: models.AlertStateActive},
+			{Timestamp: baseTime.Add(time.Minute), Alertmanager: "am2", State: models.AlertStateUnprocessed},
+			{Timestamp: baseTime.Add(time.Minute * 2), Alertmanager: "am2", State: models.AlertStateActive},
+			{Timestamp: baseTime.Add(time.Minute * 3), Alertmanager: "am1", State: models.AlertStateResolved},
+		},
+	},
+}
+
+func TestRecord(t *testing.T) {
+	alert := newAlert(models.AlertStateActive, labelsWeb1)
+	fp := alert.LabelsFingerprint()
+	for _, testCase := range historyTests {
+		store, cleanup := openStore(t)
+		for i, step := range testCase.steps {
+			ts := baseTime.Add(time.Minute * time.Duration(i))
+			if err := store.Record(step.alertmanager, ts, step.groups); err != nil {
+				t.Errorf("[%s] Record() failed: %s", testCase.name, err)
+			}
+		}
+
+		timeline, err := store.Timeline(fp)
+		if err != nil {
+			t.Errorf("[%s] Timeline() failed: %s", testCase.name, err)
+		} else {
+			if !reflect.DeepEqual(timeline.Labels, labelsWeb1) {
+				t.Errorf("[%s] Expected labels %v, got %v", testCase.name, labelsWeb1, timeline.Labels)
+			}
+			if !timeline.FirstSeen.Equal(baseTime) {
+				t.Errorf("[%s] Expected firstSeen %s, got %s", testCase.name, baseTime, timeline.FirstSeen)
+			}
+			if len(timeline.Events) != len(testCase.events) {
+				t.Errorf("[%s] Expected %d events, got %d: %v", testCase.name, len(testCase.events), len(timeline.Events), timeline.Events)
+			} else {
+				for i, event := range timeline.Events {
+					expected := testCase.events[i]
+					if !event.Timestamp.Equal(expected.Timestamp) || event.Alertmanager != expected.Alertmanager || event.State != expected.State {
+						t.Errorf("[%s] Event %d mismatch, expected %v, got %v", testCase.name, i, expected, event)
+					}
+				}
+			}
+		}
+		cleanup()
+	}
+}
+
+func TestTimelineNotFound(t *testing.T) {
+	store, cleanup := openStore(t)
+	defer cleanup()
+
+	if _, err := store.Timeline("foo"); err == nil {
+		t.Error("Timeline() didn't return any error for unknown fingerprint")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	store, cleanup := openStore(t)
+	defer cleanup()
+
+	store.Record("am1", baseTime, newGroups(newAlert(models.AlertStateActive, labelsWeb1)))
+	store.Record("am1", baseTime.Add(time.Minute), newGroups(
+		newAlert(models.AlertStateActive, labelsWeb1),
+		newAlert(models.AlertStateActive, labelsWeb2),
+	))
+
+	timelines, err := store.Search(func(labels map[string]string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timelines) != 2 {
+		t.Fatalf("Expected 2 timelines, got %d", len(timelines))
+	}
+	if timelines[0].Labels["instance"] != "web1" || timelines[1].Labels["instance"] != "web2" {
+		t.Errorf("Timelines not sorted by firstSeen: %v", timelines)
+	}
+
+	timelines, err = store.Search(func(labels map[string]string) bool { return labels["instance"] == "web2" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timelines) != 1 || timelines[0].Labels["instance"] != "web2" {
+		t.Errorf("Expected only web2 timeline, got %v", timelines)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	store, cleanup := openStore(t)
+	defer cleanup()
+
+	store.Record("am1", baseTime, newGroups(
+		newAlert(models.AlertStateActive, labelsWeb1),
+		newAlert(models.AlertStateActive, labelsWeb2),
+	))
+	store.Record("am1", baseTime.Add(time.Hour), newGroups(newAlert(models.AlertStateSuppressed, labelsWeb1)))
+	store.Record("am1", baseTime.Add(time.Hour*2), newGroups(newAlert(models.AlertStateSuppressed, labelsWeb1)))
+
+	if err := store.Prune(baseTime.Add(time.Minute * 30)); err != nil {
+		t.Fatal(err)
+	}
+
+	timelines, err := store.Search(func(labels map[string]string) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// web2 was resolved at baseTime+1h so it's last seen at baseTime
+	if len(timelines) != 1 {
+		t.Fatalf("Expected 1 timeline after pruning, got %d", len(timelines))
+	}
+	events := timelines[0].Events
+	if len(events) != 1 || events[0].State != models.AlertStateSuppressed {
+		t.Errorf("Expected a single suppressed event after pruning, got %v", events)
+	}
+}
+
+func TestRetain(t *testing.T) {
+	store, cleanup := openStore(t)
+	defer cleanup()
+
+	store.Record("am1", baseTime, newGroups(newAlert(models.AlertStateActive, labelsWeb1)))
+	store.Record("am2", baseTime, newGroups(newAlert(models.AlertStateActive, labelsWeb1)))
+
+	// am2 was removed
+	if err := store.Retain([]string{"am1"}, baseTime.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	// and later added back, alert needs to be recorded as active again
+	store.Record("am2", baseTime.Add(time.Minute*2), newGroups(newAlert(models.AlertStateActive, labelsWeb1)))
+	if err := store.Retain([]string{"am1", "am2"}, baseTime.Add(time.Minute*3)); err != nil {
+		t.Fatal(err)
+	}
+
+	alert := newAlert(models.AlertStateActive, labelsWeb1)
+	timeline, err := store.Timeline(alert.LabelsFingerprint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []models.AlertHistoryEvent{
+		{Timestamp: baseTime, Alertmanager: "am1", State: models.AlertStateActive},
+		{Timestamp: baseTime, Alertmanager: "am2", State: models.AlertStateActive},
+		{Timestamp: baseTime.Add(time.Minute), Alertmanager: "am2", State: models.AlertStateResolved},
+		{Timestamp: baseTime.Add(time.Minute * 2), Alertmanager: "am2", State: models.AlertStateActive},
+	}
+	if len(timeline.Events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %v", len(expected), len(timeline.Events), timeline.Events)
+	}
+	for i, event := range timeline.Events {
+		if !event.Timestamp.Equal(expected[i].Timestamp) || event.Alertmanager != expected[i].Alertmanager || event.State != expected[i].State {
+			t.Errorf("Event %d mismatch, expected %v, got %v", i, expected[i], event)
+		}
+	}
+}
@@ -8,8 +8,9 @@ import (
 )
 
 var (
-	alertMappers   = []AlertMapper{}
-	silenceMappers = []SilenceMapper{}
+	alertMappers    = []AlertMapper{}
+	silenceMappers  = []SilenceMapper{}
+	silenceCreators = []SilenceCreator{}
 )
 
 // Mapper converts Alertmanager response body and maps to unsee data structures
@@ -31,6 +32,17 @@ type SilenceMapper interface {
 	Decode(io.ReadCloser) ([]models.Silence, error)
 }
 
+// SilenceCreator handles sending new silences to Alertmanager, Encode returns
+// the request body for given silence and Decode returns the ID of the silence
+// that was created, an error with the message sent by Alertmanager if it was
+// rejected or an empty ID if the response can't be decoded
+type SilenceCreator interface {
+	IsSupported(version string) bool
+	AbsoluteURL(baseURI string) (string, error)
+	Encode(models.Silence) ([]byte, error)
+	Decode(io.ReadCloser) (string, error)
+}
+
 // RegisterAlertMapper allows to register mapper implementing alert data
 // handling for specific Alertmanager versions
 func RegisterAlertMapper(m AlertMapper) {
@@ -62,3 +74,19 @@ func GetSilenceMapper(version string) (SilenceMapper, error) {
 	}
 	return nil, fmt.Errorf("Can't find silence mapper for Alertmanager %s", version)
 }
+
+// RegisterSilenceCreator allows to register creator implementing silence
+// creation for specific Alertmanager versions
+func RegisterSilenceCreator(c SilenceCreator) {
+	silenceCreators = append(silenceCreators, c)
+}
+
+// GetSilenceCreator returns creator for given version
+func GetSilenceCreator(version string) (SilenceCreator, error) {
+	for _, c := range silenceCreators {
+		if c.IsSupported(version) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("Can't find silence creator for Alertmanager %s", version)
+}
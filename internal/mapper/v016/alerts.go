@@ -0,0 +1,114 @@
+// Package v016 package implements support for interacting with
+// Alertmanager 0.16 using the OpenAPI based v2 API
+// Collected data will be mapped to unsee internal schema defined the
+// unsee/models package
+// This file defines Alertmanager alerts mapping
+package v016
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/cloudflare/unsee/internal/mapper"
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/uri"
+)
+
+type receiver struct {
+	Name string `json:"name"`
+}
+
+type alertStatus struct {
+	State       string   `json:"state"`
+	SilencedBy  []string `json:"silencedBy"`
+	InhibitedBy []string `json:"inhibitedBy"`
+}
+
+type alert struct {
+	Annotations  map[string]string `json:"annotations"`
+	Labels       map[string]string `json:"labels"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Status       alertStatus       `json:"status"`
+}
+
+// v2 API returns a flat list of groups, each with a single receiver, there's
+// no status / data envelope, errors are signaled using HTTP status codes
+type alertsGroups struct {
+	Labels   map[string]string `json:"labels"`
+	Receiver receiver          `json:"receiver"`
+	Alerts   []alert           `json:"alerts"`
+}
+
+// AlertMapper implements Alertmanager API schema
+type AlertMapper struct {
+	mapper.AlertMapper
+}
+
+// AbsoluteURL for alerts API endpoint this mapper supports
+func (m AlertMapper) AbsoluteURL(baseURI string) (string, error) {
+	return uri.JoinURL(baseURI, "api/v2/alerts/groups")
+}
+
+// QueryArgs for HTTP requests send to the Alertmanager API endpoint
+func (m AlertMapper) QueryArgs() string {
+	return ""
+}
+
+// IsSupported returns true if given version string is supported
+func (m AlertMapper) IsSupported(version string) bool {
+	versionRange := semver.MustParseRange(">=0.16.0")
+	return versionRange(semver.MustParse(version))
+}
+
+// Decode Alertmanager API response body and return unsee model instances
+func (m AlertMapper) Decode(source io.ReadCloser) ([]models.AlertGroup, error) {
+	groups := []models.AlertGroup{}
+	resp := []alertsGroups{}
+
+	defer source.Close()
+	err := json.NewDecoder(source).Decode(&resp)
+	if err != nil {
+		return groups, err
+	}
+
+	for _, d := range resp {
+		alertList := models.AlertList{}
+		for _, a := range d.Alerts {
+			inhibitedBy := []string{}
+			if a.Status.InhibitedBy != nil {
+				inhibitedBy = a.Status.InhibitedBy
+			}
+			silencedBy := []string{}
+			if a.Status.SilencedBy != nil {
+				silencedBy = a.Status.SilencedBy
+			}
+			a := models.Alert{
+				Receiver:     d.Receiver.Name,
+				Annotations:  models.AnnotationsFromMap(a.Annotations),
+				Labels:       a.Labels,
+				StartsAt:     a.StartsAt,
+				EndsAt:       a.EndsAt,
+				GeneratorURL: a.GeneratorURL,
+				State:        a.Status.State,
+				InhibitedBy:  inhibitedBy,
+				SilencedBy:   silencedBy,
+			}
+			sort.Strings(a.InhibitedBy)
+			sort.Strings(a.SilencedBy)
+			a.UpdateFingerprints()
+			alertList = append(alertList, a)
+		}
+		ug := models.AlertGroup{
+			Receiver: d.Receiver.Name,
+			Labels:   d.Labels,
+			Alerts:   alertList,
+		}
+		groups = append(groups, ug)
+	}
+	return groups, nil
+}
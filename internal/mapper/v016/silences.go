@@ -0,0 +1,148 @@
+// Package v016 package implements support for interacting with
+// Alertmanager 0.16 using the OpenAPI based v2 API
+// Collected data will be mapped to unsee internal schema defined the
+// unsee/models package
+// This file defines Alertmanager silences mapping
+package v016
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/cloudflare/unsee/internal/mapper"
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/uri"
+)
+
+type silence struct {
+	ID       string `json:"id"`
+	Matchers []struct {
+		Name    string `json:"name"`
+		Value   string `json:"value"`
+		IsRegex bool   `json:"isRegex"`
+	} `json:"matchers"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment"`
+}
+
+// SilenceMapper implements Alertmanager v2 API schema
+type SilenceMapper struct {
+	mapper.SilenceMapper
+}
+
+// AbsoluteURL for silences API endpoint this mapper supports
+func (m SilenceMapper) AbsoluteURL(baseURI string) (string, error) {
+	return uri.JoinURL(baseURI, "api/v2/silences")
+}
+
+// QueryArgs for HTTP requests send to the Alertmanager API endpoint
+func (m SilenceMapper) QueryArgs() string {
+	return ""
+}
+
+// IsSupported returns true if given version string is supported
+func (m SilenceMapper) IsSupported(version string) bool {
+	versionRange := semver.MustParseRange(">=0.16.0")
+	return versionRange(semver.MustParse(version))
+}
+
+// Decode Alertmanager API response body and return unsee model instances
+func (m SilenceMapper) Decode(source io.ReadCloser) ([]models.Silence, error) {
+	silences := []models.Silence{}
+	resp := []silence{}
+
+	defer source.Close()
+	err := json.NewDecoder(source).Decode(&resp)
+	if err != nil {
+		return silences, err
+	}
+
+	for _, s := range resp {
+		us := models.Silence{
+			ID:       s.ID,
+			Matchers: s.Matchers,
+			StartsAt: s.StartsAt,
+			EndsAt:   s.EndsAt,
+			// v2 API doesn't expose creation time, updatedAt is the closest
+			// value we can get
+			CreatedAt: s.UpdatedAt,
+			CreatedBy: s.CreatedBy,
+			Comment:   s.Comment,
+		}
+		silences = append(silences, us)
+	}
+	return silences, nil
+}
+
+// silenceCreatePayload is the body sent to api/v2/silences when creating
+// silences, it only has the fields Alertmanager knows about
+type silenceCreatePayload struct {
+	Matchers []struct {
+		Name    string `json:"name"`
+		Value   string `json:"value"`
+		IsRegex bool   `json:"isRegex"`
+	} `json:"matchers"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment"`
+}
+
+type silenceCreateResponse struct {
+	SilenceID string `json:"silenceID"`
+}
+
+// SilenceCreator implements Alertmanager v2 API schema for creating silences
+type SilenceCreator struct {
+	mapper.SilenceCreator
+}
+
+// AbsoluteURL for silences API endpoint this creator supports
+func (c SilenceCreator) AbsoluteURL(baseURI string) (string, error) {
+	return uri.JoinURL(baseURI, "api/v2/silences")
+}
+
+// IsSupported returns true if given version string is supported
+func (c SilenceCreator) IsSupported(version string) bool {
+	versionRange := semver.MustParseRange(">=0.16.0")
+	return versionRange(semver.MustParse(version))
+}
+
+// Encode given silence as Alertmanager API request body
+func (c SilenceCreator) Encode(s models.Silence) ([]byte, error) {
+	return json.Marshal(silenceCreatePayload{
+		Matchers:  s.Matchers,
+		StartsAt:  s.StartsAt,
+		EndsAt:    s.EndsAt,
+		CreatedBy: s.CreatedBy,
+		Comment:   s.Comment,
+	})
+}
+
+// Decode Alertmanager API response body and return the ID of created silence
+func (c SilenceCreator) Decode(source io.ReadCloser) (string, error) {
+	defer source.Close()
+	body, err := ioutil.ReadAll(source)
+	if err != nil {
+		return "", err
+	}
+
+	// v2 API returns errors as a JSON encoded string
+	var message string
+	if json.Unmarshal(body, &message) == nil && message != "" {
+		return "", errors.New(message)
+	}
+
+	resp := silenceCreateResponse{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", nil
+	}
+	return resp.SilenceID, nil
+}
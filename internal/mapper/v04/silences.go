@@ -96,3 +96,72 @@ func (m SilenceMapper) Decode(source io.ReadCloser) ([]models.Silence, error) {
 	}
 	return silences, nil
 }
+
+// silenceCreatePayload is the body sent to api/v1/silences when creating
+// silences, it only has the fields Alertmanager knows about
+type silenceCreatePayload struct {
+	Matchers []struct {
+		Name    string `json:"name"`
+		Value   string `json:"value"`
+		IsRegex bool   `json:"isRegex"`
+	} `json:"matchers"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy"`
+	Comment   string    `json:"comment"`
+}
+
+// Alertmanager 0.4 uses numeric silence IDs
+type silenceCreateAPISchema struct {
+	Status string `json:"status"`
+	Data   struct {
+		SilenceID int `json:"silenceId"`
+	} `json:"data"`
+	Error string `json:"error"`
+}
+
+// SilenceCreator implements Alertmanager 0.4 API schema for creating silences
+type SilenceCreator struct {
+	mapper.SilenceCreator
+}
+
+// AbsoluteURL for silences API endpoint this creator supports
+func (c SilenceCreator) AbsoluteURL(baseURI string) (string, error) {
+	return uri.JoinURL(baseURI, "api/v1/silences")
+}
+
+// IsSupported returns true if given version string is supported
+func (c SilenceCreator) IsSupported(version string) bool {
+	versionRange := semver.MustParseRange(">=0.4.0 <0.5.0")
+	return versionRange(semver.MustParse(version))
+}
+
+// Encode given silence as Alertmanager API request body
+func (c SilenceCreator) Encode(s models.Silence) ([]byte, error) {
+	return json.Marshal(silenceCreatePayload{
+		Matchers:  s.Matchers,
+		StartsAt:  s.StartsAt,
+		EndsAt:    s.EndsAt,
+		CreatedBy: s.CreatedBy,
+		Comment:   s.Comment,
+	})
+}
+
+// Decode Alertmanager API response body and return the ID of created silence
+func (c SilenceCreator) Decode(source io.ReadCloser) (string, error) {
+	resp := silenceCreateAPISchema{}
+
+	defer source.Close()
+	err := json.NewDecoder(source).Decode(&resp)
+	if err != nil {
+		return "", nil
+	}
+
+	if resp.Status != "success" && resp.Error != "" {
+		return "", errors.New(resp.Error)
+	}
+	if resp.Status != "success" {
+		return "", nil
+	}
+	return strconv.Itoa(resp.Data.SilenceID), nil
+}
@@ -11,11 +11,18 @@ import (
 	httpmock "gopkg.in/jarcoal/httpmock.v1"
 )
 
-// GetAbsoluteMockPath returns absolute path for given mock file
+// GetAbsoluteMockPath returns absolute path for given mock file, filename is
+// relative to the version directory, for example "api/v1/status"
 func GetAbsoluteMockPath(filename string, version string) string {
 	_, f, _, _ := runtime.Caller(0)
 	cwd := filepath.Dir(f)
-	return path.Join(cwd, version, "api/v1", filename)
+	return path.Join(cwd, version, filename)
+}
+
+// Exists returns true if there's a mock file for given version
+func Exists(filename string, version string) bool {
+	_, err := os.Stat(GetAbsoluteMockPath(filename, version))
+	return err == nil
 }
 
 // RegisterURL for given url and return 200 status register mock http responder
@@ -44,6 +44,7 @@ type Alert struct {
 	// unsee fields
 	Alertmanager []AlertmanagerInstance `json:"alertmanager"`
 	Receiver     string                 `json:"receiver"`
+	Links        []Link                 `json:"links"`
 	// fingerprints are precomputed for speed
 	labelsFP  string `hash:"-"`
 	contentFP string `hash:"-"`
@@ -73,7 +74,7 @@ func (a *Alert) IsSilenced() bool {
 	return (a.State == AlertStateSuppressed && len(a.SilencedBy) > 0)
 }
 
-// IsInhibited will return true if alert should be considered silenced
+// IsInhibited will return true if alert should be considered inhibited
 func (a *Alert) IsInhibited() bool {
 	return (a.State == AlertStateSuppressed && len(a.InhibitedBy) > 0)
 }
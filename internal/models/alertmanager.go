@@ -7,6 +7,16 @@ import "time"
 type AlertmanagerInstance struct {
 	Name string `json:"name"`
 	URI  string `json:"uri"`
+	// name of the cluster this instance belongs to, instances that are not
+	// part of any cluster use their own name
+	Cluster string `json:"cluster"`
+	// names of all Alertmanager instances merged into this one, only set when
+	// instances from the same cluster are presented as a single instance
+	Members []string `json:"members,omitempty"`
+	// set if the last pull from this instance failed and the alert comes from
+	// data pulled earlier, StaleSince is the time of that earlier pull
+	Stale      bool      `json:"stale"`
+	StaleSince time.Time `json:"staleSince"`
 	// per instance alert state
 	State string `json:"state"`
 	// timestamp collected from this instance, those on the alert itself
@@ -17,14 +27,42 @@ type AlertmanagerInstance struct {
 	Source string `json:"source"`
 	// all silences matching current alert in this upstream
 	Silences map[string]Silence `json:"silences"`
-	// TODO also export InhibitedBy here if it ever becomes needed
+	// all alerts inhibiting current alert in this upstream
+	InhibitedBy []InhibitingAlert `json:"inhibitedBy"`
+}
+
+// InhibitingAlert describes an alert that is inhibiting other alerts,
+// Alertmanager only returns fingerprints of inhibiting alerts so unsee will
+// look them up in alerts collected from all upstreams
+type InhibitingAlert struct {
+	Fingerprint string `json:"fingerprint"`
+	// labels of the inhibiting alert, empty if it wasn't found on any upstream
+	Labels map[string]string `json:"labels"`
+	// name of the Alertmanager instance the inhibiting alert was found on
+	Alertmanager string `json:"alertmanager"`
 }
 
 // AlertmanagerAPIStatus describes the Alertmanager instance overall health
 type AlertmanagerAPIStatus struct {
-	Name  string `json:"name"`
-	URI   string `json:"uri"`
-	Error string `json:"error"`
+	Name    string `json:"name"`
+	URI     string `json:"uri"`
+	Cluster string `json:"cluster"`
+	Error   string `json:"error"`
+	// set if the last pull failed but data pulled at StaleSince is still used
+	Stale      bool      `json:"stale"`
+	StaleSince time.Time `json:"staleSince"`
+}
+
+// AlertmanagerAPICluster describes the overall health of a cluster of
+// Alertmanager instances
+type AlertmanagerAPICluster struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+	Healthy int      `json:"healthy"`
+	Failed  int      `json:"failed"`
+	// problems found when comparing data from healthy members, like silences
+	// that are missing on some of them
+	Errors []string `json:"errors"`
 }
 
 // AlertmanagerAPICounters returns number of Alertmanager instances in each
@@ -33,10 +71,13 @@ type AlertmanagerAPICounters struct {
 	Total   int `json:"total"`
 	Healthy int `json:"healthy"`
 	Failed  int `json:"failed"`
+	// failed instances that still have data from an earlier pull
+	Stale int `json:"stale"`
 }
 
 // AlertmanagerAPISummary describes the Alertmanager instance overall health
 type AlertmanagerAPISummary struct {
-	Counters  AlertmanagerAPICounters `json:"counters"`
-	Instances []AlertmanagerAPIStatus `json:"instances"`
+	Counters  AlertmanagerAPICounters  `json:"counters"`
+	Instances []AlertmanagerAPIStatus  `json:"instances"`
+	Clusters  []AlertmanagerAPICluster `json:"clusters"`
 }
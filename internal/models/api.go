@@ -7,6 +7,13 @@ type Filter struct {
 	IsValid bool   `json:"isValid"`
 }
 
+// FilterError describes why the filter expression couldn't be parsed,
+// Position is the byte offset in the expression where the error was found
+type FilterError struct {
+	Message  string `json:"message"`
+	Position int    `json:"position"`
+}
+
 // Color is used by UnseeLabelColor to reprenset colors as RGBA
 type Color struct {
 	Red   uint8 `json:"red"`
@@ -37,6 +44,8 @@ type AlertsResponse struct {
 	AlertGroups []AlertGroup           `json:"groups"`
 	Colors      LabelsColorMap         `json:"colors"`
 	Filters     []Filter               `json:"filters"`
+	FilterError *FilterError           `json:"filterError,omitempty"`
+	SortError   string                 `json:"sortError,omitempty"`
 	Counters    LabelsCountMap         `json:"counters"`
 }
 
@@ -46,3 +55,81 @@ type Autocomplete struct {
 	Value  string   `json:"value"`
 	Tokens []string `json:"tokens"`
 }
+
+// SilenceRequest is the structure of JSON request sent to the silence
+// management endpoint, silence will be created once on every cluster of
+// Alertmanager instances listed in Alertmanagers, those can be names of
+// instances or clusters
+type SilenceRequest struct {
+	Silence       Silence  `json:"silence"`
+	Alertmanagers []string `json:"alertmanagers"`
+}
+
+// SilenceResult holds the result of creating a silence on a single
+// Alertmanager cluster, Alertmanager is the name of the instance that was
+// used to create it
+type SilenceResult struct {
+	Cluster      string `json:"cluster"`
+	Alertmanager string `json:"alertmanager"`
+	SilenceID    string `json:"silenceID"`
+	Error        string `json:"error"`
+}
+
+// SilenceResponse is the structure of JSON response returned by the silence
+// management endpoint
+type SilenceResponse struct {
+	Status  string          `json:"status"`
+	Error   string          `json:"error,omitempty"`
+	Results []SilenceResult `json:"results"`
+}
+
+// SilencesResponse is the structure of JSON response returned by the silence
+// listing endpoint
+type SilencesResponse struct {
+	Status   string           `json:"status"`
+	Error    string           `json:"error,omitempty"`
+	Silences []ManagedSilence `json:"silences"`
+}
+
+// SilencePreviewCounters holds the number of alerts a silence would match,
+// grouped by Alertmanager instance and by receiver
+type SilencePreviewCounters struct {
+	Total         int            `json:"total"`
+	Alertmanagers map[string]int `json:"alertmanagers"`
+	Receivers     map[string]int `json:"receivers"`
+}
+
+// SilencePreviewResponse is the structure of JSON response returned by the
+// silence preview endpoint
+type SilencePreviewResponse struct {
+	Status      string                 `json:"status"`
+	Error       string                 `json:"error,omitempty"`
+	AlertGroups []AlertGroup           `json:"groups"`
+	Counters    SilencePreviewCounters `json:"counters"`
+}
+
+// AlertsStreamEvent is the structure of a single event sent to the alert
+// stream subscribers, it lists alert groups that were added, changed or
+// removed since the last event sent to the subscriber
+type AlertsStreamEvent struct {
+	Timestamp string       `json:"timestamp"`
+	Added     []AlertGroup `json:"added"`
+	Changed   []AlertGroup `json:"changed"`
+	Removed   []string     `json:"removed"`
+}
+
+// AlertHistoryResponse is the structure of JSON response returned by the
+// alert history endpoint
+type AlertHistoryResponse struct {
+	Status    string          `json:"status"`
+	Error     string          `json:"error,omitempty"`
+	Timelines []AlertTimeline `json:"timelines"`
+}
+
+// AuditResponse is the structure of JSON response returned by the audit log
+// endpoint
+type AuditResponse struct {
+	Status  string       `json:"status"`
+	Error   string       `json:"error,omitempty"`
+	Entries []AuditEntry `json:"entries"`
+}
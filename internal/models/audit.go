@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	// AuditActionCreate is used for requests creating or editing silences
+	AuditActionCreate = "create"
+	// AuditActionExpire is used for requests expiring silences
+	AuditActionExpire = "expire"
+)
+
+// AuditEntry is a single silence operation performed through unsee
+type AuditEntry struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Action       string    `json:"action"`
+	User         string    `json:"user"`
+	ClientIP     string    `json:"clientIP"`
+	Alertmanager string    `json:"alertmanager"`
+	Request      string    `json:"request"`
+	// Status is the status code of the Alertmanager response, or the status
+	// code returned by unsee if the request wasn't sent to Alertmanager
+	Status    int    `json:"status"`
+	SilenceID string `json:"silenceID"`
+	Error     string `json:"error,omitempty"`
+}
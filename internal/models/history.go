@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// AlertStateResolved is used in alert history for alerts that are no longer
+// reported by Alertmanager
+const AlertStateResolved = "resolved"
+
+// AlertHistoryEvent is a single alert state change reported by one of the
+// Alertmanager instances
+type AlertHistoryEvent struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Alertmanager string    `json:"alertmanager"`
+	State        string    `json:"state"`
+}
+
+// AlertTimeline holds all recorded state changes for a single alert,
+// alerts are identified by the fingerprint of their labels
+type AlertTimeline struct {
+	Fingerprint string              `json:"fingerprint"`
+	Labels      map[string]string   `json:"labels"`
+	FirstSeen   time.Time           `json:"firstSeen"`
+	LastSeen    time.Time           `json:"lastSeen"`
+	Events      []AlertHistoryEvent `json:"events"`
+}
@@ -0,0 +1,36 @@
+package models
+
+// Sources that links can be detected in
+const (
+	LinkSourceComment    = "comment"
+	LinkSourceAnnotation = "annotation"
+	LinkSourceLabel      = "label"
+)
+
+// LinkSources is the list of all valid link sources
+var LinkSources = []string{LinkSourceComment, LinkSourceAnnotation, LinkSourceLabel}
+
+// LinkRule is used to detect references to external systems (like issue
+// trackers or incident pages) in strings and turn those into links
+type LinkRule struct {
+	// Name is used as the type of all links generated by this rule
+	Name  string
+	Regex string
+	// URI is a template for the link, $1 or ${name} will be replaced with the
+	// value of the matching capture group from Regex and $0 with the full match
+	URI string
+	// Sources limits where this rule is applied, all sources are used if empty
+	Sources []string
+}
+
+// Link is a reference to an external system found in a silence comment,
+// annotation or label value
+type Link struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	URL    string `json:"url"`
+	Source string `json:"source"`
+	// Key is the name of the annotation or label this link was found in, it's
+	// empty for links found in silence comments
+	Key string `json:"key,omitempty"`
+}
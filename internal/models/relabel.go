@@ -0,0 +1,22 @@
+package models
+
+// Actions supported by relabel rules
+const (
+	RelabelActionReplace   = "replace"
+	RelabelActionKeep      = "keep"
+	RelabelActionDrop      = "drop"
+	RelabelActionLabelMap  = "labelmap"
+	RelabelActionLabelDrop = "labeldrop"
+	RelabelActionLabelKeep = "labelkeep"
+)
+
+// RelabelRule is used to modify alert labels when alerts are collected from
+// Alertmanager, it follows Prometheus relabel_config semantics
+type RelabelRule struct {
+	SourceLabels []string
+	Separator    string
+	Regex        string
+	TargetLabel  string
+	Replacement  string
+	Action       string
+}
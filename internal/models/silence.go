@@ -1,11 +1,25 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// SilenceStateActive means that the silence is currently muting alerts
+const SilenceStateActive = "active"
+
+// SilenceStatePending means that the silence will start in the future
+const SilenceStatePending = "pending"
+
+// SilenceStateExpired means that the silence already ended
+const SilenceStateExpired = "expired"
 
 // Silence is vanilla silence + some additional attributes
-// Unsee adds JIRA support, it can extract JIRA IDs from comments
-// extracted ID is used to generate link to JIRA issue
-// this means Unsee needs to store additional fields for each silence
+// Unsee can detect links to external systems (like JIRA issues) in comments
+// using configured rules, this means Unsee needs to store additional fields
+// for each silence
 type Silence struct {
 	ID       string `json:"id"`
 	Matchers []struct {
@@ -19,6 +33,90 @@ type Silence struct {
 	CreatedBy string    `json:"createdBy"`
 	Comment   string    `json:"comment"`
 	// unsee fields
-	JiraID  string `json:"jiraID"`
-	JiraURL string `json:"jiraURL"`
+	Links []Link `json:"links"`
+}
+
+// LinksOfType returns the text of all links of given type found in this
+// silence
+func (s *Silence) LinksOfType(linkType string) []string {
+	texts := []string{}
+	for _, link := range s.Links {
+		if link.Type == linkType {
+			texts = append(texts, link.Text)
+		}
+	}
+	return texts
+}
+
+// State returns the state of this silence at given time
+func (s *Silence) State(now time.Time) string {
+	if !s.EndsAt.After(now) {
+		return SilenceStateExpired
+	}
+	if s.StartsAt.After(now) {
+		return SilenceStatePending
+	}
+	return SilenceStateActive
+}
+
+// ManagedSilence is a silence collected from all Alertmanager instances,
+// identical silences found on multiple instances (for example when
+// Alertmanager is running in a cluster) are merged into a single one
+type ManagedSilence struct {
+	Silence
+	State string `json:"state"`
+	// names of all Alertmanager instances this silence was found on
+	Alertmanagers []string `json:"alertmanagers"`
+	// number of alerts matching this silence on any instance
+	AlertCount int `json:"alertCount"`
+	// true if the silence will end soon while still matching some alerts
+	Expiring bool `json:"expiring"`
+	// true if the silence didn't match any alert for a long time
+	Stale bool `json:"stale"`
+}
+
+// ValidateMatchers checks if silence has at least one matcher and all
+// matchers are valid
+func (s *Silence) ValidateMatchers() error {
+	if len(s.Matchers) == 0 {
+		return errors.New("at least one matcher is required")
+	}
+	for i, m := range s.Matchers {
+		if m.Name == "" {
+			return fmt.Errorf("matcher %d has no name", i)
+		}
+		if m.Value == "" {
+			return fmt.Errorf("matcher %d (%s) has no value", i, m.Name)
+		}
+		if m.IsRegex {
+			if _, err := regexp.Compile(m.Value); err != nil {
+				return fmt.Errorf("matcher %d (%s) has invalid regex: %s", i, m.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks if all silence fields required by Alertmanager are set
+// and all matchers are valid, it's used before sending a silence upstream
+func (s *Silence) Validate() error {
+	if err := s.ValidateMatchers(); err != nil {
+		return err
+	}
+	if s.StartsAt.IsZero() {
+		return errors.New("startsAt is required")
+	}
+	if s.EndsAt.IsZero() {
+		return errors.New("endsAt is required")
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return errors.New("endsAt must be after startsAt")
+	}
+	if s.CreatedBy == "" {
+		return errors.New("createdBy is required")
+	}
+	if s.Comment == "" {
+		return errors.New("comment is required")
+	}
+	return nil
 }
@@ -0,0 +1,111 @@
+package models_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+type silenceValidateTest struct {
+	silence string
+	isValid bool
+}
+
+var silenceValidateTests = []silenceValidateTest{
+	silenceValidateTest{
+		silence: `{
+			"matchers": [{"name": "foo", "value": "bar"}],
+			"startsAt": "2063-01-01T00:00:00Z",
+			"endsAt": "2063-01-02T00:00:00Z",
+			"createdBy": "me",
+			"comment": "foo"
+		}`,
+		isValid: true,
+	},
+	silenceValidateTest{
+		silence: `{
+			"matchers": [{"name": "foo", "value": "ba(r|z)", "isRegex": true}],
+			"startsAt": "2063-01-01T00:00:00Z",
+			"endsAt": "2063-01-02T00:00:00Z",
+			"createdBy": "me",
+			"comment": "foo"
+		}`,
+		isValid: true,
+	},
+	silenceValidateTest{
+		silence: `{
+			"matchers": [],
+			"startsAt": "2063-01-01T00:00:00Z",
+			"endsAt": "2063-01-02T00:00:00Z",
+			"createdBy": "me",
+			"comment": "foo"
+		}`,
+	},
+	silenceValidateTest{
+		silence: `{
+			"matchers": [{"name": "", "value": "bar"}],
+			"startsAt": "2063-01-01T00:00:00Z",
+			"endsAt": "2063-01-02T00:00:00Z",
+			"createdBy": "me",
+			"comment": "foo"
+		}`,
+	},
+	silenceValidateTest{
+		silence: `{
+			"matchers": [{"name": "foo", "value": ""}],
+			"startsAt": "2063-01-01T00:00:00Z",
+			"endsAt": "2063-01-02T00:00:00Z",
+			"createdBy": "me",
+			"comment": "foo"
+		}`,
+	},
+	silenceValidateTest{
+		silence: `{
+			"matchers": [{"name": "foo", "value": "ba(r", "isRegex": true}],
+			"startsAt": "2063-01-01T00:00:00Z",
+			"endsAt": "2063-01-02T00:00:00Z",
+			"createdBy": "me",
+			"comment": "foo"
+		}`,
+	},
+	silenceValidateTest{
+		silence: `{
+			"matchers": [{"name": "foo", "value": "bar"}],
+			"startsAt": "2063-01-02T00:00:00Z",
+			"endsAt": "2063-01-01T00:00:00Z",
+			"createdBy": "me",
+			"comment": "foo"
+		}`,
+	},
+	silenceValidateTest{
+		silence: `{
+			"matchers": [{"name": "foo", "value": "bar"}],
+			"startsAt": "2063-01-01T00:00:00Z",
+			"endsAt": "2063-01-02T00:00:00Z",
+			"comment": "foo"
+		}`,
+	},
+	silenceValidateTest{
+		silence: `{
+			"matchers": [{"name": "foo", "value": "bar"}],
+			"startsAt": "2063-01-01T00:00:00Z",
+			"endsAt": "2063-01-02T00:00:00Z",
+			"createdBy": "me"
+		}`,
+	},
+}
+
+func TestSilenceValidate(t *testing.T) {
+	for _, testCase := range silenceValidateTests {
+		silence := models.Silence{}
+		if err := json.Unmarshal([]byte(testCase.silence), &silence); err != nil {
+			t.Fatal(err)
+		}
+		err := silence.Validate()
+		if (err == nil) != testCase.isValid {
+			t.Errorf("silence.Validate() returned '%v' while valid=%t was expected for %s",
+				err, testCase.isValid, testCase.silence)
+		}
+	}
+}
@@ -58,7 +58,9 @@ var colorTests = []colorTest{
 
 func TestColorLabel(t *testing.T) {
 	for _, testCase := range colorTests {
-		config.Config.Labels.Color.Unique = testCase.config
+		cfg := *config.Config()
+		cfg.Labels.Color.Unique = testCase.config
+		config.Set(&cfg)
 		colorStore := models.LabelsColorMap{}
 		for key, value := range testCase.labels {
 			transform.ColorLabel(colorStore, key, value)
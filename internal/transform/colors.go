@@ -27,7 +27,7 @@ func labelToSeed(key string, val string) int64 {
 // from label key and value passed here
 // It's used to generate unique colors for configured labels
 func ColorLabel(colorStore models.LabelsColorMap, key string, val string) {
-	if slices.StringInSlice(config.Config.Labels.Color.Unique, key) == true {
+	if slices.StringInSlice(config.Config().Labels.Color.Unique, key) == true {
 		if _, found := colorStore[key]; !found {
 			colorStore[key] = make(map[string]models.LabelColors)
 		}
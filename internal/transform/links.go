@@ -0,0 +1,121 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/slices"
+)
+
+type linkDetectRule struct {
+	Name    string
+	Regexp  *regexp.Regexp
+	URI     string
+	Sources []string
+}
+
+var (
+	linkDetectRules     = []linkDetectRule{}
+	linkDetectRulesLock = sync.RWMutex{}
+)
+
+// ParseRules will parse and validate list of link detection rules provided
+// from config, valid rules will be stored for future use in DetectLinks() calls
+// replacing any previously parsed rules, if any rule is invalid an error is
+// returned and current rules are kept
+func ParseRules(rules []models.LinkRule) error {
+	parsed := []linkDetectRule{}
+	for _, rule := range rules {
+		if rule.Name == "" || rule.Regex == "" || rule.URI == "" {
+			return fmt.Errorf("Invalid link rule with name '%s', regexp '%s' and url '%s'", rule.Name, rule.Regex, rule.URI)
+		}
+		re, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return fmt.Errorf("Invalid link rule '%s' regexp '%s': %s", rule.Name, rule.Regex, err)
+		}
+		for _, source := range rule.Sources {
+			if !slices.StringInSlice(models.LinkSources, source) {
+				return fmt.Errorf("Invalid link rule '%s' source '%s'", rule.Name, source)
+			}
+		}
+		sources := rule.Sources
+		if len(sources) == 0 {
+			sources = models.LinkSources
+		}
+		parsed = append(parsed, linkDetectRule{Name: rule.Name, Regexp: re, URI: rule.URI, Sources: sources})
+	}
+
+	linkDetectRulesLock.Lock()
+	linkDetectRules = parsed
+	linkDetectRulesLock.Unlock()
+	return nil
+}
+
+// DetectLinks will find all links in given text using regexp rules from
+// configuration that were parsed and populated by ParseRules call, only rules
+// enabled for given source are used, key is the name of annotation or label
+// the text comes from
+func DetectLinks(source, key, text string) []models.Link {
+	linkDetectRulesLock.RLock()
+	defer linkDetectRulesLock.RUnlock()
+
+	links := []models.Link{}
+	seen := map[string]bool{}
+	for _, ldr := range linkDetectRules {
+		if !slices.StringInSlice(ldr.Sources, source) {
+			continue
+		}
+		for _, match := range ldr.Regexp.FindAllStringSubmatchIndex(text, -1) {
+			url := string(ldr.Regexp.ExpandString(nil, ldr.URI, text, match))
+			if seen[url] {
+				continue
+			}
+			seen[url] = true
+			links = append(links, models.Link{
+				Type:   ldr.Name,
+				Text:   text[match[0]:match[1]],
+				URL:    url,
+				Source: source,
+				Key:    key,
+			})
+		}
+	}
+	return links
+}
+
+// DetectSilenceLinks returns all links found in the silence comment
+func DetectSilenceLinks(silence *models.Silence) []models.Link {
+	return DetectLinks(models.LinkSourceComment, "", silence.Comment)
+}
+
+// DetectAlertLinks returns all links found in annotations and label values of
+// the alert, annotations are checked first and labels are checked in the
+// order of their names
+func DetectAlertLinks(alert *models.Alert) []models.Link {
+	links := []models.Link{}
+	for _, annotation := range alert.Annotations {
+		links = append(links, DetectLinks(models.LinkSourceAnnotation, annotation.Name, annotation.Value)...)
+	}
+	for _, key := range sortedLabelNames(alert.Labels) {
+		links = append(links, DetectLinks(models.LinkSourceLabel, key, alert.Labels[key])...)
+	}
+	return links
+}
+
+// JiraLinkRule returns link rule for the legacy JIRA configuration, links
+// to issues are generated by appending /browse/<issue ID> to the JIRA URI
+func JiraLinkRule(regex, uri string) models.LinkRule {
+	rule := models.LinkRule{
+		Name:    "jira",
+		Regex:   regex,
+		Sources: []string{models.LinkSourceComment},
+	}
+	// keep empty URI so that ParseRules will reject this rule
+	if uri != "" {
+		rule.URI = strings.Replace(uri, "$", "$$", -1) + "/browse/$0"
+	}
+	return rule
+}
@@ -0,0 +1,180 @@
+package transform_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/transform"
+)
+
+type linkTest struct {
+	source string
+	text   string
+	links  []models.Link
+}
+
+var linkRules = []models.LinkRule{
+	transform.JiraLinkRule("DEVOPS-[0-9]+", "https://jira.example.com"),
+	transform.JiraLinkRule("PROJECT-[0-9]+", "https://example.com"),
+	models.LinkRule{
+		Name:    "github",
+		Regex:   "(?P<repo>[a-z]+/[a-z]+)#([0-9]+)",
+		URI:     "https://github.com/${repo}/issues/$2",
+		Sources: []string{models.LinkSourceComment, models.LinkSourceAnnotation},
+	},
+	models.LinkRule{
+		Name:  "pagerduty",
+		Regex: "^P[A-Z0-9]{6}$",
+		URI:   "https://example.pagerduty.com/incidents/$0",
+	},
+}
+
+var linkTests = []linkTest{
+	linkTest{
+		source: models.LinkSourceComment,
+		text:   "Lorem ipsum dolor sit amet",
+		links:  []models.Link{},
+	},
+	linkTest{
+		source: models.LinkSourceComment,
+		text:   "DVOPS-123",
+		links:  []models.Link{},
+	},
+	linkTest{
+		source: models.LinkSourceComment,
+		text:   "DEVOPS team",
+		links:  []models.Link{},
+	},
+	linkTest{
+		source: models.LinkSourceComment,
+		text:   "a project-1 b",
+		links:  []models.Link{},
+	},
+	linkTest{
+		source: models.LinkSourceComment,
+		text:   "a PROJECT- b",
+		links:  []models.Link{},
+	},
+	linkTest{
+		source: models.LinkSourceComment,
+		text:   "DEVOPS-1",
+		links: []models.Link{
+			models.Link{Type: "jira", Text: "DEVOPS-1", URL: "https://jira.example.com/browse/DEVOPS-1", Source: "comment"},
+		},
+	},
+	linkTest{
+		source: models.LinkSourceComment,
+		text:   "a DEVOPS-1 b DEVOPS-2 c DEVOPS-1",
+		links: []models.Link{
+			models.Link{Type: "jira", Text: "DEVOPS-1", URL: "https://jira.example.com/browse/DEVOPS-1", Source: "comment"},
+			models.Link{Type: "jira", Text: "DEVOPS-2", URL: "https://jira.example.com/browse/DEVOPS-2", Source: "comment"},
+		},
+	},
+	linkTest{
+		source: models.LinkSourceComment,
+		text:   "PROJECT-9 and cloudflare/unsee#123",
+		links: []models.Link{
+			models.Link{Type: "jira", Text: "PROJECT-9", URL: "https://example.com/browse/PROJECT-9", Source: "comment"},
+			models.Link{Type: "github", Text: "cloudflare/unsee#123", URL: "https://github.com/cloudflare/unsee/issues/123", Source: "comment"},
+		},
+	},
+	linkTest{
+		// jira rules are only used for silence comments
+		source: models.LinkSourceLabel,
+		text:   "DEVOPS-1",
+		links:  []models.Link{},
+	},
+	linkTest{
+		// github rule is not used for labels
+		source: models.LinkSourceLabel,
+		text:   "cloudflare/unsee#123",
+		links:  []models.Link{},
+	},
+	linkTest{
+		source: models.LinkSourceLabel,
+		text:   "PABC123",
+		links: []models.Link{
+			models.Link{Type: "pagerduty", Text: "PABC123", URL: "https://example.pagerduty.com/incidents/PABC123", Source: "label", Key: "key"},
+		},
+	},
+}
+
+func TestDetectLinks(t *testing.T) {
+	if err := transform.ParseRules(linkRules); err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range linkTests {
+		key := "key"
+		if testCase.source == models.LinkSourceComment {
+			key = ""
+			for i := range testCase.links {
+				testCase.links[i].Key = ""
+			}
+		}
+		links := transform.DetectLinks(testCase.source, key, testCase.text)
+		if !reflect.DeepEqual(links, testCase.links) {
+			t.Errorf("Invalid links detected in %s '%s', expected %v, got %v",
+				testCase.source, testCase.text, testCase.links, links)
+		}
+	}
+}
+
+func TestDetectAlertLinks(t *testing.T) {
+	if err := transform.ParseRules(linkRules); err != nil {
+		t.Fatal(err)
+	}
+	alert := models.Alert{
+		Annotations: models.Annotations{
+			models.Annotation{Name: "summary", Value: "See cloudflare/unsee#1"},
+		},
+		Labels: map[string]string{
+			"incident":  "PABC123",
+			"alertname": "PDEF456",
+		},
+	}
+	expected := []models.Link{
+		models.Link{Type: "github", Text: "cloudflare/unsee#1", URL: "https://github.com/cloudflare/unsee/issues/1", Source: "annotation", Key: "summary"},
+		models.Link{Type: "pagerduty", Text: "PDEF456", URL: "https://example.pagerduty.com/incidents/PDEF456", Source: "label", Key: "alertname"},
+		models.Link{Type: "pagerduty", Text: "PABC123", URL: "https://example.pagerduty.com/incidents/PABC123", Source: "label", Key: "incident"},
+	}
+	links := transform.DetectAlertLinks(&alert)
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("Invalid alert links, expected %v, got %v", expected, links)
+	}
+
+	silence := models.Silence{Comment: "DEVOPS-1 cloudflare/unsee#2"}
+	silence.Links = transform.DetectSilenceLinks(&silence)
+	if texts := silence.LinksOfType("jira"); !reflect.DeepEqual(texts, []string{"DEVOPS-1"}) {
+		t.Errorf("Invalid JIRA links in silence, got %v", texts)
+	}
+}
+
+var invalidLinkRules = [][]models.LinkRule{
+	[]models.LinkRule{transform.JiraLinkRule("", "https://jira.example.com")},
+	[]models.LinkRule{transform.JiraLinkRule("DEVOPS-[0-9]+", "")},
+	[]models.LinkRule{transform.JiraLinkRule("DEVOPS-[0-9+", "https://jira.example.com")},
+	[]models.LinkRule{models.LinkRule{Regex: "DEVOPS-[0-9]+", URI: "https://example.com/$0"}},
+	[]models.LinkRule{models.LinkRule{Name: "foo", Regex: "DEVOPS-[0-9]+", URI: "https://example.com/$0", Sources: []string{"foo"}}},
+}
+
+func TestParseInvalidRules(t *testing.T) {
+	if err := transform.ParseRules(linkRules); err != nil {
+		t.Fatalf("ParseRules() failed on valid rules: %s", err)
+	}
+	for _, rules := range invalidLinkRules {
+		if err := transform.ParseRules(rules); err == nil {
+			t.Errorf("ParseRules(%v) didn't return any error", rules)
+		}
+		// current rules should be kept after a failed parse
+		if links := transform.DetectLinks(models.LinkSourceComment, "", "DEVOPS-1"); len(links) != 1 {
+			t.Errorf("Link rules were modified after ParseRules(%v) failed, got %v", rules, links)
+		}
+	}
+
+	// rules should be replaced, not appended
+	transform.ParseRules([]models.LinkRule{})
+	if links := transform.DetectLinks(models.LinkSourceComment, "", "DEVOPS-1"); len(links) != 0 {
+		t.Errorf("Link rules weren't replaced, got %v", links)
+	}
+}
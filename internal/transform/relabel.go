@@ -0,0 +1,223 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cloudflare/unsee/internal/models"
+)
+
+const (
+	defaultRelabelSeparator   = ";"
+	defaultRelabelRegex       = "(.*)"
+	defaultRelabelReplacement = "$1"
+)
+
+type relabelRule struct {
+	SourceLabels []string
+	Separator    string
+	Regexp       *regexp.Regexp
+	TargetLabel  string
+	Replacement  string
+	Action       string
+}
+
+var (
+	relabelRules     = []relabelRule{}
+	relabelRulesLock = sync.RWMutex{}
+)
+
+// ParseRelabelRules will parse and validate list of relabel rules provided
+// from config, valid rules will be stored for future use in Relabel() calls
+// replacing any previously parsed rules, if any rule is invalid an error is
+// returned and current rules are kept
+func ParseRelabelRules(rules []models.RelabelRule) error {
+	parsed := []relabelRule{}
+	for i, rule := range rules {
+		r := relabelRule{
+			SourceLabels: rule.SourceLabels,
+			Separator:    rule.Separator,
+			TargetLabel:  rule.TargetLabel,
+			Replacement:  rule.Replacement,
+			Action:       strings.ToLower(rule.Action),
+		}
+		if r.Separator == "" {
+			r.Separator = defaultRelabelSeparator
+		}
+		if r.Replacement == "" {
+			r.Replacement = defaultRelabelReplacement
+		}
+		if r.Action == "" {
+			r.Action = models.RelabelActionReplace
+		}
+		regex := rule.Regex
+		if regex == "" {
+			regex = defaultRelabelRegex
+		}
+		// regex must match the whole value, same as in Prometheus
+		re, err := regexp.Compile("^(?:" + regex + ")$")
+		if err != nil {
+			return fmt.Errorf("Invalid relabel rule %d regexp '%s': %s", i, regex, err)
+		}
+		r.Regexp = re
+
+		switch r.Action {
+		case models.RelabelActionReplace:
+			if r.TargetLabel == "" {
+				return fmt.Errorf("Invalid relabel rule %d, target_label is required for '%s' action", i, r.Action)
+			}
+		case models.RelabelActionKeep, models.RelabelActionDrop:
+			if len(r.SourceLabels) == 0 {
+				return fmt.Errorf("Invalid relabel rule %d, source_labels are required for '%s' action", i, r.Action)
+			}
+		case models.RelabelActionLabelMap, models.RelabelActionLabelDrop, models.RelabelActionLabelKeep:
+		default:
+			return fmt.Errorf("Invalid relabel rule %d action '%s'", i, rule.Action)
+		}
+		parsed = append(parsed, r)
+	}
+
+	relabelRulesLock.Lock()
+	relabelRules = parsed
+	relabelRulesLock.Unlock()
+	return nil
+}
+
+// Relabel will apply all relabel rules parsed by ParseRelabelRules call to
+// given labels, it returns modified copy of labels and false if the alert
+// should be dropped
+func Relabel(labels map[string]string) (map[string]string, bool) {
+	return relabel(labels, nil)
+}
+
+// RelabelGroup will apply all relabel rules to labels of every alert in a
+// group, it returns labels of the group and relabeled labels of every alert,
+// nil is used for dropped alerts. Rules are never applied to group labels on
+// their own since rules might use labels that are only present on alerts,
+// instead the group gets every original group label and every label set by
+// replace or labelmap rules that has the same value on all kept alerts.
+// Group labels are nil if all alerts were dropped.
+func RelabelGroup(groupLabels map[string]string, alerts []map[string]string) (map[string]string, []map[string]string) {
+	names := map[string]bool{}
+	for name := range groupLabels {
+		names[name] = true
+	}
+
+	relabeled := make([]map[string]string, len(alerts))
+	kept := []map[string]string{}
+	for i, labels := range alerts {
+		result, keep := relabel(labels, names)
+		if keep {
+			relabeled[i] = result
+			kept = append(kept, result)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, relabeled
+	}
+
+	group := map[string]string{}
+	for name := range names {
+		value, found := kept[0][name]
+		for _, labels := range kept[1:] {
+			if v, ok := labels[name]; !ok || v != value {
+				found = false
+				break
+			}
+		}
+		if found {
+			group[name] = value
+		}
+	}
+	return group, relabeled
+}
+
+// relabel applies all rules to labels, names of labels set by replace and
+// labelmap rules are added to targets if it's not nil
+func relabel(labels map[string]string, targets map[string]bool) (map[string]string, bool) {
+	relabelRulesLock.RLock()
+	defer relabelRulesLock.RUnlock()
+
+	result := make(map[string]string, len(labels))
+	for k, v := range labels {
+		result[k] = v
+	}
+
+	for _, rule := range relabelRules {
+		values := make([]string, 0, len(rule.SourceLabels))
+		for _, name := range rule.SourceLabels {
+			values = append(values, result[name])
+		}
+		value := strings.Join(values, rule.Separator)
+
+		switch rule.Action {
+		case models.RelabelActionKeep:
+			if !rule.Regexp.MatchString(value) {
+				return nil, false
+			}
+		case models.RelabelActionDrop:
+			if rule.Regexp.MatchString(value) {
+				return nil, false
+			}
+		case models.RelabelActionReplace:
+			match := rule.Regexp.FindStringSubmatchIndex(value)
+			if match == nil {
+				break
+			}
+			target := string(rule.Regexp.ExpandString(nil, rule.TargetLabel, value, match))
+			replacement := string(rule.Regexp.ExpandString(nil, rule.Replacement, value, match))
+			if target == "" {
+				break
+			}
+			if replacement == "" {
+				delete(result, target)
+			} else {
+				result[target] = replacement
+				if targets != nil {
+					targets[target] = true
+				}
+			}
+		case models.RelabelActionLabelMap:
+			// iterate over sorted names so the result doesn't depend on map
+			// ordering if multiple labels are mapped to the same name
+			for _, name := range sortedLabelNames(result) {
+				match := rule.Regexp.FindStringSubmatchIndex(name)
+				if match == nil {
+					continue
+				}
+				target := string(rule.Regexp.ExpandString(nil, rule.Replacement, name, match))
+				if target != "" {
+					result[target] = result[name]
+					if targets != nil {
+						targets[target] = true
+					}
+				}
+			}
+		case models.RelabelActionLabelDrop:
+			for name := range result {
+				if rule.Regexp.MatchString(name) {
+					delete(result, name)
+				}
+			}
+		case models.RelabelActionLabelKeep:
+			for name := range result {
+				if !rule.Regexp.MatchString(name) {
+					delete(result, name)
+				}
+			}
+		}
+	}
+	return result, true
+}
+
+func sortedLabelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,254 @@
+package transform_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/transform"
+)
+
+type relabelTest struct {
+	rules  []models.RelabelRule
+	labels map[string]string
+	result map[string]string
+	keep   bool
+}
+
+var relabelTests = []relabelTest{
+	relabelTest{
+		labels: map[string]string{"svc": "api"},
+		result: map[string]string{"svc": "api"},
+		keep:   true,
+	},
+	relabelTest{
+		rules: []models.RelabelRule{
+			models.RelabelRule{SourceLabels: []string{"svc"}, TargetLabel: "service"},
+			models.RelabelRule{Action: "labeldrop", Regex: "svc"},
+		},
+		labels: map[string]string{"svc": "api", "job": "node"},
+		result: map[string]string{"service": "api", "job": "node"},
+		keep:   true,
+	},
+	relabelTest{
+		rules: []models.RelabelRule{
+			models.RelabelRule{
+				SourceLabels: []string{"instance"},
+				Regex:        "[a-z0-9]+\\.([a-z]+)\\.example\\.com(:[0-9]+)?",
+				TargetLabel:  "region",
+			},
+		},
+		labels: map[string]string{"instance": "web1.ams.example.com:9100"},
+		result: map[string]string{"instance": "web1.ams.example.com:9100", "region": "ams"},
+		keep:   true,
+	},
+	relabelTest{
+		// regex must match the whole value
+		rules: []models.RelabelRule{
+			models.RelabelRule{SourceLabels: []string{"instance"}, Regex: "web", TargetLabel: "role", Replacement: "web"},
+		},
+		labels: map[string]string{"instance": "web1"},
+		result: map[string]string{"instance": "web1"},
+		keep:   true,
+	},
+	relabelTest{
+		rules: []models.RelabelRule{
+			models.RelabelRule{
+				SourceLabels: []string{"cluster", "instance"},
+				Separator:    "/",
+				TargetLabel:  "id",
+			},
+		},
+		labels: map[string]string{"cluster": "dev", "instance": "web1"},
+		result: map[string]string{"cluster": "dev", "instance": "web1", "id": "dev/web1"},
+		keep:   true,
+	},
+	relabelTest{
+		// empty replacement removes the target label
+		rules: []models.RelabelRule{
+			models.RelabelRule{SourceLabels: []string{"missing"}, TargetLabel: "job"},
+		},
+		labels: map[string]string{"job": "node"},
+		result: map[string]string{},
+		keep:   true,
+	},
+	relabelTest{
+		rules: []models.RelabelRule{
+			models.RelabelRule{Action: "labelmap", Regex: "team_(.+)"},
+		},
+		labels: map[string]string{"team_name": "ops", "job": "node"},
+		result: map[string]string{"team_name": "ops", "name": "ops", "job": "node"},
+		keep:   true,
+	},
+	relabelTest{
+		rules: []models.RelabelRule{
+			models.RelabelRule{Action: "labelkeep", Regex: "alertname|instance"},
+		},
+		labels: map[string]string{"alertname": "Down", "instance": "web1", "job": "node"},
+		result: map[string]string{"alertname": "Down", "instance": "web1"},
+		keep:   true,
+	},
+	relabelTest{
+		rules: []models.RelabelRule{
+			models.RelabelRule{Action: "drop", SourceLabels: []string{"env"}, Regex: "dev|test"},
+		},
+		labels: map[string]string{"env": "dev"},
+		keep:   false,
+	},
+	relabelTest{
+		rules: []models.RelabelRule{
+			models.RelabelRule{Action: "drop", SourceLabels: []string{"env"}, Regex: "dev|test"},
+		},
+		labels: map[string]string{"env": "prod"},
+		result: map[string]string{"env": "prod"},
+		keep:   true,
+	},
+	relabelTest{
+		rules: []models.RelabelRule{
+			models.RelabelRule{Action: "keep", SourceLabels: []string{"env"}, Regex: "prod"},
+		},
+		labels: map[string]string{"env": "dev"},
+		keep:   false,
+	},
+}
+
+func TestRelabel(t *testing.T) {
+	defer transform.ParseRelabelRules([]models.RelabelRule{})
+	for _, testCase := range relabelTests {
+		if err := transform.ParseRelabelRules(testCase.rules); err != nil {
+			t.Errorf("ParseRelabelRules(%v) failed: %s", testCase.rules, err)
+			continue
+		}
+		original := map[string]string{}
+		for k, v := range testCase.labels {
+			original[k] = v
+		}
+		result, keep := transform.Relabel(testCase.labels)
+		if keep != testCase.keep {
+			t.Errorf("Relabel(%v) with rules %v returned keep=%v, expected %v", testCase.labels, testCase.rules, keep, testCase.keep)
+		}
+		if keep && !reflect.DeepEqual(result, testCase.result) {
+			t.Errorf("Relabel(%v) with rules %v returned %v, expected %v", testCase.labels, testCase.rules, result, testCase.result)
+		}
+		if !reflect.DeepEqual(original, testCase.labels) {
+			t.Errorf("Relabel(%v) modified passed labels", original)
+		}
+	}
+}
+
+type relabelGroupTest struct {
+	rules     []models.RelabelRule
+	group     map[string]string
+	alerts    []map[string]string
+	result    map[string]string
+	relabeled []map[string]string
+}
+
+var relabelGroupTests = []relabelGroupTest{
+	// keep and drop rules only apply to alerts, group labels come from alerts
+	// that were kept
+	relabelGroupTest{
+		rules: []models.RelabelRule{
+			models.RelabelRule{Action: "keep", SourceLabels: []string{"job"}, Regex: "node"},
+			models.RelabelRule{Action: "drop", SourceLabels: []string{"svc"}, Regex: "web"},
+			models.RelabelRule{SourceLabels: []string{"svc"}, TargetLabel: "service"},
+			models.RelabelRule{Action: "labeldrop", Regex: "svc"},
+		},
+		group: map[string]string{"svc": "api", "alertname": "Down"},
+		alerts: []map[string]string{
+			map[string]string{"svc": "api", "alertname": "Down", "job": "node"},
+			map[string]string{"svc": "api", "alertname": "Down", "job": "mysql"},
+		},
+		result: map[string]string{"service": "api", "alertname": "Down"},
+		relabeled: []map[string]string{
+			map[string]string{"service": "api", "alertname": "Down", "job": "node"},
+			nil,
+		},
+	},
+	// replace rule using a label that only alerts have sets a different value
+	// on every alert, so it can't be a group label
+	relabelGroupTest{
+		rules: []models.RelabelRule{
+			models.RelabelRule{SourceLabels: []string{"alertname", "instance"}, Regex: "(.*);(.*)", TargetLabel: "key", Replacement: "$1-$2"},
+		},
+		group: map[string]string{"alertname": "X"},
+		alerts: []map[string]string{
+			map[string]string{"alertname": "X", "instance": "host1"},
+			map[string]string{"alertname": "X", "instance": "host2"},
+		},
+		result: map[string]string{"alertname": "X"},
+		relabeled: []map[string]string{
+			map[string]string{"alertname": "X", "instance": "host1", "key": "X-host1"},
+			map[string]string{"alertname": "X", "instance": "host2", "key": "X-host2"},
+		},
+	},
+	// same value on every alert is added to the group, labels that are not
+	// group labels and were not set by any rule are not
+	relabelGroupTest{
+		rules: []models.RelabelRule{
+			models.RelabelRule{SourceLabels: []string{"alertname", "instance"}, Regex: "(.*);(.*)", TargetLabel: "key", Replacement: "$1-$2"},
+			models.RelabelRule{Action: "labelmap", Regex: "__meta_(.+)"},
+		},
+		group: map[string]string{"alertname": "X"},
+		alerts: []map[string]string{
+			map[string]string{"alertname": "X", "instance": "host1", "__meta_dc": "dc1"},
+			map[string]string{"alertname": "X", "instance": "host1", "__meta_dc": "dc1"},
+		},
+		result: map[string]string{"alertname": "X", "key": "X-host1", "dc": "dc1"},
+		relabeled: []map[string]string{
+			map[string]string{"alertname": "X", "instance": "host1", "key": "X-host1", "__meta_dc": "dc1", "dc": "dc1"},
+			map[string]string{"alertname": "X", "instance": "host1", "key": "X-host1", "__meta_dc": "dc1", "dc": "dc1"},
+		},
+	},
+	// all alerts are dropped
+	relabelGroupTest{
+		rules: []models.RelabelRule{
+			models.RelabelRule{Action: "drop", SourceLabels: []string{"alertname"}, Regex: "X"},
+		},
+		group:     map[string]string{"alertname": "X"},
+		alerts:    []map[string]string{map[string]string{"alertname": "X"}},
+		result:    nil,
+		relabeled: []map[string]string{nil},
+	},
+}
+
+func TestRelabelGroup(t *testing.T) {
+	defer transform.ParseRelabelRules([]models.RelabelRule{})
+	for _, testCase := range relabelGroupTests {
+		if err := transform.ParseRelabelRules(testCase.rules); err != nil {
+			t.Errorf("ParseRelabelRules(%v) failed: %s", testCase.rules, err)
+			continue
+		}
+		result, relabeled := transform.RelabelGroup(testCase.group, testCase.alerts)
+		if !reflect.DeepEqual(result, testCase.result) {
+			t.Errorf("RelabelGroup(%v, %v) with rules %v returned group labels %v, expected %v", testCase.group, testCase.alerts, testCase.rules, result, testCase.result)
+		}
+		if !reflect.DeepEqual(relabeled, testCase.relabeled) {
+			t.Errorf("RelabelGroup(%v, %v) with rules %v returned alert labels %v, expected %v", testCase.group, testCase.alerts, testCase.rules, relabeled, testCase.relabeled)
+		}
+	}
+}
+
+var invalidRelabelRules = [][]models.RelabelRule{
+	[]models.RelabelRule{models.RelabelRule{SourceLabels: []string{"job"}}},
+	[]models.RelabelRule{models.RelabelRule{SourceLabels: []string{"job"}, TargetLabel: "foo", Regex: "("}},
+	[]models.RelabelRule{models.RelabelRule{Action: "keep"}},
+	[]models.RelabelRule{models.RelabelRule{Action: "hashmod", SourceLabels: []string{"job"}, TargetLabel: "foo"}},
+}
+
+func TestParseInvalidRelabelRules(t *testing.T) {
+	defer transform.ParseRelabelRules([]models.RelabelRule{})
+	valid := []models.RelabelRule{models.RelabelRule{Action: "labeldrop", Regex: "job"}}
+	if err := transform.ParseRelabelRules(valid); err != nil {
+		t.Fatalf("ParseRelabelRules() failed on valid rules: %s", err)
+	}
+	for _, rules := range invalidRelabelRules {
+		if err := transform.ParseRelabelRules(rules); err == nil {
+			t.Errorf("ParseRelabelRules(%v) didn't return any error", rules)
+		}
+		// current rules should be kept after a failed parse
+		if result, _ := transform.Relabel(map[string]string{"job": "node"}); len(result) != 0 {
+			t.Errorf("Relabel rules were modified after ParseRelabelRules(%v) failed, got %v", rules, result)
+		}
+	}
+}
@@ -61,8 +61,8 @@ type fileTransportTest struct {
 
 var fileTransportTests = []fileTransportTest{
 	fileTransportTest{
-		uri:  fmt.Sprintf("file://%s", mock.GetAbsoluteMockPath("status", mock.ListAllMocks()[0])),
-		size: getFileSize(mock.GetAbsoluteMockPath("status", mock.ListAllMocks()[0])),
+		uri:  fmt.Sprintf("file://%s", mock.GetAbsoluteMockPath("api/v1/status", mock.ListAllMocks()[0])),
+		size: getFileSize(mock.GetAbsoluteMockPath("api/v1/status", mock.ListAllMocks()[0])),
 	},
 	fileTransportTest{
 		uri:    "file:///non-existing-file.abcdef",
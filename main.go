@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"os"
 	"path"
 	"strings"
 	"time"
 
 	"github.com/cloudflare/unsee/internal/alertmanager"
 	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/discovery"
 	"github.com/cloudflare/unsee/internal/models"
 	"github.com/cloudflare/unsee/internal/transform"
 	"github.com/spf13/pflag"
@@ -40,7 +42,7 @@ var (
 )
 
 func getViewURL(sub string) string {
-	u := path.Join(config.Config.Listen.Prefix, sub)
+	u := path.Join(config.Config().Listen.Prefix, sub)
 	if strings.HasSuffix(sub, "/") {
 		// if sub path had trailing slash then add it here, since path.Join will
 		// skip it
@@ -49,7 +51,19 @@ func getViewURL(sub string) string {
 	return u
 }
 
-func setupRouter(router *gin.Engine) {
+// setupRouter registers all middlewares and routes, extra middlewares and
+// routes can be registered with passed functions, they're called after the
+// authentication middleware is installed
+func setupRouter(router *gin.Engine, extra ...func(*gin.Engine)) {
+	setupRouterAuth(router)
+	for _, f := range extra {
+		f(router)
+	}
+
+	// alert stream needs to be registered before gzip middleware, compressed
+	// responses are buffered and wouldn't be flushed after every event
+	router.GET(getViewURL("/alerts/stream"), alertsStream)
+
 	router.Use(gzip.Gzip(gzip.DefaultCompression))
 	router.Use(static.Serve(getViewURL("/static"), newBinaryFileSystem("static")))
 
@@ -58,89 +72,218 @@ func setupRouter(router *gin.Engine) {
 	router.GET(getViewURL("/help"), help)
 	router.GET(getViewURL("/alerts.json"), alerts)
 	router.GET(getViewURL("/autocomplete.json"), autocomplete)
+	router.GET(getViewURL("/history.json"), alertHistory)
+	router.GET(getViewURL("/audit.json"), auditEntries)
+	router.GET(getViewURL("/silences.json"), listSilences)
+	router.POST(getViewURL("/api/silences"), createSilence)
+	router.POST(getViewURL("/api/silences/preview"), previewSilence)
+	router.GET(getViewURL("/api/v1/alerts"), apiAlerts)
+
+	setupRouterProxyHandlers(router)
 }
 
-func setupUpstreams() {
-	for _, s := range config.Config.Alertmanager.Servers {
-
-		var httpTransport http.RoundTripper
-		var err error
-		// if either TLS root CA or client cert is configured then initialize custom transport where we have this setup
-		if s.TLS.CA != "" || s.TLS.Cert != "" {
-			httpTransport, err = alertmanager.NewHTTPTransport(s.TLS.CA, s.TLS.Cert, s.TLS.Key)
-			if err != nil {
-				log.Fatalf("Failed to create HTTP transport for Alertmanager '%s' with URI '%s': %s", s.Name, s.URI, err)
-			}
+// upstreamOptions holds options used to create an Alertmanager instance,
+// those are shared by statically configured and discovered instances
+type upstreamOptions struct {
+	cluster string
+	timeout time.Duration
+	proxy   bool
+	tlsCA   string
+	tlsCert string
+	tlsKey  string
+}
+
+func newUpstream(name, uri string, opts upstreamOptions) (*alertmanager.Alertmanager, error) {
+	var httpTransport http.RoundTripper
+	var err error
+	// if either TLS root CA or client cert is configured then initialize custom transport where we have this setup
+	if opts.tlsCA != "" || opts.tlsCert != "" {
+		httpTransport, err = alertmanager.NewHTTPTransport(opts.tlsCA, opts.tlsCert, opts.tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create HTTP transport for Alertmanager '%s' with URI '%s': %s", name, uri, err)
+		}
+	}
+
+	am, err := alertmanager.NewAlertmanager(
+		name,
+		uri,
+		alertmanager.WithCluster(opts.cluster),
+		alertmanager.WithRequestTimeout(opts.timeout),
+		alertmanager.WithProxy(opts.proxy),
+		alertmanager.WithHTTPTransport(httpTransport), // we will pass a nil unless TLS.CA or TLS.Cert is set
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create Alertmanager '%s' with URI '%s': %s", name, uri, err)
+	}
+	return am, nil
+}
+
+// newUpstreams creates Alertmanager instances for all servers from the
+// config and all targets found by discovery, instances passed in the reusable
+// map will be used instead of creating new ones if their URI and cluster
+// didn't change
+func newUpstreams(reusable map[string]*alertmanager.Alertmanager) ([]*alertmanager.Alertmanager, error) {
+	upstreams := []*alertmanager.Alertmanager{}
+	for _, s := range config.Config().Alertmanager.Servers {
+		// servers using DNS discovery are created by discoveredUpstreams()
+		if discovery.IsDNSURI(s.URI) {
+			continue
+		}
+		if am, found := reusable[s.Name]; found && am.URI == s.URI && am.Cluster == s.Cluster {
+			upstreams = append(upstreams, am)
+			continue
 		}
 
-		am, err := alertmanager.NewAlertmanager(
-			s.Name,
-			s.URI,
-			alertmanager.WithRequestTimeout(s.Timeout),
-			alertmanager.WithProxy(s.Proxy),
-			alertmanager.WithHTTPTransport(httpTransport), // we will pass a nil unless TLS.CA or TLS.Cert is set
-		)
+		am, err := newUpstream(s.Name, s.URI, upstreamOptions{
+			cluster: s.Cluster,
+			timeout: s.Timeout,
+			proxy:   s.Proxy,
+			tlsCA:   s.TLS.CA,
+			tlsCert: s.TLS.Cert,
+			tlsKey:  s.TLS.Key,
+		})
 		if err != nil {
-			log.Fatalf("Failed to create Alertmanager '%s' with URI '%s': %s", s.Name, s.URI, err)
+			return nil, err
 		}
+		upstreams = append(upstreams, am)
+	}
+
+	discovered, err := discoveredUpstreams(upstreams, reusable)
+	if err != nil {
+		return nil, err
+	}
+	return append(upstreams, discovered...), nil
+}
+
+func setupUpstreams() {
+	upstreams, err := newUpstreams(map[string]*alertmanager.Alertmanager{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, am := range upstreams {
 		err = alertmanager.RegisterAlertmanager(am)
 		if err != nil {
-			log.Fatalf("Failed to register Alertmanager '%s' with URI '%s': %s", s.Name, s.URI, err)
+			log.Fatalf("Failed to register Alertmanager '%s' with URI '%s': %s", am.Name, am.URI, err)
 		}
 	}
 }
 
-func setupLogger() {
-	switch config.Config.Log.Level {
+func parseLogLevel(level string) (log.Level, error) {
+	switch level {
 	case "debug":
-		log.SetLevel(log.DebugLevel)
+		return log.DebugLevel, nil
 	case "info":
-		log.SetLevel(log.InfoLevel)
+		return log.InfoLevel, nil
 	case "warning":
-		log.SetLevel(log.WarnLevel)
+		return log.WarnLevel, nil
 	case "error":
-		log.SetLevel(log.ErrorLevel)
+		return log.ErrorLevel, nil
 	case "fatal":
-		log.SetLevel(log.FatalLevel)
+		return log.FatalLevel, nil
 	case "panic":
-		log.SetLevel(log.PanicLevel)
+		return log.PanicLevel, nil
 	default:
-		log.Fatalf("Unknown log level '%s'", config.Config.Log.Level)
+		return log.InfoLevel, fmt.Errorf("Unknown log level '%s'", level)
 	}
 }
 
+func setupLogger() {
+	level, err := parseLogLevel(config.Config().Log.Level)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.SetLevel(level)
+}
+
+// linkRules returns all link detection rules from the config, rules from the
+// legacy jira section are converted and go first
+func linkRules() []models.LinkRule {
+	rules := []models.LinkRule{}
+	for _, rule := range config.Config().JIRA {
+		rules = append(rules, transform.JiraLinkRule(rule.Regex, rule.URI))
+	}
+	for _, rule := range config.Config().Links {
+		rules = append(rules, models.LinkRule{
+			Name:    rule.Name,
+			Regex:   rule.Regex,
+			URI:     rule.URI,
+			Sources: rule.Sources,
+		})
+	}
+	return rules
+}
+
+// relabelRules returns all relabel rules from the config
+func relabelRules() []models.RelabelRule {
+	rules := []models.RelabelRule{}
+	for _, rule := range config.Config().Relabel {
+		rules = append(rules, models.RelabelRule{
+			SourceLabels: rule.SourceLabels,
+			Separator:    rule.Separator,
+			Regex:        rule.Regex,
+			TargetLabel:  rule.TargetLabel,
+			Replacement:  rule.Replacement,
+			Action:       rule.Action,
+		})
+	}
+	return rules
+}
+
 func main() {
 	printVersion := pflag.Bool("version", false, "Print version and exit")
+	queryURI := pflag.String("query.uri", "",
+		"URI of running unsee instance used by the query subcommand, if empty config is loaded and alerts are pulled from Alertmanager directly")
+	queryOutput := pflag.String("query.output", queryOutputTable,
+		"Output format used by the query subcommand, one of: table, json, csv")
 	pflag.Parse()
 	if *printVersion {
 		fmt.Println(version)
 		return
 	}
 
-	config.Config.Read()
+	// unsee query [filter ...] prints matching alerts and exits
+	if pflag.Arg(0) == "query" {
+		err := runQuery(pflag.Args()[1:], *queryURI, *queryOutput, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	config.Read()
 	setupLogger()
 
 	// timer duration cannot be zero second or a negative one
-	if config.Config.Alertmanager.Interval <= time.Second*0 {
-		log.Fatalf("Invalid AlertmanagerTTL value '%v'", config.Config.Alertmanager.Interval)
+	if config.Config().Alertmanager.Interval <= time.Second*0 {
+		log.Fatalf("Invalid AlertmanagerTTL value '%v'", config.Config().Alertmanager.Interval)
 	}
 
 	log.Infof("Version: %s", version)
-	if config.Config.Log.Config {
-		config.Config.LogValues()
+	if config.Config().Log.Config {
+		config.Config().LogValues()
 	}
 
-	jiraRules := []models.JiraRule{}
-	for _, rule := range config.Config.JIRA {
-		jiraRules = append(jiraRules, models.JiraRule{Regex: rule.Regex, URI: rule.URI})
+	err := transform.ParseRules(linkRules())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = transform.ParseRelabelRules(relabelRules())
+	if err != nil {
+		log.Fatal(err)
 	}
-	transform.ParseRules(jiraRules)
 
 	apiCache = cache.New(cache.NoExpiration, 10*time.Second)
 
+	setupDiscoveries()
 	setupUpstreams()
+	setupHistory()
+	setupAuthentication()
+	setupAuthorization()
+	setupAudit()
 
-	if len(alertmanager.GetAlertmanagers()) == 0 {
+	if len(alertmanager.GetAlertmanagers()) == 0 && len(discoveries) == 0 {
 		log.Fatal("No valid Alertmanager URIs defined")
 	}
 
@@ -150,10 +293,10 @@ func main() {
 	log.Info("Done, starting HTTP server")
 
 	// background loop that will fetch updates from Alertmanager
-	ticker = time.NewTicker(config.Config.Alertmanager.Interval)
+	ticker = time.NewTicker(config.Config().Alertmanager.Interval)
 	go Tick()
 
-	switch config.Config.Debug {
+	switch config.Config().Debug {
 	case true:
 		gin.SetMode(gin.DebugMode)
 	case false:
@@ -167,26 +310,36 @@ func main() {
 	t = loadTemplates(t, "static/dist/templates")
 	router.SetHTMLTemplate(t)
 
+	if config.Config().Sentry.Public != "" {
+		raven.SetRelease(version)
+		router.Use(sentry.Recovery(raven.DefaultClient, false))
+	}
+
 	prom := ginprometheus.NewPrometheus("gin")
 	prom.MetricsPath = getViewURL("/metrics")
-	prom.Use(router)
-
-	if config.Config.Debug {
-		ginpprof.Wrapper(router)
+	setupRouter(router, func(r *gin.Engine) {
+		prom.Use(r)
+		if config.Config().Debug {
+			ginpprof.Wrapper(r)
+		}
+	})
+	err = setupProxies(alertmanager.GetAlertmanagers())
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if config.Config.Sentry.Public != "" {
-		raven.SetRelease(version)
-		router.Use(sentry.Recovery(raven.DefaultClient, false))
+	go watchSignals()
+	if config.Config().WatchFile() {
+		if config.Config().FileUsed() == "" {
+			log.Warning("No configuration file was read, there's nothing to watch for changes")
+		} else {
+			go watchConfigFile(config.Config().FileUsed())
+		}
 	}
 
-	setupRouter(router)
-	for _, am := range alertmanager.GetAlertmanagers() {
-		setupRouterProxyHandlers(router, am)
-	}
-	listen := fmt.Sprintf("%s:%d", config.Config.Listen.Address, config.Config.Listen.Port)
+	listen := fmt.Sprintf("%s:%d", config.Config().Listen.Address, config.Config().Listen.Port)
 	log.Infof("Listening on %s", listen)
-	err := router.Run(listen)
+	err = router.Run(listen)
 	if err != nil {
 		log.Fatal(err)
 	}
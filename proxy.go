@@ -1,20 +1,34 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/cloudflare/unsee/internal/alertmanager"
 	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/models"
 	"github.com/gin-gonic/gin"
 
 	log "github.com/sirupsen/logrus"
 )
 
+var (
+	// proxies holds a proxy handler for every Alertmanager instance, it's
+	// replaced when configuration is reloaded
+	proxies     = map[string]http.Handler{}
+	proxiesLock = sync.RWMutex{}
+)
+
 func proxyPathPrefix(name string) string {
-	return fmt.Sprintf("%sproxy/alertmanager/%s", config.Config.Listen.Prefix, name)
+	return fmt.Sprintf("%sproxy/alertmanager/%s", config.Config().Listen.Prefix, name)
 }
 
 func proxyPath(name, path string) string {
@@ -59,16 +73,162 @@ func NewAlertmanagerProxy(alertmanager *alertmanager.Alertmanager) (*httputil.Re
 	return &proxy, nil
 }
 
-func setupRouterProxyHandlers(router *gin.Engine, alertmanager *alertmanager.Alertmanager) error {
-	proxy, err := NewAlertmanagerProxy(alertmanager)
-	if err != nil {
-		return err
+func setupRouterProxyHandlers(router *gin.Engine) {
+	router.POST(proxyPath(":name", "/api/v1/silences"), proxyHandler)
+	router.DELETE(proxyPath(":name", "/api/v1/silence/*id"), proxyHandler)
+}
+
+// setupProxies will create a proxy for every passed Alertmanager instance
+// and replace all current proxies with those, if there's an error current
+// proxies are kept
+func setupProxies(upstreams []*alertmanager.Alertmanager) error {
+	newProxies := map[string]http.Handler{}
+	for _, am := range upstreams {
+		proxy, err := NewAlertmanagerProxy(am)
+		if err != nil {
+			return err
+		}
+		newProxies[am.Name] = http.StripPrefix(proxyPathPrefix(am.Name), proxy)
 	}
-	router.POST(
-		proxyPath(alertmanager.Name, "/api/v1/silences"),
-		gin.WrapH(http.StripPrefix(proxyPathPrefix(alertmanager.Name), proxy)))
-	router.DELETE(
-		proxyPath(alertmanager.Name, "/api/v1/silence/*id"),
-		gin.WrapH(http.StripPrefix(proxyPathPrefix(alertmanager.Name), proxy)))
+
+	proxiesLock.Lock()
+	proxies = newProxies
+	proxiesLock.Unlock()
 	return nil
 }
+
+// proxyHandler will pass the request to the proxy for the Alertmanager
+// instance from the request path
+func proxyHandler(c *gin.Context) {
+	start := time.Now()
+	name := c.Param("name")
+
+	proxiesLock.RLock()
+	proxy, found := proxies[name]
+	proxiesLock.RUnlock()
+
+	if !found {
+		c.String(http.StatusNotFound, "404 page not found")
+		return
+	}
+
+	body := []byte{}
+	if c.Request.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": fmt.Sprintf("failed to read request body: %s", err)})
+			return
+		}
+		// body was consumed, so it needs to be replaced before proxying
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	action := models.AuditActionCreate
+	silenceID := ""
+	if c.Request.Method == http.MethodDelete {
+		action = models.AuditActionExpire
+		silenceID = strings.TrimPrefix(c.Param("id"), "/")
+	}
+	entry := newAuditEntry(c, action, name, string(body))
+	entry.SilenceID = silenceID
+
+	if code, err := authorizeProxyRequest(c, name, body); err != nil {
+		// use the same format as Alertmanager API errors
+		c.JSON(code, gin.H{"status": "error", "error": err.Error()})
+		log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), code, c.Request.Method, c.Request.RequestURI, time.Since(start))
+		entry.Status = code
+		entry.Error = err.Error()
+		recordAudit(entry)
+		return
+	}
+
+	w := &recordingResponseWriter{ResponseWriter: c.Writer}
+	proxy.ServeHTTP(w, c.Request)
+
+	entry.Status = w.Status()
+	resp := struct {
+		Status string `json:"status"`
+		Data   struct {
+			SilenceID string `json:"silenceId"`
+		} `json:"data"`
+		Error string `json:"error"`
+	}{}
+	if err := json.Unmarshal(w.body.Bytes(), &resp); err == nil {
+		if resp.Data.SilenceID != "" {
+			entry.SilenceID = resp.Data.SilenceID
+		}
+		entry.Error = resp.Error
+	} else if entry.Status >= 300 {
+		entry.Error = http.StatusText(entry.Status)
+	}
+	recordAudit(entry)
+}
+
+// recordingResponseWriter keeps a copy of the response body, it's used to
+// get the ID of created silences from Alertmanager responses
+type recordingResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	// silence responses are tiny, don't keep anything unexpectedly big
+	if w.body.Len() < 64*1024 {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// authorizeProxyRequest checks if the user is allowed to create or expire
+// the silence from the request, silences that are expired or edited are
+// looked up in the data pulled from the Alertmanager instance
+func authorizeProxyRequest(c *gin.Context, name string, body []byte) (int, error) {
+	if getAuthorizer() == nil {
+		return http.StatusOK, nil
+	}
+
+	am := alertmanager.GetAlertmanagerByName(name)
+	if am == nil {
+		return http.StatusNotFound, fmt.Errorf("Alertmanager '%s' not found", name)
+	}
+
+	silences := []models.Silence{}
+	switch c.Request.Method {
+	case http.MethodPost:
+		silence := models.Silence{}
+		if err := json.Unmarshal(body, &silence); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("failed to decode silence: %s", err)
+		}
+		silences = append(silences, silence)
+		// editing a silence will expire the old one
+		if silence.ID != "" {
+			existing, err := findSilence(am, silence.ID)
+			if err != nil {
+				return http.StatusForbidden, err
+			}
+			silences = append(silences, existing)
+		}
+	case http.MethodDelete:
+		existing, err := findSilence(am, strings.TrimPrefix(c.Param("id"), "/"))
+		if err != nil {
+			return http.StatusForbidden, err
+		}
+		silences = append(silences, existing)
+	}
+
+	for _, silence := range silences {
+		if err := checkSilenceAccess(c, am.Name, silence); err != nil {
+			return http.StatusForbidden, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+func findSilence(am *alertmanager.Alertmanager, id string) (models.Silence, error) {
+	silence, err := am.SilenceByID(id)
+	if err != nil {
+		return silence, fmt.Errorf("silence '%s' not found on Alertmanager '%s', it can't be modified until unsee pulls it", id, am.Name)
+	}
+	return silence, nil
+}
@@ -99,7 +99,7 @@ func TestProxy(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	setupRouterProxyHandlers(r, am)
+	setupProxies([]*alertmanager.Alertmanager{am})
 
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
@@ -189,7 +189,7 @@ func TestProxyHeaders(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
-		setupRouterProxyHandlers(r, am)
+		setupProxies([]*alertmanager.Alertmanager{am})
 
 		httpmock.Reset()
 		httpmock.RegisterResponder(testCase.method, testCase.upstreamURI, func(req *http.Request) (*http.Response, error) {
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloudflare/unsee/api/v1"
+	"github.com/cloudflare/unsee/client"
+	"github.com/cloudflare/unsee/internal/alertmanager"
+	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/transform"
+
+	cache "github.com/patrickmn/go-cache"
+	log "github.com/sirupsen/logrus"
+)
+
+// output formats supported by the query subcommand
+const (
+	queryOutputTable = "table"
+	queryOutputJSON  = "json"
+	queryOutputCSV   = "csv"
+)
+
+var queryOutputs = []string{queryOutputTable, queryOutputJSON, queryOutputCSV}
+
+// runQuery implements the query subcommand, it will print all alerts matching
+// filters passed as arguments, alerts are requested from running unsee
+// instance if uri is set, otherwise the config is loaded and alerts are pulled
+// from all Alertmanager instances once
+func runQuery(args []string, uri, output string, w io.Writer) error {
+	writers := map[string]func(io.Writer, []v1.Alert) error{
+		queryOutputTable: writeAlertsTable,
+		queryOutputJSON:  writeAlertsJSON,
+		queryOutputCSV:   writeAlertsCSV,
+	}
+	writer, found := writers[output]
+	if !found {
+		return fmt.Errorf("Invalid output format '%s', valid formats are: %s", output, strings.Join(queryOutputs, ", "))
+	}
+
+	// every argument is a separate filter, same as in the UI
+	q := strings.Join(args, ",")
+
+	var groups []v1.AlertGroup
+	var err error
+	if uri != "" {
+		groups, err = queryUnsee(uri, q)
+	} else {
+		groups, err = queryAlertmanagers(q)
+	}
+	if err != nil {
+		return err
+	}
+
+	alerts := []v1.Alert{}
+	for _, ag := range groups {
+		alerts = append(alerts, ag.Alerts...)
+	}
+	return writer(w, alerts)
+}
+
+// queryUnsee requests alerts from running unsee instance
+func queryUnsee(uri, q string) ([]v1.AlertGroup, error) {
+	c, err := client.New(uri)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.AllAlerts(context.Background(), client.AlertsQuery{
+		Filters: []string{q},
+		Fields:  []string{v1.FieldFilters},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.FilterError != nil {
+		return nil, fmt.Errorf("Invalid filter expression: %s at position %d", resp.FilterError.Message, resp.FilterError.Position)
+	}
+	for _, filter := range resp.Filters {
+		if !filter.IsValid {
+			return nil, fmt.Errorf("Invalid filter: %s", filter.Text)
+		}
+	}
+	return resp.Groups, nil
+}
+
+// queryAlertmanagers loads the config and pulls alerts from all configured
+// Alertmanager instances, then evaluates the filter expression the same way
+// alerts.json does
+func queryAlertmanagers(q string) ([]v1.AlertGroup, error) {
+	// only warnings and errors are logged, info messages would clutter the
+	// output of every query
+	log.SetLevel(log.WarnLevel)
+	config.Read()
+	setupLogger()
+	if log.GetLevel() > log.WarnLevel {
+		log.SetLevel(log.WarnLevel)
+	}
+
+	if err := transform.ParseRules(linkRules()); err != nil {
+		return nil, err
+	}
+	if err := transform.ParseRelabelRules(relabelRules()); err != nil {
+		return nil, err
+	}
+
+	apiCache = cache.New(cache.NoExpiration, 10*time.Second)
+	// discovered targets are listed once, there's no need to watch them
+	ds, err := newDiscoveries()
+	if err != nil {
+		return nil, err
+	}
+	discoveries = ds
+	setupUpstreams()
+	if len(alertmanager.GetAlertmanagers()) == 0 {
+		return nil, errors.New("No valid Alertmanager URIs defined")
+	}
+	pullFromAlertmanager()
+
+	// partial results would look the same as no alerts, which scripts using
+	// the output would treat as a success
+	failed := []string{}
+	for _, am := range alertmanager.GetAlertmanagers() {
+		if am.Error() != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", am.Name, am.Error()))
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return nil, fmt.Errorf("Failed to pull alerts from Alertmanager: %s", strings.Join(failed, ", "))
+	}
+
+	expression, filterError := getFiltersFromQuery(q)
+	if filterError != nil {
+		return nil, fmt.Errorf("Invalid filter expression: %s at position %d", filterError.Message, filterError.Position)
+	}
+	for _, filter := range expression.Filters() {
+		if !filter.GetIsValid() {
+			return nil, fmt.Errorf("Invalid filter: %s", filter.GetRawText())
+		}
+	}
+
+	sortBy, err := parseSortKeys(config.Config().Sorting.Default)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered, _, _ := filterAlerts(expression, config.Config().Grouping.By, sortBy)
+	groups := []v1.AlertGroup{}
+	for _, ag := range filtered {
+		groups = append(groups, apiAlertGroup(ag))
+	}
+	return groups, nil
+}
+
+func sortedLabelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func alertmanagerNames(alert v1.Alert) string {
+	names := []string{}
+	for _, am := range alert.Alertmanager {
+		names = append(names, am.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func writeAlertsTable(w io.Writer, alerts []v1.Alert) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATE\tSTARTS AT\tRECEIVER\tALERTMANAGER\tLABELS")
+	for _, alert := range alerts {
+		labels := []string{}
+		for _, name := range sortedLabelNames(alert.Labels) {
+			labels = append(labels, fmt.Sprintf("%s=%s", name, alert.Labels[name]))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			alert.State,
+			alert.StartsAt.Format(time.RFC3339),
+			alert.Receiver,
+			alertmanagerNames(alert),
+			strings.Join(labels, " "),
+		)
+	}
+	return tw.Flush()
+}
+
+func writeAlertsJSON(w io.Writer, alerts []v1.Alert) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(alerts)
+}
+
+// writeAlertsCSV writes a header and a single row for every alert, every
+// label name found on any alert gets its own column
+func writeAlertsCSV(w io.Writer, alerts []v1.Alert) error {
+	names := map[string]string{}
+	for _, alert := range alerts {
+		for name := range alert.Labels {
+			names[name] = name
+		}
+	}
+	labelNames := sortedLabelNames(names)
+
+	cw := csv.NewWriter(w)
+	header := append([]string{"state", "startsAt", "receiver", "alertmanager"}, labelNames...)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		row := []string{alert.State, alert.StartsAt.Format(time.RFC3339), alert.Receiver, alertmanagerNames(alert)}
+		for _, name := range labelNames {
+			row = append(row, alert.Labels[name])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
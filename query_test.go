@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/unsee/api/v1"
+	"github.com/cloudflare/unsee/internal/alertmanager"
+	"github.com/cloudflare/unsee/internal/mock"
+
+	httpmock "gopkg.in/jarcoal/httpmock.v1"
+)
+
+var queryAlerts = []v1.Alert{
+	v1.Alert{
+		Labels:       map[string]string{"alertname": "Host_Down", "instance": "web1"},
+		StartsAt:     time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC),
+		State:        "active",
+		Receiver:     "by-name",
+		Alertmanager: []v1.AlertmanagerInstance{v1.AlertmanagerInstance{Name: "ha2"}, v1.AlertmanagerInstance{Name: "ha1"}},
+	},
+	v1.Alert{
+		Labels:   map[string]string{"alertname": "Free_Disk_Space_Too_Low", "cluster": "prod"},
+		StartsAt: time.Date(2018, 1, 2, 12, 0, 0, 0, time.UTC),
+		State:    "suppressed",
+		Receiver: "default",
+	},
+}
+
+func TestQueryOutputTable(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := writeAlertsTable(&buf, queryAlerts); err != nil {
+		t.Fatal(err)
+	}
+	expected := `STATE       STARTS AT             RECEIVER  ALERTMANAGER  LABELS
+active      2018-01-01T12:00:00Z  by-name   ha1,ha2       alertname=Host_Down instance=web1
+suppressed  2018-01-02T12:00:00Z  default                 alertname=Free_Disk_Space_Too_Low cluster=prod
+`
+	if buf.String() != expected {
+		t.Errorf("Invalid table output, expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestQueryOutputCSV(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := writeAlertsCSV(&buf, queryAlerts); err != nil {
+		t.Fatal(err)
+	}
+	expected := `state,startsAt,receiver,alertmanager,alertname,cluster,instance
+active,2018-01-01T12:00:00Z,by-name,"ha1,ha2",Host_Down,,web1
+suppressed,2018-01-02T12:00:00Z,default,,Free_Disk_Space_Too_Low,prod,
+`
+	if buf.String() != expected {
+		t.Errorf("Invalid CSV output, expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestQueryOutputJSON(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := writeAlertsJSON(&buf, queryAlerts); err != nil {
+		t.Fatal(err)
+	}
+	alerts := []v1.Alert{}
+	if err := json.Unmarshal(buf.Bytes(), &alerts); err != nil {
+		t.Fatalf("Failed to decode JSON output: %s", err)
+	}
+	if len(alerts) != 2 || alerts[0].Labels["instance"] != "web1" {
+		t.Errorf("Invalid JSON output: %s", buf.String())
+	}
+}
+
+type queryTest struct {
+	args   []string
+	alerts int
+	failed bool
+}
+
+var queryTests = []queryTest{
+	{args: []string{}, alerts: 24},
+	{args: []string{"alertname=HTTP_Probe_Failed"}, alerts: 4},
+	{args: []string{"alertname=HTTP_Probe_Failed", "instance=web1"}, alerts: 2},
+	{args: []string{"instance=web1 OR instance=web2"}, alerts: 4},
+	{args: []string{"@limit=foo"}, failed: true},
+	{args: []string{"(instance=web1"}, failed: true},
+}
+
+func TestQueryRemote(t *testing.T) {
+	mockConfig()
+	for _, version := range mock.ListAllMocks() {
+		mockAlerts(version)
+		ts := httptest.NewServer(ginTestEngine())
+		for _, testCase := range queryTests {
+			buf := bytes.Buffer{}
+			err := runQuery(testCase.args, ts.URL, queryOutputCSV, &buf)
+			if (err != nil) != testCase.failed {
+				t.Errorf("[%s] runQuery(%v) returned error: %v", version, testCase.args, err)
+				continue
+			}
+			if testCase.failed {
+				continue
+			}
+			rows, err := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+			if err != nil {
+				t.Errorf("[%s] runQuery(%v) returned invalid CSV: %s", version, testCase.args, err)
+				continue
+			}
+			if len(rows)-1 != testCase.alerts {
+				t.Errorf("[%s] runQuery(%v) returned %d alert(s), expected %d", version, testCase.args, len(rows)-1, testCase.alerts)
+			}
+		}
+		ts.Close()
+	}
+
+	if err := runQuery([]string{}, "http://localhost", "yaml", &bytes.Buffer{}); err == nil {
+		t.Error("runQuery() with invalid output format didn't return any error")
+	}
+}
+
+func TestQueryFailedUpstream(t *testing.T) {
+	mockConfig()
+	// query registers its own upstreams
+	upstreams := alertmanager.GetAlertmanagers()
+	defer func() {
+		alertmanager.SetAlertmanagers(upstreams)
+		mockConfig()
+	}()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	versions := mock.ListAllMocks()
+	version := versions[len(versions)-1]
+	for _, path := range []string{"api/v1/status", "api/v1/silences", "api/v1/alerts/groups", "api/v2/status", "api/v2/silences", "api/v2/alerts/groups"} {
+		if mock.Exists(path, version) {
+			mock.RegisterURL("http://localhost/"+path, version, path)
+		}
+	}
+
+	alertmanager.SetAlertmanagers([]*alertmanager.Alertmanager{})
+	groups, err := queryAlertmanagers("")
+	if err != nil {
+		t.Fatalf("queryAlertmanagers() failed: %s", err)
+	}
+	if len(groups) == 0 {
+		t.Error("queryAlertmanagers() didn't return any alert group")
+	}
+
+	// Alertmanager is down
+	httpmock.Reset()
+	alertmanager.SetAlertmanagers([]*alertmanager.Alertmanager{})
+	if _, err = queryAlertmanagers(""); err == nil || !strings.Contains(err.Error(), "default") {
+		t.Errorf("queryAlertmanagers() with a failing Alertmanager returned error: %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/alertmanager"
+	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/transform"
+	"github.com/fsnotify/fsnotify"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// reloadRequests is used to tell the background loop to reload config,
+	// reloads are done from the same goroutine that pulls alerts so those
+	// never run at the same time
+	reloadRequests = make(chan bool, 1)
+
+	// configWatchDelay is how long to wait after the last config file change
+	// before reloading it, editors will often write files in a few steps
+	configWatchDelay = time.Second
+)
+
+// requestReload will schedule a config reload, it never blocks, if there's
+// already a pending reload request it's a no-op
+func requestReload() {
+	select {
+	case reloadRequests <- true:
+	default:
+	}
+}
+
+// watchSignals will request a config reload on every SIGHUP
+func watchSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		log.Info("Got SIGHUP, reloading configuration")
+		requestReload()
+	}
+}
+
+// watchConfigFile will request a config reload every time the config file
+// is modified
+func watchConfigFile(path string) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Errorf("Failed to watch configuration file %s: %s", path, err)
+		return
+	}
+	defer watcher.Close()
+
+	// watch the whole directory since editors and tools like kubernetes
+	// will often replace the file rather than write to it
+	path = filepath.Clean(path)
+	err = watcher.Add(filepath.Dir(path))
+	if err != nil {
+		log.Errorf("Failed to watch configuration file %s: %s", path, err)
+		return
+	}
+	log.Infof("Watching configuration file %s for changes", path)
+
+	var delay *time.Timer
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != path || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			log.Infof("Configuration file %s was modified, reloading", path)
+			if delay != nil {
+				delay.Stop()
+			}
+			delay = time.AfterFunc(configWatchDelay, requestReload)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("Error while watching configuration file %s: %s", path, err)
+		}
+	}
+}
+
+// reloadConfig will read configuration again and apply all changes, if the
+// new configuration is invalid then it's rolled back and nothing is changed.
+// New configuration is read into a separate copy, it's only published once
+// all options that require a restart are reverted, rollback will publish the
+// old copy again, so the configuration in use is never modified in place
+func reloadConfig() error {
+	oldConfig := config.Config()
+	oldRules := linkRules()
+	oldRelabelRules := relabelRules()
+
+	newConfig, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	// some options are only used on startup, keep current values for those
+	if !reflect.DeepEqual(newConfig.Listen, oldConfig.Listen) {
+		log.Warning("Changes to listen options require a restart")
+		newConfig.Listen = oldConfig.Listen
+	}
+	if !reflect.DeepEqual(newConfig.Authentication, oldConfig.Authentication) {
+		log.Warning("Changes to authentication options require a restart")
+		newConfig.Authentication = oldConfig.Authentication
+	}
+	if !reflect.DeepEqual(newConfig.Audit, oldConfig.Audit) {
+		log.Warning("Changes to audit options require a restart")
+		newConfig.Audit = oldConfig.Audit
+	}
+	if !reflect.DeepEqual(newConfig.History, oldConfig.History) {
+		log.Warning("Changes to history options require a restart")
+		newConfig.History = oldConfig.History
+	}
+	if !reflect.DeepEqual(newConfig.Sentry, oldConfig.Sentry) {
+		log.Warning("Changes to sentry options require a restart")
+		newConfig.Sentry = oldConfig.Sentry
+	}
+	if newConfig.Debug != oldConfig.Debug {
+		log.Warning("Changes to debug option require a restart")
+		newConfig.Debug = oldConfig.Debug
+	}
+
+	// reuse existing Alertmanager instances if their config didn't change
+	reusable := map[string]*alertmanager.Alertmanager{}
+	for _, s := range newConfig.Alertmanager.Servers {
+		for _, old := range oldConfig.Alertmanager.Servers {
+			if reflect.DeepEqual(s, old) {
+				if am := alertmanager.GetAlertmanagerByName(s.Name); am != nil {
+					reusable[s.Name] = am
+				}
+			}
+		}
+	}
+
+	config.Set(newConfig)
+
+	// discovery is only recreated if its config has changed, otherwise all
+	// discovered instances can be reused, servers are also compared since DNS
+	// discovery is configured there
+	oldDiscoveries := discoveries
+	discoveryChanged := !reflect.DeepEqual(newConfig.Alertmanager.Servers, oldConfig.Alertmanager.Servers) ||
+		!reflect.DeepEqual(newConfig.Alertmanager.Discovery, oldConfig.Alertmanager.Discovery)
+	if discoveryChanged {
+		discoveries, err = newDiscoveries()
+		if err != nil {
+			discoveries = oldDiscoveries
+			config.Set(oldConfig)
+			return err
+		}
+	} else {
+		static := map[string]bool{}
+		for _, s := range oldConfig.Alertmanager.Servers {
+			static[s.Name] = true
+		}
+		for _, am := range alertmanager.GetAlertmanagers() {
+			if !static[am.Name] {
+				reusable[am.Name] = am
+			}
+		}
+	}
+
+	err = applyConfig(reusable, oldRules, oldRelabelRules)
+	if err != nil {
+		discoveries = oldDiscoveries
+		config.Set(oldConfig)
+		return err
+	}
+	if discoveryChanged {
+		startDiscoveries(discoveries)
+	}
+
+	log.Info("Configuration reloaded")
+	if newConfig.Log.Config {
+		newConfig.LogValues()
+	}
+	return nil
+}
+
+// applyConfig will validate current configuration and replace all objects
+// created from it
+func applyConfig(reusable map[string]*alertmanager.Alertmanager, oldRules []models.LinkRule, oldRelabelRules []models.RelabelRule) error {
+	level, err := parseLogLevel(config.Config().Log.Level)
+	if err != nil {
+		return err
+	}
+
+	if config.Config().Alertmanager.Interval <= time.Second*0 {
+		return fmt.Errorf("Invalid AlertmanagerTTL value '%v'", config.Config().Alertmanager.Interval)
+	}
+
+	upstreams, err := newUpstreams(reusable)
+	if err != nil {
+		return err
+	}
+	if len(upstreams) == 0 && len(discoveries) == 0 {
+		return fmt.Errorf("No valid Alertmanager URIs defined")
+	}
+
+	authz, err := newAuthorizer()
+	if err != nil {
+		return err
+	}
+
+	err = transform.ParseRules(linkRules())
+	if err != nil {
+		return err
+	}
+
+	err = transform.ParseRelabelRules(relabelRules())
+	if err != nil {
+		// old rules were valid, so this can't fail
+		transform.ParseRules(oldRules)
+		return err
+	}
+
+	oldUpstreams := alertmanager.GetAlertmanagers()
+	err = alertmanager.SetAlertmanagers(upstreams)
+	if err != nil {
+		transform.ParseRules(oldRules)
+		transform.ParseRelabelRules(oldRelabelRules)
+		return err
+	}
+
+	err = setupProxies(upstreams)
+	if err != nil {
+		alertmanager.SetAlertmanagers(oldUpstreams)
+		transform.ParseRules(oldRules)
+		transform.ParseRelabelRules(oldRelabelRules)
+		return err
+	}
+
+	log.SetLevel(level)
+	setAuthorizer(authz)
+
+	// restart the timer, alerts will be pulled right after reload so the
+	// next pull should happen after a full interval
+	if ticker != nil {
+		ticker.Stop()
+		ticker = time.NewTicker(config.Config().Alertmanager.Interval)
+	}
+
+	apiCache.Flush()
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/alertmanager"
+	"github.com/cloudflare/unsee/internal/config"
+
+	httpmock "gopkg.in/jarcoal/httpmock.v1"
+)
+
+const reloadTestConfig = `alertmanager:
+  interval: 1m
+  servers:
+    - name: default
+      uri: http://localhost
+      timeout: 40s
+    - name: second
+      uri: http://localhost:9094
+      timeout: 10s
+      proxy: true
+`
+
+func TestReloadConfig(t *testing.T) {
+	mockConfig()
+	r := ginTestEngine()
+
+	dir, err := ioutil.TempDir("", "unsee-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := path.Join(dir, "unsee.yaml")
+
+	defaultAM := alertmanager.GetAlertmanagerByName("default")
+	if defaultAM == nil {
+		t.Fatal("Alertmanager 'default' isn't registered")
+	}
+
+	os.Setenv("CONFIG_DIR", dir)
+	defer func() {
+		os.Unsetenv("CONFIG_DIR")
+		if err := reloadConfig(); err != nil {
+			t.Errorf("Failed to restore original config: %s", err)
+		}
+		if len(alertmanager.GetAlertmanagers()) != 1 {
+			t.Errorf("Expected 1 Alertmanager after restoring config, got %d", len(alertmanager.GetAlertmanagers()))
+		}
+	}()
+
+	err = ioutil.WriteFile(configFile, []byte(reloadTestConfig), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reloadConfig(); err != nil {
+		t.Fatalf("reloadConfig() failed: %s", err)
+	}
+	if len(alertmanager.GetAlertmanagers()) != 2 {
+		t.Errorf("Expected 2 Alertmanagers after reload, got %d", len(alertmanager.GetAlertmanagers()))
+	}
+	if am := alertmanager.GetAlertmanagerByName("default"); am != defaultAM {
+		t.Errorf("Alertmanager 'default' wasn't reused after reload, got %v", am)
+	}
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("POST", "http://localhost:9094/api/v1/silences", httpmock.NewStringResponder(200, "{\"status\":\"success\"}"))
+	req, _ := http.NewRequest("POST", "/proxy/alertmanager/second/api/v1/silences", nil)
+	resp := newCloseNotifyingRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("POST to proxy for Alertmanager added on reload returned status %d", resp.Code)
+	}
+
+	err = ioutil.WriteFile(configFile, []byte(reloadTestConfig+"jira:\n  - regex: \"(\"\n    uri: http://jira.example.com\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := config.Config()
+	if err = reloadConfig(); err == nil {
+		t.Error("reloadConfig() didn't return any error for invalid JIRA rules")
+	}
+	if config.Config() != current {
+		t.Error("Config in use wasn't restored after failed reload")
+	}
+	if len(alertmanager.GetAlertmanagers()) != 2 {
+		t.Errorf("Expected 2 Alertmanagers after failed reload, got %d", len(alertmanager.GetAlertmanagers()))
+	}
+	if len(linkRules()) != 0 {
+		t.Errorf("Link rules were modified after failed reload: %v", linkRules())
+	}
+
+	err = ioutil.WriteFile(configFile, []byte(reloadTestConfig+"links:\n  - name: github\n    regex: \"#([0-9]+)\"\n    uri: https://github.com/org/repo/issues/$1\n    sources: [foo]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reloadConfig(); err == nil {
+		t.Error("reloadConfig() didn't return any error for link rule with invalid source")
+	}
+	if len(linkRules()) != 0 {
+		t.Errorf("Link rules were modified after failed reload: %v", linkRules())
+	}
+
+	err = ioutil.WriteFile(configFile, []byte(reloadTestConfig+"relabel:\n  - source_labels: [svc]\n    action: foo\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reloadConfig(); err == nil {
+		t.Error("reloadConfig() didn't return any error for relabel rule with invalid action")
+	}
+	if len(relabelRules()) != 0 {
+		t.Errorf("Relabel rules were modified after failed reload: %v", relabelRules())
+	}
+}
+
+func TestReloadConfigWhileServing(t *testing.T) {
+	mockConfig()
+	r := ginTestEngine()
+
+	dir, err := ioutil.TempDir("", "unsee-reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("CONFIG_DIR", dir)
+	defer func() {
+		os.Unsetenv("CONFIG_DIR")
+		if err := reloadConfig(); err != nil {
+			t.Errorf("Failed to restore original config: %s", err)
+		}
+	}()
+	err = ioutil.WriteFile(path.Join(dir, "unsee.yaml"), []byte("grouping:\n  by: [cluster]\nsorting:\n  default: [severity]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// requests are served while configuration is reloaded, run with -race to
+	// verify that handlers never read config that's being modified
+	done := make(chan bool)
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			apiCache.Flush()
+			req, _ := http.NewRequest("GET", "/api/v1/alerts?q=@state=active", nil)
+			resp := newCloseNotifyingRecorder()
+			r.ServeHTTP(resp, req)
+			if resp.Code != http.StatusOK {
+				t.Errorf("GET /api/v1/alerts returned status %d during reload", resp.Code)
+			}
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		if err := reloadConfig(); err != nil {
+			t.Errorf("reloadConfig() failed: %s", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
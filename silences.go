@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/alertmanager"
+	"github.com/cloudflare/unsee/internal/auth"
+	"github.com/cloudflare/unsee/internal/filters"
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/slices"
+
+	"github.com/gin-gonic/gin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func silenceError(c *gin.Context, start time.Time, code int, err string) {
+	c.JSON(code, models.SilenceResponse{
+		Status:  "error",
+		Error:   err,
+		Results: []models.SilenceResult{},
+	})
+	log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), code, c.Request.Method, c.Request.RequestURI, time.Since(start))
+}
+
+func silencesError(c *gin.Context, start time.Time, code int, err string) {
+	c.JSON(code, models.SilencesResponse{
+		Status:   "error",
+		Error:    err,
+		Silences: []models.ManagedSilence{},
+	})
+	log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), code, c.Request.Method, c.Request.RequestURI, time.Since(start))
+}
+
+// silenceHasLabel returns true if silence has a matcher for given label,
+// label can be passed as "name" or "name=value"
+func silenceHasLabel(silence models.Silence, label string) bool {
+	parts := strings.SplitN(label, "=", 2)
+	for _, m := range silence.Matchers {
+		if m.Name != parts[0] {
+			continue
+		}
+		if len(parts) == 1 || m.Value == parts[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// listSilences endpoint, json, returns silences from all Alertmanager
+// instances, silences can be filtered using author, jira, label (name or
+// name=value), state (active, pending or expired), expiresIn (duration),
+// unused (true to only return silences not matching any alert), expiring and
+// stale query args
+func listSilences(c *gin.Context) {
+	noCache(c)
+	start := time.Now()
+
+	var expiresIn time.Duration
+	if v, found := c.GetQuery("expiresIn"); found {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			silencesError(c, start, http.StatusBadRequest, fmt.Sprintf("Invalid expiresIn value: %s", err))
+			return
+		}
+		expiresIn = d
+	}
+
+	flags := map[string]*bool{"unused": nil, "expiring": nil, "stale": nil}
+	for name := range flags {
+		if v, found := c.GetQuery(name); found {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				silencesError(c, start, http.StatusBadRequest, fmt.Sprintf("Invalid %s value: %s", name, err))
+				return
+			}
+			flags[name] = &b
+		}
+	}
+
+	state := c.Query("state")
+	if state != "" && !slices.StringInSlice([]string{models.SilenceStateActive, models.SilenceStatePending, models.SilenceStateExpired}, state) {
+		silencesError(c, start, http.StatusBadRequest, fmt.Sprintf("Invalid state value: %s", state))
+		return
+	}
+
+	author := c.Query("author")
+	jira := c.Query("jira")
+	label := c.Query("label")
+	now := time.Now()
+
+	resp := models.SilencesResponse{
+		Status:   "success",
+		Silences: []models.ManagedSilence{},
+	}
+	for _, silence := range alertmanager.DedupSilences() {
+		if author != "" && silence.CreatedBy != author {
+			continue
+		}
+		if jira != "" && !slices.StringInSlice(silence.LinksOfType("jira"), jira) {
+			continue
+		}
+		if label != "" && !silenceHasLabel(silence.Silence, label) {
+			continue
+		}
+		if state != "" && silence.State != state {
+			continue
+		}
+		if expiresIn > 0 && (silence.State != models.SilenceStateActive || silence.EndsAt.After(now.Add(expiresIn))) {
+			continue
+		}
+		if flags["unused"] != nil && (silence.AlertCount == 0) != *flags["unused"] {
+			continue
+		}
+		if flags["expiring"] != nil && silence.Expiring != *flags["expiring"] {
+			continue
+		}
+		if flags["stale"] != nil && silence.Stale != *flags["stale"] {
+			continue
+		}
+		resp.Silences = append(resp.Silences, silence)
+	}
+
+	c.JSON(http.StatusOK, resp)
+	log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), http.StatusOK, c.Request.Method, c.Request.RequestURI, time.Since(start))
+}
+
+// silenceTarget is a single Alertmanager cluster that a silence will be
+// created on, members are tried in order until one of them accepts it
+type silenceTarget struct {
+	cluster string
+	members []*alertmanager.Alertmanager
+}
+
+// createSilence endpoint, json, accepts a single silence and a list of
+// Alertmanager instances or clusters, the silence will be created once on
+// every cluster since all members of a cluster share silences
+func createSilence(c *gin.Context) {
+	start := time.Now()
+
+	req := models.SilenceRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		silenceError(c, start, http.StatusBadRequest, fmt.Sprintf("Failed to decode request body: %s", err))
+		return
+	}
+
+	// authenticated users can only create silences under their own name
+	if username := auth.GetUsername(c); username != "" {
+		req.Silence.CreatedBy = username
+	}
+
+	if err := req.Silence.Validate(); err != nil {
+		silenceError(c, start, http.StatusBadRequest, fmt.Sprintf("Invalid silence: %s", err))
+		return
+	}
+
+	if len(req.Alertmanagers) == 0 {
+		silenceError(c, start, http.StatusBadRequest, "List of Alertmanager instances is empty")
+		return
+	}
+
+	targets := []silenceTarget{}
+	clusters := []string{}
+	for _, name := range req.Alertmanagers {
+		cluster := alertmanager.GetClusterByName(name)
+		if cluster == nil {
+			silenceError(c, start, http.StatusBadRequest, fmt.Sprintf("Alertmanager '%s' not found", name))
+			return
+		}
+		if slices.StringInSlice(clusters, cluster.Name) {
+			continue
+		}
+		clusters = append(clusters, cluster.Name)
+
+		// healthy members are tried first, if a healthy member was requested
+		// by name then it's tried before any other member
+		members := []*alertmanager.Alertmanager{}
+		for _, am := range cluster.MembersByHealth() {
+			if am.Name == name && am.Error() == "" {
+				members = append([]*alertmanager.Alertmanager{am}, members...)
+			} else {
+				members = append(members, am)
+			}
+		}
+		targets = append(targets, silenceTarget{cluster: cluster.Name, members: members})
+	}
+
+	// silence is re-encoded so the audit log shows what was sent upstream
+	payload, err := json.Marshal(req.Silence)
+	if err != nil {
+		silenceError(c, start, http.StatusBadRequest, fmt.Sprintf("Failed to encode silence: %s", err))
+		return
+	}
+
+	// silences are shared by all cluster members, so the user needs to be
+	// allowed to manage silences on every one of them
+	for _, target := range targets {
+		for _, am := range target.members {
+			if err := checkSilenceAccess(c, am.Name, req.Silence); err != nil {
+				entry := newAuditEntry(c, models.AuditActionCreate, am.Name, string(payload))
+				entry.Status = http.StatusForbidden
+				entry.Error = err.Error()
+				recordAudit(entry)
+				silenceError(c, start, http.StatusForbidden, err.Error())
+				return
+			}
+		}
+	}
+
+	resp := models.SilenceResponse{
+		Status:  "success",
+		Results: make([]models.SilenceResult, len(targets)),
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(targets))
+	for i, target := range targets {
+		go func(i int, target silenceTarget) {
+			defer wg.Done()
+			result := models.SilenceResult{Cluster: target.cluster}
+			for _, am := range target.members {
+				result.Alertmanager = am.Name
+				entry := newAuditEntry(c, models.AuditActionCreate, am.Name, string(payload))
+				silenceID, status, err := am.CreateSilence(req.Silence)
+				entry.Status = status
+				if err != nil {
+					log.Errorf("[%s] Failed to create silence: %s", am.Name, err)
+					result.Error = err.Error()
+					entry.Error = err.Error()
+					recordAudit(entry)
+					// only try other members if this one didn't respond or
+					// failed, if the silence was rejected other members would
+					// reject it too, or create a duplicate if it was created
+					if status != 0 && status < http.StatusInternalServerError {
+						break
+					}
+					continue
+				}
+				result.SilenceID = silenceID
+				result.Error = ""
+				entry.SilenceID = silenceID
+				recordAudit(entry)
+				break
+			}
+			resp.Results[i] = result
+		}(i, target)
+	}
+	wg.Wait()
+
+	sort.Slice(resp.Results, func(i, j int) bool {
+		return resp.Results[i].Cluster < resp.Results[j].Cluster
+	})
+
+	code := http.StatusOK
+	for _, result := range resp.Results {
+		if result.Error != "" {
+			resp.Status = "error"
+			resp.Error = "Failed to create silence on some Alertmanager instances"
+			code = http.StatusBadGateway
+		}
+	}
+
+	c.JSON(code, resp)
+	log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), code, c.Request.Method, c.Request.RequestURI, time.Since(start))
+}
+
+// previewSilence endpoint, json, accepts a draft silence and returns all
+// alerts it would match if it was created
+func previewSilence(c *gin.Context) {
+	noCache(c)
+	start := time.Now()
+
+	silence := models.Silence{}
+	if err := c.ShouldBindJSON(&silence); err != nil {
+		c.JSON(http.StatusBadRequest, models.SilencePreviewResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("Failed to decode request body: %s", err),
+		})
+		log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), http.StatusBadRequest, c.Request.Method, c.Request.RequestURI, time.Since(start))
+		return
+	}
+
+	if err := silence.ValidateMatchers(); err != nil {
+		c.JSON(http.StatusBadRequest, models.SilencePreviewResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("Invalid silence: %s", err),
+		})
+		log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), http.StatusBadRequest, c.Request.Method, c.Request.RequestURI, time.Since(start))
+		return
+	}
+
+	resp := models.SilencePreviewResponse{
+		Status:      "success",
+		AlertGroups: []models.AlertGroup{},
+		Counters: models.SilencePreviewCounters{
+			Alertmanagers: map[string]int{},
+			Receivers:     map[string]int{},
+		},
+	}
+
+	for _, ag := range alertmanager.DedupAlerts() {
+		agCopy := models.AlertGroup{
+			ID:         ag.ID,
+			Receiver:   ag.Receiver,
+			Labels:     ag.Labels,
+			Alerts:     models.AlertList{},
+			StateCount: map[string]int{},
+		}
+		for _, s := range models.AlertStateList {
+			agCopy.StateCount[s] = 0
+		}
+		for _, alert := range ag.Alerts {
+			if !filters.SilenceMatchesAlert(&silence, &alert) {
+				continue
+			}
+			alert.UpdateFingerprints()
+			agCopy.Alerts = append(agCopy.Alerts, alert)
+			agCopy.StateCount[alert.State]++
+
+			resp.Counters.Total++
+			resp.Counters.Receivers[alert.Receiver]++
+			for _, am := range alert.Alertmanager {
+				resp.Counters.Alertmanagers[am.Name]++
+			}
+		}
+		if len(agCopy.Alerts) > 0 {
+			agCopy.Hash = agCopy.ContentFingerprint()
+			resp.AlertGroups = append(resp.AlertGroups, agCopy)
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+	log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), http.StatusOK, c.Request.Method, c.Request.RequestURI, time.Since(start))
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/cloudflare/unsee/internal/auth"
+	"github.com/cloudflare/unsee/internal/mock"
+	"github.com/cloudflare/unsee/internal/models"
+
+	httpmock "gopkg.in/jarcoal/httpmock.v1"
+)
+
+const validSilence = `{
+  "matchers": [{"name": "instance", "value": "web1", "isRegex": false}],
+  "startsAt": "2063-01-01T00:00:00Z",
+  "endsAt": "2063-01-02T00:00:00Z",
+  "createdBy": "john@example.com",
+  "comment": "Silenced instance"
+}`
+
+type silenceCreateTest struct {
+	name             string
+	body             string
+	upstreamCode     int
+	upstreamResponse string
+	code             int
+	status           string
+	results          []models.SilenceResult
+}
+
+var silenceCreateTests = []silenceCreateTest{
+	{
+		name:   "invalid JSON body",
+		body:   "{xxx",
+		code:   http.StatusBadRequest,
+		status: "error",
+	},
+	{
+		name:   "silence without matchers",
+		body:   `{"silence": {"createdBy": "me", "comment": "foo"}, "alertmanagers": ["default"]}`,
+		code:   http.StatusBadRequest,
+		status: "error",
+	},
+	{
+		name: "silence with invalid regex matcher",
+		body: `{"silence": {
+			"matchers": [{"name": "instance", "value": "web(", "isRegex": true}],
+			"startsAt": "2063-01-01T00:00:00Z",
+			"endsAt": "2063-01-02T00:00:00Z",
+			"createdBy": "john@example.com",
+			"comment": "Silenced instance"
+		}, "alertmanagers": ["default"]}`,
+		code:   http.StatusBadRequest,
+		status: "error",
+	},
+	{
+		name:   "no Alertmanager instances",
+		body:   `{"silence": ` + validSilence + `, "alertmanagers": []}`,
+		code:   http.StatusBadRequest,
+		status: "error",
+	},
+	{
+		name:   "unknown Alertmanager instance",
+		body:   `{"silence": ` + validSilence + `, "alertmanagers": ["default", "xxx"]}`,
+		code:   http.StatusBadRequest,
+		status: "error",
+	},
+	{
+		name:             "silence created",
+		body:             `{"silence": ` + validSilence + `, "alertmanagers": ["default", "default"]}`,
+		upstreamCode:     http.StatusOK,
+		upstreamResponse: `{"status":"success","data":{"silenceId":"d8a61ca8-ee2e-4076-999f-276f1e986bf3"}}`,
+		code:             http.StatusOK,
+		status:           "success",
+		results: []models.SilenceResult{
+			{Cluster: "default", Alertmanager: "default", SilenceID: "d8a61ca8-ee2e-4076-999f-276f1e986bf3"},
+		},
+	},
+	{
+		name:             "silence rejected by Alertmanager",
+		body:             `{"silence": ` + validSilence + `, "alertmanagers": ["default"]}`,
+		upstreamCode:     http.StatusBadRequest,
+		upstreamResponse: `{"status":"error","errorType":"bad_data","error":"start time must be before end time"}`,
+		code:             http.StatusBadGateway,
+		status:           "error",
+		results: []models.SilenceResult{
+			{Cluster: "default", Alertmanager: "default", Error: "start time must be before end time"},
+		},
+	},
+	{
+		name:             "Alertmanager returns an error page",
+		body:             `{"silence": ` + validSilence + `, "alertmanagers": ["default"]}`,
+		upstreamCode:     http.StatusInternalServerError,
+		upstreamResponse: "Internal Server Error",
+		code:             http.StatusBadGateway,
+		status:           "error",
+		results: []models.SilenceResult{
+			{Cluster: "default", Alertmanager: "default", Error: "Request to http://localhost/api/v1/silences failed with 500"},
+		},
+	},
+}
+
+func TestCreateSilence(t *testing.T) {
+	mockConfig()
+	r := ginTestEngine()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	for _, testCase := range silenceCreateTests {
+		t.Run(testCase.name, func(t *testing.T) {
+			httpmock.Reset()
+			if testCase.upstreamCode != 0 {
+				httpmock.RegisterResponder("POST", "http://localhost/api/v1/silences",
+					httpmock.NewStringResponder(testCase.upstreamCode, testCase.upstreamResponse))
+			}
+
+			req, _ := http.NewRequest("POST", "/api/silences", bytes.NewBufferString(testCase.body))
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			if resp.Code != testCase.code {
+				t.Errorf("POST /api/silences returned status %d while %d was expected", resp.Code, testCase.code)
+			}
+
+			ur := models.SilenceResponse{}
+			err := json.Unmarshal(resp.Body.Bytes(), &ur)
+			if err != nil {
+				t.Errorf("Failed to decode response: %s", err)
+			}
+			if ur.Status != testCase.status {
+				t.Errorf("Got status '%s' while '%s' was expected", ur.Status, testCase.status)
+			}
+			if len(ur.Results) != len(testCase.results) {
+				t.Errorf("Got %d result(s) while %d were expected: %v", len(ur.Results), len(testCase.results), ur.Results)
+				return
+			}
+			for i, result := range testCase.results {
+				if ur.Results[i] != result {
+					t.Errorf("Result mismatch, expected %v, got %v", result, ur.Results[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCreateSilenceAuthor(t *testing.T) {
+	mockConfig()
+	authenticator = auth.NewHeaderAuth("X-User", "X-Groups")
+	defer func() { authenticator = nil }()
+	r := ginTestEngine()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	authors := make(chan string, 1)
+	httpmock.RegisterResponder("POST", "http://localhost/api/v1/silences", func(req *http.Request) (*http.Response, error) {
+		silence := models.Silence{}
+		if err := json.NewDecoder(req.Body).Decode(&silence); err != nil {
+			t.Errorf("Failed to decode upstream request: %s", err)
+		}
+		authors <- silence.CreatedBy
+		return httpmock.NewStringResponse(http.StatusOK, `{"status":"success","data":{"silenceId":"1"}}`), nil
+	})
+
+	// createdBy from the request is replaced with the authenticated user
+	req, _ := http.NewRequest("POST", "/api/silences", bytes.NewBufferString(`{"silence": `+validSilence+`, "alertmanagers": ["default"]}`))
+	req.Header.Set("X-User", "alice")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("POST /api/silences returned status %d: %s", resp.Code, resp.Body.String())
+	}
+	if author := <-authors; author != "alice" {
+		t.Errorf("Silence was created by '%s', expected 'alice'", author)
+	}
+}
+
+func TestCreateSilenceOnCluster(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	defer mockClusterConfig(t)()
+
+	lock := sync.Mutex{}
+	calls := map[string]int{}
+	for uri, code := range map[string]int{
+		"http://localhost":       http.StatusOK,
+		"http://ha1.example.com": http.StatusInternalServerError,
+		"http://ha2.example.com": http.StatusOK,
+	} {
+		uri, code := uri, code
+		httpmock.RegisterResponder("POST", uri+"/api/v1/silences", func(req *http.Request) (*http.Response, error) {
+			lock.Lock()
+			calls[uri]++
+			lock.Unlock()
+			if code != http.StatusOK {
+				return httpmock.NewStringResponse(code, "Internal Server Error"), nil
+			}
+			return httpmock.NewStringResponse(code, `{"status":"success","data":{"silenceId":"silence1"}}`), nil
+		})
+	}
+
+	r := ginTestEngine()
+	body := `{"silence": ` + validSilence + `, "alertmanagers": ["default", "ha1", "ha2", "ha"]}`
+	req, _ := http.NewRequest("POST", "/api/silences", bytes.NewBufferString(body))
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("POST /api/silences returned status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	ur := models.SilenceResponse{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &ur); err != nil {
+		t.Fatalf("Failed to decode response: %s", err)
+	}
+	// ha1 fails so the silence is created using the other cluster member
+	expected := []models.SilenceResult{
+		{Cluster: "default", Alertmanager: "default", SilenceID: "silence1"},
+		{Cluster: "ha", Alertmanager: "ha2", SilenceID: "silence1"},
+	}
+	if !reflect.DeepEqual(ur.Results, expected) {
+		t.Errorf("Invalid results, expected %v, got %v", expected, ur.Results)
+	}
+	for uri, count := range calls {
+		if count != 1 {
+			t.Errorf("Silence was sent to %s %d time(s), expected 1", uri, count)
+		}
+	}
+}
+
+func TestCreateSilenceOnClusterRejected(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	defer mockClusterConfig(t)()
+
+	lock := sync.Mutex{}
+	calls := map[string]int{}
+	for _, uri := range []string{"http://ha1.example.com", "http://ha2.example.com"} {
+		uri := uri
+		httpmock.RegisterResponder("POST", uri+"/api/v1/silences", func(req *http.Request) (*http.Response, error) {
+			lock.Lock()
+			calls[uri]++
+			lock.Unlock()
+			return httpmock.NewStringResponse(http.StatusBadRequest, `{"status":"error","error":"invalid silence"}`), nil
+		})
+	}
+
+	r := ginTestEngine()
+	body := `{"silence": ` + validSilence + `, "alertmanagers": ["ha"]}`
+	req, _ := http.NewRequest("POST", "/api/silences", bytes.NewBufferString(body))
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusBadGateway {
+		t.Errorf("POST /api/silences returned status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	ur := models.SilenceResponse{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &ur); err != nil {
+		t.Fatalf("Failed to decode response: %s", err)
+	}
+	// ha1 rejects the silence so it's not sent to the other cluster member
+	expected := []models.SilenceResult{
+		{Cluster: "ha", Alertmanager: "ha1", Error: "invalid silence"},
+	}
+	if !reflect.DeepEqual(ur.Results, expected) {
+		t.Errorf("Invalid results, expected %v, got %v", expected, ur.Results)
+	}
+	if calls["http://ha1.example.com"] != 1 || calls["http://ha2.example.com"] != 0 {
+		t.Errorf("Silence should only be sent to ha1, got %v", calls)
+	}
+}
+
+type silencePreviewTest struct {
+	name     string
+	body     string
+	code     int
+	groups   int
+	counters models.SilencePreviewCounters
+}
+
+var silencePreviewTests = []silencePreviewTest{
+	{
+		name: "invalid JSON body",
+		body: "{xxx",
+		code: http.StatusBadRequest,
+	},
+	{
+		name: "no matchers",
+		body: `{"matchers": []}`,
+		code: http.StatusBadRequest,
+	},
+	{
+		name: "invalid regex",
+		body: `{"matchers": [{"name": "instance", "value": "web(", "isRegex": true}]}`,
+		code: http.StatusBadRequest,
+	},
+	{
+		name:   "equal matchers",
+		body:   `{"matchers": [{"name": "alertname", "value": "Host_Down"}, {"name": "cluster", "value": "dev"}]}`,
+		code:   http.StatusOK,
+		groups: 2,
+		counters: models.SilencePreviewCounters{
+			Total:         6,
+			Alertmanagers: map[string]int{"default": 6},
+			Receivers:     map[string]int{"by-name": 3, "by-cluster-service": 3},
+		},
+	},
+	{
+		name:   "regex matcher",
+		body:   `{"matchers": [{"name": "instance", "value": "web[0-9]", "isRegex": true}]}`,
+		code:   http.StatusOK,
+		groups: 2,
+		counters: models.SilencePreviewCounters{
+			Total:         4,
+			Alertmanagers: map[string]int{"default": 4},
+			Receivers:     map[string]int{"by-name": 2, "by-cluster-service": 2},
+		},
+	},
+	{
+		name: "regex matchers are anchored",
+		body: `{"matchers": [{"name": "instance", "value": "web", "isRegex": true}]}`,
+		code: http.StatusOK,
+		counters: models.SilencePreviewCounters{
+			Alertmanagers: map[string]int{},
+			Receivers:     map[string]int{},
+		},
+	},
+	{
+		name: "equal matchers are case sensitive",
+		body: `{"matchers": [{"name": "instance", "value": "WEB1"}]}`,
+		code: http.StatusOK,
+		counters: models.SilencePreviewCounters{
+			Alertmanagers: map[string]int{},
+			Receivers:     map[string]int{},
+		},
+	},
+}
+
+func TestPreviewSilence(t *testing.T) {
+	mockConfig()
+	for _, version := range mock.ListAllMocks() {
+		t.Logf("Testing silence preview using mock files from Alertmanager %s", version)
+		mockAlerts(version)
+		r := ginTestEngine()
+		for _, testCase := range silencePreviewTests {
+			req, _ := http.NewRequest("POST", "/api/silences/preview", bytes.NewBufferString(testCase.body))
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			if resp.Code != testCase.code {
+				t.Errorf("[%s] %s: POST /api/silences/preview returned status %d while %d was expected",
+					version, testCase.name, resp.Code, testCase.code)
+			}
+			if testCase.code != http.StatusOK {
+				continue
+			}
+
+			ur := models.SilencePreviewResponse{}
+			json.Unmarshal(resp.Body.Bytes(), &ur)
+			if len(ur.AlertGroups) != testCase.groups {
+				t.Errorf("[%s] %s: got %d group(s) while %d were expected",
+					version, testCase.name, len(ur.AlertGroups), testCase.groups)
+			}
+			if !reflect.DeepEqual(ur.Counters, testCase.counters) {
+				t.Errorf("[%s] %s: counters mismatch, expected %v, got %v",
+					version, testCase.name, testCase.counters, ur.Counters)
+			}
+		}
+	}
+}
+
+type silenceListTest struct {
+	query    string
+	code     int
+	silences int
+}
+
+var silenceListTests = []silenceListTest{
+	{query: "", code: http.StatusOK, silences: 3},
+	{query: "author=john@example.com", code: http.StatusOK, silences: 3},
+	{query: "author=bob@example.com", code: http.StatusOK, silences: 0},
+	{query: "jira=PROJECT-1", code: http.StatusOK, silences: 0},
+	{query: "label=instance", code: http.StatusOK, silences: 2},
+	{query: "label=instance=server7", code: http.StatusOK, silences: 1},
+	{query: "label=instance=server1", code: http.StatusOK, silences: 0},
+	{query: "label=instance&author=john@example.com", code: http.StatusOK, silences: 2},
+	{query: "state=active", code: http.StatusOK, silences: 3},
+	{query: "state=expired", code: http.StatusOK, silences: 0},
+	{query: "state=foo", code: http.StatusBadRequest},
+	{query: "expiresIn=1h", code: http.StatusOK, silences: 0},
+	{query: "expiresIn=876000h", code: http.StatusOK, silences: 3},
+	{query: "expiresIn=foo", code: http.StatusBadRequest},
+	{query: "unused=true", code: http.StatusOK, silences: 0},
+	{query: "unused=false", code: http.StatusOK, silences: 3},
+	{query: "unused=foo", code: http.StatusBadRequest},
+	{query: "expiring=true", code: http.StatusOK, silences: 0},
+	{query: "expiring=false", code: http.StatusOK, silences: 3},
+	{query: "expiring=foo", code: http.StatusBadRequest},
+	{query: "stale=true", code: http.StatusOK, silences: 0},
+	{query: "stale=false", code: http.StatusOK, silences: 3},
+	{query: "stale=foo", code: http.StatusBadRequest},
+}
+
+func TestListSilences(t *testing.T) {
+	mockConfig()
+	for _, version := range mock.ListAllMocks() {
+		t.Logf("Testing silence listing using mock files from Alertmanager %s", version)
+		mockAlerts(version)
+		r := ginTestEngine()
+		for _, testCase := range silenceListTests {
+			uri := "/silences.json?" + testCase.query
+			req, _ := http.NewRequest("GET", uri, nil)
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			if resp.Code != testCase.code {
+				t.Errorf("[%s] GET %s returned status %d while %d was expected", version, uri, resp.Code, testCase.code)
+			}
+
+			ur := models.SilencesResponse{}
+			if err := json.Unmarshal(resp.Body.Bytes(), &ur); err != nil {
+				t.Errorf("[%s] Failed to decode response: %s", version, err)
+			}
+			if len(ur.Silences) != testCase.silences {
+				t.Errorf("[%s] GET %s returned %d silences while %d were expected", version, uri, len(ur.Silences), testCase.silences)
+			}
+			for _, silence := range ur.Silences {
+				if len(silence.Alertmanagers) != 1 || silence.Alertmanagers[0] != "default" {
+					t.Errorf("[%s] Invalid list of Alertmanager instances for silence %s: %v", version, silence.ID, silence.Alertmanagers)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/unsee/internal/config"
+	"github.com/cloudflare/unsee/internal/models"
+	"github.com/cloudflare/unsee/internal/slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// names of all supported sort keys
+const (
+	sortByStartsAt = "startsAt"
+	sortByLabel    = "label"
+	sortBySeverity = "severity"
+	sortByCount    = "count"
+)
+
+// sortKey describes a single key alerts are sorted by
+type sortKey struct {
+	Name string
+	// Label is the name of the label to compare, only set for label key
+	Label string
+	// Reverse is true if the key was prefixed with "-"
+	Reverse bool
+}
+
+// parseSortKeys will parse a list of sort keys, every key can be one of
+// startsAt, label:<name>, severity or count, optionally prefixed with "-" to
+// reverse the order
+func parseSortKeys(values []string) ([]sortKey, error) {
+	keys := []sortKey{}
+	for _, value := range values {
+		for _, raw := range strings.Split(value, ",") {
+			raw = strings.TrimSpace(raw)
+			if raw == "" {
+				continue
+			}
+			key := sortKey{}
+			if strings.HasPrefix(raw, "-") {
+				key.Reverse = true
+				raw = strings.TrimPrefix(raw, "-")
+			}
+			if strings.HasPrefix(raw, sortByLabel+":") {
+				key.Name = sortByLabel
+				key.Label = strings.TrimPrefix(raw, sortByLabel+":")
+				if key.Label == "" {
+					return nil, fmt.Errorf("Missing label name in sort key '%s'", value)
+				}
+			} else if slices.StringInSlice([]string{sortByStartsAt, sortBySeverity, sortByCount}, raw) {
+				key.Name = raw
+			} else {
+				return nil, fmt.Errorf("Invalid sort key '%s'", raw)
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// getSortFromQuery returns the list of keys alerts should be sorted by, it's
+// read from the sort query argument (comma separated list, it can be passed
+// multiple times) and defaults to sorting.default config option
+func getSortFromQuery(c *gin.Context) ([]sortKey, error) {
+	values, found := c.GetQueryArray("sort")
+	if !found {
+		values = config.Config().Sorting.Default
+	}
+	return parseSortKeys(values)
+}
+
+// severityRank returns the position of the alert severity on the list of
+// values from the config, alerts with unknown severity are ranked last
+func severityRank(alert models.Alert) int {
+	value := alert.Labels[config.Config().Sorting.Severity.Label]
+	for i, v := range config.Config().Sorting.Severity.Values {
+		if v == value {
+			return i
+		}
+	}
+	return len(config.Config().Sorting.Severity.Values)
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// naturalCompare compares two strings treating all sequences of digits as
+// numbers, so that "web2" is before "web10"
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		ca, restA := nextChunk(a)
+		cb, restB := nextChunk(b)
+		if isDigit(ca[0]) && isDigit(cb[0]) {
+			na := strings.TrimLeft(ca, "0")
+			nb := strings.TrimLeft(cb, "0")
+			if c := compareInts(len(na), len(nb)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+		} else if c := strings.Compare(ca, cb); c != 0 {
+			return c
+		}
+		a, b = restA, restB
+	}
+	return compareInts(len(a), len(b))
+}
+
+// nextChunk returns the leading run of digits or non-digits from s
+func nextChunk(s string) (string, string) {
+	digits := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digits {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// compareByKey compares two alerts using a single sort key, aCount and
+// bCount are the sizes of groups alerts belong to
+func compareByKey(key sortKey, a, b models.Alert, aCount, bCount int) int {
+	var c int
+	switch key.Name {
+	case sortByStartsAt:
+		if a.StartsAt.Before(b.StartsAt) {
+			c = -1
+		} else if a.StartsAt.After(b.StartsAt) {
+			c = 1
+		}
+	case sortByLabel:
+		c = naturalCompare(a.Labels[key.Label], b.Labels[key.Label])
+	case sortBySeverity:
+		c = compareInts(severityRank(a), severityRank(b))
+	case sortByCount:
+		c = compareInts(aCount, bCount)
+	}
+	if key.Reverse {
+		return -c
+	}
+	return c
+}
+
+// lessAlerts returns true if alert a should be sorted before alert b, keys
+// are compared in order until one of them differs
+func lessAlerts(keys []sortKey, a, b models.Alert, aCount, bCount int) bool {
+	for _, key := range keys {
+		if c := compareByKey(key, a, b, aCount, bCount); c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/models"
+
+	"github.com/gin-gonic/gin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// alertStream keeps track of all clients subscribed to the alert stream
+	alertStream = newStreamBroker()
+
+	// streamKeepAlive is the interval at which a comment is sent to every
+	// subscriber, it keeps idle connections from being closed by proxies
+	streamKeepAlive = time.Second * 30
+)
+
+// streamBroker holds a notification channel for every stream subscriber
+type streamBroker struct {
+	lock        sync.RWMutex
+	subscribers map[chan bool]bool
+}
+
+func newStreamBroker() *streamBroker {
+	return &streamBroker{subscribers: map[chan bool]bool{}}
+}
+
+// subscribe returns a new channel that will receive a message every time
+// alerts are pulled from Alertmanager upstreams
+func (sb *streamBroker) subscribe() chan bool {
+	// buffered so that notify() never blocks, if the subscriber is still busy
+	// sending the previous event it will only get one more notification
+	ch := make(chan bool, 1)
+	sb.lock.Lock()
+	sb.subscribers[ch] = true
+	sb.lock.Unlock()
+	return ch
+}
+
+func (sb *streamBroker) unsubscribe(ch chan bool) {
+	sb.lock.Lock()
+	delete(sb.subscribers, ch)
+	sb.lock.Unlock()
+}
+
+// notify tells all subscribers that alerts were updated
+func (sb *streamBroker) notify() {
+	sb.lock.RLock()
+	defer sb.lock.RUnlock()
+	for ch := range sb.subscribers {
+		select {
+		case ch <- true:
+		default:
+		}
+	}
+}
+
+// diffAlertGroups compares alert groups with the content hash of groups
+// that were already sent to the subscriber and returns the event listing
+// all the differences, seen map is updated with the current state
+func diffAlertGroups(seen map[string]string, groups []models.AlertGroup) models.AlertsStreamEvent {
+	ts, _ := time.Now().UTC().MarshalText()
+	event := models.AlertsStreamEvent{
+		Timestamp: string(ts),
+		Added:     []models.AlertGroup{},
+		Changed:   []models.AlertGroup{},
+		Removed:   []string{},
+	}
+
+	current := map[string]bool{}
+	for _, ag := range groups {
+		current[ag.ID] = true
+		hash, found := seen[ag.ID]
+		if !found {
+			event.Added = append(event.Added, ag)
+		} else if hash != ag.Hash {
+			event.Changed = append(event.Changed, ag)
+		}
+		seen[ag.ID] = ag.Hash
+	}
+
+	for id := range seen {
+		if !current[id] {
+			event.Removed = append(event.Removed, id)
+			delete(seen, id)
+		}
+	}
+	sort.Strings(event.Removed)
+
+	return event
+}
+
+// alertsStream endpoint, text/event-stream, sends all alert groups matching
+// filters passed in the q query argument (grouped using group_by argument)
+// once the client connects and then a diff of those groups after every
+// Alertmanager pull
+func alertsStream(c *gin.Context) {
+	start := time.Now()
+	noCache(c)
+
+	updates := alertStream.subscribe()
+	defer alertStream.unsubscribe(updates)
+
+	q := c.Query("q")
+	groupBy := getGroupByFromQuery(c)
+	sortBy, err := getSortFromQuery(c)
+	if err != nil {
+		sortBy = []sortKey{}
+	}
+	seen := map[string]string{}
+
+	sendDiff := func(always bool) {
+		expression, _ := getFiltersFromQuery(q)
+		groups, _, _ := filterAlerts(expression, groupBy, sortBy)
+		event := diffAlertGroups(seen, clusterAlertGroups(groups))
+		if always || len(event.Added) > 0 || len(event.Changed) > 0 || len(event.Removed) > 0 {
+			c.SSEvent("alerts", event)
+			c.Writer.Flush()
+		}
+	}
+
+	// initial event lists all groups as added, so it's always sent
+	sendDiff(true)
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			log.Infof("[%s] <%d> %s %s stream closed after %s", c.ClientIP(), http.StatusOK, c.Request.Method, c.Request.RequestURI, time.Since(start))
+			return
+		case <-updates:
+			sendDiff(false)
+		case <-keepAlive.C:
+			c.Writer.WriteString(": keepalive\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
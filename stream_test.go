@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/unsee/internal/mock"
+	"github.com/cloudflare/unsee/internal/models"
+
+	httpmock "gopkg.in/jarcoal/httpmock.v1"
+)
+
+type alertGroupsDiffTest struct {
+	name    string
+	seen    map[string]string
+	groups  []models.AlertGroup
+	added   []string
+	changed []string
+	removed []string
+	after   map[string]string
+}
+
+var alertGroupsDiffTests = []alertGroupsDiffTest{
+	{
+		name:    "nothing seen, nothing to send",
+		seen:    map[string]string{},
+		groups:  []models.AlertGroup{},
+		added:   []string{},
+		changed: []string{},
+		removed: []string{},
+		after:   map[string]string{},
+	},
+	{
+		name:    "all groups are new",
+		seen:    map[string]string{},
+		groups:  []models.AlertGroup{{ID: "1", Hash: "a"}, {ID: "2", Hash: "b"}},
+		added:   []string{"1", "2"},
+		changed: []string{},
+		removed: []string{},
+		after:   map[string]string{"1": "a", "2": "b"},
+	},
+	{
+		name:    "no changes",
+		seen:    map[string]string{"1": "a", "2": "b"},
+		groups:  []models.AlertGroup{{ID: "1", Hash: "a"}, {ID: "2", Hash: "b"}},
+		added:   []string{},
+		changed: []string{},
+		removed: []string{},
+		after:   map[string]string{"1": "a", "2": "b"},
+	},
+	{
+		name:    "one added, one changed, one removed",
+		seen:    map[string]string{"1": "a", "2": "b", "3": "c"},
+		groups:  []models.AlertGroup{{ID: "1", Hash: "a"}, {ID: "2", Hash: "x"}, {ID: "4", Hash: "d"}},
+		added:   []string{"4"},
+		changed: []string{"2"},
+		removed: []string{"3"},
+		after:   map[string]string{"1": "a", "2": "x", "4": "d"},
+	},
+	{
+		name:    "all removed",
+		seen:    map[string]string{"2": "b", "1": "a"},
+		groups:  []models.AlertGroup{},
+		added:   []string{},
+		changed: []string{},
+		removed: []string{"1", "2"},
+		after:   map[string]string{},
+	},
+}
+
+func groupIDs(groups []models.AlertGroup) []string {
+	ids := []string{}
+	for _, ag := range groups {
+		ids = append(ids, ag.ID)
+	}
+	return ids
+}
+
+func TestDiffAlertGroups(t *testing.T) {
+	for _, testCase := range alertGroupsDiffTests {
+		event := diffAlertGroups(testCase.seen, testCase.groups)
+		if ids := groupIDs(event.Added); !reflect.DeepEqual(ids, testCase.added) {
+			t.Errorf("[%s] Expected added groups %v, got %v", testCase.name, testCase.added, ids)
+		}
+		if ids := groupIDs(event.Changed); !reflect.DeepEqual(ids, testCase.changed) {
+			t.Errorf("[%s] Expected changed groups %v, got %v", testCase.name, testCase.changed, ids)
+		}
+		if !reflect.DeepEqual(event.Removed, testCase.removed) {
+			t.Errorf("[%s] Expected removed groups %v, got %v", testCase.name, testCase.removed, event.Removed)
+		}
+		if !reflect.DeepEqual(testCase.seen, testCase.after) {
+			t.Errorf("[%s] Expected seen map %v after diff, got %v", testCase.name, testCase.after, testCase.seen)
+		}
+	}
+}
+
+// mockEmptyAlerts will pull from a mocked Alertmanager without any alerts
+func mockEmptyAlerts(version string) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	mock.RegisterURL("http://localhost/api/v1/status", version, "api/v1/status")
+	mock.RegisterURL("http://localhost/api/v1/silences", version, "api/v1/silences")
+	httpmock.RegisterResponder("GET", "http://localhost/api/v1/alerts/groups", httpmock.NewStringResponder(200, `{"status":"success","data":[]}`))
+	if mock.Exists("api/v2/status", version) {
+		mock.RegisterURL("http://localhost/api/v2/status", version, "api/v2/status")
+		mock.RegisterURL("http://localhost/api/v2/silences", version, "api/v2/silences")
+		httpmock.RegisterResponder("GET", "http://localhost/api/v2/alerts/groups", httpmock.NewStringResponder(200, "[]"))
+	}
+
+	pullFromAlertmanager()
+}
+
+func readStreamEvent(t *testing.T, reader *bufio.Reader) models.AlertsStreamEvent {
+	event := models.AlertsStreamEvent{}
+	name := ""
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read stream event: %s", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if name != "" {
+				return event
+			}
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimPrefix(line, "event:")
+			if name != "alerts" {
+				t.Fatalf("Unexpected event name '%s'", name)
+			}
+		case strings.HasPrefix(line, "data:"):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event); err != nil {
+				t.Fatalf("Failed to decode event data: %s", err)
+			}
+		}
+	}
+}
+
+func TestAlertsStream(t *testing.T) {
+	mockConfig()
+	for _, version := range mock.ListAllMocks() {
+		t.Logf("Testing alert stream using mock files from Alertmanager %s", version)
+		mockAlerts(version)
+
+		server := httptest.NewServer(ginTestEngine())
+		// httpmock replaces the default transport, use a dedicated one to
+		// talk to the test server
+		client := http.Client{Transport: &http.Transport{}, Timeout: time.Second * 10}
+		resp, err := client.Get(server.URL + "/alerts/stream?q=alertname=Host_Down,cluster=dev")
+		if err != nil {
+			t.Fatalf("GET /alerts/stream failed: %s", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET /alerts/stream returned status %d", resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("GET /alerts/stream returned Content-Type '%s'", ct)
+		}
+		reader := bufio.NewReader(resp.Body)
+
+		event := readStreamEvent(t, reader)
+		if len(event.Added) != 2 || len(event.Changed) != 0 || len(event.Removed) != 0 {
+			t.Errorf("[%s] Expected initial event with 2 added groups, got added=%d changed=%d removed=%d",
+				version, len(event.Added), len(event.Changed), len(event.Removed))
+		}
+		initialIDs := groupIDs(event.Added)
+
+		mockEmptyAlerts(version)
+		event = readStreamEvent(t, reader)
+		if len(event.Added) != 0 || len(event.Changed) != 0 || len(event.Removed) != 2 {
+			t.Errorf("[%s] Expected event with 2 removed groups, got added=%d changed=%d removed=%d",
+				version, len(event.Added), len(event.Changed), len(event.Removed))
+		}
+		for _, id := range initialIDs {
+			found := false
+			for _, removed := range event.Removed {
+				if removed == id {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("[%s] Group '%s' missing from removed list %v", version, id, event.Removed)
+			}
+		}
+
+		mockAlerts(version)
+		event = readStreamEvent(t, reader)
+		if len(event.Added) != 2 || len(event.Changed) != 0 || len(event.Removed) != 0 {
+			t.Errorf("[%s] Expected event with 2 added groups, got added=%d changed=%d removed=%d",
+				version, len(event.Added), len(event.Changed), len(event.Removed))
+		}
+
+		resp.Body.Close()
+		server.Close()
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/cloudflare/unsee/internal/alertmanager"
+	"github.com/cloudflare/unsee/internal/config"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -13,8 +15,16 @@ func pullFromAlertmanager() {
 	// always flush cache once we're done
 	defer apiCache.Flush()
 
+	// some discovery mechanisms need to be refreshed before every pull
+	if refreshDiscoveries() {
+		if _, err := syncUpstreams(); err != nil {
+			log.Errorf("Failed to update discovered Alertmanager instances: %s", err)
+		}
+	}
+
 	log.Info("Pulling latest alerts and silences from Alertmanager")
 
+	start := time.Now()
 	upstreams := alertmanager.GetAlertmanagers()
 	wg := sync.WaitGroup{}
 	wg.Add(len(upstreams))
@@ -25,6 +35,12 @@ func pullFromAlertmanager() {
 			err := am.Pull()
 			if err != nil {
 				log.Errorf("[%s] %s", am.Name, err)
+			} else if historyStore != nil {
+				// only record history after a successful pull, otherwise
+				// all alerts would be marked as resolved
+				if err := historyStore.Record(am.Name, start, am.Alerts()); err != nil {
+					log.Errorf("[%s] Failed to record alert history: %s", am.Name, err)
+				}
 			}
 			wg.Done()
 		}(upstream)
@@ -32,7 +48,24 @@ func pullFromAlertmanager() {
 
 	wg.Wait()
 
+	alertmanager.CheckSilences()
+
+	if historyStore != nil {
+		// alerts from instances that are gone would stay open forever
+		names := make([]string, 0, len(upstreams))
+		for _, am := range upstreams {
+			names = append(names, am.Name)
+		}
+		if err := historyStore.Retain(names, start); err != nil {
+			log.Errorf("Failed to resolve alert history of removed Alertmanager instances: %s", err)
+		}
+		if err := historyStore.Prune(start.Add(-config.Config().History.Retention)); err != nil {
+			log.Errorf("Failed to prune alert history: %s", err)
+		}
+	}
+
 	log.Info("Pull completed")
+	alertStream.notify()
 	runtime.GC()
 }
 
@@ -42,6 +75,20 @@ func Tick() {
 		select {
 		case <-ticker.C:
 			pullFromAlertmanager()
+		case <-reloadRequests:
+			err := reloadConfig()
+			if err != nil {
+				log.Errorf("Failed to reload configuration, keeping current one: %s", err)
+			} else {
+				pullFromAlertmanager()
+			}
+		case <-discoveryUpdates:
+			changed, err := syncUpstreams()
+			if err != nil {
+				log.Errorf("Failed to update discovered Alertmanager instances: %s", err)
+			} else if changed {
+				pullFromAlertmanager()
+			}
 		}
 	}
 }
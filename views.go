@@ -10,7 +10,6 @@ import (
 	"github.com/cloudflare/unsee/internal/alertmanager"
 	"github.com/cloudflare/unsee/internal/config"
 	"github.com/cloudflare/unsee/internal/models"
-	"github.com/cloudflare/unsee/internal/slices"
 
 	"github.com/gin-gonic/gin"
 
@@ -40,12 +39,12 @@ func index(c *gin.Context) {
 
 	c.HTML(http.StatusOK, "templates/index.html", gin.H{
 		"Version":           version,
-		"SentryDSN":         config.Config.Sentry.Public,
+		"SentryDSN":         config.Config().Sentry.Public,
 		"QFilter":           q,
 		"DefaultUsed":       defaultUsed,
-		"DefaultFilter":     strings.Join(config.Config.Filters.Default, ","),
-		"StaticColorLabels": strings.Join(config.Config.Labels.Color.Static, " "),
-		"WebPrefix":         config.Config.Listen.Prefix,
+		"DefaultFilter":     strings.Join(config.Config().Filters.Default, ","),
+		"StaticColorLabels": strings.Join(config.Config().Labels.Color.Static, " "),
+		"WebPrefix":         config.Config().Listen.Prefix,
 	})
 
 	log.Infof("[%s] %s %s took %s", c.ClientIP(), c.Request.Method, c.Request.RequestURI, time.Since(start))
@@ -56,8 +55,8 @@ func help(c *gin.Context) {
 	start := time.Now()
 	noCache(c)
 	c.HTML(http.StatusOK, "templates/help.html", gin.H{
-		"SentryDSN": config.Config.Sentry.Public,
-		"WebPrefix": config.Config.Listen.Prefix,
+		"SentryDSN": config.Config().Sentry.Public,
+		"WebPrefix": config.Config().Listen.Prefix,
 	})
 	log.Infof("[%s] <%d> %s %s took %s", c.ClientIP(), http.StatusOK, c.Request.Method, c.Request.RequestURI, time.Since(start))
 }
@@ -91,88 +90,24 @@ func alerts(c *gin.Context) {
 
 	// get filters
 	apiFilters := []models.Filter{}
-	matchFilters, validFilters := getFiltersFromQuery(c.Query("q"))
-
-	// set pointers for data store objects, need a lock until end of view is reached
-	alerts := []models.AlertGroup{}
-	colors := models.LabelsColorMap{}
-	counters := models.LabelsCountMap{}
-
-	dedupedAlerts := alertmanager.DedupAlerts()
-	dedupedColors := alertmanager.DedupColors()
-
-	var matches int
-	for _, ag := range dedupedAlerts {
-		agCopy := models.AlertGroup{
-			ID:         ag.ID,
-			Receiver:   ag.Receiver,
-			Labels:     ag.Labels,
-			Alerts:     []models.Alert{},
-			StateCount: map[string]int{},
-		}
-		for _, s := range models.AlertStateList {
-			agCopy.StateCount[s] = 0
-		}
-
-		for _, alert := range ag.Alerts {
-			results := []bool{}
-			if validFilters {
-				for _, filter := range matchFilters {
-					if filter.GetIsValid() {
-						match := filter.Match(&alert, matches)
-						results = append(results, match)
-					}
-				}
-			}
-			if !validFilters || (slices.BoolInSlice(results, true) && !slices.BoolInSlice(results, false)) {
-				matches++
-				// we need to update fingerprints since we've modified some fields in dedup
-				// and agCopy.ContentFingerprint() depends on per alert fingerprint
-				// we update it here rather than in dedup since here we can apply it
-				// only for alerts left after filtering
-				alert.UpdateFingerprints()
-				agCopy.Alerts = append(agCopy.Alerts, alert)
-
-				countLabel(counters, "@state", alert.State)
-
-				countLabel(counters, "@receiver", alert.Receiver)
-				if ck, foundKey := dedupedColors["@receiver"]; foundKey {
-					if cv, foundVal := ck[alert.Receiver]; foundVal {
-						if _, found := colors["@receiver"]; !found {
-							colors["@receiver"] = map[string]models.LabelColors{}
-						}
-						colors["@receiver"][alert.Receiver] = cv
-					}
-				}
-
-				agCopy.StateCount[alert.State]++
-
-				for key, value := range alert.Labels {
-					if keyMap, foundKey := dedupedColors[key]; foundKey {
-						if color, foundColor := keyMap[value]; foundColor {
-							if _, found := colors[key]; !found {
-								colors[key] = map[string]models.LabelColors{}
-							}
-							colors[key][value] = color
-						}
-					}
-					countLabel(counters, key, value)
-				}
-			}
-		}
-
-		if len(agCopy.Alerts) > 0 {
-			agCopy.Hash = agCopy.ContentFingerprint()
-			alerts = append(alerts, agCopy)
-		}
+	expression, filterError := getFiltersFromQuery(c.Query("q"))
+	resp.FilterError = filterError
 
+	// invalid sort keys are reported in the response and alerts are returned
+	// in the default order
+	sortBy, err := getSortFromQuery(c)
+	if err != nil {
+		resp.SortError = err.Error()
+		sortBy = []sortKey{}
 	}
 
-	resp.AlertGroups = alerts
+	alerts, colors, counters := filterAlerts(expression, getGroupByFromQuery(c), sortBy)
+
+	resp.AlertGroups = clusterAlertGroups(alerts)
 	resp.Colors = colors
 	resp.Counters = counters
 
-	for _, filter := range matchFilters {
+	for _, filter := range expression.Filters() {
 		af := models.Filter{
 			Text:    filter.GetRawText(),
 			Hits:    filter.GetHits(),
@@ -182,7 +117,7 @@ func alerts(c *gin.Context) {
 	}
 	resp.Filters = apiFilters
 
-	data, err := json.Marshal(resp)
+	data, err = json.Marshal(resp)
 	if err != nil {
 		log.Error(err.Error())
 		panic(err)
@@ -249,8 +184,8 @@ func autocomplete(c *gin.Context) {
 }
 
 func favicon(c *gin.Context) {
-	if config.Config.Listen.Prefix != "/" {
-		c.Request.URL.Path = strings.TrimPrefix(c.Request.URL.Path, config.Config.Listen.Prefix)
+	if config.Config().Listen.Prefix != "/" {
+		c.Request.URL.Path = strings.TrimPrefix(c.Request.URL.Path, config.Config().Listen.Prefix)
 	}
 	faviconFileServer.ServeHTTP(c.Writer, c.Request)
 }
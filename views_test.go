@@ -7,7 +7,10 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path"
+	"reflect"
 	"testing"
 	"time"
 
@@ -29,7 +32,7 @@ func mockConfig() {
 	log.SetLevel(log.ErrorLevel)
 	os.Setenv("ALERTMANAGER_URI", "http://localhost")
 	os.Setenv("LABELS_COLOR_UNIQUE", "alertname")
-	config.Config.Read()
+	config.Read()
 	if !upstreamSetup {
 		upstreamSetup = true
 		setupUpstreams()
@@ -107,9 +110,15 @@ func mockAlerts(version string) {
 
 	apiCache = cache.New(cache.NoExpiration, 10*time.Second)
 
-	mock.RegisterURL("http://localhost/api/v1/status", version, "status")
-	mock.RegisterURL("http://localhost/api/v1/silences", version, "silences")
-	mock.RegisterURL("http://localhost/api/v1/alerts/groups", version, "alerts/groups")
+	mock.RegisterURL("http://localhost/api/v1/status", version, "api/v1/status")
+	mock.RegisterURL("http://localhost/api/v1/silences", version, "api/v1/silences")
+	mock.RegisterURL("http://localhost/api/v1/alerts/groups", version, "api/v1/alerts/groups")
+	// v2 API is only present in newer versions
+	if mock.Exists("api/v2/status", version) {
+		mock.RegisterURL("http://localhost/api/v2/status", version, "api/v2/status")
+		mock.RegisterURL("http://localhost/api/v2/silences", version, "api/v2/silences")
+		mock.RegisterURL("http://localhost/api/v2/alerts/groups", version, "api/v2/alerts/groups")
+	}
 
 	pullFromAlertmanager()
 }
@@ -181,6 +190,295 @@ func TestAlerts(t *testing.T) {
 	}
 }
 
+type filterExpressionTest struct {
+	q             string
+	groups        int
+	alerts        int
+	hits          []int
+	errorPosition int
+}
+
+var filterExpressionTests = []filterExpressionTest{
+	filterExpressionTest{
+		q:      "alertname=Host_Down OR alertname=HTTP_Probe_Failed",
+		groups: 6,
+		alerts: 20,
+		hits:   []int{16, 4},
+	},
+	filterExpressionTest{
+		q:      "NOT alertname=Host_Down",
+		groups: 6,
+		alerts: 8,
+		hits:   []int{16},
+	},
+	filterExpressionTest{
+		q:      "(alertname=Host_Down OR alertname=HTTP_Probe_Failed),@receiver=by-name",
+		groups: 2,
+		alerts: 10,
+		hits:   []int{16, 4, 12},
+	},
+	filterExpressionTest{
+		q:             "alertname=Host_Down OR",
+		groups:        0,
+		alerts:        0,
+		hits:          []int{},
+		errorPosition: 22,
+	},
+}
+
+func TestAlertsFilterExpression(t *testing.T) {
+	mockConfig()
+	for _, version := range mock.ListAllMocks() {
+		t.Logf("Testing filter expressions using mock files from Alertmanager %s", version)
+		mockAlerts(version)
+		r := ginTestEngine()
+		for _, testCase := range filterExpressionTests {
+			apiCache.Flush()
+			req, _ := http.NewRequest("GET", "/alerts.json?q="+url.QueryEscape(testCase.q), nil)
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			if resp.Code != http.StatusOK {
+				t.Errorf("GET /alerts.json returned status %d", resp.Code)
+			}
+
+			ur := models.AlertsResponse{}
+			json.Unmarshal(resp.Body.Bytes(), &ur)
+			alerts := 0
+			for _, ag := range ur.AlertGroups {
+				alerts += len(ag.Alerts)
+			}
+			if len(ur.AlertGroups) != testCase.groups || alerts != testCase.alerts {
+				t.Errorf("[%s] q=%s: got %d group(s) with %d alert(s), expected %d group(s) with %d alert(s)",
+					version, testCase.q, len(ur.AlertGroups), alerts, testCase.groups, testCase.alerts)
+			}
+			hits := []int{}
+			for _, filter := range ur.Filters {
+				hits = append(hits, filter.Hits)
+			}
+			if !reflect.DeepEqual(hits, testCase.hits) {
+				t.Errorf("[%s] q=%s: got filter hits %v, expected %v", version, testCase.q, hits, testCase.hits)
+			}
+			if testCase.errorPosition > 0 {
+				if ur.FilterError == nil {
+					t.Errorf("[%s] q=%s: missing filterError in response", version, testCase.q)
+				} else if ur.FilterError.Position != testCase.errorPosition {
+					t.Errorf("[%s] q=%s: got filterError at position %d, expected %d", version, testCase.q, ur.FilterError.Position, testCase.errorPosition)
+				}
+			} else if ur.FilterError != nil {
+				t.Errorf("[%s] q=%s: unexpected filterError: %v", version, testCase.q, ur.FilterError)
+			}
+		}
+	}
+}
+
+type groupByTest struct {
+	query  string
+	config string
+	groups func(alert models.Alert) string
+}
+
+var groupByTests = []groupByTest{
+	{
+		query: "group_by=cluster",
+		groups: func(alert models.Alert) string {
+			return alert.Labels["cluster"]
+		},
+	},
+	{
+		query: "group_by=cluster,@receiver",
+		groups: func(alert models.Alert) string {
+			return alert.Labels["cluster"] + "/" + alert.Receiver
+		},
+	},
+	{
+		query: "group_by=@alertmanager&group_by=alertname",
+		groups: func(alert models.Alert) string {
+			return alert.Labels["alertname"]
+		},
+	},
+	{
+		query:  "",
+		config: "job",
+		groups: func(alert models.Alert) string {
+			return alert.Labels["job"]
+		},
+	},
+}
+
+func getAlertsResponse(t *testing.T, r *gin.Engine, uri string) models.AlertsResponse {
+	apiCache.Flush()
+	req, _ := http.NewRequest("GET", uri, nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("GET %s returned status %d", uri, resp.Code)
+	}
+	ur := models.AlertsResponse{}
+	json.Unmarshal(resp.Body.Bytes(), &ur)
+	return ur
+}
+
+func getAlertGroups(t *testing.T, r *gin.Engine, uri string) []models.AlertGroup {
+	return getAlertsResponse(t, r, uri).AlertGroups
+}
+
+func TestAlertsGroupBy(t *testing.T) {
+	defer os.Unsetenv("GROUPING_BY")
+	for _, testCase := range groupByTests {
+		os.Setenv("GROUPING_BY", testCase.config)
+		mockConfig()
+		for _, version := range mock.ListAllMocks() {
+			mockAlerts(version)
+			r := ginTestEngine()
+
+			expected := map[string]int{}
+			for _, ag := range getAlertGroups(t, r, "/alerts.json?group_by=") {
+				for _, alert := range ag.Alerts {
+					expected[testCase.groups(alert)]++
+				}
+			}
+
+			groups := getAlertGroups(t, r, "/alerts.json?"+testCase.query)
+			if len(groups) != len(expected) {
+				t.Errorf("[%s] %s: got %d group(s), expected %d", version, testCase.query, len(groups), len(expected))
+			}
+			ids := map[string]bool{}
+			for _, ag := range groups {
+				if ids[ag.ID] {
+					t.Errorf("[%s] %s: duplicated group ID %s", version, testCase.query, ag.ID)
+				}
+				ids[ag.ID] = true
+				total := 0
+				for _, count := range ag.StateCount {
+					total += count
+				}
+				if total != len(ag.Alerts) {
+					t.Errorf("[%s] %s: group %v has %d alert(s) but state counters sum to %d",
+						version, testCase.query, ag.Labels, len(ag.Alerts), total)
+				}
+				key := testCase.groups(ag.Alerts[0])
+				if expected[key] != len(ag.Alerts) {
+					t.Errorf("[%s] %s: group %v has %d alert(s), expected %d",
+						version, testCase.query, ag.Labels, len(ag.Alerts), expected[key])
+				}
+				for _, alert := range ag.Alerts {
+					if testCase.groups(alert) != key {
+						t.Errorf("[%s] %s: alert %v doesn't belong to group %v", version, testCase.query, alert.Labels, ag.Labels)
+					}
+				}
+			}
+		}
+	}
+	os.Unsetenv("GROUPING_BY")
+	mockConfig()
+}
+
+type sortTest struct {
+	query   string
+	compare func(a, b models.Alert) int
+}
+
+var sortTests = []sortTest{
+	{
+		query: "sort=label:instance",
+		compare: func(a, b models.Alert) int {
+			return naturalCompare(a.Labels["instance"], b.Labels["instance"])
+		},
+	},
+	{
+		query: "sort=-label:instance",
+		compare: func(a, b models.Alert) int {
+			return naturalCompare(b.Labels["instance"], a.Labels["instance"])
+		},
+	},
+	{
+		// severity label and values are set in TestAlertsSort
+		query: "sort=severity,label:instance",
+		compare: func(a, b models.Alert) int {
+			if c := compareInts(severityRank(a), severityRank(b)); c != 0 {
+				return c
+			}
+			return naturalCompare(a.Labels["instance"], b.Labels["instance"])
+		},
+	},
+	{
+		query: "sort=-startsAt",
+		compare: func(a, b models.Alert) int {
+			if a.StartsAt.After(b.StartsAt) {
+				return -1
+			}
+			if a.StartsAt.Before(b.StartsAt) {
+				return 1
+			}
+			return 0
+		},
+	},
+}
+
+func TestAlertsSort(t *testing.T) {
+	os.Setenv("SORTING_SEVERITY_LABEL", "cluster")
+	os.Setenv("SORTING_SEVERITY_VALUES", "prod staging")
+	defer os.Unsetenv("SORTING_SEVERITY_LABEL")
+	defer os.Unsetenv("SORTING_SEVERITY_VALUES")
+	mockConfig()
+	for _, version := range mock.ListAllMocks() {
+		mockAlerts(version)
+		r := ginTestEngine()
+		for _, testCase := range sortTests {
+			all := []models.Alert{}
+			for _, ag := range getAlertGroups(t, r, "/alerts.json?"+testCase.query) {
+				for i, alert := range ag.Alerts {
+					if i > 0 && testCase.compare(ag.Alerts[i-1], alert) > 0 {
+						t.Errorf("[%s] %s: alert %v sorted after %v in group %v",
+							version, testCase.query, ag.Alerts[i-1].Labels, alert.Labels, ag.Labels)
+					}
+					all = append(all, alert)
+				}
+			}
+
+			// @limit should keep first alerts according to the sort order
+			limited := getAlertGroups(t, r, "/alerts.json?q=@limit=3&"+testCase.query)
+			kept := []models.Alert{}
+			for _, ag := range limited {
+				kept = append(kept, ag.Alerts...)
+			}
+			if len(kept) != 3 {
+				t.Errorf("[%s] %s: got %d alert(s) with @limit=3", version, testCase.query, len(kept))
+			}
+			for _, k := range kept {
+				greater := 0
+				for _, alert := range all {
+					if testCase.compare(alert, k) < 0 {
+						greater++
+					}
+				}
+				if greater >= len(kept) {
+					t.Errorf("[%s] %s: alert %v kept by @limit=3 but %d alert(s) are sorted before it",
+						version, testCase.query, k.Labels, greater)
+				}
+			}
+		}
+
+		ur := getAlertsResponse(t, r, "/alerts.json?sort=foo")
+		if ur.SortError == "" {
+			t.Errorf("[%s] sort=foo didn't return any error", version)
+		}
+		total := 0
+		for _, ag := range ur.AlertGroups {
+			total += len(ag.Alerts)
+		}
+		if total != 24 {
+			t.Errorf("[%s] sort=foo returned %d alert(s), expected 24", version, total)
+		}
+		if ur := getAlertsResponse(t, r, "/alerts.json?sort=count,-startsAt"); ur.SortError != "" {
+			t.Errorf("[%s] sort=count,-startsAt returned an error: %s", version, ur.SortError)
+		}
+	}
+	os.Unsetenv("SORTING_SEVERITY_LABEL")
+	os.Unsetenv("SORTING_SEVERITY_VALUES")
+	mockConfig()
+}
+
 func TestValidateAllAlerts(t *testing.T) {
 	mockConfig()
 	for _, version := range mock.ListAllMocks() {
@@ -305,6 +603,10 @@ var acTests = []acTestCase{
 			"@state=active",
 			"@state!=suppressed",
 			"@state!=active",
+			"@silence_expires>1h",
+			"@silence_expires>10m",
+			"@silence_expires<1h",
+			"@silence_expires<10m",
 			"@silence_author=~john@example.com",
 			"@silence_author=john@example.com",
 			"@silence_author!~john@example.com",
@@ -315,6 +617,8 @@ var acTests = []acTestCase{
 			"@receiver!=by-cluster-service",
 			"@limit=50",
 			"@limit=10",
+			"@cluster=default",
+			"@cluster!=default",
 			"@alertmanager=default",
 			"@alertmanager!=default",
 			"@age>1h",
@@ -510,3 +814,119 @@ func TestGzipMiddlewareWithoutAcceptEncoding(t *testing.T) {
 		}
 	}
 }
+
+const clusterTestConfig = `alertmanager:
+  interval: 1m
+  servers:
+    - name: default
+      uri: http://localhost
+      timeout: 40s
+    - name: ha1
+      uri: http://ha1.example.com
+      cluster: ha
+    - name: ha2
+      uri: http://ha2.example.com
+      cluster: ha
+`
+
+// mockClusterConfig loads a config with a cluster of two Alertmanager
+// instances and pulls alerts from all instances, returned function will
+// restore the original config
+func mockClusterConfig(t *testing.T) func() {
+	mockConfig()
+
+	dir, err := ioutil.TempDir("", "unsee-cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CONFIG_DIR", dir)
+	restore := func() {
+		os.Unsetenv("CONFIG_DIR")
+		os.RemoveAll(dir)
+		if err := reloadConfig(); err != nil {
+			t.Errorf("Failed to restore original config: %s", err)
+		}
+	}
+
+	err = ioutil.WriteFile(path.Join(dir, "unsee.yaml"), []byte(clusterTestConfig), 0644)
+	if err != nil {
+		restore()
+		t.Fatal(err)
+	}
+	if err = reloadConfig(); err != nil {
+		restore()
+		t.Fatalf("reloadConfig() failed: %s", err)
+	}
+
+	apiCache = cache.New(cache.NoExpiration, 10*time.Second)
+	version := mock.ListAllMocks()[len(mock.ListAllMocks())-1]
+	for _, uri := range []string{"http://localhost", "http://ha1.example.com", "http://ha2.example.com"} {
+		for _, endpoint := range []string{"api/v1/status", "api/v1/silences", "api/v1/alerts/groups", "api/v2/status", "api/v2/silences", "api/v2/alerts/groups"} {
+			if mock.Exists(endpoint, version) {
+				mock.RegisterURL(uri+"/"+endpoint, version, endpoint)
+			}
+		}
+	}
+	pullFromAlertmanager()
+
+	return restore
+}
+
+func TestClusteredAlerts(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	defer mockClusterConfig(t)()
+
+	r := ginTestEngine()
+	req, _ := http.NewRequest("GET", "/alerts.json?q=alertname=HTTP_Probe_Failed,instance=web1", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("GET /alerts.json returned status %d", resp.Code)
+	}
+
+	ur := models.AlertsResponse{}
+	json.Unmarshal(resp.Body.Bytes(), &ur)
+	if len(ur.AlertGroups) == 0 {
+		t.Fatal("No alert groups returned")
+	}
+	for _, ag := range ur.AlertGroups {
+		for _, alert := range ag.Alerts {
+			names := []string{}
+			for _, am := range alert.Alertmanager {
+				names = append(names, am.Name)
+				if am.Name == "ha" && !reflect.DeepEqual(am.Members, []string{"ha1", "ha2"}) {
+					t.Errorf("Invalid members of cluster 'ha': %v", am.Members)
+				}
+			}
+			if !reflect.DeepEqual(names, []string{"default", "ha"}) {
+				t.Errorf("Invalid Alertmanager instances on alert %v: %v", alert.Labels, names)
+			}
+		}
+	}
+
+	expected := []models.AlertmanagerAPICluster{
+		models.AlertmanagerAPICluster{
+			Name:    "default",
+			Members: []string{"default"},
+			Healthy: 1,
+			Errors:  []string{},
+		},
+		models.AlertmanagerAPICluster{
+			Name:    "ha",
+			Members: []string{"ha1", "ha2"},
+			Healthy: 2,
+			// both instances use the same mock files so they report the same
+			// peer name
+			Errors: []string{"Alertmanager 'ha1' and 'ha2' are not cluster peers"},
+		},
+	}
+	if !reflect.DeepEqual(ur.Upstreams.Clusters, expected) {
+		t.Errorf("Invalid clusters, expected %+v, got %+v", expected, ur.Upstreams.Clusters)
+	}
+	for _, instance := range ur.Upstreams.Instances {
+		if instance.Name != "default" && instance.Cluster != "ha" {
+			t.Errorf("Invalid cluster for Alertmanager '%s': '%s'", instance.Name, instance.Cluster)
+		}
+	}
+}